@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strings"
 	"time"
 	"unicode/utf8"
 
@@ -171,19 +172,62 @@ func writeCommands(w io.Writer, cmds []context.Command) {
 	if len(cmds) == 0 {
 		return
 	}
+	// Nested commands are listed under their namespace, indented one
+	// level per depth, so names carry their indent for alignment.
+	type row struct {
+		name string
+		cmd  context.Command
+	}
+	var rows []row
+	var flatten func(cmds []context.Command, indent string)
+	flatten = func(cmds []context.Command, indent string) {
+		for _, c := range cmds {
+			rows = append(rows, row{indent + c.Name, c})
+			flatten(c.Commands, indent+"  ")
+		}
+	}
+	flatten(cmds, "")
+
 	nameW := 0
-	for _, c := range cmds {
-		if n := utf8.RuneCountInString(c.Name); n > nameW {
+	for _, r := range rows {
+		if n := utf8.RuneCountInString(r.name); n > nameW {
 			nameW = n
 		}
 	}
-	fmt.Fprintf(w, "\nCommands (%d):\n", len(cmds))
-	for _, c := range cmds {
-		fmt.Fprintf(w, "  %s%s  %s\n", c.Name, padRunes(c.Name, nameW), c.Description)
+	fmt.Fprintf(w, "\nCommands (%d):\n", len(rows))
+	for _, r := range rows {
+		c := r.cmd
+		desc := c.Description
+		if c.Hidden {
+			desc += " (hidden)"
+		}
+		fmt.Fprintf(w, "  %s%s  %s\n", r.name, padRunes(r.name, nameW), desc)
+		if c.Deprecated != "" {
+			fmt.Fprintf(w, "  %s  deprecated: %s\n", padRunes("", nameW), c.Deprecated)
+		}
+		if len(c.Aliases) > 0 {
+			fmt.Fprintf(w, "  %s  aliases: %s\n", padRunes("", nameW), strings.Join(c.Aliases, ", "))
+		}
 		for i, step := range c.Steps {
 			fmt.Fprintf(w, "  %s  %d. %s\n", padRunes("", nameW), i+1, step.Name)
 		}
+		if len(c.Requires) > 0 {
+			fmt.Fprintf(w, "  %s  requires: %s\n", padRunes("", nameW), requiresText(c.Requires))
+		}
+	}
+}
+
+// requiresText joins a command's required variable names, flagging the
+// ones that aren't satisfied in the current environment.
+func requiresText(reqs []context.Requirement) string {
+	names := make([]string, len(reqs))
+	for i, r := range reqs {
+		names[i] = r.Name
+		if !r.Satisfied {
+			names[i] += " (unmet)"
+		}
 	}
+	return strings.Join(names, ", ")
 }
 
 // writeRecent renders the recent-runs section. now should be the snapshot's
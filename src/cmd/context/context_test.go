@@ -283,6 +283,31 @@ func TestWritePretty_commands(t *testing.T) {
 	}
 }
 
+func TestWritePretty_nestedCommands(t *testing.T) {
+	var buf bytes.Buffer
+	ws := rctx.Snapshot{
+		Workspace: rctx.Workspace{
+			Profile: "demo",
+			Repos:   []rctx.Repo{},
+			Commands: []rctx.Command{
+				{Name: "db", Description: "Database tasks", Commands: []rctx.Command{
+					{Name: "db migrate", Description: "Apply migrations"},
+				}},
+				{Name: "test", Description: "Run tests"},
+			},
+		},
+	}
+	if err := writePretty(&buf, ws); err != nil {
+		t.Fatalf("writePretty: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"Commands (3)", "\n  db            Database tasks\n", "\n    db migrate  Apply migrations\n", "\n  test          Run tests\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\n--- output ---\n%s", want, out)
+		}
+	}
+}
+
 // TestWritePretty_commandSteps confirms that commands with named tasks expose
 // numbered step rows under their main row, mirroring what the JSON output
 // emits via the steps[] array.
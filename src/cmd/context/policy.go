@@ -0,0 +1,193 @@
+package context
+
+import (
+	stdctx "context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/8bitalex/raid/src/raid"
+	"github.com/8bitalex/raid/src/raid/errs"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// enforcePolicy is `raid context serve --policy`. The server also enforces
+// the policy whenever the active profile declares an `agentPolicy:`.
+var enforcePolicy bool
+
+// policyGatedTools are the mutating tools, besides raid_run_task, that an
+// enforced policy allows only through `allowTools:`.
+var policyGatedTools = []string{
+	"raid_install",
+	"raid_env_switch",
+	"raid_vars_set",
+	"raid_vars_unset",
+	"raid_vars_clear",
+}
+
+// confirmTokenTTL is how long a confirmation token stays valid.
+const confirmTokenTTL = 10 * time.Minute
+
+// pendingConfirmation is a confirmation token's grant: one run of command
+// with exactly args, before expires.
+type pendingConfirmation struct {
+	command string
+	args    []string
+	expires time.Time
+}
+
+var (
+	confirmMu     sync.Mutex
+	confirmations = map[string]pendingConfirmation{}
+)
+
+func policyEnforced() bool {
+	return enforcePolicy || raid.AgentPolicyDeclared()
+}
+
+// withPolicy wraps the handler of the tool called name so an enforced
+// agent policy, checked on each call since the profile can change under a
+// running server, decides whether it runs. Read-only tools aren't gated.
+func withPolicy(name string, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	var check func(mcp.CallToolRequest) *mcp.CallToolResult
+	switch {
+	case name == "raid_run_task":
+		check = checkRunTaskPolicy
+	case slices.Contains(policyGatedTools, name):
+		check = func(mcp.CallToolRequest) *mcp.CallToolResult { return checkToolPolicy(name) }
+	default:
+		return handler
+	}
+	return func(ctx stdctx.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if policyEnforced() {
+			if denied := check(req); denied != nil {
+				return denied, nil
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// checkToolPolicy audits and decides a call to a gated tool. It returns
+// the tool result to reject the call with, or nil to let it run.
+func checkToolPolicy(tool string) *mcp.CallToolResult {
+	d := raid.AgentDecision{Tool: tool}
+	err := raid.CheckAgentTool(tool)
+	return decide(d, err)
+}
+
+// checkRunTaskPolicy audits and decides a raid_run_task call. A command
+// the policy wants confirmed runs only with a valid `confirm` token;
+// without one, a new token goes to the user through the server's stderr,
+// never back to the agent. The audit log records only its TokenID.
+func checkRunTaskPolicy(req mcp.CallToolRequest) *mcp.CallToolResult {
+	command := req.GetString("command", "")
+	if command == "" {
+		// The handler reports the missing argument.
+		return nil
+	}
+	args := req.GetStringSlice("args", nil)
+	d := raid.AgentDecision{Tool: "raid_run_task", Command: command, Args: args}
+
+	confirm, err := raid.CheckAgentCommand(command)
+	if err != nil || !confirm {
+		return decide(d, err)
+	}
+	if token := req.GetString("confirm", ""); token != "" {
+		if takeConfirmation(token, command, args) {
+			d.Reason = "confirmed by token"
+			d.TokenID = confirmationID(token)
+			return decide(d, nil)
+		}
+		d.Reason = "invalid or expired confirmation token; issued a new one"
+	}
+
+	token, err := issueConfirmation(command, args)
+	if err != nil {
+		return decide(d, fmt.Errorf("agent policy: can't issue a confirmation token: %w", err))
+	}
+	d.Decision = raid.AgentDecisionConfirm
+	d.TokenID = confirmationID(token)
+	d.Code = errs.CodeConfirmationRequired
+	if err := raid.AuditAgentDecision(d); err != nil {
+		return auditFailed(d.Tool, err)
+	}
+	fmt.Fprintf(os.Stderr, "raid: an agent asked to run '%s'; to confirm, give it the token %s (valid for %s)\n",
+		command, token, confirmTokenTTL)
+	return mcpStructuredError("raid_run_task", errs.ConfirmationRequired(command), "")
+}
+
+// decide records d as allowed when err is nil and denied otherwise, and
+// returns the rejection result, if any. The audit log must be writable:
+// a decision that can't be recorded is refused.
+func decide(d raid.AgentDecision, err error) *mcp.CallToolResult {
+	d.Decision = raid.AgentDecisionAllow
+	if err != nil {
+		rErr := errs.Wrap(err)
+		d.Decision = raid.AgentDecisionDeny
+		d.Reason = rErr.Error()
+		d.Code = rErr.Code()
+	}
+	if auditErr := raid.AuditAgentDecision(d); auditErr != nil {
+		return auditFailed(d.Tool, auditErr)
+	}
+	if err != nil {
+		return mcpStructuredError(d.Tool, err, "")
+	}
+	return nil
+}
+
+func auditFailed(tool string, err error) *mcp.CallToolResult {
+	return mcpStructuredError(tool, fmt.Errorf("agent policy: can't write the audit log: %w", err), "")
+}
+
+// confirmTokenBytes is the entropy of a confirmation token.
+const confirmTokenBytes = 16
+
+// issueConfirmation returns a new single-use token granting one run of
+// command with args, dropping any that have expired. It fails rather than
+// issue a guessable token when the system's randomness is unavailable.
+func issueConfirmation(command string, args []string) (string, error) {
+	b := make([]byte, confirmTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	confirmMu.Lock()
+	defer confirmMu.Unlock()
+	now := time.Now()
+	for t, c := range confirmations {
+		if now.After(c.expires) {
+			delete(confirmations, t)
+		}
+	}
+	confirmations[token] = pendingConfirmation{command: command, args: args, expires: now.Add(confirmTokenTTL)}
+	return token, nil
+}
+
+// confirmationID is the short hash of token the audit log records, enough
+// to match a confirm decision to the run it granted.
+func confirmationID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:4])
+}
+
+// takeConfirmation redeems token for a run of command with args. A token
+// is spent whether or not it matches, so one can't be guessed at.
+func takeConfirmation(token, command string, args []string) bool {
+	confirmMu.Lock()
+	defer confirmMu.Unlock()
+	c, ok := confirmations[token]
+	if !ok {
+		return false
+	}
+	delete(confirmations, token)
+	return c.command == command && slices.Equal(c.args, args) && time.Now().Before(c.expires)
+}
@@ -0,0 +1,195 @@
+package context
+
+import (
+	"bufio"
+	stdctx "context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/8bitalex/raid/src/internal/lib"
+	"github.com/8bitalex/raid/src/raid"
+	"github.com/8bitalex/raid/src/raid/errs"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// loadPolicyProfile loads a profile with an agentPolicy, redirects the
+// audit log to a temp file, and returns that file's path.
+func loadPolicyProfile(t *testing.T) string {
+	t.Helper()
+	auditLog := filepath.Join(t.TempDir(), "audit.log")
+	orig := lib.AuditLogPathOverride
+	lib.AuditLogPathOverride = auditLog
+	t.Cleanup(func() { lib.AuditLogPathOverride = orig })
+	loadTestProfile(t, `
+name: test-fixture
+agentPolicy:
+  allow: ["deploy"]
+  confirm: ["deploy"]
+commands:
+  - name: test
+    agent:
+      safe: true
+    tasks:
+      - type: Shell
+        cmd: "exit 0"
+  - name: deploy
+    tasks:
+      - type: Shell
+        cmd: "exit 0"
+  - name: wipe
+    tasks:
+      - type: Shell
+        cmd: "exit 0"
+`)
+	return auditLog
+}
+
+func readAuditLog(t *testing.T, path string) []raid.AgentDecision {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open audit log: %v", err)
+	}
+	defer f.Close()
+	var out []raid.AgentDecision
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var d raid.AgentDecision
+		if err := json.Unmarshal(sc.Bytes(), &d); err != nil {
+			t.Fatalf("audit line %q: %v", sc.Text(), err)
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+func runTaskRequest(args map[string]any) mcp.CallToolRequest {
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = args
+	return req
+}
+
+func TestWithPolicy_runTask(t *testing.T) {
+	auditLog := loadPolicyProfile(t)
+	stderrPath := filepath.Join(t.TempDir(), "stderr")
+	stderr, err := os.Create(stderrPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStderr := os.Stderr
+	os.Stderr = stderr
+	t.Cleanup(func() { os.Stderr = oldStderr; stderr.Close() })
+	// lastToken is the most recent token the server printed for the user.
+	tokenRE := regexp.MustCompile(`the token ([0-9a-f]+) `)
+	lastToken := func() string {
+		t.Helper()
+		data, err := os.ReadFile(stderrPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := tokenRE.FindAllStringSubmatch(string(data), -1)
+		if len(m) == 0 {
+			t.Fatalf("no confirmation token on stderr: %q", data)
+		}
+		return m[len(m)-1][1]
+	}
+	handler := withPolicy("raid_run_task", handleRunTask)
+	call := func(args map[string]any) (*mcp.CallToolResult, string) {
+		t.Helper()
+		res, err := handler(stdctx.Background(), runTaskRequest(args))
+		if err != nil {
+			t.Fatalf("handler error: %v", err)
+		}
+		return res, toolResultText(res)
+	}
+
+	if res, text := call(map[string]any{"command": "test"}); res.IsError {
+		t.Errorf("safe command rejected: %s", text)
+	}
+	if res, text := call(map[string]any{"command": "wipe"}); !res.IsError || !strings.Contains(text, errs.CodePolicyDenied) {
+		t.Errorf("unsafe command not in allow: got %s, want POLICY_DENIED", text)
+	}
+	res, text := call(map[string]any{"command": "deploy"})
+	if !res.IsError || !strings.Contains(text, errs.CodeConfirmationRequired) {
+		t.Fatalf("deploy without a token: got %s, want CONFIRMATION_REQUIRED", text)
+	}
+
+	decisions := readAuditLog(t, auditLog)
+	if len(decisions) != 3 {
+		t.Fatalf("audit log has %d decisions, want 3: %+v", len(decisions), decisions)
+	}
+	token := lastToken()
+	if len(token) < 32 {
+		t.Errorf("token %q is too short to resist guessing", token)
+	}
+	if decisions[2].Decision != raid.AgentDecisionConfirm || decisions[2].TokenID != confirmationID(token) {
+		t.Fatalf("third decision = %+v, want a confirm identifying the token", decisions[2])
+	}
+	if strings.Contains(text, token) {
+		t.Error("the token was returned to the agent")
+	}
+	if data, _ := os.ReadFile(auditLog); strings.Contains(string(data), token) {
+		t.Error("the token was written to the audit log")
+	}
+
+	// A token only grants the command and args it was issued for, once.
+	if res, _ := call(map[string]any{"command": "deploy", "args": []any{"prod"}, "confirm": token}); !res.IsError {
+		t.Error("token accepted for different args")
+	}
+	if res, _ := call(map[string]any{"command": "deploy", "confirm": token}); !res.IsError {
+		t.Error("token accepted after it was spent")
+	}
+	call(map[string]any{"command": "deploy"})
+	token = lastToken()
+	if res, text := call(map[string]any{"command": "deploy", "confirm": token}); res.IsError {
+		t.Errorf("deploy with a valid token rejected: %s", text)
+	}
+	decisions = readAuditLog(t, auditLog)
+	if last := decisions[len(decisions)-1]; last.Decision != raid.AgentDecisionAllow || last.Command != "deploy" {
+		t.Errorf("last decision = %+v, want deploy allowed", last)
+	}
+}
+
+func TestWithPolicy_gatedTools(t *testing.T) {
+	auditLog := loadPolicyProfile(t)
+	handler := withPolicy("raid_vars_clear", handleVarsClear)
+	res, err := handler(stdctx.Background(), runTaskRequest(nil))
+	if err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if !res.IsError || !strings.Contains(toolResultText(res), errs.CodePolicyDenied) {
+		t.Errorf("raid_vars_clear not in allowTools: got %s, want POLICY_DENIED", toolResultText(res))
+	}
+	if d := readAuditLog(t, auditLog); len(d) != 1 || d[0].Tool != "raid_vars_clear" || d[0].Decision != raid.AgentDecisionDeny {
+		t.Errorf("audit log = %+v, want the denied raid_vars_clear call", d)
+	}
+}
+
+func TestWithPolicy_notEnforced(t *testing.T) {
+	loadTestProfile(t, `
+name: test-fixture
+commands:
+  - name: wipe
+    tasks:
+      - type: Shell
+        cmd: "exit 0"
+`)
+	res, err := withPolicy("raid_run_task", handleRunTask)(stdctx.Background(), runTaskRequest(map[string]any{"command": "wipe"}))
+	if err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if res.IsError {
+		t.Errorf("unsafe command rejected with no policy in force: %s", toolResultText(res))
+	}
+
+	enforcePolicy = true
+	t.Cleanup(func() { enforcePolicy = false })
+	res, _ = withPolicy("raid_run_task", handleRunTask)(stdctx.Background(), runTaskRequest(map[string]any{"command": "wipe"}))
+	if !res.IsError || !strings.Contains(toolResultText(res), errs.CodePolicyDenied) {
+		t.Errorf("--policy: got %s, want POLICY_DENIED from the default policy", toolResultText(res))
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/8bitalex/raid/src/raid/env"
 	"github.com/8bitalex/raid/src/raid/errs"
 	"github.com/8bitalex/raid/src/raid/profile"
+	"github.com/8bitalex/raid/src/raid/vars"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 	"github.com/spf13/cobra"
@@ -49,6 +50,7 @@ var startVarsWatcherFn = startVarsWatcher
 
 func init() {
 	Command.AddCommand(ServeCmd)
+	ServeCmd.Flags().BoolVar(&enforcePolicy, "policy", false, "Enforce the profile's agentPolicy, or the default policy allowing only safe commands, on every mutating tool call")
 	// Populate Long at startup with the absolute path of the running
 	// binary, so `raid context serve --help` shows snippets a user can
 	// copy-paste straight into their MCP host config.
@@ -66,6 +68,8 @@ func buildServeLong() string {
 
 The server speaks JSON-RPC 2.0 (newline-delimited) over stdin/stdout. Stderr is reserved for diagnostics.
 
+With --policy, or when the active profile declares agentPolicy:, the server enforces the policy on mutating tools instead of leaving agent.safe to the client, and logs every decision to ~/.raid/audit.log.
+
 Wire it into your MCP host using the snippets below:
 
 Claude Code:
@@ -195,7 +199,7 @@ func registerResources(s *server.MCPServer) {
 	)
 	s.AddResource(
 		mcp.NewResource(uriCommands, "commands",
-			mcp.WithResourceDescription("User-defined raid commands available in the active profile"),
+			mcp.WithResourceDescription("User-defined raid commands available in the active profile, with the variables each one requires"),
 			mcp.WithMIMEType("application/json"),
 		),
 		readWorkspaceCommands,
@@ -209,7 +213,7 @@ func registerResources(s *server.MCPServer) {
 	)
 	s.AddResource(
 		mcp.NewResource(uriVars, "vars",
-			mcp.WithResourceDescription("Persisted raid variables (Set-task values + auto-derived RAID_REPO_*). Reloaded live when ~/.raid/vars changes on disk."),
+			mcp.WithResourceDescription("Persisted raid variables (Set-task values + auto-derived RAID_REPO_*). Reloaded live when ~/.raid/vars or the active profile's ~/.raid/vars.d/<profile> changes on disk."),
 			mcp.WithMIMEType("application/json"),
 		),
 		readWorkspaceVars,
@@ -274,7 +278,7 @@ type agentToolDef struct {
 
 func registerTools(s *server.MCPServer) {
 	for _, def := range agentToolDefs() {
-		s.AddTool(def.tool, def.handler)
+		s.AddTool(def.tool, withPolicy(def.tool.Name, def.handler))
 	}
 }
 
@@ -327,11 +331,51 @@ func agentToolDefs() []agentToolDef {
 		{
 			tool: mcp.NewTool("raid_run_task",
 				mcp.WithDescription("Run a user-defined raid command (`raid <command>`) from the active profile."),
-				mcp.WithString("command", mcp.Required(), mcp.Description("Command name as exposed in `raid context`'s commands list.")),
+				mcp.WithString("command", mcp.Required(), mcp.Description("Command name as exposed in `raid context`'s commands list. Nested commands use their full path, e.g. \"db migrate\".")),
 				mcp.WithArray("args", mcp.Description("Positional arguments passed to the command. Each element must be a string.")),
+				mcp.WithString("confirm", mcp.Description("Confirmation token from the user, when the server's agent policy returned CONFIRMATION_REQUIRED for this command and args.")),
 			),
 			handler: handleRunTask,
 		},
+		{
+			tool: mcp.NewTool("raid_vars_list",
+				mcp.WithDescription("List raid variables (global ~/.raid/vars, the active profile's ~/.raid/vars.d/<profile>, session values, and RAID_REPO_* repo metadata) with the source of each value."),
+			),
+			handler: handleVarsList,
+		},
+		{
+			tool: mcp.NewTool("raid_vars_get",
+				mcp.WithDescription("Look up one raid variable and report its value and source (global, profile, session, or repo). The server's process environment isn't readable through this tool."),
+				mcp.WithString("name", mcp.Required(), mcp.Description("Variable name.")),
+			),
+			handler: handleVarsGet,
+		},
+		{
+			tool: mcp.NewTool("raid_vars_set",
+				mcp.WithDescription("Persist a variable, exactly as a Set task would. The name is uppercased. RAID_REPO_* variables can't be set."),
+				mcp.WithString("name", mcp.Required(), mcp.Description("Variable name.")),
+				mcp.WithString("value", mcp.Required(), mcp.Description("Value to persist.")),
+				mcp.WithString("scope", mcp.Enum("global", "profile", "session"), mcp.Description("Where to store it. Defaults to the active profile, or global when none is loaded.")),
+				mcp.WithBoolean("secret", mcp.Description("Encrypt the value at rest. Secret values are masked in every raid output, including this tool's result.")),
+			),
+			handler: handleVarsSet,
+		},
+		{
+			tool: mcp.NewTool("raid_vars_unset",
+				mcp.WithDescription("Remove a persisted variable."),
+				mcp.WithString("name", mcp.Required(), mcp.Description("Variable name.")),
+				mcp.WithString("scope", mcp.Enum("global", "profile", "session"), mcp.Description("Scope to remove it from. Defaults to wherever its effective value lives.")),
+			),
+			handler: handleVarsUnset,
+		},
+		{
+			tool: mcp.NewTool("raid_vars_clear",
+				mcp.WithDescription("Remove every variable in one scope. RAID_REPO_* metadata is unaffected."),
+				mcp.WithString("scope", mcp.Enum("global", "profile", "session"), mcp.Description("Scope to clear. Defaults to the active profile, or global when none is loaded.")),
+				mcp.WithDestructiveHintAnnotation(true),
+			),
+			handler: handleVarsClear,
+		},
 	}
 }
 
@@ -461,6 +505,11 @@ func handleRunTask(_ stdctx.Context, req mcp.CallToolRequest) (*mcp.CallToolResu
 	}
 	args := req.GetStringSlice("args", nil)
 
+	// Fail fast, as the CLI does, when another run holds the command's
+	// lock; ExecuteCommand takes it.
+	if err := raid.CheckCommandLock("", command); err != nil {
+		return mcpStructuredError(fmt.Sprintf("raid_run_task %q", command), err, ""), nil
+	}
 	var output string
 	lockErr := raid.WithMutationLock(func() error {
 		var runErr error
@@ -484,8 +533,74 @@ func handleRunTask(_ stdctx.Context, req mcp.CallToolRequest) (*mcp.CallToolResu
 	return mcp.NewToolResultText(fmt.Sprintf("ran %q\n%s", command, output)), nil
 }
 
+func handleVarsSet(_ stdctx.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, err := req.RequireString("name")
+	if err != nil {
+		return mcpStructuredError("raid_vars_set", errs.ArgInvalid(err.Error()), ""), nil
+	}
+	value, err := req.RequireString("value")
+	if err != nil {
+		return mcpStructuredError("raid_vars_set", errs.ArgInvalid(err.Error()), ""), nil
+	}
+	scope := vars.Scope(req.GetString("scope", ""))
+	var entry vars.Entry
+	err = raid.WithMutationLock(func() error {
+		var setErr error
+		entry, setErr = vars.Set(name, value, scope, req.GetBool("secret", false))
+		return setErr
+	})
+	if err != nil {
+		return mcpStructuredError("raid_vars_set", err, ""), nil
+	}
+	return jsonToolResult(entry)
+}
+
+func handleVarsUnset(_ stdctx.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, err := req.RequireString("name")
+	if err != nil {
+		return mcpStructuredError("raid_vars_unset", errs.ArgInvalid(err.Error()), ""), nil
+	}
+	scope := vars.Scope(req.GetString("scope", ""))
+	if err := raid.WithMutationLock(func() error { return vars.Unset(name, scope) }); err != nil {
+		return mcpStructuredError("raid_vars_unset", err, ""), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("unset %q", name)), nil
+}
+
+func handleVarsClear(_ stdctx.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	scope := vars.Scope(req.GetString("scope", ""))
+	var removed int
+	err := raid.WithMutationLock(func() error {
+		var clearErr error
+		removed, clearErr = vars.Clear(scope)
+		return clearErr
+	})
+	if err != nil {
+		return mcpStructuredError("raid_vars_clear", err, ""), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("removed %d persisted variable(s)", removed)), nil
+}
+
 // --- Read-only handlers --------------------------------------------------
 
+func handleVarsList(_ stdctx.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return jsonToolResult(vars.List())
+}
+
+func handleVarsGet(_ stdctx.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, err := req.RequireString("name")
+	if err != nil {
+		return mcpStructuredError("raid_vars_get", errs.ArgInvalid(err.Error()), ""), nil
+	}
+	// Raid vars only: the server's own environment holds whatever
+	// credentials it was started with, and no agent should read those.
+	entry, err := vars.GetRaid(name)
+	if err != nil {
+		return mcpStructuredError("raid_vars_get", err, ""), nil
+	}
+	return jsonToolResult(entry)
+}
+
 // listProfilesEntry is the JSON shape returned by raid_list_profiles. Defined
 // here (not in lib) because it's specific to this MCP tool's contract.
 type listProfilesEntry struct {
@@ -25,7 +25,8 @@ import (
 // the entire cmd/context test package. The mutating handler tests
 // (handleInstall, handleEnvSwitch, handleRunTask) all reach raid.WithMutation
 // Lock; without the redirect they'd write to the developer's real
-// ~/.raid/.lock and ~/.raid/recent.json on every test run.
+// ~/.raid/.lock and ~/.raid/recent.json on every test run, and the policy
+// tests to ~/.raid/audit.log.
 func TestMain(m *testing.M) {
 	dir, err := os.MkdirTemp("", "raid-cmd-context-test-*")
 	if err != nil {
@@ -34,6 +35,7 @@ func TestMain(m *testing.M) {
 	}
 	lib.LockPathOverride = filepath.Join(dir, ".lock")
 	lib.RecentPathOverride = filepath.Join(dir, "recent.json")
+	lib.AuditLogPathOverride = filepath.Join(dir, "audit.log")
 	code := m.Run()
 	_ = os.RemoveAll(dir)
 	os.Exit(code)
@@ -210,6 +212,11 @@ func TestAgentToolDefs_namesMatchIssue45(t *testing.T) {
 		"raid_install":       false,
 		"raid_env_switch":    false,
 		"raid_run_task":      false,
+		"raid_vars_list":     false,
+		"raid_vars_get":      false,
+		"raid_vars_set":      false,
+		"raid_vars_unset":    false,
+		"raid_vars_clear":    false,
 	}
 	for _, d := range defs {
 		if _, ok := want[d.tool.Name]; !ok {
@@ -237,6 +244,59 @@ func TestAgentToolDefs_haveDescriptions(t *testing.T) {
 	}
 }
 
+// --- Vars tools -----------------------------------------------------------
+
+func TestHandleVars_setGetUnsetRoundTrip(t *testing.T) {
+	t.Cleanup(lib.SetVarsPathForTest(filepath.Join(t.TempDir(), "vars")))
+
+	callWith := func(args map[string]any) mcp.CallToolRequest {
+		var req mcp.CallToolRequest
+		req.Params.Arguments = args
+		return req
+	}
+
+	res, _ := handleVarsSet(stdctx.Background(), callWith(map[string]any{"name": "target", "value": "staging"}))
+	if res.IsError {
+		t.Fatalf("raid_vars_set: %s", toolResultText(res))
+	}
+	var entry lib.VarEntry
+	if err := json.Unmarshal([]byte(toolResultText(res)), &entry); err != nil {
+		t.Fatalf("raid_vars_set body: %v", err)
+	}
+	if entry.Name != "TARGET" || entry.Value != "staging" || entry.Source != lib.VarSourceGlobal {
+		t.Errorf("raid_vars_set entry = %+v", entry)
+	}
+
+	res, _ = handleVarsList(stdctx.Background(), mcp.CallToolRequest{})
+	if !strings.Contains(toolResultText(res), `"TARGET"`) {
+		t.Errorf("raid_vars_list = %s, want TARGET", toolResultText(res))
+	}
+
+	res, _ = handleVarsUnset(stdctx.Background(), callWith(map[string]any{"name": "target"}))
+	if res.IsError {
+		t.Fatalf("raid_vars_unset: %s", toolResultText(res))
+	}
+
+	res, _ = handleVarsGet(stdctx.Background(), callWith(map[string]any{"name": "TARGET"}))
+	if !res.IsError || !strings.Contains(toolResultText(res), errs.CodeVarNotFound) {
+		t.Errorf("raid_vars_get after unset = %s, want VAR_NOT_FOUND error", toolResultText(res))
+	}
+
+	// The server's own environment stays out of reach.
+	t.Setenv("RAID_SERVE_TEST_ENV_ONLY", "from-env")
+	res, _ = handleVarsGet(stdctx.Background(), callWith(map[string]any{"name": "RAID_SERVE_TEST_ENV_ONLY"}))
+	if !res.IsError || strings.Contains(toolResultText(res), "from-env") {
+		t.Errorf("raid_vars_get of an env var = %s, want VAR_NOT_FOUND", toolResultText(res))
+	}
+}
+
+func TestHandleVarsSet_requiresName(t *testing.T) {
+	res, _ := handleVarsSet(stdctx.Background(), mcp.CallToolRequest{})
+	if !res.IsError || !strings.Contains(toolResultText(res), errs.CodeArgInvalid) {
+		t.Errorf("raid_vars_set without name = %s, want ARG_INVALID", toolResultText(res))
+	}
+}
+
 // --- Read-only handlers --------------------------------------------------
 
 func TestHandleListProfiles_returnsValidJSON(t *testing.T) {
@@ -0,0 +1,73 @@
+package env
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/8bitalex/raid/src/raid/env"
+	"github.com/8bitalex/raid/src/raid/errs"
+	"github.com/spf13/cobra"
+)
+
+var DiffEnvCmd = &cobra.Command{
+	Use:   "diff <from> <to>",
+	Short: "Compare two environments",
+	Long:  "Compare two environments across the active profile. For each repository, prints the variables added, removed, or changed when moving from <from> to <to>, plus env tasks that only one side declares. Values of secret variables are masked.",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		diff, err := env.Compare(args[0], args[1])
+		if err != nil {
+			return errs.Wrap(err)
+		}
+
+		if jsonMode(cmd) {
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(diff); err != nil {
+				return errs.Unknown(err)
+			}
+			return nil
+		}
+
+		out := cmd.OutOrStdout()
+		if diff.IsEmpty() {
+			fmt.Fprintf(out, "No differences between %s and %s.\n", diff.From, diff.To)
+			return nil
+		}
+		fmt.Fprintf(out, "Comparing %s → %s\n", diff.From, diff.To)
+		if diff.Tasks != nil {
+			fmt.Fprintln(out, "\nprofile:")
+			printTaskDiff(out, diff.Tasks)
+		}
+		for _, rd := range diff.Repos {
+			fmt.Fprintf(out, "\nrepo %s:\n", rd.Repo)
+			for _, v := range rd.Added {
+				fmt.Fprintf(out, "  + %s=%s\n", v.Name, v.To)
+			}
+			for _, v := range rd.Removed {
+				fmt.Fprintf(out, "  - %s=%s\n", v.Name, v.From)
+			}
+			for _, v := range rd.Changed {
+				if v.Secret {
+					fmt.Fprintf(out, "  ~ %s (secret value changed)\n", v.Name)
+					continue
+				}
+				fmt.Fprintf(out, "  ~ %s: %s → %s\n", v.Name, v.From, v.To)
+			}
+			if rd.Tasks != nil {
+				printTaskDiff(out, rd.Tasks)
+			}
+		}
+		return nil
+	},
+}
+
+func printTaskDiff(out io.Writer, d *env.TaskDiff) {
+	for _, t := range d.Removed {
+		fmt.Fprintf(out, "  - task #%d %s\n", t.Index, t.Label)
+	}
+	for _, t := range d.Added {
+		fmt.Fprintf(out, "  + task #%d %s\n", t.Index, t.Label)
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 func init() {
 	Command.AddCommand(ListEnvCmd)
+	Command.AddCommand(DiffEnvCmd)
 }
 
 // jsonMode resolves --json by walking up to the root's persistent flag, so
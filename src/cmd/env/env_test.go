@@ -68,6 +68,7 @@ func resetEnvCmdState(t *testing.T) {
 	t.Helper()
 	Command.ResetFlags()
 	ListEnvCmd.ResetFlags()
+	DiffEnvCmd.ResetFlags()
 }
 
 func TestListEnvCmd_noEnvironments(t *testing.T) {
@@ -559,3 +560,93 @@ func TestCommand_envSetError(t *testing.T) {
 		t.Fatal("expected error when env.Set fails")
 	}
 }
+
+// setupConfigWithEnvDiff registers a profile with two environments that
+// differ in one plain and one secret variable, then loads it.
+func setupConfigWithEnvDiff(t *testing.T) {
+	t.Helper()
+	setupConfigWithEnv(t, "diff-profile", "staging")
+
+	repoDir := t.TempDir()
+	profilePath := lib.GetProfile().Path
+	content := fmt.Sprintf(`name: diff-profile
+repositories:
+  - name: api
+    path: %s
+environments:
+  - name: staging
+    variables:
+      - name: LOG_LEVEL
+        value: debug
+      - name: DB_PASSWORD
+        value: hunter2
+  - name: production
+    variables:
+      - name: LOG_LEVEL
+        value: warn
+      - name: DB_PASSWORD
+        value: correct-horse
+`, repoDir)
+	if err := os.WriteFile(profilePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := lib.ForceLoad(); err != nil {
+		t.Fatalf("ForceLoad: %v", err)
+	}
+}
+
+func TestDiffEnvCmd_text(t *testing.T) {
+	resetEnvCmdState(t)
+	setupConfigWithEnvDiff(t)
+
+	root := &cobra.Command{Use: "raid"}
+	root.PersistentFlags().Bool("json", false, "")
+	got := execCmd(t, root, Command, "env", "diff", "staging", "production")
+
+	for _, want := range []string{"repo api:", "~ LOG_LEVEL: debug → warn", "~ DB_PASSWORD (secret value changed)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	for _, leaked := range []string{"hunter2", "correct-horse"} {
+		if strings.Contains(got, leaked) {
+			t.Errorf("output leaks secret %q:\n%s", leaked, got)
+		}
+	}
+}
+
+func TestDiffEnvCmd_json(t *testing.T) {
+	resetEnvCmdState(t)
+	setupConfigWithEnvDiff(t)
+
+	root := &cobra.Command{Use: "raid"}
+	root.PersistentFlags().Bool("json", false, "")
+	got := execCmd(t, root, Command, "env", "diff", "staging", "production", "--json")
+
+	var diff lib.EnvDiff
+	if err := json.Unmarshal([]byte(got), &diff); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %v", got, err)
+	}
+	if diff.From != "staging" || diff.To != "production" || len(diff.Repos) != 1 {
+		t.Fatalf("diff = %+v", diff)
+	}
+	if strings.Contains(got, "hunter2") {
+		t.Errorf("JSON output leaks secret:\n%s", got)
+	}
+}
+
+func TestDiffEnvCmd_unknownEnv(t *testing.T) {
+	resetEnvCmdState(t)
+	setupConfigWithEnvDiff(t)
+
+	root := &cobra.Command{Use: "raid"}
+	root.PersistentFlags().Bool("json", false, "")
+	root.SilenceErrors = true
+	root.SilenceUsage = true
+	root.AddCommand(Command)
+	root.SetArgs([]string{"env", "diff", "staging", "nope"})
+	err := root.Execute()
+	if rErr, ok := errs.AsError(err); !ok || rErr.Code() != errs.CodeEnvNotFound {
+		t.Errorf("err = %v, want ENV_NOT_FOUND", err)
+	}
+}
@@ -14,23 +14,31 @@ import (
 	"github.com/8bitalex/raid/src/cmd/env"
 	"github.com/8bitalex/raid/src/cmd/install"
 	"github.com/8bitalex/raid/src/cmd/profile"
+	servicecmd "github.com/8bitalex/raid/src/cmd/service"
 	telemetrycmd "github.com/8bitalex/raid/src/cmd/telemetry"
+	varscmd "github.com/8bitalex/raid/src/cmd/vars"
 	"github.com/8bitalex/raid/src/internal/lib"
 	"github.com/8bitalex/raid/src/internal/sys"
 	"github.com/8bitalex/raid/src/internal/telemetry"
 	"github.com/8bitalex/raid/src/raid"
 	"github.com/8bitalex/raid/src/raid/errs"
+	"github.com/8bitalex/raid/src/raid/service"
 	"github.com/spf13/cobra"
 )
 
 // reservedNames are built-in cobra subcommands that custom commands cannot shadow.
 var reservedNames = map[string]bool{
 	"profile":    true,
+	"up":         true,
+	"down":       true,
+	"ps":         true,
+	"logs":       true,
 	"install":    true,
 	"env":        true,
 	"doctor":     true,
 	"context":    true,
 	"telemetry":  true,
+	"vars":       true,
 	"help":       true,
 	"version":    true,
 	"completion": true,
@@ -69,6 +77,11 @@ func init() {
 	rootCmd.AddCommand(doctor.Command)
 	rootCmd.AddCommand(contextcmd.Command)
 	rootCmd.AddCommand(telemetrycmd.Command)
+	rootCmd.AddCommand(varscmd.Command)
+	rootCmd.AddCommand(servicecmd.UpCmd)
+	rootCmd.AddCommand(servicecmd.DownCmd)
+	rootCmd.AddCommand(servicecmd.PsCmd)
+	rootCmd.AddCommand(servicecmd.LogsCmd)
 }
 
 // isInfoCommand reports whether the invocation is for a built-in
@@ -144,6 +157,13 @@ var (
 )
 
 func Execute() {
+	// A Service runs under raid itself as its supervisor. That
+	// process is not a CLI invocation: skip the version check, consent
+	// prompt and command registration entirely.
+	if len(os.Args) == 3 && os.Args[1] == service.SupervisorArg {
+		osExit(service.Supervise(os.Args[2]))
+		return
+	}
 	code := executeRoot(os.Args)
 	if code != 0 {
 		osExit(code)
@@ -411,27 +431,20 @@ const (
 )
 
 // registerUserCommands adds user-defined commands to root.
-// Reserved built-in names are skipped with a warning.
+// Reserved built-in names are skipped with a warning, as are aliases that
+// collide with a built-in or another command.
 func registerUserCommands(root *cobra.Command, cmds []lib.Command) {
-	for _, cmd := range cmds {
+	aliases := commandAliases("", cmds, func(alias string) bool {
+		return reservedNames[alias] || hasCommand(root, alias)
+	})
+	for i, cmd := range cmds {
 		if reservedNames[cmd.Name] {
 			fmt.Fprintf(os.Stderr, "warning: command '%s' conflicts with a built-in subcommand and will be ignored\n", cmd.Name)
 			continue
 		}
-		name := cmd.Name
-		def := cmd
-		coCmd := &cobra.Command{
-			Use:         buildCommandUse(name, def.Args),
-			Short:       cmd.Usage,
-			Annotations: map[string]string{CommandSourceAnnotation: CommandSourceUser},
-		}
-		attachCommandArgsAndFlags(coCmd, def)
-		coCmd.RunE = func(c *cobra.Command, args []string) error {
-			named := gatherCommandValues(c, def, args)
-			return raid.WithMutationLock(func() error {
-				return raid.ExecuteCommand(name, args, named)
-			})
-		}
+		cmd.Aliases = aliases[i]
+		coCmd := newCustomCommand(cmd, cmd.Name, "", "", raid.ExecuteCommand)
+		coCmd.Annotations = map[string]string{CommandSourceAnnotation: CommandSourceUser}
 		root.AddCommand(coCmd)
 	}
 }
@@ -458,24 +471,87 @@ func registerRepoCommands(root *cobra.Command, repos []lib.Repo) {
 			Use:   repoName,
 			Short: fmt.Sprintf("Commands for the %s repository", repoName),
 		}
-		for _, cmd := range repo.Commands {
-			cmdName := cmd.Name
-			def := cmd
-			subCmd := &cobra.Command{
-				Use:   buildCommandUse(cmdName, def.Args),
-				Short: cmd.Usage,
+		execute := func(path string, args []string, named map[string]string) error {
+			return raid.ExecuteRepoCommand(repoName, path, args, named)
+		}
+		aliases := commandAliases(repoName+" ", repo.Commands, nil)
+		for i, cmd := range repo.Commands {
+			cmd.Aliases = aliases[i]
+			repoCmd.AddCommand(newCustomCommand(cmd, cmd.Name, repoName, repo.Path, execute))
+		}
+		root.AddCommand(repoCmd)
+	}
+}
+
+// newCustomCommand builds the cobra command for a profile or repo command
+// and, recursively, its children. path is def's full command path, e.g.
+// "db migrate", which is what execute receives; repo names the repository
+// a repo command belongs to, empty for a profile command; dir is where
+// completion commands run, empty for the home directory. A namespace with no tasks
+// of its own has no Run, so cobra prints its help listing the children.
+func newCustomCommand(def lib.Command, path, repo, dir string, execute func(path string, args []string, named map[string]string) error) *cobra.Command {
+	coCmd := &cobra.Command{
+		Use:        buildCommandUse(def.Name, def.Args),
+		Short:      def.Usage,
+		Aliases:    def.Aliases,
+		Hidden:     def.Hidden,
+		Deprecated: def.Deprecated,
+	}
+	aliases := commandAliases(path+" ", def.Commands, nil)
+	for i, child := range def.Commands {
+		child.Aliases = aliases[i]
+		coCmd.AddCommand(newCustomCommand(child, path+" "+child.Name, repo, dir, execute))
+	}
+	if len(def.Tasks) == 0 && len(def.Commands) > 0 {
+		return coCmd
+	}
+	attachCommandArgsAndFlags(coCmd, def)
+	attachCommandCompletions(coCmd, def, dir)
+	coCmd.RunE = func(c *cobra.Command, args []string) error {
+		named := gatherCommandValues(c, def, args)
+		// The command's own lock is checked first, so a second run of an
+		// exclusive command fails fast instead of queueing on the
+		// mutation lock.
+		if err := raid.CheckCommandLock(repo, path); err != nil {
+			return err
+		}
+		return raid.WithMutationLock(func() error {
+			return execute(path, args, named)
+		})
+	}
+	return coCmd
+}
+
+// commandAliases returns the usable aliases of each of a set of sibling
+// commands, in order. An alias is dropped with a warning when it's reserved,
+// names one of the siblings, or an earlier sibling already claimed it.
+// prefix is the siblings' parent path, with a trailing space, for the
+// warning.
+func commandAliases(prefix string, cmds []lib.Command, reserved func(string) bool) [][]string {
+	owners := make(map[string]string, len(cmds))
+	for _, c := range cmds {
+		if _, ok := owners[c.Name]; !ok {
+			owners[c.Name] = c.Name
+		}
+	}
+	out := make([][]string, len(cmds))
+	for i, c := range cmds {
+		for _, alias := range c.Aliases {
+			if reserved != nil && reserved(alias) {
+				fmt.Fprintf(os.Stderr, "warning: alias '%s' of command '%s%s' conflicts with a built-in subcommand and will be ignored\n", alias, prefix, c.Name)
+				continue
 			}
-			attachCommandArgsAndFlags(subCmd, def)
-			subCmd.RunE = func(c *cobra.Command, args []string) error {
-				named := gatherCommandValues(c, def, args)
-				return raid.WithMutationLock(func() error {
-					return raid.ExecuteRepoCommand(repoName, cmdName, args, named)
-				})
+			if owner, ok := owners[alias]; ok {
+				if owner != c.Name {
+					fmt.Fprintf(os.Stderr, "warning: alias '%s' of command '%s%s' conflicts with command '%s%s' and will be ignored\n", alias, prefix, c.Name, prefix, owner)
+				}
+				continue
 			}
-			repoCmd.AddCommand(subCmd)
+			owners[alias] = c.Name
+			out[i] = append(out[i], alias)
 		}
-		root.AddCommand(repoCmd)
 	}
+	return out
 }
 
 // buildCommandUse renders the cobra Use string with declared positional
@@ -504,9 +580,10 @@ func buildCommandUse(name string, args []lib.Arg) string {
 
 // attachCommandArgsAndFlags configures a cobra subcommand from the lib.Command
 // definition: positional-arg cardinality validators and declared flags. Type
-// defaults to "string" when unset; "bool" / "int" are also recognised. A
-// missing or wrong-typed Default falls back to the zero value rather than
-// failing — the schema's `oneOf` already guards the YAML side.
+// defaults to "string" when unset; "bool", "int" and "list" get typed flags,
+// and "duration" and "path" are string flags that lib validates. A missing
+// or wrong-typed Default falls back to the zero value rather than failing —
+// the schema's `oneOf` already guards the YAML side.
 func attachCommandArgsAndFlags(co *cobra.Command, cmd lib.Command) {
 	if n := len(cmd.Args); n > 0 {
 		req := 0
@@ -516,6 +593,9 @@ func attachCommandArgsAndFlags(co *cobra.Command, cmd lib.Command) {
 			}
 		}
 		switch {
+		case cmd.Args[n-1].Type == "list":
+			// A trailing list arg takes every remaining value.
+			co.Args = cobra.MinimumNArgs(req)
 		case req == n:
 			co.Args = cobra.ExactArgs(n)
 		case req == 0:
@@ -540,6 +620,14 @@ func attachCommandArgsAndFlags(co *cobra.Command, cmd lib.Command) {
 				d = int(v)
 			}
 			co.Flags().IntP(f.Name, f.Short, d, f.Usage)
+		case "list":
+			var d []string
+			if items, ok := f.Default.([]any); ok {
+				for _, item := range items {
+					d = append(d, fmt.Sprint(item))
+				}
+			}
+			co.Flags().StringSliceP(f.Name, f.Short, d, f.Usage)
 		default:
 			d, _ := f.Default.(string)
 			co.Flags().StringP(f.Name, f.Short, d, f.Usage)
@@ -559,7 +647,11 @@ func gatherCommandValues(co *cobra.Command, cmd lib.Command, posArgs []string) m
 	}
 	out := make(map[string]string, len(cmd.Args)+len(cmd.Flags))
 	for i, a := range cmd.Args {
-		if i < len(posArgs) {
+		switch {
+		case i >= len(posArgs):
+		case a.Type == "list":
+			out[a.Name] = strings.Join(posArgs[i:], ",")
+		default:
 			out[a.Name] = posArgs[i]
 		}
 	}
@@ -575,6 +667,9 @@ func gatherCommandValues(co *cobra.Command, cmd lib.Command, posArgs []string) m
 		case "int":
 			v, _ := co.Flags().GetInt(f.Name)
 			out[f.Name] = strconv.Itoa(v)
+		case "list":
+			v, _ := co.Flags().GetStringSlice(f.Name)
+			out[f.Name] = strings.Join(v, ",")
 		default:
 			v, _ := co.Flags().GetString(f.Name)
 			out[f.Name] = v
@@ -583,9 +678,45 @@ func gatherCommandValues(co *cobra.Command, cmd lib.Command, posArgs []string) m
 	return out
 }
 
+// attachCommandCompletions registers shell completion for the declared
+// args and flags that have `complete:` values, choices, or the path type.
+// Path values fall back to the shell's file completion.
+func attachCommandCompletions(co *cobra.Command, cmd lib.Command, dir string) {
+	complete := func(c *lib.Completion, choices []string, typ, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if c == nil && len(choices) == 0 {
+			if typ == "path" {
+				return nil, cobra.ShellCompDirectiveDefault
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return raid.CompleteValue(c, choices, dir, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+	if len(cmd.Args) > 0 {
+		co.ValidArgsFunction = func(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			i := len(args)
+			if last := len(cmd.Args) - 1; i > last {
+				if cmd.Args[last].Type != "list" {
+					return nil, cobra.ShellCompDirectiveNoFileComp
+				}
+				i = last
+			}
+			a := cmd.Args[i]
+			return complete(a.Complete, a.Choices, a.Type, toComplete)
+		}
+	}
+	for _, f := range cmd.Flags {
+		if f.Complete == nil && len(f.Choices) == 0 {
+			continue
+		}
+		_ = co.RegisterFlagCompletionFunc(f.Name, func(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return complete(f.Complete, f.Choices, f.Type, toComplete)
+		})
+	}
+}
+
 func hasCommand(root *cobra.Command, name string) bool {
 	for _, c := range root.Commands() {
-		if c.Name() == name {
+		if c.Name() == name || c.HasAlias(name) {
 			return true
 		}
 	}
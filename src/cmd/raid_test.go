@@ -549,6 +549,8 @@ func TestAttachCommandArgsAndFlags_argValidatorCardinality(t *testing.T) {
 		{"mixed at min", []lib.Arg{{Name: "a", Required: true}, {Name: "b"}}, []string{"x"}, false},
 		{"mixed at max", []lib.Arg{{Name: "a", Required: true}, {Name: "b"}}, []string{"x", "y"}, false},
 		{"mixed above max", []lib.Arg{{Name: "a", Required: true}, {Name: "b"}}, []string{"x", "y", "z"}, true},
+		{"trailing list takes the rest", []lib.Arg{{Name: "a", Required: true}, {Name: "b", Type: "list"}}, []string{"x", "y", "z"}, false},
+		{"required list needs one", []lib.Arg{{Name: "a", Required: true}, {Name: "b", Type: "list", Required: true}}, []string{"x"}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -684,6 +686,63 @@ func TestGatherCommandValues_boolFalseWhenAbsent(t *testing.T) {
 	}
 }
 
+func TestGatherCommandValues_lists(t *testing.T) {
+	cmd := lib.Command{
+		Args:  []lib.Arg{{Name: "target"}, {Name: "pkgs", Type: "list"}},
+		Flags: []lib.Flag{{Name: "tag", Type: "list", Default: []any{"ci"}}, {Name: "timeout", Type: "duration", Default: "1m"}},
+	}
+	co := &cobra.Command{Use: "cmd", Run: func(*cobra.Command, []string) {}}
+	attachCommandArgsAndFlags(co, cmd)
+	co.SetArgs([]string{"--tag", "fast", "--tag", "unit,race", "api", "./a", "./b"})
+	if err := co.Execute(); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	got := gatherCommandValues(co, cmd, []string{"api", "./a", "./b"})
+	want := map[string]string{"target": "api", "pkgs": "./a,./b", "tag": "fast,unit,race", "timeout": "1m"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("gathered[%q] = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestAttachCommandCompletions(t *testing.T) {
+	cmd := lib.Command{
+		Args: []lib.Arg{
+			{Name: "env", Choices: []string{"dev", "prod"}},
+			{Name: "files", Type: "list", Complete: &lib.Completion{Values: []string{"a.go", "b.go"}}},
+		},
+		Flags: []lib.Flag{{Name: "region", Complete: &lib.Completion{Values: []string{"eu", "us"}}}},
+	}
+	co := &cobra.Command{Use: "cmd"}
+	attachCommandArgsAndFlags(co, cmd)
+	attachCommandCompletions(co, cmd, "")
+
+	tests := []struct {
+		args       []string
+		toComplete string
+		want       string
+	}{
+		{nil, "d", "dev"},
+		{[]string{"dev"}, "", "a.go,b.go"},
+		{[]string{"dev", "a.go", "b.go"}, "b", "b.go"},
+	}
+	for _, tt := range tests {
+		got, directive := co.ValidArgsFunction(co, tt.args, tt.toComplete)
+		if strings.Join(got, ",") != tt.want || directive != cobra.ShellCompDirectiveNoFileComp {
+			t.Errorf("complete(%q, %q) = %q, %v; want %q", tt.args, tt.toComplete, got, directive, tt.want)
+		}
+	}
+	fn, ok := co.GetFlagCompletionFunc("region")
+	if !ok {
+		t.Fatal("no completion registered for --region")
+	}
+	if got, _ := fn(co, nil, "u"); strings.Join(got, ",") != "us" {
+		t.Errorf("--region completions = %q, want us", got)
+	}
+}
+
 func TestRegisterUserCommands_useStringIncludesDeclaredArgs(t *testing.T) {
 	root := newTestRoot()
 	registerUserCommands(root, []lib.Command{
@@ -1139,6 +1198,102 @@ func TestRegisterUserCommands_runEExecution(t *testing.T) {
 	}
 }
 
+func TestRegisterUserCommands_nested(t *testing.T) {
+	setupTestConfig(t)
+	root := newTestRoot()
+	registerUserCommands(root, []lib.Command{{
+		Name:  "db",
+		Usage: "Database tasks",
+		Commands: []lib.Command{
+			{Name: "migrate", Usage: "Apply migrations", Tasks: []lib.Task{{Type: lib.Shell, Cmd: "true"}}},
+			{Name: "reset", Usage: "Drop and recreate"},
+		},
+	}})
+
+	db, _, err := root.Find([]string{"db"})
+	if err != nil || db.Name() != "db" {
+		t.Fatalf("Find(db) = %v, %v", db, err)
+	}
+	if db.Runnable() {
+		t.Error("namespace without tasks should not be runnable")
+	}
+	var buf bytes.Buffer
+	db.SetOut(&buf)
+	_ = db.Help()
+	for _, want := range []string{"migrate", "Apply migrations", "reset", "Drop and recreate"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("db help missing %q\n\nfull output:\n%s", want, buf.String())
+		}
+	}
+
+	// With no loaded context the lookup fails, naming the full path
+	// the child passed to ExecuteCommand.
+	root.SetOut(&buf)
+	root.SetErr(&buf)
+	root.SetArgs([]string{"db", "migrate"})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "'db migrate'") {
+		t.Errorf("Execute(db migrate) error = %v, want the full command path", err)
+	}
+}
+
+func TestRegisterRepoCommands_nested(t *testing.T) {
+	setupTestConfig(t)
+	root := newTestRoot()
+	registerRepoCommands(root, []lib.Repo{{
+		Name: "api",
+		Commands: []lib.Command{{Name: "db", Commands: []lib.Command{
+			{Name: "migrate", Tasks: []lib.Task{{Type: lib.Shell, Cmd: "true"}}},
+		}}},
+	}})
+
+	var buf bytes.Buffer
+	root.SetOut(&buf)
+	root.SetErr(&buf)
+	root.SetArgs([]string{"api", "db", "migrate"})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "repository 'api'") {
+		t.Errorf("Execute(api db migrate) error = %v, want a repo lookup error", err)
+	}
+}
+
+func TestRegisterUserCommands_aliasesHiddenDeprecated(t *testing.T) {
+	setupTestConfig(t)
+	root := newTestRoot()
+	root.AddCommand(&cobra.Command{Use: "profile", Aliases: []string{"p"}})
+	registerUserCommands(root, []lib.Command{
+		{Name: "setup", Usage: "Set up", Aliases: []string{"init", "p", "env", "ship"}},
+		{Name: "bootstrap", Usage: "Old setup", Deprecated: "use setup"},
+		{Name: "internal", Usage: "Plumbing", Hidden: true},
+		{Name: "deploy", Usage: "Deploy", Aliases: []string{"init", "setup"}},
+		{Name: "ship", Usage: "Ship"},
+	})
+
+	byName := map[string]*cobra.Command{}
+	for _, c := range root.Commands() {
+		byName[c.Name()] = c
+	}
+	if got := byName["setup"].Aliases; len(got) != 1 || got[0] != "init" {
+		t.Errorf("setup aliases = %q, want only init", got)
+	}
+	if got := byName["deploy"].Aliases; len(got) != 0 {
+		t.Errorf("deploy aliases = %q, want none", got)
+	}
+	if byName["bootstrap"].Deprecated != "use setup" || !byName["internal"].Hidden {
+		t.Error("deprecated/hidden not wired into cobra")
+	}
+	out := helpOutput(root)
+	if strings.Contains(out, "bootstrap") || strings.Contains(out, "internal") {
+		t.Errorf("help lists deprecated or hidden command\n\nfull output:\n%s", out)
+	}
+
+	var buf bytes.Buffer
+	root.SetOut(&buf)
+	root.SetErr(&buf)
+	root.SetArgs([]string{"init"})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "'setup'") {
+		t.Errorf("Execute(init) error = %v, want it to run setup", err)
+	}
+}
+
 // TestExecute_inProcess_nonInfoCommand exercises the non-info path of Execute()
 // by running "raid env list" which doesn't call os.Exit. This test MUST run last
 // in the file to avoid state pollution since Execute() modifies global state.
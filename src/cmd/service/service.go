@@ -0,0 +1,112 @@
+// Start, stop and inspect the long-running processes of Service tasks.
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/8bitalex/raid/src/raid/errs"
+	"github.com/8bitalex/raid/src/raid/service"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addFlags()
+}
+
+// addFlags registers the subcommands' local flags.
+func addFlags() {
+	LogsCmd.Flags().BoolP("follow", "f", false, "Keep printing new output until interrupted")
+}
+
+// UpCmd is `raid up`.
+var UpCmd = &cobra.Command{
+	Use:   "up [name...]",
+	Short: "Start the services of the active environment",
+	Long:  "Start the Service tasks of the active environment, or only the named ones. Services that are already running are left alone. Other task types in the environment are not run.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errs.Wrap(service.Up(args))
+	},
+}
+
+// DownCmd is `raid down`.
+var DownCmd = &cobra.Command{
+	Use:   "down [name...]",
+	Short: "Stop running services",
+	Long:  "Stop the named services, or every service of the active profile when no name is given. Each service's process tree gets a chance to exit before it is killed. Logs are kept.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Not wrapped: Down joins one error per service that failed to
+		// stop, and wrapping would keep only the first.
+		return service.Down(args)
+	},
+}
+
+// PsCmd is `raid ps`.
+var PsCmd = &cobra.Command{
+	Use:   "ps",
+	Short: "List the services of the active profile",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		services, err := service.List()
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		if jsonMode(cmd) {
+			if services == nil {
+				services = []service.Info{}
+			}
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(services); err != nil {
+				return errs.Unknown(err)
+			}
+			return nil
+		}
+
+		out := cmd.OutOrStdout()
+		if len(services) == 0 {
+			fmt.Fprintln(out, "No services.")
+			return nil
+		}
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tSTATUS\tPID\tRESTARTS\tUPTIME\tCOMMAND")
+		for _, s := range services {
+			status, pid, uptime := "exited", "-", "-"
+			if s.Running {
+				status = "running"
+				pid = fmt.Sprint(s.PID)
+				uptime = time.Since(s.Started).Round(time.Second).String()
+			}
+			if !s.Running && s.LastExit != nil {
+				status = fmt.Sprintf("exited (%d)", *s.LastExit)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", s.Name, status, pid, s.Restarts, uptime, s.Cmd)
+		}
+		return tw.Flush()
+	},
+}
+
+// LogsCmd is `raid logs`.
+var LogsCmd = &cobra.Command{
+	Use:   "logs <name>",
+	Short: "Print a service's log",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		follow, _ := cmd.Flags().GetBool("follow")
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+		return errs.Wrap(service.Logs(ctx, args[0], follow, cmd.OutOrStdout()))
+	},
+}
+
+// jsonMode resolves the persistent --json flag from rootCmd. Returns false
+// when the flag isn't registered (bare test cmds) so callers don't need to
+// guard.
+func jsonMode(cmd *cobra.Command) bool {
+	v, _ := cmd.Root().PersistentFlags().GetBool("json")
+	return v
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/8bitalex/raid/src/internal/lib"
+	"github.com/8bitalex/raid/src/raid/errs"
+	"github.com/8bitalex/raid/src/raid/service"
+	"github.com/spf13/cobra"
+)
+
+// TestMain lets the test binary stand in for raid as a service's
+// supervisor, since that's the executable a Service task re-runs.
+func TestMain(m *testing.M) {
+	if len(os.Args) == 3 && os.Args[1] == service.SupervisorArg {
+		os.Exit(service.Supervise(os.Args[2]))
+	}
+	os.Exit(m.Run())
+}
+
+func setupServices(t *testing.T) {
+	t.Helper()
+	old := lib.ServicesPathOverride
+	lib.ServicesPathOverride = t.TempDir()
+	t.Cleanup(func() { lib.ServicesPathOverride = old })
+}
+
+// run executes `raid <args>` against a fresh root carrying the persistent
+// --json flag and returns stdout plus the command error.
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	cmds := []*cobra.Command{UpCmd, DownCmd, PsCmd, LogsCmd}
+	for _, c := range cmds {
+		c.ResetFlags()
+	}
+	addFlags()
+	var buf bytes.Buffer
+	root := &cobra.Command{Use: "raid", SilenceErrors: true, SilenceUsage: true}
+	root.PersistentFlags().Bool("json", false, "")
+	root.AddCommand(cmds...)
+	root.SetOut(&buf)
+	root.SetErr(&buf)
+	root.SetArgs(args)
+	err := root.Execute()
+	root.RemoveCommand(cmds...)
+	return buf.String(), err
+}
+
+func TestPsCmd_empty(t *testing.T) {
+	setupServices(t)
+
+	out, err := run(t, "ps")
+	if err != nil || !strings.Contains(out, "No services.") {
+		t.Errorf("ps: out=%q err=%v", out, err)
+	}
+	out, err = run(t, "ps", "--json")
+	var got []service.Info
+	if err != nil || json.Unmarshal([]byte(out), &got) != nil || got == nil || len(got) != 0 {
+		t.Errorf("ps --json: out=%q err=%v, want []", out, err)
+	}
+}
+
+func TestPsCmd_listsServices(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	setupServices(t)
+	t.Cleanup(func() { service.Down(nil) })
+	if err := lib.ExecuteTask(lib.Task{TaskProps: lib.TaskProps{Name: "api"}, Type: lib.Service, Cmd: "exec sleep 30", Shell: "sh"}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := run(t, "ps")
+	if err != nil || !strings.Contains(out, "NAME") || !strings.Contains(out, "api") || !strings.Contains(out, "running") {
+		t.Errorf("ps: out=%q err=%v", out, err)
+	}
+	out, err = run(t, "ps", "--json")
+	var got []service.Info
+	if err != nil || json.Unmarshal([]byte(out), &got) != nil || len(got) != 1 || !got[0].Running {
+		t.Errorf("ps --json: out=%q err=%v", out, err)
+	}
+}
+
+func TestLogsCmd_unknownService(t *testing.T) {
+	setupServices(t)
+	_, err := run(t, "logs", "ghost")
+	if rErr, ok := errs.AsError(err); !ok || rErr.Code() != errs.CodeTaskServiceFailed {
+		t.Errorf("logs ghost: err=%v, want TASK_SERVICE_FAILED", err)
+	}
+	if _, err := run(t, "logs"); err == nil {
+		t.Error("logs with no name succeeded")
+	}
+}
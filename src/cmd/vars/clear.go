@@ -0,0 +1,42 @@
+package vars
+
+import (
+	"fmt"
+
+	"github.com/8bitalex/raid/src/raid"
+	"github.com/8bitalex/raid/src/raid/errs"
+	"github.com/8bitalex/raid/src/raid/vars"
+	"github.com/spf13/cobra"
+)
+
+// clearResult is the stable JSON shape for `raid vars clear --json`.
+type clearResult struct {
+	Removed int `json:"removed"`
+}
+
+var ClearVarsCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove every variable in a scope",
+	Long:  "Remove every variable in one scope — the active profile's vars by default, or the scope named by --scope. RAID_REPO_* metadata is rebuilt from the profile and is unaffected.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scope, err := scopeFlag(cmd)
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		var removed int
+		err = raid.WithMutationLock(func() error {
+			var err error
+			removed, err = vars.Clear(scope)
+			return err
+		})
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		if jsonMode(cmd) {
+			return emitJSON(cmd, clearResult{Removed: removed})
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Removed %d persisted variable(s).\n", removed)
+		return nil
+	},
+}
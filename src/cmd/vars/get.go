@@ -0,0 +1,27 @@
+package vars
+
+import (
+	"fmt"
+
+	"github.com/8bitalex/raid/src/raid/errs"
+	"github.com/8bitalex/raid/src/raid/vars"
+	"github.com/spf13/cobra"
+)
+
+var GetVarCmd = &cobra.Command{
+	Use:   "get <name>",
+	Short: "Print a variable's effective value",
+	Long:  "Print the value raid resolves for <name> — a persisted or repo variable first, then the process environment. With --json the source is included; otherwise the bare value is printed so it can be used in shell substitutions.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entry, err := vars.Get(args[0])
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		if jsonMode(cmd) {
+			return emitJSON(cmd, entry)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), entry.Value)
+		return nil
+	},
+}
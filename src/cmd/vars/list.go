@@ -0,0 +1,31 @@
+package vars
+
+import (
+	"fmt"
+
+	"github.com/8bitalex/raid/src/raid/vars"
+	"github.com/spf13/cobra"
+)
+
+var ListVarsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List raid variables and where each value comes from",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries := vars.List()
+		if jsonMode(cmd) {
+			return emitJSON(cmd, entries)
+		}
+
+		out := cmd.OutOrStdout()
+		if len(entries) == 0 {
+			fmt.Fprintln(out, "No raid variables set.")
+			return nil
+		}
+		fmt.Fprintln(out, "Raid variables:")
+		for _, e := range entries {
+			fmt.Fprintf(out, "\t%s=%s\t(%s)\n", e.Name, e.Value, sourceLabel(e))
+		}
+		return nil
+	},
+}
@@ -0,0 +1,38 @@
+package vars
+
+import (
+	"fmt"
+
+	"github.com/8bitalex/raid/src/raid"
+	"github.com/8bitalex/raid/src/raid/errs"
+	"github.com/8bitalex/raid/src/raid/vars"
+	"github.com/spf13/cobra"
+)
+
+var SetVarCmd = &cobra.Command{
+	Use:   "set <name> <value>",
+	Short: "Persist a variable",
+	Long:  "Persist <name>=<value>, exactly as a Set task would. Names are uppercased. Stored in the active profile's vars unless --scope says otherwise; --secret encrypts it at rest. RAID_REPO_* variables are derived from the profile and can't be set.",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scope, err := scopeFlag(cmd)
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		var entry vars.Entry
+		err = raid.WithMutationLock(func() error {
+			var err error
+			secret, _ := cmd.Flags().GetBool("secret")
+			entry, err = vars.Set(args[0], args[1], scope, secret)
+			return err
+		})
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		if jsonMode(cmd) {
+			return emitJSON(cmd, entry)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Set %s (%s).\n", entry.Name, entry.Source)
+		return nil
+	},
+}
@@ -0,0 +1,41 @@
+package vars
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/8bitalex/raid/src/raid"
+	"github.com/8bitalex/raid/src/raid/errs"
+	"github.com/8bitalex/raid/src/raid/vars"
+	"github.com/spf13/cobra"
+)
+
+// unsetResult is the stable JSON shape for `raid vars unset --json`.
+type unsetResult struct {
+	Unset string `json:"unset"`
+}
+
+var UnsetVarCmd = &cobra.Command{
+	Use:   "unset <name>",
+	Short: "Remove a persisted variable",
+	Long:  "Remove a persisted variable. Without --scope it's removed from wherever its effective value lives; removing a profile value exposes a global one of the same name, if any.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scope, err := scopeFlag(cmd)
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		err = raid.WithMutationLock(func() error {
+			return vars.Unset(args[0], scope)
+		})
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		name := strings.ToUpper(args[0])
+		if jsonMode(cmd) {
+			return emitJSON(cmd, unsetResult{Unset: name})
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Unset %s.\n", name)
+		return nil
+	},
+}
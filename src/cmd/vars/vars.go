@@ -0,0 +1,83 @@
+// Inspect and edit raid's persisted variables.
+package vars
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/8bitalex/raid/src/raid/errs"
+	"github.com/8bitalex/raid/src/raid/vars"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addScopeFlags()
+	Command.AddCommand(ListVarsCmd)
+	Command.AddCommand(GetVarCmd)
+	Command.AddCommand(SetVarCmd)
+	Command.AddCommand(UnsetVarCmd)
+	Command.AddCommand(ClearVarsCmd)
+}
+
+// Command is `raid vars`. With no subcommand it behaves like `raid vars list`.
+var Command = &cobra.Command{
+	Use:   "vars",
+	Short: "Inspect and edit persisted raid variables",
+	Long:  "Inspect and edit the variables raid persists between runs. Set tasks write to the same files, and every value is available to tasks as $NAME. Each entry reports where its effective value comes from: profile (~/.raid/vars.d/<profile>, the default), global (~/.raid/vars, shared by every profile), session (in memory for the current run), repo (RAID_REPO_* metadata derived from the active profile), or env (the process environment).",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ListVarsCmd.RunE(cmd, args)
+	},
+}
+
+// jsonMode resolves the persistent --json flag from rootCmd. Returns false
+// when the flag isn't registered (bare test cmds) so callers don't need to
+// guard.
+func jsonMode(cmd *cobra.Command) bool {
+	v, _ := cmd.Root().PersistentFlags().GetBool("json")
+	return v
+}
+
+// emitJSON writes v as pretty-printed JSON to the command's stdout.
+func emitJSON(cmd *cobra.Command, v any) error {
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return errs.Unknown(err)
+	}
+	return nil
+}
+
+// addScopeFlags registers --scope on the subcommands that write, and
+// --secret on set.
+func addScopeFlags() {
+	for _, c := range []*cobra.Command{SetVarCmd, UnsetVarCmd, ClearVarsCmd} {
+		c.Flags().String("scope", "", "Variable scope: global or profile (default: the active profile, or global when none is loaded)")
+	}
+	SetVarCmd.Flags().Bool("secret", false, "Encrypt the value at rest and mask it in raid output")
+}
+
+// scopeFlag reads the --scope flag registered by addScopeFlags. The
+// session scope is rejected: it lasts for one raid run, which for these
+// commands ends as soon as they return.
+func scopeFlag(cmd *cobra.Command) (vars.Scope, error) {
+	v, _ := cmd.Flags().GetString("scope")
+	scope := vars.Scope(strings.ToLower(v))
+	if scope == vars.ScopeSession {
+		return "", errs.ArgInvalid("--scope session only lasts for a single run, so it has nothing to act on here; use global or profile")
+	}
+	return scope, nil
+}
+
+// sourceLabel renders an entry's source for text output, noting secrets
+// and raid values that hide a process env var of the same name.
+func sourceLabel(e vars.Entry) string {
+	label := string(e.Source)
+	if e.Secret {
+		label += ", secret"
+	}
+	if e.ShadowsEnv {
+		label += ", overrides env"
+	}
+	return label
+}
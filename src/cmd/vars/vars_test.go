@@ -0,0 +1,138 @@
+package vars
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/8bitalex/raid/src/internal/lib"
+	"github.com/8bitalex/raid/src/raid/errs"
+	"github.com/8bitalex/raid/src/raid/vars"
+	"github.com/spf13/cobra"
+)
+
+// setupVars isolates the vars file and the mutation lock in a temp dir.
+func setupVars(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Cleanup(lib.SetVarsPathForTest(filepath.Join(dir, "vars")))
+	oldLock := lib.LockPathOverride
+	t.Cleanup(func() { lib.LockPathOverride = oldLock })
+	lib.LockPathOverride = filepath.Join(dir, ".lock")
+}
+
+// run executes `raid vars <args>` against a fresh root carrying the
+// persistent --json flag and returns stdout plus the command error.
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	for _, c := range append([]*cobra.Command{Command}, Command.Commands()...) {
+		c.ResetFlags()
+	}
+	addScopeFlags()
+	var buf bytes.Buffer
+	root := &cobra.Command{Use: "raid", SilenceErrors: true, SilenceUsage: true}
+	root.PersistentFlags().Bool("json", false, "")
+	root.AddCommand(Command)
+	root.SetOut(&buf)
+	root.SetErr(&buf)
+	root.SetArgs(append([]string{"vars"}, args...))
+	err := root.Execute()
+	root.RemoveCommand(Command)
+	return buf.String(), err
+}
+
+func TestVarsCmd_setGetUnset(t *testing.T) {
+	setupVars(t)
+
+	if out, err := run(t, "set", "region", "eu-west-1"); err != nil || !strings.Contains(out, "Set REGION") {
+		t.Fatalf("set: out=%q err=%v", out, err)
+	}
+	out, err := run(t, "get", "REGION")
+	if err != nil || strings.TrimSpace(out) != "eu-west-1" {
+		t.Fatalf("get: out=%q err=%v", out, err)
+	}
+	if _, err := run(t, "unset", "region"); err != nil {
+		t.Fatalf("unset: %v", err)
+	}
+	_, err = run(t, "get", "REGION")
+	if rErr, ok := errs.AsError(err); !ok || rErr.Code() != errs.CodeVarNotFound {
+		t.Errorf("get after unset: err=%v, want VAR_NOT_FOUND", err)
+	}
+}
+
+func TestVarsCmd_listJSON(t *testing.T) {
+	setupVars(t)
+	if _, err := vars.Set("ALPHA", "1", "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := run(t, "list", "--json")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var entries []vars.Entry
+	if err := json.Unmarshal([]byte(out), &entries); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %v", out, err)
+	}
+	if len(entries) != 1 || entries[0].Name != "ALPHA" || entries[0].Source != vars.SourceGlobal {
+		t.Errorf("entries = %+v", entries)
+	}
+}
+
+func TestVarsCmd_bareListsAndReportsEmpty(t *testing.T) {
+	setupVars(t)
+	out, err := run(t)
+	if err != nil || !strings.Contains(out, "No raid variables set.") {
+		t.Errorf("bare vars: out=%q err=%v", out, err)
+	}
+}
+
+func TestVarsCmd_clearJSON(t *testing.T) {
+	setupVars(t)
+	for _, k := range []string{"A", "B"} {
+		if _, err := vars.Set(k, "x", "", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out, err := run(t, "clear", "--json")
+	if err != nil {
+		t.Fatalf("clear: %v", err)
+	}
+	var res clearResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil || res.Removed != 2 {
+		t.Errorf("clear --json = %q (err %v), want removed=2", out, err)
+	}
+	if len(vars.List()) != 0 {
+		t.Errorf("List() after clear = %+v", vars.List())
+	}
+}
+
+func TestVarsCmd_setRejectsRepoVar(t *testing.T) {
+	setupVars(t)
+	_, err := run(t, "set", "RAID_REPO_API_URL", "x")
+	if rErr, ok := errs.AsError(err); !ok || rErr.Code() != errs.CodeArgInvalid {
+		t.Errorf("set RAID_REPO_*: err=%v, want ARG_INVALID", err)
+	}
+}
+
+func TestVarsCmd_scopeSessionRejected(t *testing.T) {
+	setupVars(t)
+	for _, args := range [][]string{
+		{"set", "--scope", "session", "token", "abc"},
+		{"unset", "--scope", "Session", "token"},
+		{"clear", "--scope", "session"},
+	} {
+		_, err := run(t, args...)
+		if rErr, ok := errs.AsError(err); !ok || rErr.Code() != errs.CodeArgInvalid || !strings.Contains(err.Error(), "--scope session") {
+			t.Errorf("%s --scope session: err=%v, want ARG_INVALID", args[0], err)
+		}
+	}
+
+	_, err := run(t, "set", "--scope", "profile", "x", "1")
+	if rErr, ok := errs.AsError(err); !ok || rErr.Code() != errs.CodeArgInvalid {
+		t.Errorf("set --scope profile without a profile: err=%v, want ARG_INVALID", err)
+	}
+}
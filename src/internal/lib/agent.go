@@ -5,9 +5,10 @@ package lib
 // from the `raid://workspace/commands` resource and use it to decide
 // whether to auto-execute a command or prompt the user for approval.
 //
-// Raid never gates execution on Agent — it surfaces the hint and the
-// client implements the policy. Absence of the block is equivalent to
-// `{Safe: false}` so unannotated commands stay opt-in to automation.
+// Raid only gates execution on Agent under an enforced AgentPolicy;
+// otherwise it surfaces the hint and the client implements the policy.
+// Absence of the block is equivalent to `{Safe: false}` so unannotated
+// commands stay opt-in to automation.
 type Agent struct {
 	// Safe declares the command idempotent and side-effect free. MCP
 	// clients that respect the hint may auto-run safe commands; unsafe
@@ -19,7 +20,8 @@ type Agent struct {
 	// safety the same way across tools.
 	Reads []string `json:"reads,omitempty" yaml:"reads,omitempty"`
 	// Writes lists the paths or globs the command writes. Same
-	// semantics as Reads — informational, not enforced.
+	// semantics as Reads, except that an enforced AgentPolicy checks
+	// them against its allowed writes.
 	Writes []string `json:"writes,omitempty" yaml:"writes,omitempty"`
 	// Description is an agent-facing description of the command. When
 	// set, it overrides the command's `usage` field in the workspace
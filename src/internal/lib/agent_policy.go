@@ -0,0 +1,273 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+	"github.com/8bitalex/raid/src/internal/sys"
+)
+
+// auditLogFileName is the default audit log under ~/.raid/.
+const auditLogFileName = "audit.log"
+
+// AgentPolicy is a profile's `agentPolicy:`, which the MCP server enforces
+// on agents, unlike the advisory Agent hints it's built on. An unsafe
+// command runs only when Allow lists it, and only if every path its
+// `agent.writes` declares falls within AllowWrites. Commands matching
+// Confirm also need a confirmation token from the user. Mutating tools
+// other than raid_run_task run only when AllowTools lists them.
+//
+// Command entries are full command paths, e.g. "db migrate", and may use
+// path.Match wildcards.
+type AgentPolicy struct {
+	Allow       []string `json:"allow,omitempty"`
+	AllowWrites []string `json:"allowWrites,omitempty" yaml:"allowWrites,omitempty"`
+	Confirm     []string `json:"confirm,omitempty"`
+	AllowTools  []string `json:"allowTools,omitempty" yaml:"allowTools,omitempty"`
+	// AuditLog is where decisions are logged, ~/.raid/audit.log by
+	// default.
+	AuditLog string `json:"auditLog,omitempty" yaml:"auditLog,omitempty"`
+}
+
+// AgentPolicyDeclared reports whether the active profile declares an
+// `agentPolicy:`, which turns enforcement on without `--policy`.
+func AgentPolicyDeclared() bool {
+	ctx := loadContext()
+	return ctx != nil && ctx.Profile.AgentPolicy != nil
+}
+
+// activeAgentPolicy returns the active profile's policy, or the empty
+// policy, which allows only safe commands that declare no writes.
+func activeAgentPolicy() AgentPolicy {
+	if ctx := loadContext(); ctx != nil && ctx.Profile.AgentPolicy != nil {
+		return *ctx.Profile.AgentPolicy
+	}
+	return AgentPolicy{}
+}
+
+// CheckAgentCommand applies the active agent policy to running the
+// profile command name and every command its Run tasks reach, through
+// groups and hooks. It fails with POLICY_DENIED if any of them is denied,
+// or COMMAND_NOT_FOUND for an unknown command, and otherwise reports
+// whether any of them needs a confirmation token.
+func CheckAgentCommand(name string) (confirm bool, err error) {
+	found, ok := lookupCommand(GetCommands(), name)
+	if !ok {
+		return false, liberrs.CommandNotFound(name)
+	}
+	policy := activeAgentPolicy()
+	target := fmt.Sprintf("command '%s'", found.Name)
+	if reason := agentCommandDenial(policy, found, found.Name); reason != "" {
+		return false, liberrs.PolicyDenied(target, "it "+reason)
+	}
+	w := agentRunWalk{policy: policy, seen: map[string]bool{found.Name: true}}
+	if reason := w.command(found); reason != "" {
+		return false, liberrs.PolicyDenied(target, reason)
+	}
+	return matchesCommand(policy.Confirm, found.Name) || w.confirm, nil
+}
+
+// agentCommandDenial returns why policy denies cmd, named by label, on its
+// own, or "" if it doesn't.
+func agentCommandDenial(policy AgentPolicy, cmd Command, label string) string {
+	agent := Agent{}
+	if cmd.Agent != nil {
+		agent = *cmd.Agent
+	}
+	if !agent.Safe && !matchesCommand(policy.Allow, label) {
+		return "isn't marked agent.safe and agentPolicy.allow doesn't list it"
+	}
+	for _, w := range agent.Writes {
+		if !writeAllowed(policy.AllowWrites, w) {
+			return fmt.Sprintf("writes '%s', outside agentPolicy.allowWrites", w)
+		}
+	}
+	return ""
+}
+
+// agentRunWalk follows a command's Run tasks so the policy sees every
+// command an agent's call would run, not just the one it named. A command
+// from a repository is matched as "repo:command".
+type agentRunWalk struct {
+	policy  AgentPolicy
+	seen    map[string]bool
+	confirm bool
+}
+
+// command checks what cmd's tasks and hooks run, returning why the policy
+// denies it or "".
+func (w *agentRunWalk) command(cmd Command) string {
+	h := cmd.Hooks
+	return w.tasks(slices.Concat(h.Before, cmd.Tasks, h.After, h.OnFailure, h.Finally), nil)
+}
+
+func (w *agentRunWalk) tasks(tasks []Task, groups []string) string {
+	for _, t := range tasks {
+		var reason string
+		switch t.Type.ToLower() {
+		case Group:
+			// A cycle fails at run time; here it just ends the walk.
+			if slices.Contains(groups, t.Ref) {
+				continue
+			}
+			var group []Task
+			if ctx := loadContext(); ctx != nil {
+				group = ctx.Profile.Groups[t.Ref]
+			}
+			reason = w.tasks(group, append(slices.Clone(groups), t.Ref))
+		case Run:
+			reason = w.run(t)
+		}
+		if reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+func (w *agentRunWalk) run(t Task) string {
+	var found Command
+	var err error
+	label := strings.Join(strings.Fields(t.Command), " ")
+	if t.Repo != "" {
+		found, err = findRepoCommand(t.Repo, t.Command)
+		label = t.Repo + ":" + label
+	} else {
+		found, err = findCommand(t.Command)
+	}
+	// An unresolvable command, e.g. one named by a variable, can't be
+	// vetted, so it can't be allowed either.
+	if err != nil {
+		return fmt.Sprintf("it runs command '%s', which can't be checked: %v", label, err)
+	}
+	if t.Repo != "" {
+		label = t.Repo + ":" + found.Name
+	} else {
+		label = found.Name
+	}
+	if w.seen[label] {
+		return ""
+	}
+	w.seen[label] = true
+	if reason := agentCommandDenial(w.policy, found, label); reason != "" {
+		return fmt.Sprintf("it runs command '%s', which %s", label, reason)
+	}
+	w.confirm = w.confirm || matchesCommand(w.policy.Confirm, label)
+	return w.command(found)
+}
+
+// CheckAgentTool applies the active agent policy to calling the mutating
+// MCP tool, which must be listed in `allowTools:`.
+func CheckAgentTool(tool string) error {
+	if slices.Contains(activeAgentPolicy().AllowTools, tool) {
+		return nil
+	}
+	return liberrs.PolicyDenied(fmt.Sprintf("tool '%s'", tool), "agentPolicy.allowTools doesn't list it")
+}
+
+func matchesCommand(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// writeAllowed reports whether the path or glob w, as declared in
+// `agent.writes`, falls within one of the allowed globs. An allowed glob
+// ending in "/**" covers everything beneath its directory; any other is
+// matched with path.Match.
+func writeAllowed(allowed []string, w string) bool {
+	w = cleanPolicyPath(w)
+	for _, a := range allowed {
+		a = cleanPolicyPath(a)
+		if dir, ok := strings.CutSuffix(a, "/**"); ok {
+			if w == dir || strings.HasPrefix(w, dir+"/") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(a, w); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func cleanPolicyPath(p string) string {
+	return path.Clean(filepath.ToSlash(sys.ExpandPath(p)))
+}
+
+// AgentDecision is one line of the agent policy audit log.
+type AgentDecision struct {
+	Time     time.Time `json:"time"`
+	Profile  string    `json:"profile,omitempty"`
+	Tool     string    `json:"tool"`
+	Command  string    `json:"command,omitempty"`
+	Args     []string  `json:"args,omitempty"`
+	Decision string    `json:"decision"`
+	Reason   string    `json:"reason,omitempty"`
+	Code     string    `json:"code,omitempty"`
+	// TokenID identifies the confirmation token a confirm decision issued
+	// without revealing it: the log is readable by the agent's user, so
+	// the token itself would let an agent confirm its own request.
+	TokenID string `json:"tokenId,omitempty"`
+}
+
+// Agent policy decisions.
+const (
+	AgentDecisionAllow   = "allow"
+	AgentDecisionDeny    = "deny"
+	AgentDecisionConfirm = "confirm"
+)
+
+// AuditLogPathOverride redirects the audit log, taking precedence over
+// the profile's `auditLog:`. Tests set this; empty in production.
+var AuditLogPathOverride string
+
+var auditMu sync.Mutex
+
+// AuditAgentDecision appends d to the audit log as a line of JSON, filling
+// in its time and the active profile.
+func AuditAgentDecision(d AgentDecision) error {
+	d.Time = time.Now().UTC()
+	if ctx := loadContext(); ctx != nil {
+		d.Profile = ctx.Profile.Name
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	logPath := auditLogPath()
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+func auditLogPath() string {
+	if AuditLogPathOverride != "" {
+		return AuditLogPathOverride
+	}
+	if p := activeAgentPolicy().AuditLog; p != "" {
+		return sys.ExpandPath(p)
+	}
+	return filepath.Join(sys.GetHomeDir(), ConfigDirName, auditLogFileName)
+}
@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+)
+
+func TestCheckAgentCommand(t *testing.T) {
+	setupTestConfig(t)
+	commands := []Command{
+		{Name: "test", Agent: &Agent{Safe: true}},
+		{Name: "build", Agent: &Agent{Safe: true, Writes: []string{"./dist/app"}}},
+		{Name: "deploy"},
+		{Name: "db", Commands: []Command{{Name: "migrate"}}},
+		{Name: "ci", Agent: &Agent{Safe: true}, Tasks: []Task{{Type: Group, Ref: "release"}}},
+		{Name: "check", Agent: &Agent{Safe: true}, Hooks: Hooks{Finally: []Task{{Type: Run, Command: "test"}}}},
+		{Name: "lint", Agent: &Agent{Safe: true}, Tasks: []Task{{Type: Run, Repo: "api", Command: "lint"}}},
+		{Name: "dynamic", Agent: &Agent{Safe: true}, Tasks: []Task{{Type: Run, Command: "$TARGET"}}},
+	}
+	groups := map[string][]Task{"release": {{Type: Run, Command: "check"}, {Type: Run, Command: "deploy"}}}
+	repos := []Repo{{Name: "api", Commands: []Command{{Name: "lint", Agent: &Agent{Safe: true}}}}}
+	policy := &AgentPolicy{
+		Allow:       []string{"deploy", "db *"},
+		AllowWrites: []string{"./dist/**"},
+		Confirm:     []string{"deploy"},
+	}
+
+	tests := []struct {
+		name        string
+		policy      *AgentPolicy
+		command     string
+		wantConfirm bool
+		wantCode    string
+	}{
+		{"safe command", nil, "test", false, ""},
+		{"unsafe command", nil, "deploy", false, liberrs.CodePolicyDenied},
+		{"write outside the default policy", nil, "build", false, liberrs.CodePolicyDenied},
+		{"unknown command", nil, "nope", false, liberrs.CodeCommandNotFound},
+		{"allowed write", policy, "build", false, ""},
+		{"allowed unsafe command needing confirmation", policy, "deploy", true, ""},
+		{"allowed by wildcard", policy, "db migrate", false, ""},
+		{"safe command running an unsafe one through a group", nil, "ci", false, liberrs.CodePolicyDenied},
+		{"safe command running one needing confirmation", policy, "ci", true, ""},
+		{"safe command running a safe one from a hook", nil, "check", false, ""},
+		{"safe command running a safe repo command", nil, "lint", false, ""},
+		{"run of a command that can't be resolved", policy, "dynamic", false, liberrs.CodePolicyDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storeContext(&Context{Profile: Profile{Commands: commands, Groups: groups, Repositories: repos, AgentPolicy: tt.policy}})
+			confirm, err := CheckAgentCommand(tt.command)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("CheckAgentCommand(%q) error: %v", tt.command, err)
+				}
+			} else if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != tt.wantCode {
+				t.Fatalf("CheckAgentCommand(%q) error = %v, want %s", tt.command, err, tt.wantCode)
+			}
+			if confirm != tt.wantConfirm {
+				t.Errorf("CheckAgentCommand(%q) confirm = %v, want %v", tt.command, confirm, tt.wantConfirm)
+			}
+		})
+	}
+}
+
+func TestAuditLogPath_overrideWins(t *testing.T) {
+	setupTestConfig(t)
+	override := filepath.Join(t.TempDir(), "audit.log")
+	orig := AuditLogPathOverride
+	AuditLogPathOverride = override
+	t.Cleanup(func() { AuditLogPathOverride = orig })
+	storeContext(&Context{Profile: Profile{AgentPolicy: &AgentPolicy{AuditLog: "~/elsewhere.log"}}})
+
+	if got := auditLogPath(); got != override {
+		t.Errorf("auditLogPath() = %q, want the override %q", got, override)
+	}
+}
+
+func TestWriteAllowed(t *testing.T) {
+	allowed := []string{"./dist/**", "/tmp/*.log"}
+	tests := []struct {
+		write string
+		want  bool
+	}{
+		{"dist", true},
+		{"./dist/app/bin", true},
+		{"./dist/**", true},
+		{"/tmp/raid.log", true},
+		{"./distribution", false},
+		{"/tmp/sub/raid.log", false},
+		{"./dist/../secrets", false},
+	}
+	for _, tt := range tests {
+		if got := writeAllowed(allowed, tt.write); got != tt.want {
+			t.Errorf("writeAllowed(%q) = %v, want %v", tt.write, got, tt.want)
+		}
+	}
+}
+
+func TestAuditAgentDecision(t *testing.T) {
+	setupTestConfig(t)
+	logPath := filepath.Join(t.TempDir(), "logs", "audit.log")
+	storeContext(&Context{Profile: Profile{Name: "work", AgentPolicy: &AgentPolicy{AuditLog: logPath}}})
+
+	for _, d := range []AgentDecision{
+		{Tool: "raid_run_task", Command: "test", Decision: AgentDecisionAllow},
+		{Tool: "raid_install", Decision: AgentDecisionDeny, Code: liberrs.CodePolicyDenied},
+	} {
+		if err := AuditAgentDecision(d); err != nil {
+			t.Fatalf("AuditAgentDecision() error: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("audit log has %d lines, want 2:\n%s", len(lines), data)
+	}
+	var got AgentDecision
+	if err := json.Unmarshal([]byte(lines[1]), &got); err != nil {
+		t.Fatalf("audit line isn't JSON: %v", err)
+	}
+	if got.Profile != "work" || got.Tool != "raid_install" || got.Decision != AgentDecisionDeny || got.Time.IsZero() {
+		t.Errorf("audit entry = %+v, want the denied raid_install call in profile work, timestamped", got)
+	}
+}
@@ -0,0 +1,655 @@
+package lib
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+	"github.com/8bitalex/raid/src/internal/sys"
+)
+
+// Archive formats, as written in `format:` once normalized.
+const (
+	archiveTar   = "tar"
+	archiveTarGz = "tar.gz"
+	archiveZip   = "zip"
+	archiveGz    = "gz"
+)
+
+// maxArchiveLinkTarget caps how much of a zip symlink entry is read as
+// its target. Real targets are a path, not a payload.
+const maxArchiveLinkTarget = 4096
+
+func execArchive(task Task) error {
+	task = task.Expand()
+
+	if task.Src == "" {
+		return liberrs.ArgInvalid("src is required for Archive task")
+	}
+	if task.Dest == "" {
+		return liberrs.ArgInvalid("dest is required for Archive task")
+	}
+	if task.Strip < 0 {
+		return liberrs.ArgInvalid("strip must not be negative for Archive task")
+	}
+	for _, g := range task.Include {
+		if _, err := path.Match(g, ""); err != nil {
+			return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid include pattern '%s': %v", g, err)
+		}
+	}
+	format, err := normalizeArchiveFormat(task.Format)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(task.Op) {
+	case "extract":
+		return extractArchive(task, format)
+	case "create":
+		return createArchive(task, format)
+	case "":
+		return liberrs.ArgInvalid("op is required for Archive task")
+	default:
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid archive operation '%s' (supported: extract, create)", task.Op)
+	}
+}
+
+// normalizeArchiveFormat maps the accepted `format:` spellings onto the
+// canonical names. Empty means detect.
+func normalizeArchiveFormat(f string) (string, error) {
+	switch strings.ToLower(strings.TrimPrefix(f, ".")) {
+	case "":
+		return "", nil
+	case "tar":
+		return archiveTar, nil
+	case "tar.gz", "tgz":
+		return archiveTarGz, nil
+	case "zip":
+		return archiveZip, nil
+	case "gz", "gzip":
+		return archiveGz, nil
+	}
+	return "", liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "unsupported archive format '%s' (supported: tar, tar.gz, zip, gz)", f)
+}
+
+// archiveFormatFromName infers a format from a file name's extension.
+func archiveFormatFromName(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return archiveTarGz
+	case strings.HasSuffix(lower, ".tar"):
+		return archiveTar
+	case strings.HasSuffix(lower, ".zip"):
+		return archiveZip
+	case strings.HasSuffix(lower, ".gz"):
+		return archiveGz
+	}
+	return ""
+}
+
+// sniffArchiveFormat identifies an archive by its leading bytes, for
+// sources whose name says nothing (a download saved as "latest"). A gzip
+// stream is peeked into to tell tar.gz from a single compressed file.
+func sniffArchiveFormat(name string) string {
+	f, err := os.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return archiveZip
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return archiveGz
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return ""
+		}
+		inner := make([]byte, 512)
+		n, _ := io.ReadFull(zr, inner)
+		if isTarHeader(inner[:n]) {
+			return archiveTarGz
+		}
+		return archiveGz
+	case isTarHeader(head):
+		return archiveTar
+	}
+	return ""
+}
+
+// isTarHeader reports whether b starts with a ustar (or GNU) tar header.
+func isTarHeader(b []byte) bool {
+	return len(b) >= 262 && bytes.Equal(b[257:262], []byte("ustar"))
+}
+
+// matchArchiveInclude reports whether an entry's slash-separated path is
+// selected by the include globs: a glob matching the path itself or any
+// of its parent directories selects it. No globs selects everything.
+func matchArchiveInclude(rel string, include []string) bool {
+	if len(include) == 0 {
+		return true
+	}
+	for _, g := range include {
+		g = strings.TrimSuffix(filepath.ToSlash(g), "/")
+		for p := rel; ; p = path.Dir(p) {
+			if ok, _ := path.Match(g, p); ok {
+				return true
+			}
+			if !strings.Contains(p, "/") {
+				break
+			}
+		}
+	}
+	return false
+}
+
+// within reports whether p is root or lies beneath it.
+func within(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func extractArchive(task Task, format string) error {
+	if !sys.FileExists(task.Src) {
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "archive does not exist: %s", task.Src)
+	}
+	if format == "" {
+		format = archiveFormatFromName(task.Src)
+	}
+	if format == "" {
+		format = sniffArchiveFormat(task.Src)
+	}
+	if format == "" {
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "can't tell the archive format of '%s'; set format", task.Src)
+	}
+
+	if format == archiveGz {
+		return extractGzip(task)
+	}
+
+	if err := os.MkdirAll(task.Dest, 0755); err != nil {
+		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to create directory '%s': %v", task.Dest, err)
+	}
+	dest, err := filepath.Abs(task.Dest)
+	if err == nil {
+		dest, err = filepath.EvalSymlinks(dest)
+	}
+	if err != nil {
+		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to resolve '%s': %v", task.Dest, err)
+	}
+	x := &archiveExtractor{src: task.Src, dest: dest, strip: task.Strip, include: task.Include}
+
+	if format == archiveZip {
+		return x.extractZip()
+	}
+	f, err := os.Open(task.Src)
+	if err != nil {
+		return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to open archive '%s': %v", task.Src, err)
+	}
+	defer f.Close()
+	r := io.Reader(f)
+	if format == archiveTarGz {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to read archive '%s': %v", task.Src, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	return x.extractTar(r)
+}
+
+// extractGzip decompresses a single-file .gz archive to dest, which names
+// the output file. strip and include don't apply.
+func extractGzip(task Task) error {
+	f, err := os.Open(task.Src)
+	if err != nil {
+		return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to open archive '%s': %v", task.Src, err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to read archive '%s': %v", task.Src, err)
+	}
+	defer zr.Close()
+	if err := writeFileAtomic(task.Dest, zr, nil, 0); err != nil {
+		return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to extract '%s': %v", task.Src, err)
+	}
+	return nil
+}
+
+// archiveExtractor writes archive entries beneath dest. Every entry is
+// checked before anything touches disk: absolute names, `..` escapes,
+// symlinks pointing outside dest, and paths that would be written through
+// a symlink leading out of dest are all rejected, failing the task.
+type archiveExtractor struct {
+	src     string
+	dest    string // absolute, symlinks resolved
+	strip   int
+	include []string
+}
+
+// target maps an entry name to its path under dest after strip and
+// include. ok is false for entries filtered out.
+func (x *archiveExtractor) target(name string) (string, bool, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if path.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", false, x.unsafe(name, "has an absolute path")
+	}
+	clean := path.Clean(name)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", false, x.unsafe(name, "escapes the destination")
+	}
+	if clean == "." {
+		return "", false, nil
+	}
+	parts := strings.Split(clean, "/")
+	if len(parts) <= x.strip {
+		return "", false, nil
+	}
+	rel := strings.Join(parts[x.strip:], "/")
+	if !matchArchiveInclude(rel, x.include) {
+		return "", false, nil
+	}
+	return filepath.Join(x.dest, filepath.FromSlash(rel)), true, nil
+}
+
+func (x *archiveExtractor) unsafe(name, why string) error {
+	return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "refusing to extract '%s' from '%s': entry %s", name, x.src, why)
+}
+
+// prepare creates p's parent directory and confirms it really is inside
+// dest once symlinks already on disk are followed. Anything at p that
+// isn't a directory is removed, so a file entry never writes through an
+// existing symlink.
+func (x *archiveExtractor) prepare(p, name string) (string, error) {
+	parent := filepath.Dir(p)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to create directory '%s': %v", parent, err)
+	}
+	resolved, err := filepath.EvalSymlinks(parent)
+	if err != nil {
+		return "", liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to resolve '%s': %v", parent, err)
+	}
+	if !within(x.dest, resolved) {
+		return "", x.unsafe(name, "is reached through a symlink outside the destination")
+	}
+	if fi, err := os.Lstat(p); err == nil && !fi.IsDir() {
+		if err := os.Remove(p); err != nil {
+			return "", liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to replace '%s': %v", p, err)
+		}
+	}
+	return resolved, nil
+}
+
+func (x *archiveExtractor) dir(p, name string) error {
+	if _, err := x.prepare(p, name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(p, 0755); err != nil {
+		return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to create directory '%s': %v", p, err)
+	}
+	return nil
+}
+
+func (x *archiveExtractor) file(p, name string, r io.Reader, mode fs.FileMode) error {
+	if _, err := x.prepare(p, name); err != nil {
+		return err
+	}
+	mode = mode.Perm()
+	if mode == 0 {
+		mode = 0644
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to create '%s': %v", p, err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to extract '%s' from '%s': %v", name, x.src, err)
+	}
+	if err := f.Close(); err != nil {
+		return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to write '%s': %v", p, err)
+	}
+	// OpenFile's mode is filtered by the umask; the archive's bits win.
+	if err := os.Chmod(p, mode); err != nil {
+		return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to set mode on '%s': %v", p, err)
+	}
+	return nil
+}
+
+func (x *archiveExtractor) symlink(p, name, linkname string) error {
+	parent, err := x.prepare(p, name)
+	if err != nil {
+		return err
+	}
+	if filepath.IsAbs(linkname) || path.IsAbs(filepath.ToSlash(linkname)) {
+		return x.unsafe(name, "is a symlink to an absolute path")
+	}
+	if !within(x.dest, filepath.Join(parent, filepath.FromSlash(linkname))) {
+		return x.unsafe(name, "is a symlink pointing outside the destination")
+	}
+	if err := os.Symlink(linkname, p); err != nil {
+		return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to create symlink '%s': %v", p, err)
+	}
+	// The lexical check can't see through links created earlier in the
+	// archive; when the target already exists, check where it really is.
+	if resolved, err := filepath.EvalSymlinks(p); err == nil && !within(x.dest, resolved) {
+		os.Remove(p)
+		return x.unsafe(name, "is a symlink pointing outside the destination")
+	}
+	return nil
+}
+
+func (x *archiveExtractor) extractTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to read archive '%s': %v", x.src, err)
+		}
+		p, ok, err := x.target(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = x.dir(p, hdr.Name)
+		case tar.TypeReg:
+			err = x.file(p, hdr.Name, tr, hdr.FileInfo().Mode())
+		case tar.TypeSymlink:
+			err = x.symlink(p, hdr.Name, hdr.Linkname)
+		case tar.TypeLink:
+			err = x.hardlink(p, hdr.Name, hdr.Linkname)
+		default:
+			// Devices, FIFOs and the like have no place in a dev setup.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// hardlink links p to an entry extracted earlier. A link to an entry that
+// strip or include filtered out is skipped along with it.
+func (x *archiveExtractor) hardlink(p, name, linkname string) error {
+	old, ok, err := x.target(linkname)
+	if err != nil || !ok {
+		return err
+	}
+	if _, err := x.prepare(p, name); err != nil {
+		return err
+	}
+	if resolved, err := filepath.EvalSymlinks(old); err != nil || !within(x.dest, resolved) {
+		return x.unsafe(name, "is a hard link to a file outside the destination")
+	}
+	if err := os.Link(old, p); err != nil {
+		return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to create link '%s': %v", p, err)
+	}
+	return nil
+}
+
+func (x *archiveExtractor) extractZip() error {
+	zr, err := zip.OpenReader(x.src)
+	if err != nil {
+		return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to read archive '%s': %v", x.src, err)
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		p, ok, err := x.target(f.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := x.zipEntry(f, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *archiveExtractor) zipEntry(f *zip.File, p string) error {
+	mode := f.Mode()
+	if mode.IsDir() || strings.HasSuffix(f.Name, "/") {
+		return x.dir(p, f.Name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to read '%s' from '%s': %v", f.Name, x.src, err)
+	}
+	defer rc.Close()
+	if mode&fs.ModeSymlink != 0 {
+		target, err := io.ReadAll(io.LimitReader(rc, maxArchiveLinkTarget))
+		if err != nil {
+			return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to read '%s' from '%s': %v", f.Name, x.src, err)
+		}
+		return x.symlink(p, f.Name, string(target))
+	}
+	return x.file(p, f.Name, rc, mode)
+}
+
+// archiveEntry is one file, directory, or symlink going into a created
+// archive, named by its slash-separated path inside it.
+type archiveEntry struct {
+	name string
+	path string
+	info fs.FileInfo
+}
+
+func createArchive(task Task, format string) error {
+	if format == "" {
+		format = archiveFormatFromName(task.Dest)
+	}
+	if format == "" {
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "can't tell the archive format from '%s'; set format", task.Dest)
+	}
+	info, err := os.Stat(task.Src)
+	if err != nil {
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "archive source does not exist: %s", task.Src)
+	}
+	if format == archiveGz && info.IsDir() {
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "gz holds a single file; use tar.gz to archive directory '%s'", task.Src)
+	}
+	entries, err := collectArchiveEntries(task.Src, info, task.Dest, task.Include)
+	if err != nil {
+		return err
+	}
+
+	// Stream the archive into writeFileAtomic's temp-file-and-rename so a
+	// failed run never leaves a truncated archive at dest.
+	pr, pw := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		err := writeArchive(pw, format, task.Src, info, entries)
+		pw.CloseWithError(err)
+		errc <- err
+	}()
+	destErr := writeFileAtomic(task.Dest, pr, nil, 0)
+	pr.CloseWithError(destErr)
+	if err := <-errc; err != nil && (destErr == nil || !errors.Is(err, destErr)) {
+		return liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to create archive '%s': %v", task.Dest, err)
+	}
+	return destErr
+}
+
+func writeArchive(w io.Writer, format, src string, info fs.FileInfo, entries []archiveEntry) error {
+	switch format {
+	case archiveTar:
+		return writeTar(w, entries)
+	case archiveTarGz:
+		zw := gzip.NewWriter(w)
+		if err := writeTar(zw, entries); err != nil {
+			return err
+		}
+		return zw.Close()
+	case archiveZip:
+		return writeZip(w, entries)
+	default:
+		return writeGzip(w, src, info)
+	}
+}
+
+// collectArchiveEntries lists what goes into an archive of src: src
+// itself when it's a file, otherwise everything beneath it named relative
+// to it. dest is skipped so archiving into the source tree doesn't
+// include a previous run's output.
+func collectArchiveEntries(src string, info fs.FileInfo, dest string, include []string) ([]archiveEntry, error) {
+	if !info.IsDir() {
+		name := filepath.Base(src)
+		if !matchArchiveInclude(name, include) {
+			return nil, nil
+		}
+		return []archiveEntry{{name: name, path: src, info: info}}, nil
+	}
+
+	destAbs, _ := filepath.Abs(dest)
+	var entries []archiveEntry
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		if abs, _ := filepath.Abs(p); abs == destAbs {
+			return nil
+		}
+		name := filepath.ToSlash(rel)
+		if !matchArchiveInclude(name, include) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, archiveEntry{name: name, path: p, info: fi})
+		return nil
+	})
+	if err != nil {
+		return nil, liberrs.Newf(liberrs.CodeTaskArchiveFailed, liberrs.CategoryTask, "failed to read '%s': %v", src, err)
+	}
+	return entries, nil
+}
+
+func writeTar(w io.Writer, entries []archiveEntry) error {
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		link := ""
+		switch {
+		case e.info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(e.path)
+			if err != nil {
+				return err
+			}
+			link = target
+		case !e.info.IsDir() && !e.info.Mode().IsRegular():
+			continue
+		}
+		hdr, err := tar.FileInfoHeader(e.info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = e.name
+		if e.info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if e.info.Mode().IsRegular() {
+			if err := copyFileTo(tw, e.path); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+func writeZip(w io.Writer, entries []archiveEntry) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		mode := e.info.Mode()
+		if !e.info.IsDir() && !mode.IsRegular() && mode&fs.ModeSymlink == 0 {
+			continue
+		}
+		hdr, err := zip.FileInfoHeader(e.info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = e.name
+		if e.info.IsDir() {
+			hdr.Name += "/"
+		} else {
+			hdr.Method = zip.Deflate
+		}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		switch {
+		case mode&fs.ModeSymlink != 0:
+			target, err := os.Readlink(e.path)
+			if err != nil {
+				return err
+			}
+			if _, err := io.WriteString(fw, target); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			if err := copyFileTo(fw, e.path); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+func writeGzip(w io.Writer, src string, info fs.FileInfo) error {
+	zw := gzip.NewWriter(w)
+	zw.Name = info.Name()
+	zw.ModTime = info.ModTime()
+	if err := copyFileTo(zw, src); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func copyFileTo(w io.Writer, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package lib
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+)
+
+// writeArchiveTree lays out a small source tree for create round trips.
+func writeArchiveTree(t *testing.T) string {
+	t.Helper()
+	src := filepath.Join(t.TempDir(), "pkg")
+	files := map[string]string{
+		"bin/tool":     "#!/bin/sh\n",
+		"README.md":    "readme",
+		"docs/a.md":    "a",
+		"docs/b.txt":   "b",
+		"package.json": "{}",
+	}
+	for name, body := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Chmod(filepath.Join(src, "bin", "tool"), 0o755)
+	return src
+}
+
+// writeTarGz builds a tar.gz from raw headers, for entries no well-behaved
+// tool would write.
+func writeTarGz(t *testing.T, name string, hdrs []*tar.Header) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	for _, h := range hdrs {
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(h.Name))
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			tw.Write([]byte(h.Name))
+		}
+	}
+	tw.Close()
+	zw.Close()
+}
+
+func TestExecuteTask_archiveRoundTrip(t *testing.T) {
+	for _, ext := range []string{"tar.gz", "tar", "zip"} {
+		t.Run(ext, func(t *testing.T) {
+			src := writeArchiveTree(t)
+			archive := filepath.Join(t.TempDir(), "pkg."+ext)
+			if err := ExecuteTask(Task{Type: Archive, Op: "create", Src: src, Dest: archive}); err != nil {
+				t.Fatalf("create error: %v", err)
+			}
+
+			out := t.TempDir()
+			if err := ExecuteTask(Task{Type: Archive, Op: "extract", Src: archive, Dest: out}); err != nil {
+				t.Fatalf("extract error: %v", err)
+			}
+			if got, _ := os.ReadFile(filepath.Join(out, "docs", "a.md")); string(got) != "a" {
+				t.Errorf("docs/a.md = %q, want a", got)
+			}
+			if runtime.GOOS != "windows" {
+				if fi, err := os.Stat(filepath.Join(out, "bin", "tool")); err != nil || fi.Mode().Perm() != 0o755 {
+					t.Errorf("bin/tool = %v, %v; want mode 0755 preserved", fi, err)
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteTask_archiveStripAndInclude(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "release")
+	writeTarGz(t, archive, []*tar.Header{
+		{Name: "tool-1.0/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "tool-1.0/bin/tool", Typeflag: tar.TypeReg, Mode: 0o755},
+		{Name: "tool-1.0/docs/a.md", Typeflag: tar.TypeReg, Mode: 0o644},
+		{Name: "tool-1.0/LICENSE", Typeflag: tar.TypeReg, Mode: 0o644},
+	})
+
+	// No extension: the format is sniffed from the content.
+	out := t.TempDir()
+	task := Task{Type: Archive, Op: "extract", Src: archive, Dest: out, Strip: 1, Include: []string{"bin", "LICENSE"}}
+	if err := ExecuteTask(task); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(out, "bin", "tool")); string(got) != "tool-1.0/bin/tool" {
+		t.Errorf("bin/tool = %q, want the stripped entry", got)
+	}
+	if _, err := os.Stat(filepath.Join(out, "LICENSE")); err != nil {
+		t.Errorf("LICENSE not extracted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "docs")); !os.IsNotExist(err) {
+		t.Errorf("docs extracted despite include; stat err = %v", err)
+	}
+}
+
+func TestExecuteTask_archiveRejectsUnsafeEntries(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlink entries need POSIX symlinks")
+	}
+	tests := []struct {
+		name string
+		hdrs []*tar.Header
+	}{
+		{"dot-dot", []*tar.Header{{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0o644}}},
+		{"absolute", []*tar.Header{{Name: "/tmp/evil", Typeflag: tar.TypeReg, Mode: 0o644}}},
+		{"symlink out", []*tar.Header{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../.."}}},
+		{"absolute symlink", []*tar.Header{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"}}},
+		{"write through symlink", []*tar.Header{
+			{Name: "here", Typeflag: tar.TypeSymlink, Linkname: "."},
+			{Name: "up", Typeflag: tar.TypeSymlink, Linkname: "here/.."},
+			{Name: "up/evil", Typeflag: tar.TypeReg, Mode: 0o644},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			archive := filepath.Join(root, "bad.tar.gz")
+			writeTarGz(t, archive, tt.hdrs)
+			out := filepath.Join(root, "out")
+
+			err := ExecuteTask(Task{Type: Archive, Op: "extract", Src: archive, Dest: out})
+			rErr, ok := liberrs.AsError(err)
+			if !ok || rErr.Code() != liberrs.CodeTaskArchiveFailed {
+				t.Fatalf("error = %v, want TASK_ARCHIVE_FAILED", err)
+			}
+			if _, err := os.Stat(filepath.Join(root, "evil")); !os.IsNotExist(err) {
+				t.Error("entry escaped the destination")
+			}
+		})
+	}
+}
+
+func TestExecuteTask_archiveGz(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "dump.sql")
+	os.WriteFile(src, []byte("select 1;"), 0o644)
+
+	if err := ExecuteTask(Task{Type: Archive, Op: "create", Src: src, Dest: src + ".gz"}); err != nil {
+		t.Fatalf("create error: %v", err)
+	}
+	out := filepath.Join(dir, "restored", "dump.sql")
+	if err := ExecuteTask(Task{Type: Archive, Op: "extract", Src: src + ".gz", Dest: out}); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if got, _ := os.ReadFile(out); string(got) != "select 1;" {
+		t.Errorf("restored = %q, want the original", got)
+	}
+
+	if err := ExecuteTask(Task{Type: Archive, Op: "create", Src: dir, Dest: filepath.Join(dir, "all.gz")}); err == nil {
+		t.Error("gz of a directory accepted")
+	}
+}
+
+func TestExecuteTask_archiveConfigErrors(t *testing.T) {
+	src := writeArchiveTree(t)
+	for _, task := range []Task{
+		{Type: Archive, Src: src, Dest: "x.zip"},
+		{Type: Archive, Op: "list", Src: src, Dest: "x.zip"},
+		{Type: Archive, Op: "create", Src: src, Dest: "x.rar"},
+		{Type: Archive, Op: "create", Src: src, Dest: "x", Format: "rar"},
+		{Type: Archive, Op: "extract", Src: src, Dest: "x", Strip: -1},
+		{Type: Archive, Op: "create", Src: src, Dest: "x.zip", Include: []string{"["}},
+	} {
+		err := ExecuteTask(task)
+		if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeArgInvalid {
+			t.Errorf("ExecuteTask(%+v) = %v, want ARG_INVALID", task, err)
+		}
+	}
+}
+
+func TestMatchArchiveInclude(t *testing.T) {
+	tests := []struct {
+		rel     string
+		include []string
+		want    bool
+	}{
+		{"a/b/c", nil, true},
+		{"bin/tool", []string{"bin"}, true},
+		{"bin/tool", []string{"bin/"}, true},
+		{"bin/tool", []string{"*.md"}, false},
+		{"README.md", []string{"*.md"}, true},
+		{"docs/a.md", []string{"*.md"}, false},
+		{"docs/a.md", []string{"docs/*.md"}, true},
+	}
+	for _, tt := range tests {
+		if got := matchArchiveInclude(tt.rel, tt.include); got != tt.want {
+			t.Errorf("matchArchiveInclude(%q, %q) = %v, want %v", tt.rel, tt.include, got, tt.want)
+		}
+	}
+	if !strings.HasSuffix(archiveFormatFromName("X.TGZ"), "tar.gz") {
+		t.Error("archiveFormatFromName ignores case")
+	}
+}
@@ -3,10 +3,14 @@ package lib
 import (
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
@@ -27,29 +31,90 @@ type Command struct {
 	// commands keep their "requires confirmation" semantics.
 	Agent *Agent  `json:"agent,omitempty"`
 	Out   *Output `json:"out,omitempty"`
+	// Requires lists variables that must be set before any task runs.
+	// Checked after args and flags are bound, so a requirement can be
+	// satisfied by a declared arg of the same name.
+	Requires []Requirement `json:"requires,omitempty"`
+	// Commands are child commands, invoked as 'raid <name> <child>'. A
+	// command with children and no tasks is a namespace that only groups
+	// them.
+	Commands []Command `json:"commands,omitempty"`
+	// Aliases are alternative names the command can be invoked by.
+	Aliases []string `json:"aliases,omitempty"`
+	// Hidden keeps the command out of `raid --help` while it stays
+	// runnable.
+	Hidden bool `json:"hidden,omitempty"`
+	// Deprecated, when set, is printed whenever the command is run and
+	// hides it from `raid --help`, e.g. "use setup".
+	Deprecated string `json:"deprecated,omitempty"`
+	// Env is exported into the command's session before its requires are
+	// checked, each value expanded once.
+	Env map[string]string `json:"env,omitempty"`
+	// Dir is the default working directory for the command's tasks, and
+	// what their relative paths resolve against. A relative Dir resolves
+	// against the repository for repo commands and the home directory
+	// otherwise.
+	Dir string `json:"dir,omitempty"`
+	// Shell is the default shell for the command's Shell and Service
+	// tasks.
+	Shell string `json:"shell,omitempty"`
+	// Hooks are tasks run before and after the command's tasks, on
+	// failure, and finally in any case.
+	Hooks `yaml:",inline"`
+	// Exclusive keeps two runs of the command from overlapping, across
+	// raid processes, by holding a lock named after it while it runs.
+	Exclusive bool `json:"exclusive,omitempty"`
+	// Lock names the lock the command holds while it runs, which commands
+	// that mustn't overlap each other share. It implies Exclusive.
+	Lock string `json:"lock,omitempty"`
+	// LockWait makes a run wait for a held lock rather than fail with
+	// COMMAND_LOCKED.
+	LockWait bool `json:"lockWait,omitempty" yaml:"lockWait,omitempty"`
+
+	// baseDir is the repository or home directory the command was loaded
+	// for, stamped by applyCommandDir.
+	baseDir string
 }
 
 // Arg declares a positional argument for a custom command. The supplied value
 // is bound to the env var named after Name (uppercased) for the duration of
 // the command, so tasks can reference it as `$NAME`. Required args without a
 // matching positional value cause cobra to reject the invocation.
+//
+// Type is one of "string" (default), "int", "duration", "path", or "list".
+// A list arg must be the last one; it takes every remaining value and binds
+// them comma-separated. Choices, Pattern, Min and Max are checked before
+// any task runs; see checkCommandValues.
 type Arg struct {
-	Name     string `json:"name"`
-	Usage    string `json:"usage,omitempty"`
-	Required bool   `json:"required,omitempty"`
+	Name     string      `json:"name"`
+	Usage    string      `json:"usage,omitempty"`
+	Required bool        `json:"required,omitempty"`
+	Type     string      `json:"type,omitempty"`
+	Choices  []string    `json:"choices,omitempty"`
+	Pattern  string      `json:"pattern,omitempty"`
+	Min      *float64    `json:"min,omitempty"`
+	Max      *float64    `json:"max,omitempty"`
+	Complete *Completion `json:"complete,omitempty"`
 }
 
 // Flag declares a long-form (--name) and optional short-form (-x) flag for a
-// custom command. Type is one of "string" (default), "bool", or "int".
-// Required flags are enforced by cobra. Default supplies the value when the
-// flag is omitted; bool flags default to false unless overridden.
+// custom command. Type is one of "string" (default), "bool", "int",
+// "duration", "path", or "list"; a list flag can be repeated or given
+// comma-separated values. Required flags are enforced by cobra. Default
+// supplies the value when the flag is omitted; bool flags default to false
+// unless overridden. The remaining fields work as they do on Arg.
 type Flag struct {
-	Name     string `json:"name"`
-	Short    string `json:"short,omitempty"`
-	Usage    string `json:"usage,omitempty"`
-	Type     string `json:"type,omitempty"`
-	Required bool   `json:"required,omitempty"`
-	Default  any    `json:"default,omitempty"`
+	Name     string      `json:"name"`
+	Short    string      `json:"short,omitempty"`
+	Usage    string      `json:"usage,omitempty"`
+	Type     string      `json:"type,omitempty"`
+	Required bool        `json:"required,omitempty"`
+	Default  any         `json:"default,omitempty"`
+	Choices  []string    `json:"choices,omitempty"`
+	Pattern  string      `json:"pattern,omitempty"`
+	Min      *float64    `json:"min,omitempty"`
+	Max      *float64    `json:"max,omitempty"`
+	Complete *Completion `json:"complete,omitempty"`
 }
 
 // Output configures how a command's task output is handled.
@@ -90,15 +155,13 @@ func GetRepos() []Repo {
 // var with the key uppercased — this is how cobra-parsed named arguments and
 // flags reach task scripts. All bindings are unset after the command exits.
 func ExecuteCommand(name string, args []string, named map[string]string) error {
-	var found Command
-	for _, cmd := range GetCommands() {
-		if cmd.Name == name {
-			found = cmd
-			break
-		}
+	found, err := findCommand(name)
+	if err != nil {
+		return err
 	}
-	if found.IsZero() {
-		return liberrs.CommandNotFound(name)
+	found = withCommandCallStack(found, nil, []string{found.Name})
+	if named, err = checkCommandValues(found, found.Name, args, named); err != nil {
+		return err
 	}
 
 	cleanup := setCommandArgs(args, named)
@@ -106,17 +169,71 @@ func ExecuteCommand(name string, args []string, named map[string]string) error {
 
 	startSession()
 	defer endSession()
+	exportCommandEnv(found)
 
+	if err := checkRequirements(fmt.Sprintf("command '%s'", found.Name), profileRequirements(), found.Requires); err != nil {
+		return err
+	}
+
+	vars := map[string]string{"COMMAND": found.Name}
+	if err := runLifecycleHook(hookPreCommand, vars); err != nil {
+		return err
+	}
 	startedAt := RecordRecentStart(found.Name)
-	err := runCommand(found)
+	err = runLockedCommand(found, found.Name, nil)
 	RecordRecentEnd(found.Name, err, startedAt)
 	captureCommandTelemetry(found, err, time.Since(startedAt))
-	return err
+	return runPostHook(hookPostCommand, vars, err)
 }
 
 // ExecuteRepoCommand runs a command defined in a specific repository's raid.yaml.
 // See ExecuteCommand for how `args` and `named` are bound to env vars.
 func ExecuteRepoCommand(repoName, cmdName string, args []string, named map[string]string) error {
+	found, err := findRepoCommand(repoName, cmdName)
+	if err != nil {
+		return err
+	}
+	recentName := repoName + ":" + found.Name
+	found = withCommandCallStack(found, nil, []string{recentName})
+	if named, err = checkCommandValues(found, recentName, args, named); err != nil {
+		return err
+	}
+
+	cleanup := setCommandArgs(args, named)
+	defer cleanup()
+
+	startSession()
+	defer endSession()
+	exportCommandEnv(found)
+
+	if err := checkRequirements(fmt.Sprintf("command '%s'", recentName), profileRequirements(), found.Requires); err != nil {
+		return err
+	}
+
+	vars := map[string]string{"COMMAND": found.Name, "REPO": repoName}
+	if err := runLifecycleHook(hookPreCommand, vars); err != nil {
+		return err
+	}
+	startedAt := RecordRecentStart(recentName)
+	err = runLockedCommand(found, recentName, nil)
+	RecordRecentEnd(recentName, err, startedAt)
+	captureCommandTelemetry(found, err, time.Since(startedAt))
+	return runPostHook(hookPostCommand, vars, err)
+}
+
+// findCommand returns the active profile's command called name. Nested
+// commands are named by their space-separated path, e.g. "db migrate".
+func findCommand(name string) (Command, error) {
+	found, ok := lookupCommand(GetCommands(), name)
+	if !ok {
+		return Command{}, liberrs.CommandNotFound(name)
+	}
+	return found, checkRunnable(found)
+}
+
+// findRepoCommand returns the command called cmdName in repoName's
+// raid.yaml.
+func findRepoCommand(repoName, cmdName string) (Command, error) {
 	repos := GetRepos()
 	var repo *Repo
 	for i := range repos {
@@ -126,32 +243,329 @@ func ExecuteRepoCommand(repoName, cmdName string, args []string, named map[strin
 		}
 	}
 	if repo == nil {
-		return liberrs.RepoNotFound(repoName)
+		return Command{}, liberrs.RepoNotFound(repoName)
+	}
+	found, ok := lookupCommand(repo.Commands, cmdName)
+	if !ok {
+		return Command{}, liberrs.Newf(liberrs.CodeCommandNotFound, liberrs.CategoryNotFound, "command '%s' not found in repository '%s'", cmdName, repoName)
 	}
+	return found, checkRunnable(found)
+}
 
-	var found Command
-	for _, cmd := range repo.Commands {
-		if cmd.Name == cmdName {
-			found = cmd
-			break
+// lookupCommand resolves a space-separated command path against cmds. Each
+// segment matches a command's name or, failing that, one of its aliases.
+// The returned command's Name is the canonical full path.
+func lookupCommand(cmds []Command, path string) (Command, bool) {
+	parts := strings.Fields(path)
+	if len(parts) == 0 {
+		return Command{}, false
+	}
+	names := make([]string, 0, len(parts))
+	for i, part := range parts {
+		idx := slices.IndexFunc(cmds, func(c Command) bool { return c.Name == part })
+		if idx < 0 {
+			idx = slices.IndexFunc(cmds, func(c Command) bool { return slices.Contains(c.Aliases, part) })
+		}
+		if idx < 0 {
+			return Command{}, false
+		}
+		names = append(names, cmds[idx].Name)
+		if i == len(parts)-1 {
+			found := cmds[idx]
+			found.Name = strings.Join(names, " ")
+			return found, true
 		}
+		cmds = cmds[idx].Commands
+	}
+	return Command{}, false
+}
+
+// checkRunnable rejects a namespace that has child commands but no tasks
+// of its own, naming the children so the caller knows what to run instead.
+func checkRunnable(cmd Command) error {
+	if len(cmd.Tasks) > 0 || len(cmd.Commands) == 0 {
+		return nil
 	}
-	if found.IsZero() {
-		return liberrs.Newf(liberrs.CodeCommandNotFound, liberrs.CategoryNotFound, "command '%s' not found in repository '%s'", cmdName, repoName)
+	names := make([]string, len(cmd.Commands))
+	for i, c := range cmd.Commands {
+		names[i] = cmd.Name + " " + c.Name
 	}
+	return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "command '%s' is a namespace; run one of: %s", cmd.Name, strings.Join(names, ", "))
+}
 
-	cleanup := setCommandArgs(args, named)
+// walkCommands calls fn for every command in cmds and their descendants,
+// depth first, with each command's Name set to its full path.
+func walkCommands(cmds []Command, fn func(Command)) {
+	for _, cmd := range cmds {
+		walkNested(cmd, fn)
+	}
+}
+
+func walkNested(cmd Command, fn func(Command)) {
+	fn(cmd)
+	for _, child := range cmd.Commands {
+		child.Name = cmd.Name + " " + child.Name
+		walkNested(child, fn)
+	}
+}
+
+// applyCommandDir records dir as the base directory of cmds and all of
+// their children, in place, and applies withDefaultDir to the tasks of
+// those without a `dir:`; applyCommandDefaults applies theirs at run time.
+func applyCommandDir(cmds []Command, dir string) {
+	for i := range cmds {
+		cmds[i].baseDir = dir
+		if cmds[i].Dir == "" {
+			cmds[i].Tasks = withDefaultDir(cmds[i].Tasks, dir)
+			cmds[i].Hooks = cmds[i].Hooks.mapTasks(func(ts []Task) []Task { return withDefaultDir(ts, dir) })
+		}
+		applyCommandDir(cmds[i].Commands, dir)
+	}
+}
+
+// exportCommandEnv exports cmd's env into the active session. Called as
+// soon as the command's session starts, so its `requires:` and pre-command
+// hook already see it.
+func exportCommandEnv(cmd Command) {
+	if len(cmd.Env) == 0 || commandSession == nil {
+		return
+	}
+	env := expandRaidMap(cmd.Env)
+	commandSession.mu.Lock()
+	maps.Copy(commandSession.vars, env)
+	commandSession.mu.Unlock()
+}
+
+// applyCommandDefaults returns cmd with its dir and shell applied to its
+// tasks and hooks. A task's own path and shell win; relative paths
+// resolve against the dir.
+func applyCommandDefaults(cmd Command) Command {
+	if cmd.Dir == "" && cmd.Shell == "" {
+		return cmd
+	}
+
+	dir := ""
+	if cmd.Dir != "" {
+		dir = expandRaid(cmd.Dir)
+		if cmd.baseDir != "" && !filepath.IsAbs(dir) && !strings.HasPrefix(dir, "~") {
+			dir = filepath.Join(cmd.baseDir, dir)
+		}
+		dir = sys.ExpandPath(dir)
+	}
+	apply := func(tasks []Task) []Task { return commandTaskDefaults(tasks, dir, cmd.Shell) }
+	cmd.Tasks = apply(cmd.Tasks)
+	cmd.Hooks = cmd.Hooks.mapTasks(apply)
+	return cmd
+}
+
+// commandTaskDefaults returns a copy of tasks with a command's resolved
+// dir and shell applied.
+func commandTaskDefaults(in []Task, dir, shell string) []Task {
+	tasks := make([]Task, len(in))
+	for i, t := range in {
+		typ := t.Type.ToLower()
+		if dir != "" {
+			t.dir = dir
+			if (typ == Shell || typ == Service || typ == Container || typ == Git) && t.Path == "" {
+				t.Path = dir
+			}
+		}
+		if shell != "" && (typ == Shell || typ == Service) && t.Shell == "" {
+			t.Shell = shell
+		}
+		tasks[i] = t
+	}
+	return tasks
+}
+
+// execRun runs another command from the active profile, or from a
+// repository's raid.yaml when repo is set, with the task's args and flags
+// bound the way the CLI binds them. It runs under the caller's mutation
+// lock; the caller's args are restored when it returns.
+func execRun(task Task) error {
+	task = task.Expand()
+	if task.Command == "" {
+		return liberrs.ArgInvalid("command is required for Run task")
+	}
+	if task.Concurrent {
+		// Args are bound in the process environment, so two commands
+		// running at once would see each other's.
+		return liberrs.ArgInvalid("Run tasks can't be concurrent")
+	}
+	// Normalized the way lookupCommand names nested commands, so the
+	// cycle check matches however the path was spaced.
+	label := strings.Join(strings.Fields(task.Command), " ")
+	if task.Repo != "" {
+		label = task.Repo + ":" + label
+	}
+	// Same guard as execGroup: a command that (transitively) runs itself
+	// would otherwise recurse until the stack is exhausted.
+	if slices.Contains(task.runStack, label) {
+		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask,
+			"command cycle detected: %s", strings.Join(append(task.runStack, label), " -> "))
+	}
+
+	var found Command
+	var err error
+	if task.Repo != "" {
+		found, err = findRepoCommand(task.Repo, task.Command)
+	} else {
+		found, err = findCommand(task.Command)
+	}
+	if err != nil {
+		return err
+	}
+	named, err := bindRunValues(found, label, task.Args, task.Flags)
+	if err != nil {
+		return err
+	}
+	if named, err = checkCommandValues(found, label, task.Args, named); err != nil {
+		return err
+	}
+	found = withCommandCallStack(found, task.groupStack, append(append([]string(nil), task.runStack...), label))
+
+	cleanup := setCommandArgs(task.Args, named)
 	defer cleanup()
 
+	// The command gets its own session, as it would from the CLI, so its
+	// Shell exports, which include its args, don't outlive it.
+	parentSession := commandSession
 	startSession()
-	defer endSession()
+	defer func() { commandSession = parentSession }()
+	exportCommandEnv(found)
 
-	recentName := repoName + ":" + found.Name
-	startedAt := RecordRecentStart(recentName)
-	err := runCommand(found)
-	RecordRecentEnd(recentName, err, startedAt)
-	captureCommandTelemetry(found, err, time.Since(startedAt))
-	return err
+	if err := checkRequirements(fmt.Sprintf("command '%s'", label), found.Requires); err != nil {
+		return err
+	}
+	return runLockedCommand(found, label, task.commandLocks)
+}
+
+// withCommandCallStack applies withCallStack to cmd's tasks and hooks.
+func withCommandCallStack(cmd Command, groupStack, runStack []string) Command {
+	stamp := func(tasks []Task) []Task { return withCallStack(tasks, groupStack, runStack) }
+	cmd.Tasks = stamp(cmd.Tasks)
+	cmd.Hooks = cmd.Hooks.mapTasks(stamp)
+	return cmd
+}
+
+// withCallStack returns a copy of tasks stamped with the group and command
+// chains that led to them, for execGroup and execRun to detect cycles.
+// The slice is shared cached-profile state, so it's never stamped in place.
+func withCallStack(tasks []Task, groupStack, runStack []string) []Task {
+	out := make([]Task, len(tasks))
+	for i, t := range tasks {
+		t.groupStack = groupStack
+		t.runStack = runStack
+		out[i] = t
+	}
+	return out
+}
+
+// bindRunValues builds the named values a Run task hands cmd, the way
+// gatherCommandValues does for the CLI: declared args by position, and
+// every declared flag, from the task or else its default. Checks the
+// constraints cobra would otherwise enforce.
+func bindRunValues(cmd Command, label string, args []string, flags map[string]any) (map[string]string, error) {
+	required := 0
+	for _, a := range cmd.Args {
+		if a.Required {
+			required++
+		}
+	}
+	if len(args) < required || (len(cmd.Args) > 0 && !variadicArg(cmd) && len(args) > len(cmd.Args)) {
+		if variadicArg(cmd) {
+			return nil, liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig,
+				"command '%s' takes at least %d args, got %d", label, required, len(args))
+		}
+		return nil, liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig,
+			"command '%s' takes %d to %d args, got %d", label, required, len(cmd.Args), len(args))
+	}
+	for name := range flags {
+		if !slices.ContainsFunc(cmd.Flags, func(f Flag) bool { return f.Name == name }) {
+			return nil, liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "command '%s' has no flag '%s'", label, name)
+		}
+	}
+	if len(cmd.Args) == 0 && len(cmd.Flags) == 0 {
+		return nil, nil
+	}
+
+	out := make(map[string]string, len(cmd.Args)+len(cmd.Flags))
+	for i, a := range cmd.Args {
+		switch {
+		case i >= len(args):
+		case a.Type == valueTypeList:
+			out[a.Name] = strings.Join(args[i:], listSeparator)
+		default:
+			out[a.Name] = args[i]
+		}
+	}
+	for _, f := range cmd.Flags {
+		v, set := flags[f.Name]
+		if !set {
+			if f.Required {
+				return nil, liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "command '%s' requires flag '%s'", label, f.Name)
+			}
+			v = f.Default
+		}
+		s, err := formatFlagValue(f, v)
+		if err != nil {
+			return nil, liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid value for flag '%s' of command '%s': %v", f.Name, label, err)
+		}
+		out[f.Name] = s
+	}
+	return out, nil
+}
+
+// formatFlagValue renders a flag value from YAML or JSON as the CLI would
+// bind it: bools as true/false, ints in decimal, lists comma-separated. A
+// nil value gives the type's zero value.
+func formatFlagValue(f Flag, v any) (string, error) {
+	if items, ok := v.([]any); ok {
+		if f.Type != valueTypeList {
+			return "", fmt.Errorf("a list is only allowed for list flags")
+		}
+		parts := make([]string, len(items))
+		for i, item := range items {
+			s, err := formatFlagValue(Flag{Type: "string"}, item)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = s
+		}
+		return strings.Join(parts, listSeparator), nil
+	}
+	s := ""
+	switch v := v.(type) {
+	case nil:
+	case string:
+		s = expandRaid(v)
+	case float64:
+		// JSON numbers decode as float64.
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		s = fmt.Sprint(v)
+	}
+	switch f.Type {
+	case valueTypeBool:
+		if s == "" {
+			return "false", nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return "", fmt.Errorf("'%s' is not a bool", s)
+		}
+		return strconv.FormatBool(b), nil
+	case valueTypeInt:
+		if s == "" {
+			return "0", nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return "", fmt.Errorf("'%s' is not an int", s)
+		}
+		return strconv.Itoa(n), nil
+	}
+	return s, nil
 }
 
 // captureCommandTelemetry fires the appropriate raid_command_executed
@@ -203,7 +617,9 @@ func errorCodeFor(err error) string {
 // sanitised, uppercased env vars for the lifetime of a command run. Returns
 // a cleanup closure that restores any pre-existing values raid overwrote
 // (or unsets entries that didn't exist) so a command declaring e.g.
-// `name: PATH` doesn't permanently clobber the parent process's PATH.
+// `name: PATH` doesn't permanently clobber the parent process's PATH. The
+// caller's RAID_ARG_* come back too, which is what lets a Run task nest a
+// command inside another.
 //
 // Names are normalised via sanitizeEnvName: lowercase → uppercase, anything
 // outside [A-Za-z0-9_] becomes '_'. Names that sanitise to a non-identifier
@@ -211,7 +627,9 @@ func errorCodeFor(err error) string {
 // up-front via the `pattern` constraint, this is defence-in-depth for
 // callers that construct lib.Command directly (tests, future MCP hooks).
 func setCommandArgs(args []string, named map[string]string) func() {
+	parentArgs := raidArgsEnv()
 	clearRaidArgs()
+	prevArgs := swapCommandArgs(args, named)
 	for i, arg := range args {
 		os.Setenv(fmt.Sprintf("RAID_ARG_%d", i+1), arg)
 	}
@@ -252,6 +670,10 @@ func setCommandArgs(args []string, named map[string]string) func() {
 	}
 	return func() {
 		clearRaidArgs()
+		for k, v := range parentArgs {
+			os.Setenv(k, v)
+		}
+		restoreCommandArgs(prevArgs)
 		for _, p := range snapshots {
 			if p.hadValue {
 				os.Setenv(p.key, p.oldValue)
@@ -286,6 +708,54 @@ func sanitizeEnvName(s string) string {
 	return out
 }
 
+// commandArgs holds the running command's args by their declared names,
+// with positional args under "1", "2", ... Go templates read it as .Args;
+// the env var form loses the original names to sanitizeEnvName.
+var (
+	commandArgsMu sync.RWMutex
+	commandArgs   map[string]string
+)
+
+// swapCommandArgs records args and named as the running command's args
+// and returns the previous set for restoreCommandArgs.
+func swapCommandArgs(args []string, named map[string]string) map[string]string {
+	next := make(map[string]string, len(args)+len(named))
+	for i, arg := range args {
+		next[strconv.Itoa(i+1)] = arg
+	}
+	maps.Copy(next, named)
+	commandArgsMu.Lock()
+	defer commandArgsMu.Unlock()
+	prev := commandArgs
+	commandArgs = next
+	return prev
+}
+
+func restoreCommandArgs(prev map[string]string) {
+	commandArgsMu.Lock()
+	commandArgs = prev
+	commandArgsMu.Unlock()
+}
+
+// snapshotCommandArgs returns a copy of the running command's args.
+func snapshotCommandArgs() map[string]string {
+	commandArgsMu.RLock()
+	defer commandArgsMu.RUnlock()
+	return maps.Clone(commandArgs)
+}
+
+// raidArgsEnv returns the RAID_ARG_* environment variables currently set.
+func raidArgsEnv() map[string]string {
+	out := make(map[string]string)
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(key, "RAID_ARG_") {
+			out[key] = value
+		}
+	}
+	return out
+}
+
 // clearRaidArgs unsets all RAID_ARG_* environment variables.
 func clearRaidArgs() {
 	for _, kv := range os.Environ() {
@@ -296,6 +766,30 @@ func clearRaidArgs() {
 	}
 }
 
+// runLockedCommand runs cmd holding its `exclusive:` or `lock:` lock, if
+// it has one. label names the command in the lock, "name" or "repo:name";
+// held is the locks of the commands whose Run tasks led here. cmd's tasks
+// are stamped with the locks held while they run, so a command they Run
+// re-enters them.
+func runLockedCommand(cmd Command, label string, held []string) error {
+	release, locks, err := acquireCommandLock(cmd, label, held)
+	if err != nil {
+		return err
+	}
+	defer release()
+	stamp := func(tasks []Task) []Task {
+		out := make([]Task, len(tasks))
+		for i, t := range tasks {
+			t.commandLocks = locks
+			out[i] = t
+		}
+		return out
+	}
+	cmd.Tasks = stamp(cmd.Tasks)
+	cmd.Hooks = cmd.Hooks.mapTasks(stamp)
+	return runCommand(cmd)
+}
+
 // runCommand applies the optional Out wrapping and runs the task
 // sequence. Command-level showExeTime is independent of per-task timing —
 // both flags can be set together. The command line is emitted after the
@@ -314,8 +808,9 @@ func runCommand(cmd Command) error {
 		start = timeNowFn()
 	}
 
+	cmd = applyCommandDefaults(cmd)
 	if cmd.Out == nil {
-		err := ExecuteTasks(cmd.Tasks)
+		err := runHooked(cmd.Hooks, cmd.Tasks)
 		if showExeTime {
 			emitExeTime(cmd.Name, timeNowFn().Sub(start))
 		}
@@ -382,19 +877,26 @@ func runCommand(cmd Command) error {
 		restore()
 	}()
 
-	return ExecuteTasks(cmd.Tasks)
+	return runHooked(cmd.Hooks, cmd.Tasks)
 }
 
-// mergeCommands merges additional into base. On name conflicts, base takes priority.
+// mergeCommands merges additional into base. On name conflicts, base takes
+// priority, except that the children of two same-named commands are merged
+// the same way so a repo can add commands to a profile namespace.
 func mergeCommands(base, additional []Command) []Command {
-	existing := make(map[string]bool, len(base))
-	for _, c := range base {
-		existing[c.Name] = true
+	existing := make(map[string]int, len(base))
+	for i, c := range base {
+		existing[c.Name] = i
 	}
 	result := append([]Command(nil), base...)
 	for _, c := range additional {
-		if !existing[c.Name] {
+		i, ok := existing[c.Name]
+		if !ok {
 			result = append(result, c)
+			continue
+		}
+		if len(c.Commands) > 0 {
+			result[i].Commands = mergeCommands(result[i].Commands, c.Commands)
 		}
 	}
 	return result
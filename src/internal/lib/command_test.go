@@ -592,6 +592,19 @@ func TestMergeCommands(t *testing.T) {
 		},
 	}
 
+	t.Run("conflict: children merged", func(t *testing.T) {
+		base := []Command{{Name: "db", Usage: "from-base", Commands: []Command{a}}}
+		additional := []Command{{Name: "db", Usage: "from-repo", Commands: []Command{aAlt, b}}}
+		got := mergeCommands(base, additional)
+		if len(got) != 1 || got[0].Usage != "from-base" || len(got[0].Commands) != 2 ||
+			got[0].Commands[0].Usage != "from-a" || got[0].Commands[1].Name != "b" {
+			t.Errorf("mergeCommands() = %+v, want db with a (from base) and b", got)
+		}
+		if len(base[0].Commands) != 1 {
+			t.Errorf("mergeCommands() modified base children: %+v", base[0].Commands)
+		}
+	})
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got := mergeCommands(tt.base, tt.additional)
@@ -868,3 +881,315 @@ func TestSetCommandArgs_collidingNamesRestorePreexistingValue(t *testing.T) {
 		t.Errorf("after cleanup MY_FLAG = %q, want %q", got, "original")
 	}
 }
+
+// --- Run task ---
+
+func TestExecuteCommand_runTask(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	setupTestConfig(t)
+	origOut := commandStdout
+	commandStdout = io.Discard
+	t.Cleanup(func() { commandStdout = origOut })
+
+	out := filepath.Join(t.TempDir(), "out.txt")
+	record := func(line string) Task {
+		return Task{Type: Shell, Shell: "sh", Cmd: `echo "` + line + `" >> ` + out}
+	}
+	storeContext(&Context{Profile: Profile{
+		Commands: []Command{
+			{
+				Name: "deploy",
+				Args: []Arg{{Name: "env", Required: true}},
+				Tasks: []Task{
+					{Type: Run, Repo: "api", Command: "test", Args: []string{"unit-$ENV"}, Flags: map[string]any{"verbose": true}},
+					record("deploy $RAID_ARG_1 $ENV [$TARGET]"),
+				},
+			},
+		},
+		Repositories: []Repo{{Name: "api", Commands: []Command{{
+			Name:  "test",
+			Args:  []Arg{{Name: "target", Required: true}},
+			Flags: []Flag{{Name: "verbose", Type: "bool"}, {Name: "retries", Type: "int", Default: 2}},
+			Tasks: []Task{record("test $RAID_ARG_1 $TARGET $VERBOSE $RETRIES [$ENV]")},
+		}}}},
+	}})
+
+	if err := ExecuteCommand("deploy", []string{"prod"}, map[string]string{"env": "prod"}); err != nil {
+		t.Fatalf("ExecuteCommand() error: %v", err)
+	}
+	want := "test unit-prod unit-prod true 2 [prod]\ndeploy prod prod []\n"
+	if got, _ := os.ReadFile(out); string(got) != want {
+		t.Errorf("output =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExecuteCommand_runTaskWaitsForConcurrentPeers(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	setupTestConfig(t)
+	origOut := commandStdout
+	commandStdout = io.Discard
+	t.Cleanup(func() { commandStdout = origOut })
+
+	out := filepath.Join(t.TempDir(), "out.txt")
+	peer := Task{Type: Shell, Shell: "sh", Cmd: `sleep 0.2; echo "peer $ENV" >> ` + out, Concurrent: true}
+	storeContext(&Context{Profile: Profile{
+		Commands: []Command{
+			{
+				Name:  "deploy",
+				Args:  []Arg{{Name: "env", Required: true}},
+				Tasks: []Task{peer, {Type: Run, Command: "test", Args: []string{"unit"}}},
+			},
+			{
+				Name:  "test",
+				Args:  []Arg{{Name: "target", Required: true}},
+				Tasks: []Task{{Type: Shell, Shell: "sh", Cmd: `echo "test $TARGET" >> ` + out}},
+			},
+		},
+	}})
+
+	// Run with -race, this also catches the Run swapping the session and
+	// args under the peer.
+	if err := ExecuteCommand("deploy", []string{"prod"}, map[string]string{"env": "prod"}); err != nil {
+		t.Fatalf("ExecuteCommand() error: %v", err)
+	}
+	want := "peer prod\ntest unit\n"
+	if got, _ := os.ReadFile(out); string(got) != want {
+		t.Errorf("output =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExecuteCommand_runTaskCycle(t *testing.T) {
+	setupTestConfig(t)
+	storeContext(&Context{Profile: Profile{
+		Commands: []Command{
+			{Name: "a", Tasks: []Task{{Type: Run, Command: "b"}}},
+			{Name: "b", Tasks: []Task{{Type: Group, Ref: "g"}}},
+		},
+		Groups: map[string][]Task{"g": {{Type: Run, Command: "a"}}},
+	}})
+
+	err := ExecuteCommand("a", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "command cycle detected: a -> b -> a") {
+		t.Errorf("error = %v, want a command cycle through the group", err)
+	}
+}
+
+func TestExecuteCommand_runTaskErrors(t *testing.T) {
+	setupTestConfig(t)
+	storeContext(&Context{Profile: Profile{
+		Commands: []Command{{
+			Name:  "test",
+			Args:  []Arg{{Name: "target", Required: true}},
+			Flags: []Flag{{Name: "retries", Type: "int"}, {Name: "env", Required: true}},
+		}},
+		Repositories: []Repo{{Name: "api"}},
+	}})
+
+	tests := []struct {
+		name string
+		task Task
+		code string
+	}{
+		{"no command", Task{Type: Run}, liberrs.CodeArgInvalid},
+		{"unknown command", Task{Type: Run, Command: "nope"}, liberrs.CodeCommandNotFound},
+		{"unknown repo", Task{Type: Run, Repo: "web", Command: "test"}, liberrs.CodeRepoNotFound},
+		{"unknown repo command", Task{Type: Run, Repo: "api", Command: "test"}, liberrs.CodeCommandNotFound},
+		{"missing arg", Task{Type: Run, Command: "test", Flags: map[string]any{"env": "dev"}}, liberrs.CodeArgInvalid},
+		{"extra arg", Task{Type: Run, Command: "test", Args: []string{"a", "b"}, Flags: map[string]any{"env": "dev"}}, liberrs.CodeArgInvalid},
+		{"unknown flag", Task{Type: Run, Command: "test", Args: []string{"a"}, Flags: map[string]any{"env": "dev", "force": true}}, liberrs.CodeArgInvalid},
+		{"missing flag", Task{Type: Run, Command: "test", Args: []string{"a"}}, liberrs.CodeArgInvalid},
+		{"bad int", Task{Type: Run, Command: "test", Args: []string{"a"}, Flags: map[string]any{"env": "dev", "retries": "many"}}, liberrs.CodeArgInvalid},
+		{"concurrent", Task{Type: Run, Command: "test", Concurrent: true}, liberrs.CodeArgInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ExecuteTask(tt.task)
+			if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != tt.code {
+				t.Errorf("error = %v, want %s", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestFormatFlagValue(t *testing.T) {
+	tests := []struct {
+		typ     string
+		in      any
+		want    string
+		wantErr bool
+	}{
+		{"", "plain", "plain", false},
+		{"", nil, "", false},
+		{"bool", true, "true", false},
+		{"bool", nil, "false", false},
+		{"bool", "yes", "", true},
+		{"int", float64(3), "3", false},
+		{"int", 4, "4", false},
+		{"int", "5", "5", false},
+		{"int", nil, "0", false},
+		{"int", 1.5, "", true},
+		{"list", []any{"a", float64(2)}, "a,2", false},
+		{"list", "a,b", "a,b", false},
+		{"", []any{"a"}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := formatFlagValue(Flag{Name: "f", Type: tt.typ}, tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("formatFlagValue(%q, %v) = %q, %v; want %q, error %v", tt.typ, tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestExecuteCommand_nested(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	setupTestConfig(t)
+	origOut := commandStdout
+	commandStdout = io.Discard
+	t.Cleanup(func() { commandStdout = origOut })
+
+	out := filepath.Join(t.TempDir(), "out.txt")
+	record := func(line string) []Task {
+		return []Task{{Type: Shell, Shell: "sh", Cmd: `echo "` + line + `" >> ` + out}}
+	}
+	storeContext(&Context{Profile: Profile{
+		Commands: []Command{
+			{Name: "db", Commands: []Command{
+				{Name: "migrate", Tasks: record("migrate $RAID_ARG_1")},
+				{Name: "seed", Tasks: []Task{{Type: Run, Command: "db  migrate", Args: []string{"seeded"}}}},
+			}},
+		},
+		Repositories: []Repo{{Name: "api", Commands: []Command{
+			{Name: "cache", Commands: []Command{{Name: "flush", Tasks: record("flush")}}},
+		}}},
+	}})
+
+	if err := ExecuteCommand("db migrate", []string{"up"}, nil); err != nil {
+		t.Fatalf("ExecuteCommand(db migrate) error: %v", err)
+	}
+	if err := ExecuteCommand("db seed", nil, nil); err != nil {
+		t.Fatalf("ExecuteCommand(db seed) error: %v", err)
+	}
+	if err := ExecuteRepoCommand("api", "cache flush", nil, nil); err != nil {
+		t.Fatalf("ExecuteRepoCommand(cache flush) error: %v", err)
+	}
+	want := "migrate up\nmigrate seeded\nflush\n"
+	if got, _ := os.ReadFile(out); string(got) != want {
+		t.Errorf("output =\n%s\nwant\n%s", got, want)
+	}
+
+	err := ExecuteCommand("db", nil, nil)
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeArgInvalid || !strings.Contains(err.Error(), "db migrate, db seed") {
+		t.Errorf("namespace error = %v, want ARG_INVALID listing its children", err)
+	}
+	err = ExecuteCommand("db rollback", nil, nil)
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeCommandNotFound {
+		t.Errorf("unknown child error = %v, want COMMAND_NOT_FOUND", err)
+	}
+}
+
+func TestLookupCommand_aliases(t *testing.T) {
+	cmds := []Command{
+		{Name: "setup", Aliases: []string{"bootstrap", "db"}},
+		{Name: "db", Aliases: []string{"database"}, Commands: []Command{{Name: "migrate", Aliases: []string{"mig"}}}},
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"bootstrap", "setup"},
+		{"db", "db"},
+		{"database mig", "db migrate"},
+		{"db  migrate", "db migrate"},
+		{"setup migrate", ""},
+	}
+	for _, tt := range tests {
+		got, ok := lookupCommand(cmds, tt.path)
+		if ok != (tt.want != "") || got.Name != tt.want {
+			t.Errorf("lookupCommand(%q) = %q, %v; want %q", tt.path, got.Name, ok, tt.want)
+		}
+	}
+}
+
+func TestExecuteCommand_envDirShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	setupTestConfig(t)
+	origOut := commandStdout
+	commandStdout = io.Discard
+	t.Cleanup(func() { commandStdout = origOut })
+
+	base := t.TempDir()
+	work := filepath.Join(base, "work")
+	other := t.TempDir()
+	if err := os.Mkdir(work, 0755); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "out.txt")
+	cmds := []Command{{
+		Name:  "build",
+		Env:   map[string]string{"TARGET": "$RAID_ARG_1-build"},
+		Dir:   "work",
+		Shell: "sh",
+		Tasks: []Task{
+			{Type: Shell, Cmd: `echo "$TARGET $(pwd)" >> ` + out},
+			{Type: Shell, Shell: "bash", Path: other, Cmd: `echo "$TARGET $(pwd)" >> ` + out},
+		},
+	}}
+	applyCommandDir(cmds, base)
+	storeContext(&Context{Profile: Profile{Commands: cmds}})
+
+	if err := ExecuteCommand("build", []string{"prod"}, nil); err != nil {
+		t.Fatalf("ExecuteCommand() error: %v", err)
+	}
+	want := "prod-build " + work + "\nprod-build " + other + "\n"
+	if got, _ := os.ReadFile(out); string(got) != want {
+		t.Errorf("output =\n%s\nwant\n%s", got, want)
+	}
+	if _, ok := os.LookupEnv("TARGET"); ok {
+		t.Error("command env leaked into the process environment")
+	}
+}
+
+func TestApplyCommandDefaults(t *testing.T) {
+	base := t.TempDir()
+	cmd := Command{
+		Dir:     "sub",
+		Shell:   "zsh",
+		baseDir: base,
+		Tasks: []Task{
+			{Type: Shell, Cmd: "true"},
+			{Type: Service, Shell: "bash"},
+			{Type: Git, Path: "/elsewhere"},
+			{Type: Template, Src: "in.tmpl", Dest: "/abs/out"},
+		},
+	}
+	dir := filepath.Join(base, "sub")
+
+	got := applyCommandDefaults(cmd).Tasks
+	if got[0].Path != dir || got[0].Shell != "zsh" {
+		t.Errorf("shell task = path %q shell %q, want %q zsh", got[0].Path, got[0].Shell, dir)
+	}
+	if got[1].Path != dir || got[1].Shell != "bash" {
+		t.Errorf("service task = path %q shell %q, want %q bash", got[1].Path, got[1].Shell, dir)
+	}
+	if got[2].Path != "/elsewhere" {
+		t.Errorf("git task path = %q, want its own", got[2].Path)
+	}
+	expanded := got[3].Expand()
+	if want := filepath.Join(dir, "in.tmpl"); expanded.Src != want {
+		t.Errorf("template src = %q, want %q", expanded.Src, want)
+	}
+	if expanded.Dest != "/abs/out" {
+		t.Errorf("template dest = %q, want it unchanged", expanded.Dest)
+	}
+	if cmd.Tasks[0].Path != "" {
+		t.Error("applyCommandDefaults modified the command's tasks in place")
+	}
+}
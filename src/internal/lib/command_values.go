@@ -0,0 +1,278 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+	"github.com/8bitalex/raid/src/internal/sys"
+)
+
+// Arg and flag value types beyond the default string.
+const (
+	valueTypeBool     = "bool"
+	valueTypeInt      = "int"
+	valueTypeDuration = "duration"
+	valueTypePath     = "path"
+	valueTypeList     = "list"
+)
+
+// listSeparator joins the items of a list arg or flag into the single
+// value bound to its env var.
+const listSeparator = ","
+
+// Completion is an arg or flag's `complete:`: a static list of values, or
+// a shell command that prints one value per line. A line may carry a
+// description after a tab, which shells that support it display.
+type Completion struct {
+	Values []string
+	Cmd    string
+}
+
+func (c *Completion) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &c.Cmd); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &c.Values); err != nil {
+		return fmt.Errorf("complete must be a shell command or a list of values")
+	}
+	return nil
+}
+
+func (c *Completion) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&c.Cmd)
+	}
+	if err := node.Decode(&c.Values); err != nil {
+		return fmt.Errorf("complete must be a shell command or a list of values")
+	}
+	return nil
+}
+
+func (c Completion) MarshalJSON() ([]byte, error) {
+	if c.Cmd != "" {
+		return json.Marshal(c.Cmd)
+	}
+	return json.Marshal(c.Values)
+}
+
+// valueRules is what Arg and Flag have in common for validation.
+type valueRules struct {
+	kind     string
+	name     string
+	typ      string
+	choices  []string
+	pattern  string
+	min, max *float64
+}
+
+func (a Arg) rules() valueRules {
+	return valueRules{"argument", a.Name, a.Type, a.Choices, a.Pattern, a.Min, a.Max}
+}
+
+func (f Flag) rules() valueRules {
+	return valueRules{"flag", f.Name, f.Type, f.Choices, f.Pattern, f.Min, f.Max}
+}
+
+// variadicArg reports whether cmd's last declared arg is a list, which
+// takes every remaining positional value.
+func variadicArg(cmd Command) bool {
+	return len(cmd.Args) > 0 && cmd.Args[len(cmd.Args)-1].Type == valueTypeList
+}
+
+// checkCommandValues validates the values given for cmd's declared args
+// and flags, and the flags' `default:` values, against their types,
+// choices, patterns and bounds. Args are read from their positions in
+// args; flags from named, which may be nil. It returns a copy of named
+// with path values expanded.
+func checkCommandValues(cmd Command, label string, args []string, named map[string]string) (map[string]string, error) {
+	named = maps.Clone(named)
+	for i, a := range cmd.Args {
+		if a.Type == valueTypeList && i != len(cmd.Args)-1 {
+			return nil, liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig,
+				"command '%s': list argument '%s' must be the last argument", label, a.Name)
+		}
+		if i >= len(args) {
+			continue
+		}
+		values := args[i : i+1]
+		if a.Type == valueTypeList {
+			values = args[i:]
+		}
+		if err := a.rules().check(label, values); err != nil {
+			return nil, err
+		}
+		if a.Type == valueTypePath && named != nil {
+			named[a.Name] = sys.ExpandPath(args[i])
+		}
+	}
+	for _, f := range cmd.Flags {
+		if err := checkFlagDefault(f, label); err != nil {
+			return nil, err
+		}
+		v, ok := named[f.Name]
+		if !ok {
+			continue
+		}
+		values := []string{v}
+		if f.Type == valueTypeList {
+			values = splitList(v)
+		}
+		if err := f.rules().check(label, values); err != nil {
+			return nil, err
+		}
+		if f.Type == valueTypePath && v != "" {
+			named[f.Name] = sys.ExpandPath(v)
+		}
+	}
+	return named, nil
+}
+
+// checkFlagDefault validates f's `default:` like a value given for it, so
+// a default that breaks its own flag's rules is reported as such whether
+// or not the flag was given.
+func checkFlagDefault(f Flag, label string) error {
+	if f.Default == nil {
+		return nil
+	}
+	v, err := formatFlagValue(f, f.Default)
+	if err != nil {
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid default for flag '%s' of command '%s': %v", f.Name, label, err)
+	}
+	values := []string{v}
+	if f.Type == valueTypeList {
+		values = splitList(v)
+	}
+	r := f.rules()
+	r.kind = "default of flag"
+	return r.check(label, values)
+}
+
+// splitList splits a bound list value back into its items.
+func splitList(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, listSeparator)
+}
+
+// check validates the value, or for a list each item, of one arg or flag.
+// Bounds apply to an int's value and a list's number of items.
+func (r valueRules) check(label string, values []string) error {
+	fail := func(format string, a ...any) error {
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig,
+			"command '%s': %s '%s' %s", label, r.kind, r.name, fmt.Sprintf(format, a...))
+	}
+	var re *regexp.Regexp
+	if r.pattern != "" {
+		var err error
+		if re, err = regexp.Compile("^(?:" + r.pattern + ")$"); err != nil {
+			return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig,
+				"command '%s': %s '%s' has an invalid pattern %q: %v", label, r.kind, r.name, r.pattern, err)
+		}
+	}
+
+	for _, v := range values {
+		switch r.typ {
+		case valueTypeInt:
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fail("must be an int, got %q", v)
+			}
+			if err := r.checkBounds(float64(n), "be"); err != "" {
+				return fail("%s, got %d", err, n)
+			}
+		case valueTypeDuration:
+			if _, err := time.ParseDuration(v); err != nil {
+				return fail("must be a duration such as 30s or 5m, got %q", v)
+			}
+		}
+		if len(r.choices) > 0 && !slices.Contains(r.choices, v) {
+			return fail("must be one of %s, got %q", strings.Join(r.choices, ", "), v)
+		}
+		if re != nil && !re.MatchString(v) {
+			return fail("must match pattern %q, got %q", r.pattern, v)
+		}
+	}
+	if r.typ == valueTypeList {
+		if err := r.checkBounds(float64(len(values)), "have"); err != "" {
+			return fail("%s items, got %d", err, len(values))
+		}
+	}
+	return nil
+}
+
+// checkBounds returns what n violates, phrased with verb, or "".
+func (r valueRules) checkBounds(n float64, verb string) string {
+	format := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	switch {
+	case r.min != nil && n < *r.min:
+		return fmt.Sprintf("must %s at least %s", verb, format(*r.min))
+	case r.max != nil && n > *r.max:
+		return fmt.Sprintf("must %s at most %s", verb, format(*r.max))
+	}
+	return ""
+}
+
+// completionTimeout bounds a `complete:` command. Completion runs while
+// the user waits at the prompt, so a slow command gives no completions
+// rather than a hung shell.
+var completionTimeout = 2 * time.Second
+
+// CompleteValue returns the shell completions for an arg or flag that
+// start with toComplete: its `complete:` values or command output, or
+// else its choices. A completion command runs in dir, or the home
+// directory when dir is empty; if it fails or takes longer than
+// completionTimeout there are no completions.
+func CompleteValue(complete *Completion, choices []string, dir, toComplete string) []string {
+	values := choices
+	if complete != nil {
+		values = complete.Values
+		if complete.Cmd != "" {
+			values = runCompletionCmd(complete.Cmd, dir)
+		}
+	}
+	var out []string
+	for _, v := range values {
+		if strings.HasPrefix(v, toComplete) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func runCompletionCmd(command, dir string) []string {
+	if dir == "" {
+		dir = sys.GetHomeDir()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+	shell := getShell("")
+	cmd := exec.CommandContext(ctx, shell[0], append(shell[1:], expandRaid(command))...)
+	cmd.Dir = sys.ExpandPath(dir)
+	cmd.Env = buildSubprocessEnv()
+	// A background child still holding stdout would otherwise keep
+	// Output waiting after the shell is killed.
+	cmd.WaitDelay = 100 * time.Millisecond
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+	var values []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimRight(line, "\r"); strings.TrimSpace(line) != "" {
+			values = append(values, line)
+		}
+	}
+	return values
+}
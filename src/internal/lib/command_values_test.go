@@ -0,0 +1,200 @@
+package lib
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+	"github.com/8bitalex/raid/src/internal/sys"
+)
+
+func ptr(f float64) *float64 { return &f }
+
+func TestCheckCommandValues(t *testing.T) {
+	cmd := Command{
+		Args: []Arg{
+			{Name: "env", Choices: []string{"dev", "prod"}},
+			{Name: "count", Type: "int", Min: ptr(1), Max: ptr(5)},
+			{Name: "pkgs", Type: "list", Pattern: `[a-z./]+`, Max: ptr(2)},
+		},
+		Flags: []Flag{
+			{Name: "timeout", Type: "duration"},
+			{Name: "ticket", Pattern: `[A-Z]+-[0-9]+`},
+			{Name: "tags", Type: "list", Choices: []string{"fast", "slow"}, Min: ptr(1)},
+		},
+	}
+	tests := []struct {
+		name   string
+		args   []string
+		named  map[string]string
+		reason string
+	}{
+		{"valid", []string{"dev", "3", "./a", "./b"}, map[string]string{"timeout": "5m", "ticket": "RAID-1", "tags": "fast,slow"}, ""},
+		{"omitted values", nil, map[string]string{}, ""},
+		{"choice", []string{"qa"}, nil, "argument 'env' must be one of dev, prod, got \"qa\""},
+		{"not an int", []string{"dev", "three"}, nil, "argument 'count' must be an int"},
+		{"below min", []string{"dev", "0"}, nil, "argument 'count' must be at least 1, got 0"},
+		{"above max", []string{"dev", "9"}, nil, "argument 'count' must be at most 5, got 9"},
+		{"list item pattern", []string{"dev", "1", "./a", "B"}, nil, "argument 'pkgs' must match pattern"},
+		{"list too long", []string{"dev", "1", "a", "b", "c"}, nil, "argument 'pkgs' must have at most 2 items, got 3"},
+		{"duration", nil, map[string]string{"timeout": "soon"}, "flag 'timeout' must be a duration"},
+		{"flag pattern", nil, map[string]string{"ticket": "raid-1"}, "flag 'ticket' must match pattern"},
+		{"list choice", nil, map[string]string{"tags": "fast,medium"}, "flag 'tags' must be one of fast, slow, got \"medium\""},
+		{"empty list", nil, map[string]string{"tags": ""}, "flag 'tags' must have at least 1 items, got 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := checkCommandValues(cmd, "deploy", tt.args, tt.named)
+			if tt.reason == "" {
+				if err != nil {
+					t.Fatalf("checkCommandValues() error: %v", err)
+				}
+				return
+			}
+			if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeArgInvalid || !strings.Contains(err.Error(), "command 'deploy': "+tt.reason) {
+				t.Errorf("error = %v, want ARG_INVALID with %q", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestCheckCommandValues_expandsPaths(t *testing.T) {
+	cmd := Command{Args: []Arg{{Name: "dir", Type: "path"}}, Flags: []Flag{{Name: "out", Type: "path"}}}
+	named := map[string]string{"dir": "~/src", "out": "~/out.txt"}
+	got, err := checkCommandValues(cmd, "build", []string{"~/src"}, named)
+	if err != nil {
+		t.Fatalf("checkCommandValues() error: %v", err)
+	}
+	if got["dir"] != sys.ExpandPath("~/src") || got["out"] != sys.ExpandPath("~/out.txt") {
+		t.Errorf("values = %v, want expanded paths", got)
+	}
+	if named["dir"] != "~/src" {
+		t.Errorf("caller's map was modified: %v", named)
+	}
+}
+
+func TestCheckCommandValues_configErrors(t *testing.T) {
+	for _, cmd := range []Command{
+		{Args: []Arg{{Name: "files", Type: "list"}, {Name: "dest"}}},
+		{Flags: []Flag{{Name: "ticket", Pattern: "["}}},
+	} {
+		_, err := checkCommandValues(cmd, "x", []string{"a"}, map[string]string{"ticket": "a"})
+		if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeArgInvalid {
+			t.Errorf("checkCommandValues(%+v) = %v, want ARG_INVALID", cmd, err)
+		}
+	}
+}
+
+func TestCheckCommandValues_defaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		flag   Flag
+		reason string
+	}{
+		{"valid", Flag{Name: "env", Default: "dev", Choices: []string{"dev", "prod"}}, ""},
+		{"choice", Flag{Name: "env", Default: "qa", Choices: []string{"dev", "prod"}}, "default of flag 'env' must be one of dev, prod, got \"qa\""},
+		{"pattern", Flag{Name: "ticket", Default: "raid-1", Pattern: `[A-Z]+-[0-9]+`}, "default of flag 'ticket' must match pattern"},
+		{"min", Flag{Name: "retries", Type: "int", Default: 0, Min: ptr(1)}, "default of flag 'retries' must be at least 1, got 0"},
+		{"max", Flag{Name: "retries", Type: "int", Default: 9.0, Max: ptr(5)}, "default of flag 'retries' must be at most 5, got 9"},
+		{"list items", Flag{Name: "tags", Type: "list", Default: []any{"fast", "medium"}, Choices: []string{"fast", "slow"}}, "default of flag 'tags' must be one of fast, slow, got \"medium\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// No value is given for the flag, so only its default is checked.
+			cmd := Command{Flags: []Flag{tt.flag}}
+			_, err := checkCommandValues(cmd, "deploy", nil, nil)
+			if tt.reason == "" {
+				if err != nil {
+					t.Fatalf("checkCommandValues() error: %v", err)
+				}
+				return
+			}
+			if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeArgInvalid || !strings.Contains(err.Error(), "command 'deploy': "+tt.reason) {
+				t.Errorf("error = %v, want ARG_INVALID with %q", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestExecuteCommand_validatesValues(t *testing.T) {
+	setupTestConfig(t)
+	storeContext(&Context{Profile: Profile{Commands: []Command{
+		{Name: "deploy", Args: []Arg{{Name: "env", Choices: []string{"dev", "prod"}}}, Tasks: []Task{{Type: Shell, Cmd: "exit 1"}}},
+		{Name: "release", Tasks: []Task{{Type: Run, Command: "deploy", Args: []string{"qa"}}}},
+	}}})
+
+	for _, name := range []string{"deploy", "release"} {
+		err := ExecuteCommand(name, []string{"qa"}, map[string]string{"env": "qa"})
+		if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeArgInvalid || !strings.Contains(err.Error(), "argument 'env'") {
+			t.Errorf("ExecuteCommand(%s) = %v, want ARG_INVALID naming env", name, err)
+		}
+	}
+}
+
+func TestCompletion_unmarshal(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Completion
+	}{
+		{`"git branch"`, Completion{Cmd: "git branch"}},
+		{`["dev", "prod"]`, Completion{Values: []string{"dev", "prod"}}},
+	}
+	for _, tt := range tests {
+		var fromJSON, fromYAML Completion
+		if err := json.Unmarshal([]byte(tt.in), &fromJSON); err != nil {
+			t.Fatalf("json.Unmarshal(%s) error: %v", tt.in, err)
+		}
+		if err := yaml.Unmarshal([]byte(tt.in), &fromYAML); err != nil {
+			t.Fatalf("yaml.Unmarshal(%s) error: %v", tt.in, err)
+		}
+		for _, got := range []Completion{fromJSON, fromYAML} {
+			if got.Cmd != tt.want.Cmd || strings.Join(got.Values, ",") != strings.Join(tt.want.Values, ",") {
+				t.Errorf("unmarshal(%s) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		}
+		if data, _ := json.Marshal(fromJSON); string(data) != strings.ReplaceAll(tt.in, " ", "") && string(data) != tt.in {
+			t.Errorf("json.Marshal() = %s, want %s", data, tt.in)
+		}
+	}
+	var c Completion
+	if err := json.Unmarshal([]byte(`{"cmd": 1}`), &c); err == nil {
+		t.Error("json.Unmarshal(object) succeeded, want an error")
+	}
+}
+
+func TestCompleteValue(t *testing.T) {
+	if got := CompleteValue(nil, []string{"dev", "prod", "preview"}, "", "pr"); strings.Join(got, ",") != "prod,preview" {
+		t.Errorf("choices = %q", got)
+	}
+	if got := CompleteValue(&Completion{Values: []string{"a", "b"}}, []string{"dev"}, "", ""); strings.Join(got, ",") != "a,b" {
+		t.Errorf("static = %q", got)
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	dir := t.TempDir()
+	got := CompleteValue(&Completion{Cmd: "printf 'main\\tdefault\\nfeature\\n\\n'; pwd"}, nil, dir, "")
+	if len(got) != 3 || got[0] != "main\tdefault" || got[1] != "feature" || !strings.HasSuffix(got[2], "/"+filepath.Base(dir)) {
+		t.Errorf("command = %q", got)
+	}
+	if got := CompleteValue(&Completion{Cmd: "exit 1"}, nil, dir, ""); got != nil {
+		t.Errorf("failed command = %q, want none", got)
+	}
+
+	orig := completionTimeout
+	completionTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { completionTimeout = orig })
+	start := time.Now()
+	if got := CompleteValue(&Completion{Cmd: "echo early; sleep 5"}, nil, dir, ""); got != nil {
+		t.Errorf("slow command = %q, want none", got)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("slow command took %s, want it cut off", d)
+	}
+}
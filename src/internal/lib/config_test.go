@@ -20,11 +20,19 @@ func setupTestConfig(t *testing.T) {
 	oldContext := loadContext()
 	oldRecent := RecentPathOverride
 	oldLock := LockPathOverride
+	raidVarsMu.RLock()
+	oldVarsProfile := raidVarsProfile
+	raidVarsMu.RUnlock()
 	t.Cleanup(func() {
 		CfgPath = oldCfgPath
 		storeContext(oldContext)
 		RecentPathOverride = oldRecent
 		LockPathOverride = oldLock
+		// ForceLoad records the loaded profile for vars scoping; don't let
+		// it leak into later tests that load vars files directly.
+		raidVarsMu.Lock()
+		raidVarsProfile = oldVarsProfile
+		raidVarsMu.Unlock()
 		viper.Reset()
 	})
 
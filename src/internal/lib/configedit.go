@@ -0,0 +1,579 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Config file formats a ConfigEdit task reads and writes.
+const (
+	configJSON = "json"
+	configYAML = "yaml"
+	configTOML = "toml"
+)
+
+// ConfigEditOp is one operation of a ConfigEdit task. Exactly one of Set,
+// Delete, and Merge names the key it applies to, as a dotted path
+// (`server.port`, `services.0.name`) or a JSONPath (`$.features['a.b']`).
+type ConfigEditOp struct {
+	Set    string `json:"set,omitempty"`
+	Delete string `json:"delete,omitempty"`
+	Merge  string `json:"merge,omitempty"`
+	Value  any    `json:"value,omitempty"`
+	// ValueType converts a string value (after $VAR expansion) before
+	// it's written: string, int, float, bool, or json.
+	ValueType string `json:"valueType,omitempty" yaml:"valueType,omitempty"`
+}
+
+// execConfigEdit applies a ConfigEdit task's edits in order and writes the
+// file back only when something changed. YAML is edited as a node tree, so
+// comments and key order survive; JSON keeps its key order and indent.
+func execConfigEdit(task Task) error {
+	raw := task
+	task = task.Expand()
+
+	if task.File == "" {
+		return liberrs.ArgInvalid("file is required for ConfigEdit task")
+	}
+	if len(task.Edits) == 0 {
+		return liberrs.ArgInvalid("edits is required for ConfigEdit task")
+	}
+	format, err := configFormat(task.File, task.Format)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(task.File)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return liberrs.Newf(liberrs.CodeTaskConfigEditFailed, liberrs.CategoryTask, "failed to read '%s': %v", task.File, err)
+	}
+	doc, err := decodeConfig(format, data)
+	if err != nil {
+		return liberrs.Newf(liberrs.CodeTaskConfigEditFailed, liberrs.CategoryTask, "failed to parse '%s' as %s: %v", task.File, format, err)
+	}
+
+	for _, edit := range raw.Edits {
+		if err := applyConfigEdit(doc, edit, !raw.Literal); err != nil {
+			return liberrs.Newf(liberrs.CodeTaskConfigEditFailed, liberrs.CategoryTask, "failed to edit '%s': %v", task.File, err)
+		}
+	}
+
+	out, err := encodeConfig(format, doc, data)
+	if err != nil {
+		return liberrs.Newf(liberrs.CodeTaskConfigEditFailed, liberrs.CategoryTask, "failed to write '%s': %v", task.File, err)
+	}
+	if bytes.Equal(out, data) {
+		return nil
+	}
+	return writeFileAtomic(task.File, bytes.NewReader(out), nil, 0)
+}
+
+// configFormat resolves `format:`, or the file's extension when unset.
+func configFormat(file, format string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(file), ".")
+	}
+	switch strings.ToLower(format) {
+	case "json":
+		return configJSON, nil
+	case "yaml", "yml":
+		return configYAML, nil
+	case "toml":
+		return configTOML, nil
+	}
+	return "", liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "can't tell the config format of '%s'; set format to json, yaml, or toml", file)
+}
+
+// decodeConfig parses a config file into a YAML document node, the one
+// representation every edit works on. An empty or missing file is an
+// empty mapping.
+func decodeConfig(format string, data []byte) (*yaml.Node, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if len(bytes.TrimSpace(data)) > 0 {
+		switch format {
+		case configYAML:
+			var doc yaml.Node
+			if err := yaml.Unmarshal(data, &doc); err != nil {
+				return nil, err
+			}
+			if len(doc.Content) > 0 {
+				return &doc, nil
+			}
+		case configJSON:
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.UseNumber()
+			n, err := decodeJSONNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := dec.Token(); err != io.EOF {
+				return nil, fmt.Errorf("unexpected data after the top-level value")
+			}
+			root = n
+		case configTOML:
+			var m map[string]any
+			if err := toml.Unmarshal(data, &m); err != nil {
+				return nil, err
+			}
+			if err := root.Encode(m); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}, nil
+}
+
+// decodeJSONNode reads one JSON value into a node, keeping object key
+// order and number text exactly as written.
+func decodeJSONNode(dec *json.Decoder) (*yaml.Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		end := json.Delim('}')
+		if t == '[' {
+			n = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			end = ']'
+		}
+		for dec.More() {
+			if n.Kind == yaml.MappingNode {
+				k, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k.(string)})
+			}
+			v, err := decodeJSONNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, v)
+		}
+		if tok, err := dec.Token(); err != nil || tok != end {
+			return nil, fmt.Errorf("unterminated %s", t)
+		}
+		return n, nil
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: t}, nil
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(t.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: t.String()}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(t)}, nil
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+}
+
+// encodeConfig renders the edited document in its format, matching the
+// original file's indentation where it can.
+func encodeConfig(format string, doc *yaml.Node, original []byte) ([]byte, error) {
+	switch format {
+	case configJSON:
+		var buf bytes.Buffer
+		if err := writeJSONNode(&buf, doc.Content[0]); err != nil {
+			return nil, err
+		}
+		var out bytes.Buffer
+		if err := json.Indent(&out, buf.Bytes(), "", detectIndent(original, "  ")); err != nil {
+			return nil, err
+		}
+		out.WriteByte('\n')
+		return out.Bytes(), nil
+	case configTOML:
+		var v any
+		if err := doc.Content[0].Decode(&v); err != nil {
+			return nil, err
+		}
+		return toml.Marshal(v)
+	default:
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(max(len(detectIndent(original, "  ")), 2))
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+// detectIndent returns the leading whitespace of the first indented line,
+// or def when nothing is indented.
+func detectIndent(data []byte, def string) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || trimmed == line || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		return line[:len(line)-len(trimmed)]
+	}
+	return def
+}
+
+// writeJSONNode writes n as compact JSON.
+func writeJSONNode(buf *bytes.Buffer, n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		return writeJSONNode(buf, n.Content[0])
+	case yaml.AliasNode:
+		return writeJSONNode(buf, n.Alias)
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			k, _ := json.Marshal(n.Content[i].Value)
+			buf.Write(k)
+			buf.WriteByte(':')
+			if err := writeJSONNode(buf, n.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, c := range n.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSONNode(buf, c); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		switch n.ShortTag() {
+		case "!!str":
+			v, _ := json.Marshal(n.Value)
+			buf.Write(v)
+		case "!!null":
+			buf.WriteString("null")
+		default:
+			if json.Valid([]byte(n.Value)) {
+				buf.WriteString(n.Value)
+				return nil
+			}
+			var v any
+			if err := n.Decode(&v); err != nil {
+				return err
+			}
+			data, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("%s can't be written as JSON", n.Value)
+			}
+			buf.Write(data)
+		}
+	}
+	return nil
+}
+
+// parseConfigKey reads a dotted key or JSONPath into path segments.
+func parseConfigKey(key string) ([]jsonPathSeg, error) {
+	if strings.HasPrefix(strings.TrimSpace(key), "$") {
+		return parseJSONPath(key)
+	}
+	return parseJSONPath("$." + key)
+}
+
+func applyConfigEdit(doc *yaml.Node, edit ConfigEditOp, expand bool) error {
+	op, key := "", ""
+	for _, c := range []struct{ op, key string }{{"set", edit.Set}, {"delete", edit.Delete}, {"merge", edit.Merge}} {
+		if c.key == "" {
+			continue
+		}
+		if op != "" {
+			return liberrs.ArgInvalid("each ConfigEdit edit takes exactly one of set, delete, merge")
+		}
+		op, key = c.op, c.key
+	}
+	if op == "" {
+		return liberrs.ArgInvalid("each ConfigEdit edit needs set, delete, or merge")
+	}
+	if expand {
+		key = expandRaid(key)
+	}
+	segs, err := parseConfigKey(key)
+	if err != nil {
+		return liberrs.ArgInvalid(err.Error())
+	}
+	root := doc.Content[0]
+
+	if op == "delete" {
+		if len(segs) == 0 {
+			return liberrs.ArgInvalid("delete needs a key below the document root")
+		}
+		parent, err := configNode(root, segs[:len(segs)-1], false, 0, key)
+		if err != nil || parent == nil {
+			return err
+		}
+		deleteConfigChild(parent, segs[len(segs)-1])
+		return nil
+	}
+
+	val, err := configValueNode(edit, expand)
+	if err != nil {
+		return err
+	}
+	if op == "merge" {
+		target, err := configNode(root, segs, true, yaml.MappingNode, key)
+		if err != nil {
+			return err
+		}
+		return mergeConfigNode(target, val, key)
+	}
+
+	if len(segs) == 0 {
+		doc.Content[0] = val
+		return nil
+	}
+	last := segs[len(segs)-1]
+	kind := yaml.MappingNode
+	if last.isIndex {
+		kind = yaml.SequenceNode
+	}
+	parent, err := configNode(root, segs[:len(segs)-1], true, kind, key)
+	if err != nil {
+		return err
+	}
+	return setConfigChild(parent, last, val, key)
+}
+
+// configValueNode builds the node an edit writes: its value with $VAR
+// expanded in every string, converted per valueType.
+func configValueNode(edit ConfigEditOp, expand bool) (*yaml.Node, error) {
+	v := edit.Value
+	if expand {
+		v = expandConfigValue(v)
+	}
+	if edit.ValueType != "" {
+		s, ok := v.(string)
+		if !ok {
+			s = fmt.Sprint(v)
+		}
+		var err error
+		switch edit.ValueType {
+		case "string":
+			v = s
+		case "int":
+			v, err = strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		case "float":
+			v, err = strconv.ParseFloat(strings.TrimSpace(s), 64)
+		case "bool":
+			v, err = strconv.ParseBool(strings.TrimSpace(s))
+		case "json":
+			err = json.Unmarshal([]byte(s), &v)
+		default:
+			return nil, liberrs.ArgInvalid(fmt.Sprintf("invalid valueType %q (supported: string, int, float, bool, json)", edit.ValueType))
+		}
+		if err != nil {
+			return nil, liberrs.ArgInvalid(fmt.Sprintf("value %q is not a valid %s", s, edit.ValueType))
+		}
+	}
+	var n yaml.Node
+	if err := n.Encode(v); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// expandConfigValue applies expandRaid to every string in a decoded value.
+func expandConfigValue(v any) any {
+	switch x := v.(type) {
+	case string:
+		return expandRaid(x)
+	case map[string]any:
+		out := make(map[string]any, len(x))
+		for k, e := range x {
+			out[k] = expandConfigValue(e)
+		}
+		return out
+	case []any:
+		out := make([]any, len(x))
+		for i, e := range x {
+			out[i] = expandConfigValue(e)
+		}
+		return out
+	}
+	return v
+}
+
+// configChild finds seg under n: the index into n.Content of the value,
+// or -1 when it's absent. A numeric key indexes a list, and a negative
+// index counts from the end.
+func configChild(n *yaml.Node, seg jsonPathSeg, key string) (int, error) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		if seg.isIndex {
+			return -1, fmt.Errorf("%s: [%d] applied to a mapping", key, seg.index)
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == seg.key {
+				return i + 1, nil
+			}
+		}
+		return -1, nil
+	case yaml.SequenceNode:
+		idx := seg.index
+		if !seg.isIndex {
+			var err error
+			if idx, err = strconv.Atoi(seg.key); err != nil {
+				return -1, fmt.Errorf("%s: %q applied to a list", key, seg.key)
+			}
+		}
+		if idx < 0 {
+			idx += len(n.Content)
+		}
+		if idx < 0 || idx > len(n.Content) {
+			return -1, fmt.Errorf("%s: index %d out of range (length %d)", key, idx, len(n.Content))
+		}
+		if idx == len(n.Content) {
+			return -1, nil
+		}
+		return idx, nil
+	}
+	return -1, fmt.Errorf("%s: %s is not a mapping or list", key, seg)
+}
+
+// configNode walks segs from n and returns the node there. With create,
+// missing containers are added along the way, each a list when the next
+// step is an index and a mapping otherwise, and the last one of kind
+// leaf. Without create, a missing node returns nil.
+func configNode(n *yaml.Node, segs []jsonPathSeg, create bool, leaf yaml.Kind, key string) (*yaml.Node, error) {
+	for i, seg := range segs {
+		kind := leaf
+		if i+1 < len(segs) {
+			kind = yaml.MappingNode
+			if segs[i+1].isIndex {
+				kind = yaml.SequenceNode
+			}
+		}
+		idx, err := configChild(n, seg, key)
+		if err != nil {
+			return nil, err
+		}
+		if idx < 0 {
+			if !create {
+				return nil, nil
+			}
+			child := newConfigContainer(kind)
+			if err := setConfigChild(n, seg, child, key); err != nil {
+				return nil, err
+			}
+			n = child
+			continue
+		}
+		child := n.Content[idx]
+		if create && child.Kind == yaml.ScalarNode && child.ShortTag() == "!!null" {
+			replacement := newConfigContainer(kind)
+			keepPresentation(child, replacement)
+			n.Content[idx] = replacement
+			child = replacement
+		}
+		n = child
+	}
+	return n, nil
+}
+
+func newConfigContainer(kind yaml.Kind) *yaml.Node {
+	if kind == yaml.SequenceNode {
+		return &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	}
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+}
+
+// setConfigChild puts val at seg under n, replacing what's there (and
+// keeping its comments) or adding it.
+func setConfigChild(n *yaml.Node, seg jsonPathSeg, val *yaml.Node, key string) error {
+	idx, err := configChild(n, seg, key)
+	if err != nil {
+		return err
+	}
+	if idx >= 0 {
+		keepPresentation(n.Content[idx], val)
+		n.Content[idx] = val
+		return nil
+	}
+	if n.Kind == yaml.SequenceNode {
+		n.Content = append(n.Content, val)
+		return nil
+	}
+	n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: seg.key}, val)
+	return nil
+}
+
+func deleteConfigChild(n *yaml.Node, seg jsonPathSeg) {
+	idx, err := configChild(n, seg, "")
+	if err != nil || idx < 0 {
+		return
+	}
+	if n.Kind == yaml.MappingNode {
+		n.Content = append(n.Content[:idx-1], n.Content[idx+1:]...)
+		return
+	}
+	n.Content = append(n.Content[:idx], n.Content[idx+1:]...)
+}
+
+// mergeConfigNode deep-merges the mapping src into dst: nested mappings
+// merge key by key, anything else replaces what dst had.
+func mergeConfigNode(dst, src *yaml.Node, key string) error {
+	if src.Kind != yaml.MappingNode {
+		return liberrs.ArgInvalid(fmt.Sprintf("merge value for %s must be a mapping", key))
+	}
+	if dst.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s is not a mapping", key)
+	}
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		seg := jsonPathSeg{key: src.Content[i].Value}
+		idx, _ := configChild(dst, seg, key)
+		if idx >= 0 && dst.Content[idx].Kind == yaml.MappingNode && src.Content[i+1].Kind == yaml.MappingNode {
+			if err := mergeConfigNode(dst.Content[idx], src.Content[i+1], key+"."+seg.key); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := setConfigChild(dst, seg, src.Content[i+1], key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keepPresentation carries comments, and a string's quoting style, from
+// a replaced node to its replacement, so setting a value doesn't drop the
+// note beside it or restyle the file.
+func keepPresentation(old, replacement *yaml.Node) {
+	if replacement.HeadComment == "" {
+		replacement.HeadComment = old.HeadComment
+	}
+	if replacement.LineComment == "" {
+		replacement.LineComment = old.LineComment
+	}
+	if replacement.FootComment == "" {
+		replacement.FootComment = old.FootComment
+	}
+	if old.Kind == yaml.ScalarNode && replacement.Kind == yaml.ScalarNode && replacement.ShortTag() == "!!str" && replacement.Style == 0 {
+		replacement.Style = old.Style
+	}
+}
@@ -0,0 +1,137 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+	"gopkg.in/yaml.v3"
+)
+
+func TestExecuteTask_configEditYAMLKeepsComments(t *testing.T) {
+	withRaidVar(t, "API_PORT", "9090")
+	path := filepath.Join(t.TempDir(), "docker-compose.override.yml")
+	os.WriteFile(path, []byte(`# local overrides
+services:
+  api:
+    ports:
+      - "8080:8080" # host:container
+    environment:
+      LOG_LEVEL: info
+  legacy:
+    image: old
+`), 0o644)
+
+	task := Task{Type: ConfigEdit, File: path, Edits: []ConfigEditOp{
+		{Set: "services.api.ports.0", Value: "$API_PORT:8080"},
+		{Merge: "services.api.environment", Value: map[string]any{"LOG_LEVEL": "debug", "FEATURE_X": "on"}},
+		{Delete: "services.legacy"},
+		{Set: "services.web.replicas", Value: "2", ValueType: "int"},
+	}}
+	for i := 0; i < 2; i++ {
+		if err := ExecuteTask(task); err != nil {
+			t.Fatalf("ExecuteTask() #%d error: %v", i+1, err)
+		}
+	}
+	want := `# local overrides
+services:
+  api:
+    ports:
+      - "9090:8080" # host:container
+    environment:
+      LOG_LEVEL: debug
+      FEATURE_X: "on"
+  web:
+    replicas: 2
+`
+	if got, _ := os.ReadFile(path); string(got) != want {
+		t.Errorf("file =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExecuteTask_configEditJSONKeepsOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte("{\n\t\"name\": \"api\",\n\t\"version\": 1.10,\n\t\"features\": {\"a.b\": false}\n}\n"), 0o644)
+
+	task := Task{Type: ConfigEdit, File: path, Edits: []ConfigEditOp{
+		{Set: "$.features['a.b']", Value: true},
+		{Set: "server.port", Value: 8080},
+		{Set: "tags[0]", Value: "$NOT_EXPANDED"},
+	}, Literal: true}
+	if err := ExecuteTask(task); err != nil {
+		t.Fatalf("ExecuteTask() error: %v", err)
+	}
+	want := "{\n\t\"name\": \"api\",\n\t\"version\": 1.10,\n\t\"features\": {\n\t\t\"a.b\": true\n\t},\n\t\"server\": {\n\t\t\"port\": 8080\n\t},\n\t\"tags\": [\n\t\t\"$NOT_EXPANDED\"\n\t]\n}\n"
+	if got, _ := os.ReadFile(path); string(got) != want {
+		t.Errorf("file = %q, want %q", got, want)
+	}
+}
+
+func TestExecuteTask_configEditTOML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.toml")
+	os.WriteFile(path, []byte("[db]\nhost = \"localhost\"\nport = 5432\n"), 0o644)
+
+	task := Task{Type: ConfigEdit, File: path, Edits: []ConfigEditOp{{Set: "db.port", Value: 6543}}}
+	if err := ExecuteTask(task); err != nil {
+		t.Fatalf("ExecuteTask() error: %v", err)
+	}
+	got, _ := os.ReadFile(path)
+	if !strings.Contains(string(got), "port = 6543") || !strings.Contains(string(got), "host = 'localhost'") {
+		t.Errorf("file = %q, want port updated and host kept", got)
+	}
+}
+
+func TestExecuteTask_configEditCreatesMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "new", "app.json")
+	task := Task{Type: ConfigEdit, File: path, Edits: []ConfigEditOp{{Set: "debug", Value: true}}}
+	if err := ExecuteTask(task); err != nil {
+		t.Fatalf("ExecuteTask() error: %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "{\n  \"debug\": true\n}\n" {
+		t.Errorf("file = %q", got)
+	}
+}
+
+func TestExecuteTask_configEditErrors(t *testing.T) {
+	dir := t.TempDir()
+	yml := filepath.Join(dir, "a.yaml")
+	os.WriteFile(yml, []byte("list: [1, 2]\nname: x\n"), 0o644)
+
+	tests := []struct {
+		name string
+		task Task
+		code string
+	}{
+		{"no file", Task{Type: ConfigEdit, Edits: []ConfigEditOp{{Delete: "a"}}}, liberrs.CodeArgInvalid},
+		{"unknown format", Task{Type: ConfigEdit, File: filepath.Join(dir, "a.ini"), Edits: []ConfigEditOp{{Delete: "a"}}}, liberrs.CodeArgInvalid},
+		{"two ops", Task{Type: ConfigEdit, File: yml, Edits: []ConfigEditOp{{Set: "a", Delete: "b"}}}, liberrs.CodeTaskConfigEditFailed},
+		{"key into scalar", Task{Type: ConfigEdit, File: yml, Edits: []ConfigEditOp{{Set: "name.first", Value: "a"}}}, liberrs.CodeTaskConfigEditFailed},
+		{"index past end", Task{Type: ConfigEdit, File: yml, Edits: []ConfigEditOp{{Set: "list[5]", Value: 3}}}, liberrs.CodeTaskConfigEditFailed},
+		{"merge non-mapping", Task{Type: ConfigEdit, File: yml, Edits: []ConfigEditOp{{Merge: "list", Value: map[string]any{"a": 1}}}}, liberrs.CodeTaskConfigEditFailed},
+		{"bad valueType", Task{Type: ConfigEdit, File: yml, Edits: []ConfigEditOp{{Set: "n", Value: "x", ValueType: "int"}}}, liberrs.CodeTaskConfigEditFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ExecuteTask(tt.task)
+			if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != tt.code {
+				t.Errorf("error = %v, want %s", err, tt.code)
+			}
+		})
+	}
+	if got, _ := os.ReadFile(yml); string(got) != "list: [1, 2]\nname: x\n" {
+		t.Errorf("file changed by failed edits: %q", got)
+	}
+}
+
+func TestTask_configEditFromYAML(t *testing.T) {
+	var task Task
+	src := "type: ConfigEdit\nfile: a.json\nedits:\n  - set: port\n    value: \"8080\"\n    valueType: int\n"
+	if err := yaml.Unmarshal([]byte(src), &task); err != nil {
+		t.Fatal(err)
+	}
+	if len(task.Edits) != 1 || task.Edits[0].ValueType != "int" || task.Edits[0].Value != "8080" {
+		t.Errorf("Edits = %+v, want set/value/valueType decoded", task.Edits)
+	}
+}
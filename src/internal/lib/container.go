@@ -0,0 +1,316 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+	"github.com/8bitalex/raid/src/internal/sys"
+)
+
+const (
+	containerEngineDocker = "docker"
+	containerEnginePodman = "podman"
+)
+
+// Container task operations.
+const (
+	containerComposeUp   = "compose-up"
+	containerComposeDown = "compose-down"
+	containerRun         = "run"
+	containerStop        = "stop"
+	containerExec        = "exec"
+	containerPull        = "pull"
+	containerHealth      = "health"
+)
+
+// containerConfigLabel marks a container `run` created with a hash of the
+// settings it was created with, so a later run can tell whether they've
+// changed.
+const containerConfigLabel = "raid.config"
+
+// containerStateFormat makes inspect print whether the container is
+// running, followed by its containerConfigLabel, if it has one.
+const containerStateFormat = `{{.State.Running}} {{index .Config.Labels "` + containerConfigLabel + `"}}`
+
+// containerHealthFormat makes inspect print the container's state followed
+// by its health status, when it has a healthcheck.
+const containerHealthFormat = "{{.State.Status}}{{if .State.Health}} {{.State.Health.Status}}{{end}}"
+
+// execContainer runs one docker or podman lifecycle operation. Both engines
+// take the same arguments for everything raid does, including `compose`.
+func execContainer(task Task) error {
+	file := task.File
+	var secretEnv map[string]string
+	if !task.Literal {
+		secretEnv = containerSecretEnv(task.Env)
+	}
+	task = task.Expand()
+	op := strings.ToLower(task.Op)
+	// A relative compose file belongs to the task's directory, which is
+	// the repo for repo tasks, not wherever raid was started.
+	if file = expandRaid(file); file != "" && task.Path != "" && !filepath.IsAbs(file) && !strings.HasPrefix(file, "~") {
+		task.File = sys.ExpandPath(filepath.Join(task.Path, file))
+	}
+
+	var args []string
+	switch op {
+	case containerComposeUp, containerComposeDown:
+		args = []string{"compose"}
+		if task.File != "" {
+			args = append(args, "-f", task.File)
+		}
+		if op == containerComposeUp {
+			args = append(args, "up", "-d")
+		} else {
+			args = append(args, "down")
+		}
+	case containerRun:
+		if task.Image == "" {
+			return liberrs.ArgInvalid("image is required for Container run")
+		}
+		args = containerRunArgs(task, secretEnv)
+	case containerPull:
+		if task.Image == "" {
+			return liberrs.ArgInvalid("image is required for Container pull")
+		}
+		args = []string{"pull", task.Image}
+	case containerStop, containerExec, containerHealth:
+		if task.Container == "" {
+			return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "container is required for Container %s", op)
+		}
+		if op == containerExec && len(task.Args) == 0 {
+			return liberrs.ArgInvalid("args is required for Container exec")
+		}
+		args = []string{op, task.Container}
+	case "":
+		return liberrs.ArgInvalid("op is required for Container task")
+	default:
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid Container op '%s' (supported: compose-up, compose-down, run, stop, exec, pull, health)", task.Op)
+	}
+	if op != containerPull && op != containerHealth && op != containerRun {
+		args = append(args, task.Args...)
+	}
+
+	engine, err := containerEngine(task.Engine)
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case containerHealth:
+		return waitContainerHealthy(engine, task)
+	case containerRun, containerStop:
+		if task.Container == "" {
+			break
+		}
+		running, exists, config := containerState(engine, task.Path, task.Container)
+		switch {
+		case op == containerStop && !running:
+			lockedFprintf(commandStdout, "Container %s is not running\n", task.Container)
+			return nil
+		case op == containerRun && running:
+			lockedFprintf(commandStdout, "Container %s is already running\n", task.Container)
+			return nil
+		case op == containerRun && exists && config != "" && config != containerConfigHash(containerRunSpec(task, secretEnv)):
+			// Only a container raid created, and so labelled, is ever
+			// removed; starting it as it was would drop the changes.
+			lockedFprintf(commandStdout, "Container %s has changed, recreating it\n", task.Container)
+			if err := runContainerCmd(engine, op, task, []string{"rm", task.Container}, nil); err != nil {
+				return err
+			}
+		case op == containerRun && exists:
+			args = []string{"start", task.Container}
+		}
+	}
+	return runContainerCmd(engine, op, task, args, secretEnv)
+}
+
+// containerRunArgs builds `run -d` for the task. A named container is
+// labelled with the hash of its containerRunSpec.
+func containerRunArgs(task Task, secret map[string]string) []string {
+	spec := containerRunSpec(task, secret)
+	args := []string{"run", "-d"}
+	if task.Container != "" {
+		args = append(args, "--name", task.Container, "--label", containerConfigLabel+"="+containerConfigHash(spec))
+	}
+	return append(args, spec...)
+}
+
+// containerRunSpec is the part of `run -d` that defines the container:
+// ports, volumes, env, image and command. Env vars are passed in name
+// order so the spec is stable between runs; those in secret are passed by
+// name only, for the engine to read from its own env.
+func containerRunSpec(task Task, secret map[string]string) []string {
+	var args []string
+	for _, p := range task.Ports {
+		args = append(args, "-p", p)
+	}
+	for _, v := range task.Volumes {
+		args = append(args, "-v", v)
+	}
+	for _, k := range slices.Sorted(maps.Keys(task.Env)) {
+		if _, ok := secret[k]; ok {
+			args = append(args, "-e", k)
+		} else {
+			args = append(args, "-e", k+"="+task.Env[k])
+		}
+	}
+	args = append(args, task.Image)
+	return append(args, task.Args...)
+}
+
+// containerConfigHash identifies a containerRunSpec. Secret env values
+// aren't in the spec, so changing one alone doesn't recreate a container.
+func containerConfigHash(spec []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(spec, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// containerSecretEnv returns the entries of a task's unexpanded env whose
+// values reference a secret var, expanded with the secret decrypted.
+// Expanded the usual way they'd hold the mask, and the plaintext can't go
+// on the engine's command line, where ps shows it to every user.
+func containerSecretEnv(env map[string]string) map[string]string {
+	out := make(map[string]string)
+	for k, v := range env {
+		secret := false
+		plain := os.Expand(v, func(key string) string {
+			raw, ok := lookupRaidVarRaw(key)
+			if !ok {
+				return ""
+			}
+			if isSecretValue(raw) {
+				secret = true
+			}
+			plain, _ := revealRaidVar(key, raw)
+			return plain
+		})
+		if secret {
+			out[k] = plain
+		}
+	}
+	return out
+}
+
+// containerEngine resolves the engine a task runs: the one it names, or
+// docker when it's on PATH, then podman.
+func containerEngine(engine string) (string, error) {
+	switch e := strings.ToLower(engine); e {
+	case containerEngineDocker, containerEnginePodman:
+		return e, nil
+	case "":
+		for _, e := range []string{containerEngineDocker, containerEnginePodman} {
+			if _, err := exec.LookPath(e); err == nil {
+				return e, nil
+			}
+		}
+		return "", liberrs.TaskContainerFailed("engine", errors.New("neither docker nor podman was found on PATH"))
+	}
+	return "", liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid Container engine '%s' (supported: docker, podman)", engine)
+}
+
+// runContainerCmd runs the engine with args. env holds the values of env
+// vars args pass by name only.
+func runContainerCmd(engine, op string, task Task, args []string, env map[string]string) error {
+	cmd := exec.Command(engine, args...)
+	cmd.Dir = task.Path
+	cmd.Env = append(buildSubprocessEnv(), commandLocksEnv(task)...)
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		cmd.Env = append(cmd.Env, k+"="+env[k])
+	}
+	flush := setCmdOutput(cmd, task)
+	defer flush()
+
+	if err := cmd.Run(); err != nil {
+		return liberrs.TaskContainerFailed(op, fmt.Errorf("%s %s: %w", engine, strings.Join(args, " "), err))
+	}
+	return nil
+}
+
+// inspectContainer prints the named container's state with the given Go
+// template.
+func inspectContainer(engine, dir, name, format string) (string, error) {
+	cmd := exec.Command(engine, "inspect", "--format", format, name)
+	cmd.Dir = dir
+	cmd.Env = buildSubprocessEnv()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// containerState reports whether the named container is running, whether
+// it exists at all, and its containerConfigLabel. A failed inspect counts
+// as not existing.
+func containerState(engine, dir, name string) (running, exists bool, config string) {
+	out, err := inspectContainer(engine, dir, name, containerStateFormat)
+	if err != nil {
+		return false, false, ""
+	}
+	state, config, _ := strings.Cut(out, " ")
+	return state == "true", true, config
+}
+
+// waitContainerHealthy polls the container's healthcheck until it reports
+// healthy. A container that stops, or has no healthcheck, fails at once;
+// one that doesn't exist yet is waited for, since compose may still be
+// creating it. An interrupt ends the wait with a Cancelled error.
+func waitContainerHealthy(engine string, task Task) error {
+	timeout, err := parseWaitDuration("timeout", task.Timeout, defaultWaitTimeout)
+	if err != nil {
+		return err
+	}
+	interval, err := parseWaitDuration("interval", task.Interval, defaultWaitInterval)
+	if err != nil {
+		return err
+	}
+
+	lockedFprintf(commandStdout, "Waiting for container %s to be healthy (timeout: %s)...\n", task.Container, timeout)
+	deadline := time.Now().Add(timeout)
+	var last string
+	for {
+		if err := checkInterrupted(); err != nil {
+			return err
+		}
+		out, err := inspectContainer(engine, task.Path, task.Container, containerHealthFormat)
+		if err != nil {
+			last = err.Error()
+		} else {
+			state, health, _ := strings.Cut(out, " ")
+			switch {
+			case health == "healthy":
+				return nil
+			case state == "exited" || state == "dead":
+				return liberrs.TaskContainerFailed(containerHealth, fmt.Errorf("container %s is %s", task.Container, state))
+			case health == "":
+				return liberrs.TaskContainerFailed(containerHealth, fmt.Errorf("container %s has no healthcheck", task.Container))
+			}
+			last = "health is " + health
+		}
+		wait := min(interval, time.Until(deadline))
+		if wait <= 0 {
+			break
+		}
+		if err := sleepInterruptible(wait); err != nil {
+			return err
+		}
+	}
+	return liberrs.TaskContainerFailed(containerHealth, fmt.Errorf("timed out waiting for container %s after %s: %s", task.Container, timeout, last))
+}
@@ -0,0 +1,270 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+)
+
+// fakeEngineScript records each call in $FAKE_ENGINE_DIR/calls, followed
+// by the value of the env var $FAKE_ENGINE_ENV names, if set. Each
+// inspect prints the next line of $FAKE_ENGINE_DIR/inspect, repeating the
+// last one; a "missing" line fails the way an unknown container does. It
+// sticks to shell builtins so it works with PATH pointing only at it.
+const fakeEngineScript = `#!/bin/sh
+d="$FAKE_ENGINE_DIR"
+echo "${0##*/} $*" >> "$d/calls"
+[ -n "$FAKE_ENGINE_ENV" ] && eval "echo \"$FAKE_ENGINE_ENV=\${$FAKE_ENGINE_ENV}\"" >> "$d/calls"
+[ "$1" = inspect ] || exit "${FAKE_ENGINE_EXIT:-0}"
+n=0
+[ -f "$d/n" ] && read -r n < "$d/n"
+n=$((n+1))
+echo "$n" > "$d/n"
+i=0
+while IFS= read -r line; do
+	i=$((i+1))
+	out=$line
+	[ "$i" -ge "$n" ] && break
+done < "$d/inspect"
+if [ "$out" = missing ]; then
+	echo "Error: no such container" >&2
+	exit 1
+fi
+echo "$out"
+`
+
+// fakeEngine installs fake engine binaries with the given names as the
+// only entries on PATH. Inspect answers with the given lines.
+func fakeEngine(t *testing.T, names []string, inspect ...string) (calls func() []string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake engine is a shell script")
+	}
+	dir := t.TempDir()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(fakeEngineScript), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(inspect) == 0 {
+		inspect = []string{"missing"}
+	}
+	os.WriteFile(filepath.Join(dir, "inspect"), []byte(strings.Join(inspect, "\n")+"\n"), 0o644)
+	t.Setenv("PATH", dir)
+	t.Setenv("FAKE_ENGINE_DIR", dir)
+	return func() []string {
+		data, _ := os.ReadFile(filepath.Join(dir, "calls"))
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+}
+
+func TestExecuteTask_containerRun(t *testing.T) {
+	calls := fakeEngine(t, []string{"docker", "podman"})
+	withRaidVar(t, "PG_VERSION", "16")
+
+	var err error
+	withCapturedStdout(t, func() {
+		err = ExecuteTask(Task{
+			Type: Container, Op: "run", Image: "postgres:$PG_VERSION", Container: "db",
+			Ports: []string{"5432:5432"}, Volumes: []string{"pgdata:/var/lib/postgresql/data"},
+			Env:  map[string]string{"POSTGRES_USER": "dev", "POSTGRES_DB": "app_$PG_VERSION"},
+			Args: []string{"postgres", "-c", "fsync=off"},
+		})
+	})
+	if err != nil {
+		t.Fatalf("ExecuteTask() error: %v", err)
+	}
+	spec := "-p 5432:5432 -v pgdata:/var/lib/postgresql/data -e POSTGRES_DB=app_16 -e POSTGRES_USER=dev postgres:16 postgres -c fsync=off"
+	want := []string{
+		"docker inspect --format " + containerStateFormat + " db",
+		"docker run -d --name db --label raid.config=" + containerConfigHash(strings.Fields(spec)) + " " + spec,
+	}
+	if got := calls(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestExecuteTask_containerRunSecretEnv(t *testing.T) {
+	calls := fakeEngine(t, []string{"docker"})
+	setupVarsFile(t)
+	if _, err := PersistVar("DB_PASS", "hunter22", VarScopeSession, true); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FAKE_ENGINE_ENV", "POSTGRES_PASSWORD")
+
+	var err error
+	withCapturedStdout(t, func() {
+		err = ExecuteTask(Task{
+			Type: Container, Op: "run", Image: "postgres",
+			Env: map[string]string{"POSTGRES_USER": "dev", "POSTGRES_PASSWORD": "pw-$DB_PASS"},
+		})
+	})
+	if err != nil {
+		t.Fatalf("ExecuteTask() error: %v", err)
+	}
+	// The secret goes by name on the command line, and its decrypted
+	// value through the engine's env.
+	want := []string{
+		"docker run -d -e POSTGRES_PASSWORD -e POSTGRES_USER=dev postgres",
+		"POSTGRES_PASSWORD=pw-hunter22",
+	}
+	if got := calls(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestExecuteTask_containerRunExisting(t *testing.T) {
+	config := containerConfigHash([]string{"postgres"})
+	inspect := "docker inspect --format " + containerStateFormat + " db"
+	run := "docker run -d --name db --label raid.config=" + config + " postgres"
+	tests := []struct {
+		name  string
+		state string
+		calls []string
+		out   string
+	}{
+		{"running", "true " + config, []string{inspect}, "already running"},
+		{"running with other settings", "true 0123456789abcdef", []string{inspect}, "already running"},
+		{"stopped", "false " + config, []string{inspect, "docker start db"}, ""},
+		{"stopped, not created by raid", "false", []string{inspect, "docker start db"}, ""},
+		{"stopped with other settings", "false 0123456789abcdef", []string{inspect, "docker rm db", run}, "recreating"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeEngine(t, []string{"docker"}, tt.state)
+			out := withCapturedStdout(t, func() {
+				if err := ExecuteTask(Task{Type: Container, Op: "run", Image: "postgres", Container: "db"}); err != nil {
+					t.Fatalf("ExecuteTask() error: %v", err)
+				}
+			})
+			if got := calls(); strings.Join(got, "\n") != strings.Join(tt.calls, "\n") || !strings.Contains(out, tt.out) {
+				t.Errorf("calls = %q, output = %q; want calls %q", got, out, tt.calls)
+			}
+		})
+	}
+}
+
+func TestExecuteTask_containerOps(t *testing.T) {
+	calls := fakeEngine(t, []string{"podman"}, "true")
+	repo := t.TempDir()
+	for _, task := range []Task{
+		{Type: Container, Engine: "podman", Op: "compose-up", File: "compose.dev.yml", Path: repo, Args: []string{"db", "cache"}},
+		{Type: Container, Op: "pull", Image: "redis:7"},
+		{Type: Container, Op: "exec", Container: "db", Args: []string{"psql", "-c", "select 1"}},
+		{Type: Container, Op: "stop", Container: "db"},
+		{Type: Container, Op: "compose-down", Args: []string{"-v"}},
+	} {
+		withCapturedStdout(t, func() {
+			if err := ExecuteTask(task); err != nil {
+				t.Fatalf("ExecuteTask(%s) error: %v", task.Op, err)
+			}
+		})
+	}
+	want := []string{
+		"podman compose -f " + filepath.Join(repo, "compose.dev.yml") + " up -d db cache",
+		"podman pull redis:7",
+		"podman exec db psql -c select 1",
+		"podman inspect --format " + containerStateFormat + " db",
+		"podman stop db",
+		"podman compose down -v",
+	}
+	if got := calls(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestExecuteTask_containerStopNotRunning(t *testing.T) {
+	calls := fakeEngine(t, []string{"docker"}, "missing")
+	out := withCapturedStdout(t, func() {
+		if err := ExecuteTask(Task{Type: Container, Op: "stop", Container: "db"}); err != nil {
+			t.Fatalf("ExecuteTask() error: %v", err)
+		}
+	})
+	if got := calls(); len(got) != 1 || !strings.Contains(out, "not running") {
+		t.Errorf("calls = %q, output = %q; want no stop", got, out)
+	}
+}
+
+func TestExecuteTask_containerEngineFailure(t *testing.T) {
+	fakeEngine(t, []string{"docker"})
+	t.Setenv("FAKE_ENGINE_EXIT", "1")
+	err := ExecuteTask(Task{Type: Container, Op: "pull", Image: "redis"})
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeTaskContainerFailed || !strings.Contains(err.Error(), "docker pull redis") {
+		t.Errorf("error = %v, want TASK_CONTAINER_FAILED naming the command", err)
+	}
+}
+
+func TestContainerEngine_detect(t *testing.T) {
+	calls := fakeEngine(t, []string{"podman"})
+	if err := ExecuteTask(Task{Type: Container, Op: "pull", Image: "redis"}); err != nil {
+		t.Fatalf("ExecuteTask() error: %v", err)
+	}
+	if got := calls(); got[0] != "podman pull redis" {
+		t.Errorf("calls = %q, want podman used", got)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	err := ExecuteTask(Task{Type: Container, Op: "pull", Image: "redis"})
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeTaskContainerFailed {
+		t.Errorf("no engine error = %v, want TASK_CONTAINER_FAILED", err)
+	}
+}
+
+func TestExecuteTask_containerHealth(t *testing.T) {
+	tests := []struct {
+		name    string
+		inspect []string
+		code    string
+		reason  string
+	}{
+		{"becomes healthy", []string{"missing", "running starting", "running healthy"}, "", ""},
+		{"no healthcheck", []string{"running"}, liberrs.CodeTaskContainerFailed, "no healthcheck"},
+		{"exited", []string{"running starting", "exited"}, liberrs.CodeTaskContainerFailed, "is exited"},
+		{"timeout", []string{"running unhealthy"}, liberrs.CodeTaskContainerFailed, "health is unhealthy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeEngine(t, []string{"docker"}, tt.inspect...)
+			var err error
+			withCapturedStdout(t, func() {
+				err = ExecuteTask(Task{Type: Container, Op: "health", Container: "db", Interval: "10ms", Timeout: "200ms"})
+			})
+			if tt.code == "" {
+				if err != nil {
+					t.Fatalf("ExecuteTask() error: %v", err)
+				}
+				return
+			}
+			if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != tt.code || !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("error = %v, want %s mentioning %q", err, tt.code, tt.reason)
+			}
+		})
+	}
+}
+
+func TestExecuteTask_containerConfigErrors(t *testing.T) {
+	calls := fakeEngine(t, []string{"docker"})
+	for _, task := range []Task{
+		{Type: Container},
+		{Type: Container, Op: "restart"},
+		{Type: Container, Op: "run"},
+		{Type: Container, Op: "pull"},
+		{Type: Container, Op: "stop"},
+		{Type: Container, Op: "exec", Container: "db"},
+		{Type: Container, Op: "health"},
+		{Type: Container, Op: "pull", Image: "redis", Engine: "lxc"},
+		{Type: Container, Op: "health", Container: "db", Timeout: "soon"},
+	} {
+		err := ExecuteTask(task)
+		if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeArgInvalid {
+			t.Errorf("ExecuteTask(%+v) = %v, want ARG_INVALID", task, err)
+		}
+	}
+	if got := calls(); len(got) != 1 || got[0] != "" {
+		t.Errorf("invalid tasks ran the engine: %q", got)
+	}
+}
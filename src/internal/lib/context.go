@@ -79,6 +79,28 @@ type WorkspaceCommand struct {
 	// clients can rely on `agent.safe` being present — a command with
 	// no `agent:` block in YAML surfaces as `{safe: false}`.
 	Agent WorkspaceAgent `json:"agent"`
+	// Requires lists the variables the command checks before running —
+	// the profile's requires followed by the command's own — so an
+	// agent knows what to supply before invoking it.
+	Requires []WorkspaceRequirement `json:"requires,omitempty"`
+	// Commands are the command's children. Their names are full paths,
+	// e.g. "db migrate", which is how raid_run_task addresses them.
+	Commands []WorkspaceCommand `json:"commands,omitempty"`
+	// Aliases, Hidden and Deprecated mirror the command's definition. An
+	// agent should prefer the replacement a deprecated command names.
+	Aliases    []string `json:"aliases,omitempty"`
+	Hidden     bool     `json:"hidden,omitempty"`
+	Deprecated string   `json:"deprecated,omitempty"`
+}
+
+// WorkspaceRequirement is the wire form of Requirement. Satisfied
+// reflects the variable's state when the snapshot was taken; a command
+// arg of the same name can still satisfy it at invocation time.
+type WorkspaceRequirement struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern,omitempty"`
+	Description string `json:"description,omitempty"`
+	Satisfied   bool   `json:"satisfied"`
 }
 
 // WorkspaceAgent is the wire form of Agent. `Safe` has no `omitempty`
@@ -175,16 +197,47 @@ func GetWorkspaceContext() WorkspaceContext {
 
 	wc.Workspace.Commands = make([]WorkspaceCommand, 0, len(profile.Commands))
 	for _, cmd := range profile.Commands {
-		wc.Workspace.Commands = append(wc.Workspace.Commands, WorkspaceCommand{
-			Name:        cmd.Name,
-			Description: cmd.Usage,
-			Steps:       collectSteps(cmd.Tasks),
-			Agent:       resolveAgent(cmd),
-		})
+		wc.Workspace.Commands = append(wc.Workspace.Commands, describeCommand(cmd, profile.Requires))
 	}
 	return wc
 }
 
+// describeCommand builds the wire form of cmd, whose Name is its full
+// path, and of its children.
+func describeCommand(cmd Command, profileRequires []Requirement) WorkspaceCommand {
+	out := WorkspaceCommand{
+		Name:        cmd.Name,
+		Description: cmd.Usage,
+		Steps:       collectSteps(cmd.Tasks),
+		Agent:       resolveAgent(cmd),
+		Requires:    describeRequirements(profileRequires, cmd.Requires),
+		Aliases:     cmd.Aliases,
+		Hidden:      cmd.Hidden,
+		Deprecated:  cmd.Deprecated,
+	}
+	for _, child := range cmd.Commands {
+		child.Name = cmd.Name + " " + child.Name
+		out.Commands = append(out.Commands, describeCommand(child, profileRequires))
+	}
+	return out
+}
+
+// describeRequirements flattens the merged requirement lists into their
+// wire form. Returns nil when nothing is required so the field is
+// omitted from the JSON.
+func describeRequirements(lists ...[]Requirement) []WorkspaceRequirement {
+	var out []WorkspaceRequirement
+	for _, r := range mergeRequirements(lists...) {
+		out = append(out, WorkspaceRequirement{
+			Name:        r.Name,
+			Pattern:     r.Pattern,
+			Description: r.Description,
+			Satisfied:   r.Unmet() == "",
+		})
+	}
+	return out
+}
+
 // collectSteps returns one WorkspaceStep per task in tasks that has a
 // populated Name. Unnamed tasks are skipped — the goal is an outline of
 // user-meaningful labels, not a full transcript of the task sequence.
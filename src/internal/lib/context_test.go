@@ -1,8 +1,10 @@
 package lib
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -121,6 +123,48 @@ func TestGetWorkspaceContext_includesCommands(t *testing.T) {
 	}
 }
 
+func TestGetWorkspaceContext_nestedCommands(t *testing.T) {
+	resetWorkspaceContextState(t)
+	storeContext(&Context{
+		Profile: Profile{
+			Name: "demo",
+			Path: "/tmp/demo.raid.yaml",
+			Commands: []Command{{Name: "db", Usage: "Database tasks", Commands: []Command{
+				{Name: "migrate", Usage: "Apply migrations", Agent: &Agent{Safe: true}},
+			}}},
+		},
+	})
+
+	got := GetWorkspaceContext().Workspace.Commands
+	if len(got) != 1 || len(got[0].Commands) != 1 {
+		t.Fatalf("Commands = %+v, want db with one child", got)
+	}
+	if child := got[0].Commands[0]; child.Name != "db migrate" || child.Description != "Apply migrations" || !child.Agent.Safe {
+		t.Errorf("child = %+v, want full path name and its own agent", child)
+	}
+}
+
+func TestGetWorkspaceContext_commandDeprecation(t *testing.T) {
+	resetWorkspaceContextState(t)
+	storeContext(&Context{
+		Profile: Profile{
+			Name: "demo",
+			Path: "/tmp/demo.raid.yaml",
+			Commands: []Command{
+				{Name: "setup", Aliases: []string{"init"}},
+				{Name: "bootstrap", Deprecated: "use setup", Hidden: true},
+			},
+		},
+	})
+
+	data, _ := json.Marshal(GetWorkspaceContext().Workspace.Commands)
+	for _, want := range []string{`"aliases":["init"]`, `"hidden":true`, `"deprecated":"use setup"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("commands JSON missing %s: %s", want, data)
+		}
+	}
+}
+
 // TestGetWorkspaceContext_populatesAgentForProfileCommands verifies that a
 // command's agent block flows into the WorkspaceCommand snapshot.
 func TestGetWorkspaceContext_populatesAgentForProfileCommands(t *testing.T) {
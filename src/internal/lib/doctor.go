@@ -131,6 +131,13 @@ func checkProfile() []Finding {
 	}
 
 	findings = append(findings, checkVerify("verify", fullProfile.Verify, sys.GetHomeDir())...)
+	findings = append(findings, checkRequires("requires", fullProfile.Requires, SeverityError, "")...)
+	if env := GetEnv(); env != "" {
+		findings = append(findings, checkRequires(fmt.Sprintf("env/%s requires", env), fullProfile.getEnv(env).Requires, SeverityError, "")...)
+	}
+	walkCommands(fullProfile.Commands, func(cmd Command) {
+		findings = append(findings, checkRequires(fmt.Sprintf("command/%s requires", cmd.Name), cmd.Requires, SeverityWarn, cmd.Name)...)
+	})
 
 	if len(fullProfile.Repositories) == 0 {
 		return append(findings, Finding{
@@ -220,6 +227,45 @@ func checkRepo(repo Repo) []Finding {
 	repo.Verify = append(repo.Verify, repoConfig.Verify...)
 
 	findings = append(findings, checkVerify(fmt.Sprintf("repo/%s verify", repo.Name), repo.Verify, repoPath)...)
+	if env := GetEnv(); env != "" {
+		findings = append(findings, checkRequires(fmt.Sprintf("repo/%s env/%s requires", repo.Name, env), repoConfig.getEnv(env).Requires, SeverityError, "")...)
+	}
+	walkCommands(repoConfig.Commands, func(cmd Command) {
+		findings = append(findings, checkRequires(fmt.Sprintf("repo/%s command/%s requires", repo.Name, cmd.Name), cmd.Requires, SeverityWarn, cmd.Name)...)
+	})
+	return findings
+}
+
+// checkRequires reports each `requires:` entry as a finding. Profile and
+// active-env requirements gate the next `raid env` run, so callers pass
+// SeverityError for those. Command requirements are reported as warnings
+// because a declared arg or flag of the same name can still supply the
+// value at invocation time; command names the command for the
+// suggestion and is empty otherwise.
+func checkRequires(label string, reqs []Requirement, unmetSeverity Severity, command string) []Finding {
+	var findings []Finding
+	for _, r := range reqs {
+		check := fmt.Sprintf("%s/%s", label, r.Name)
+		reason := r.Unmet()
+		if reason == "" {
+			findings = append(findings, Finding{Severity: SeverityOK, Check: check, Message: "set"})
+			continue
+		}
+		msg := reason
+		if r.Description != "" {
+			msg = fmt.Sprintf("%s (%s)", reason, r.Description)
+		}
+		suggestion := fmt.Sprintf("export %s before running raid", r.Name)
+		if command != "" {
+			suggestion = fmt.Sprintf("export %s or pass it as an argument before running 'raid %s'", r.Name, command)
+		}
+		findings = append(findings, Finding{
+			Severity:   unmetSeverity,
+			Check:      check,
+			Message:    msg,
+			Suggestion: suggestion,
+		})
+	}
 	return findings
 }
 
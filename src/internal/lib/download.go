@@ -0,0 +1,223 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+)
+
+// checksum is the digest an HTTP download must match, from `sha256:` or
+// `sha512:`.
+type checksum struct {
+	algo string
+	new  func() hash.Hash
+	want string // lowercase hex
+}
+
+// verify compares a computed digest against the expected one.
+func (c *checksum) verify(sum []byte, what string) error {
+	if got := hex.EncodeToString(sum); got != c.want {
+		return liberrs.Newf(liberrs.CodeTaskHTTPFailed, liberrs.CategoryNetwork, "%s checksum mismatch for %s: got %s, want %s", c.algo, what, got, c.want)
+	}
+	return nil
+}
+
+// resolveChecksum returns the checksum an HTTP task declares, or nil when
+// it declares none. A value starting with http:// or https:// names a
+// checksums file (`sha256sum` output) that is fetched with client and
+// searched for the downloaded file's name.
+func resolveChecksum(client *http.Client, task Task) (*checksum, error) {
+	c := &checksum{}
+	value := ""
+	switch {
+	case task.SHA256 != "" && task.SHA512 != "":
+		return nil, liberrs.ArgInvalid("sha256 and sha512 are mutually exclusive for HTTP task")
+	case task.SHA256 != "":
+		c.algo, c.new, value = "sha256", sha256.New, task.SHA256
+	case task.SHA512 != "":
+		c.algo, c.new, value = "sha512", sha512.New, task.SHA512
+	default:
+		return nil, nil
+	}
+
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") {
+		sum, err := fetchChecksum(client, value, task)
+		if err != nil {
+			return nil, err
+		}
+		value = sum
+	}
+	c.want = strings.ToLower(value)
+	if _, err := hex.DecodeString(c.want); err != nil || len(c.want) != c.new().Size()*2 {
+		return nil, liberrs.ArgInvalid(fmt.Sprintf("%s %q is not a %d-character hex digest", c.algo, value, c.new().Size()*2))
+	}
+	return c, nil
+}
+
+// fetchChecksum downloads a checksums file and picks the digest for this
+// task's file: the line naming the URL's last path element (or dest's
+// base name), or the only digest when the file holds just one.
+func fetchChecksum(client *http.Client, sumsURL string, task Task) (string, error) {
+	resp, err := client.Get(sumsURL)
+	if err != nil {
+		return "", liberrs.Newf(liberrs.CodeTaskHTTPFailed, liberrs.CategoryNetwork, "failed to fetch checksums '%s': %v", sumsURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", liberrs.Newf(liberrs.CodeTaskHTTPFailed, liberrs.CategoryNetwork, "checksums request to '%s' returned status %d", sumsURL, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", liberrs.Newf(liberrs.CodeTaskHTTPFailed, liberrs.CategoryNetwork, "failed to read checksums '%s': %v", sumsURL, err)
+	}
+
+	names := map[string]bool{}
+	if u, err := url.Parse(task.URL); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		names[path.Base(u.Path)] = true
+	}
+	if task.Dest != "" {
+		names[filepath.Base(task.Dest)] = true
+	}
+
+	var only []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		only = append(only, fields[0])
+		// sha256sum marks binary-mode entries with a leading '*'.
+		if len(fields) >= 2 && names[strings.TrimPrefix(fields[len(fields)-1], "*")] {
+			return fields[0], nil
+		}
+	}
+	if len(only) == 1 {
+		return only[0], nil
+	}
+	return "", liberrs.Newf(liberrs.CodeTaskHTTPFailed, liberrs.CategoryNetwork, "checksums '%s' has no entry for %s", sumsURL, strings.Join(slices.Sorted(maps.Keys(names)), " or "))
+}
+
+// fileMatchesChecksum reports whether path exists and already has the
+// expected digest, so a repeat run can skip the download.
+func fileMatchesChecksum(path string, sum *checksum) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	h := sum.new()
+	if _, err := io.Copy(h, f); err != nil {
+		return false
+	}
+	return sum.verify(h.Sum(nil), path) == nil
+}
+
+// OctalMode is a task's `mode:`, written as octal digits. YAML hands it
+// over as a string either way; JSON may have it as a bare number (755),
+// whose digits are taken as octal too.
+type OctalMode string
+
+func (m *OctalMode) UnmarshalJSON(data []byte) error {
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err == nil {
+		*m = OctalMode(n.String())
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("mode must be octal permissions such as \"0755\"")
+	}
+	*m = OctalMode(s)
+	return nil
+}
+
+// parseFileMode reads `mode:` as octal ("0755" or "755"). Empty means
+// the default.
+func parseFileMode(s string) (fs.FileMode, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(s, "0o"), 8, 32)
+	if err != nil || n > 0o7777 {
+		return 0, liberrs.ArgInvalid(fmt.Sprintf("invalid mode %q: want octal permissions such as 0755", s))
+	}
+	return fs.FileMode(n), nil
+}
+
+// writeFileAtomic streams body to dest through a temp file in the same
+// directory, verifying sum on the way when set, and renames it into place
+// only once everything succeeded — a failed or mismatched write never
+// leaves a partial or wrong dest behind. mode, when non-zero, is applied
+// before the rename; otherwise an existing dest keeps its permissions and
+// a new one gets 0644.
+func writeFileAtomic(dest string, body io.Reader, sum *checksum, mode fs.FileMode) error {
+	dir := filepath.Dir(dest)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to create directory for '%s': %v", dest, err)
+	}
+	if fi, err := os.Stat(dest); err == nil && fi.IsDir() {
+		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to create file '%s': is a directory", dest)
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to create file '%s': %v", dest, err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	var h hash.Hash
+	w := io.Writer(tmp)
+	if sum != nil {
+		h = sum.new()
+		w = io.MultiWriter(tmp, h)
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		tmp.Close()
+		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to write to '%s': %v", dest, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to write to '%s': %v", dest, err)
+	}
+	if sum != nil {
+		if err := sum.verify(h.Sum(nil), dest); err != nil {
+			return err
+		}
+	}
+
+	if mode == 0 {
+		mode = 0644
+		if fi, err := os.Stat(dest); err == nil {
+			mode = fi.Mode().Perm()
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to stat '%s': %v", dest, err)
+		}
+	}
+	if err := os.Chmod(tmpName, mode); err != nil {
+		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to set mode on '%s': %v", dest, err)
+	}
+	if err := os.Rename(tmpName, dest); err != nil {
+		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to replace '%s': %v", dest, err)
+	}
+	return nil
+}
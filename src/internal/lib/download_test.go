@@ -0,0 +1,130 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const downloadBody = "#!/bin/sh\necho tool\n"
+
+func downloadSum() string {
+	s := sha256.Sum256([]byte(downloadBody))
+	return hex.EncodeToString(s[:])
+}
+
+// downloadServer serves downloadBody at /tool and a sha256sum-style
+// checksums file at /SHA256SUMS, counting requests for /tool.
+func downloadServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tool":
+			hits.Add(1)
+			w.Write([]byte(downloadBody))
+		case "/SHA256SUMS":
+			fmt.Fprintf(w, "%s *other\n%s *tool\n", strings.Repeat("0", 64), downloadSum())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func TestExecuteTask_httpChecksumAndMode(t *testing.T) {
+	srv, hits := downloadServer(t)
+	dest := filepath.Join(t.TempDir(), "bin", "tool")
+
+	task := Task{Type: HTTP, URL: srv.URL + "/tool", Dest: dest, SHA256: downloadSum(), Mode: "0755"}
+	if err := ExecuteTask(task); err != nil {
+		t.Fatalf("ExecuteTask() error: %v", err)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != downloadBody {
+		t.Errorf("dest = %q, want the download", got)
+	}
+	if runtime.GOOS != "windows" {
+		if fi, _ := os.Stat(dest); fi.Mode().Perm() != 0o755 {
+			t.Errorf("mode = %o, want 0755", fi.Mode().Perm())
+		}
+	}
+
+	// Already in place with the right digest: no second request.
+	if err := ExecuteTask(task); err != nil {
+		t.Fatalf("second ExecuteTask() error: %v", err)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("server hit %d times, want 1 (re-download skipped)", n)
+	}
+}
+
+func TestExecuteTask_httpChecksumMismatchKeepsDest(t *testing.T) {
+	srv, _ := downloadServer(t)
+	dest := filepath.Join(t.TempDir(), "tool")
+	os.WriteFile(dest, []byte("previous"), 0o644)
+
+	err := ExecuteTask(Task{Type: HTTP, URL: srv.URL + "/tool", Dest: dest, SHA256: strings.Repeat("a", 64)})
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("error = %v, want a checksum mismatch", err)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != "previous" {
+		t.Errorf("dest = %q, want the previous file untouched", got)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(dest))
+	if len(entries) != 1 {
+		t.Errorf("dir has %d entries, want no leftover temp file", len(entries))
+	}
+}
+
+func TestExecuteTask_httpChecksumFromURL(t *testing.T) {
+	srv, _ := downloadServer(t)
+	dest := filepath.Join(t.TempDir(), "renamed")
+
+	if err := ExecuteTask(Task{Type: HTTP, URL: srv.URL + "/tool", Dest: dest, SHA256: srv.URL + "/SHA256SUMS"}); err != nil {
+		t.Fatalf("ExecuteTask() error: %v", err)
+	}
+	err := ExecuteTask(Task{Type: HTTP, URL: srv.URL + "/tool?x=1", Dest: dest, SHA512: srv.URL + "/SHA256SUMS"})
+	if err == nil {
+		t.Error("sha512 accepted a 64-character digest")
+	}
+}
+
+func TestResolveChecksum_invalid(t *testing.T) {
+	for _, task := range []Task{
+		{SHA256: "abc"},
+		{SHA256: strings.Repeat("z", 64)},
+		{SHA256: downloadSum(), SHA512: downloadSum()},
+	} {
+		if _, err := resolveChecksum(http.DefaultClient, task); err == nil {
+			t.Errorf("resolveChecksum(%+v) = nil error", task)
+		}
+	}
+}
+
+func TestParseFileMode(t *testing.T) {
+	var task Task
+	if err := yaml.Unmarshal([]byte("mode: 0755"), &task); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := parseFileMode(string(task.Mode)); err != nil || m != 0o755 {
+		t.Errorf("parseFileMode(%q) = %o, %v; want 0755", task.Mode, m, err)
+	}
+	var fromJSON OctalMode
+	if err := fromJSON.UnmarshalJSON([]byte("755")); err != nil || fromJSON != "755" {
+		t.Errorf("UnmarshalJSON(755) = %q, %v", fromJSON, err)
+	}
+	if _, err := parseFileMode("rwx"); err == nil {
+		t.Error("parseFileMode(rwx) = nil error")
+	}
+}
@@ -12,11 +12,16 @@ import (
 
 const activeEnvKey = "env"
 
-// Env represents a named environment with variables and tasks.
+// Env represents a named environment with variables and tasks. Requires
+// lists variables that must be set before the env is applied.
 type Env struct {
-	Name      string   `json:"name"`
-	Variables []EnvVar `json:"variables"`
-	Tasks     []Task   `json:"tasks"`
+	Name      string        `json:"name"`
+	Variables []EnvVar      `json:"variables"`
+	Tasks     []Task        `json:"tasks"`
+	Requires  []Requirement `json:"requires,omitempty"`
+	// Hooks are tasks run before and after the environment's tasks, on
+	// failure, and finally in any case.
+	Hooks `yaml:",inline"`
 }
 
 // IsZero reports whether the environment is uninitialized.
@@ -25,9 +30,12 @@ func (e Env) IsZero() bool {
 }
 
 // EnvVar is a key/value pair written into a repository's .env file.
+// Secret marks the value as sensitive so read-only surfaces (such as
+// `raid env diff`) mask it; it does not change what is written to .env.
 type EnvVar struct {
-	Name  string `json:"name"`
-	Value string `json:"value"`
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Secret bool   `json:"secret,omitempty"`
 }
 
 // SetEnv sets the named environment as the active environment.
@@ -91,6 +99,19 @@ func ExecuteEnv(name string) error {
 	if ctx == nil {
 		return liberrs.Internal("raid context is not initialized")
 	}
+	if err := checkEnvRequirements(ctx, name); err != nil {
+		return err
+	}
+	vars := map[string]string{"ENV": name}
+	if err := runLifecycleHook(hookPreEnv, vars); err != nil {
+		return err
+	}
+	return runPostHook(hookPostEnv, vars, applyEnv(ctx, name))
+}
+
+// applyEnv writes the named environment's variables to each repository's
+// .env file and runs its tasks.
+func applyEnv(ctx *Context, name string) error {
 	if err := setEnvVariablesForRepos(ctx, name); err != nil {
 		return liberrs.Newf(liberrs.CodeConfigInvalid, liberrs.CategoryConfig, "failed to set env variables: %v", err)
 	}
@@ -100,6 +121,16 @@ func ExecuteEnv(name string) error {
 	return nil
 }
 
+// checkEnvRequirements validates the profile's requires plus those of the
+// named env at profile and repo level, before anything is written.
+func checkEnvRequirements(ctx *Context, name string) error {
+	lists := [][]Requirement{ctx.Profile.Requires, ctx.Profile.getEnv(name).Requires}
+	for _, repo := range ctx.Profile.Repositories {
+		lists = append(lists, repo.getEnv(name).Requires)
+	}
+	return checkRequirements(fmt.Sprintf("environment '%s'", name), lists...)
+}
+
 func setEnvVariablesForRepos(ctx *Context, name string) error {
 	for _, repo := range ctx.Profile.Repositories {
 		// Skip repos that haven't been installed yet. buildEnvPath would
@@ -159,8 +190,8 @@ func runTasksForEnv(ctx *Context, name string) error {
 	// same tasks once, with the repo dir as the default, which is where
 	// tasks declared in a raid.yaml expect to execute.
 	if !ctx.Profile.IsSingleRepo() {
-		if env := ctx.Profile.getEnv(name); !env.IsZero() && len(env.Tasks) > 0 {
-			if err := ExecuteTasks(withDefaultDir(env.Tasks, sys.GetHomeDir())); err != nil {
+		if env := ctx.Profile.getEnv(name); !env.IsZero() {
+			if err := runEnvTasks(env, sys.GetHomeDir()); err != nil {
 				return err
 			}
 		}
@@ -173,16 +204,23 @@ func runTasksForEnv(ctx *Context, name string) error {
 	// profile-level environments when applied".
 	for _, repo := range ctx.Profile.Repositories {
 		env := repo.getEnv(name)
-		if env.IsZero() || len(env.Tasks) == 0 {
+		if env.IsZero() {
 			continue
 		}
-		if err := ExecuteTasks(withDefaultDir(env.Tasks, sys.ExpandPath(repo.Path))); err != nil {
+		if err := runEnvTasks(env, sys.ExpandPath(repo.Path)); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// runEnvTasks runs env's tasks and hooks with dir as their default
+// working directory.
+func runEnvTasks(env Env, dir string) error {
+	withDir := func(tasks []Task) []Task { return withDefaultDir(tasks, dir) }
+	return runHooked(env.Hooks.mapTasks(withDir), withDir(env.Tasks))
+}
+
 // mergeEnvironments merges additional into base by Name. On name conflicts
 // base wins, mirroring the mergeCommands contract — the wrapping profile
 // is canonical, and a per-repo raid.yaml can't silently override an env
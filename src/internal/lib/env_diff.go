@@ -0,0 +1,221 @@
+package lib
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+)
+
+// maskedValue replaces a secret variable's value anywhere raid renders it
+// for humans or agents. Fixed-width so the mask leaks nothing about the
+// length of the underlying value.
+const maskedValue = "********"
+
+// secretNameMarkers are the substrings that mark a variable name as
+// secret-bearing when the variable wasn't explicitly flagged with
+// `secret: true`. Matched case-insensitively against the whole name.
+var secretNameMarkers = []string{"SECRET", "TOKEN", "PASSWORD", "PASSWD", "PASSPHRASE", "API_KEY", "APIKEY", "PRIVATE_KEY", "CREDENTIAL"}
+
+// isSecretName reports whether a variable name looks like it holds a
+// credential. A heuristic safety net for configs that predate the
+// explicit `secret:` flag — false negatives are possible, so authors
+// should still mark sensitive variables explicitly.
+func isSecretName(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, m := range secretNameMarkers {
+		if strings.Contains(upper, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// EnvDiff is the result of comparing two environments across the active
+// profile. Repos lists only repositories whose resolved variables or env
+// tasks differ; Tasks covers the profile-level env tasks.
+type EnvDiff struct {
+	From  string        `json:"from"`
+	To    string        `json:"to"`
+	Tasks *EnvTaskDiff  `json:"tasks,omitempty"`
+	Repos []RepoEnvDiff `json:"repos"`
+}
+
+// IsEmpty reports whether the two environments resolve identically.
+func (d EnvDiff) IsEmpty() bool {
+	return d.Tasks == nil && len(d.Repos) == 0
+}
+
+// RepoEnvDiff holds the per-repository differences between two
+// environments. Variables are the effective set written to the repo's
+// .env file — profile-level variables overlaid with the repo's own.
+type RepoEnvDiff struct {
+	Repo    string         `json:"repo"`
+	Added   []EnvVarChange `json:"added,omitempty"`
+	Removed []EnvVarChange `json:"removed,omitempty"`
+	Changed []EnvVarChange `json:"changed,omitempty"`
+	Tasks   *EnvTaskDiff   `json:"tasks,omitempty"`
+}
+
+// EnvVarChange describes one variable that differs between environments.
+// From is empty for added variables and To is empty for removed ones.
+// Secret values are replaced with a fixed mask before they get here.
+type EnvVarChange struct {
+	Name   string `json:"name"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+// EnvTaskDiff lists env tasks present in only one of the two environments.
+// Tasks are matched by their full definition, so a task whose command
+// changed shows up as removed from one side and added to the other.
+type EnvTaskDiff struct {
+	Removed []EnvTaskRef `json:"removed,omitempty"`
+	Added   []EnvTaskRef `json:"added,omitempty"`
+}
+
+// EnvTaskRef identifies a task by its position in the env's task list
+// (1-based) and its label. Task bodies are intentionally omitted so a
+// diff never echoes a command line that embeds a credential.
+type EnvTaskRef struct {
+	Index int    `json:"index"`
+	Label string `json:"label"`
+}
+
+// DiffEnvs compares two environments of the active profile. Both names
+// must resolve via ContainsEnv. Variables are compared per repository
+// using the same profile-then-repo overlay ExecuteEnv writes to .env;
+// tasks are compared at the profile level and per repository.
+func DiffEnvs(from, to string) (EnvDiff, error) {
+	ctx := loadContext()
+	if ctx == nil {
+		return EnvDiff{}, liberrs.Internal("raid context is not initialized")
+	}
+	for _, name := range []string{from, to} {
+		if !ContainsEnv(name) {
+			return EnvDiff{}, liberrs.EnvNotFound(name)
+		}
+	}
+
+	diff := EnvDiff{From: from, To: to, Repos: []RepoEnvDiff{}}
+
+	// Single-repo profiles hoist the repo's envs to profile level, so the
+	// profile pass would report every task twice. runTasksForEnv skips it
+	// for the same reason.
+	if !ctx.Profile.IsSingleRepo() {
+		diff.Tasks = diffEnvTasks(ctx.Profile.getEnv(from).Tasks, ctx.Profile.getEnv(to).Tasks)
+	}
+
+	for _, repo := range ctx.Profile.Repositories {
+		fromEnv, toEnv := repo.getEnv(from), repo.getEnv(to)
+		rd := diffEnvVars(
+			resolveEnvVars(ctx.Profile.getEnv(from).Variables, fromEnv.Variables),
+			resolveEnvVars(ctx.Profile.getEnv(to).Variables, toEnv.Variables),
+		)
+		rd.Repo = repo.Name
+		rd.Tasks = diffEnvTasks(fromEnv.Tasks, toEnv.Tasks)
+		if len(rd.Added) == 0 && len(rd.Removed) == 0 && len(rd.Changed) == 0 && rd.Tasks == nil {
+			continue
+		}
+		diff.Repos = append(diff.Repos, rd)
+	}
+	return diff, nil
+}
+
+// resolveEnvVars overlays repo variables on profile variables, matching
+// setEnvVariables' write order so the diff reflects what lands in .env.
+func resolveEnvVars(profVars, repoVars []EnvVar) map[string]EnvVar {
+	out := make(map[string]EnvVar, len(profVars)+len(repoVars))
+	for _, v := range profVars {
+		out[v.Name] = v
+	}
+	for _, v := range repoVars {
+		out[v.Name] = v
+	}
+	return out
+}
+
+func diffEnvVars(from, to map[string]EnvVar) RepoEnvDiff {
+	var rd RepoEnvDiff
+	for _, name := range sortedEnvVarNames(from, to) {
+		a, inFrom := from[name]
+		b, inTo := to[name]
+		secret := a.Secret || b.Secret || isSecretName(name)
+		mask := func(v string) string {
+			if secret && v != "" {
+				return maskedValue
+			}
+			return v
+		}
+		switch {
+		case inFrom && !inTo:
+			rd.Removed = append(rd.Removed, EnvVarChange{Name: name, From: mask(a.Value), Secret: secret})
+		case !inFrom && inTo:
+			rd.Added = append(rd.Added, EnvVarChange{Name: name, To: mask(b.Value), Secret: secret})
+		case a.Value != b.Value:
+			rd.Changed = append(rd.Changed, EnvVarChange{Name: name, From: mask(a.Value), To: mask(b.Value), Secret: secret})
+		}
+	}
+	return rd
+}
+
+func sortedEnvVarNames(maps ...map[string]EnvVar) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range maps {
+		for name := range m {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// diffEnvTasks returns nil when both task lists contain the same tasks.
+// Matching is by multiset of serialized definitions so duplicated tasks
+// are paired one-to-one and reordering alone doesn't register as a change.
+func diffEnvTasks(from, to []Task) *EnvTaskDiff {
+	remaining := make(map[string]int, len(to))
+	for _, t := range to {
+		remaining[taskFingerprint(t)]++
+	}
+	var d EnvTaskDiff
+	for i, t := range from {
+		fp := taskFingerprint(t)
+		if remaining[fp] > 0 {
+			remaining[fp]--
+			continue
+		}
+		d.Removed = append(d.Removed, EnvTaskRef{Index: i + 1, Label: t.Label()})
+	}
+
+	remaining = make(map[string]int, len(from))
+	for _, t := range from {
+		remaining[taskFingerprint(t)]++
+	}
+	for i, t := range to {
+		fp := taskFingerprint(t)
+		if remaining[fp] > 0 {
+			remaining[fp]--
+			continue
+		}
+		d.Added = append(d.Added, EnvTaskRef{Index: i + 1, Label: t.Label()})
+	}
+
+	if len(d.Removed) == 0 && len(d.Added) == 0 {
+		return nil
+	}
+	return &d
+}
+
+// taskFingerprint serializes a task's declared fields. Marshal can't fail
+// for Task (no channels, funcs, or cyclic values), so the error is dropped.
+func taskFingerprint(t Task) string {
+	data, _ := json.Marshal(t)
+	return string(data)
+}
@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
 )
 
 func TestEnvIsZero(t *testing.T) {
@@ -596,3 +598,144 @@ func TestRunTasksForEnv_singleRepoRunsOnceInRepoDir(t *testing.T) {
 		t.Errorf("env tasks ran %d times, want exactly once", got)
 	}
 }
+
+func TestDiffEnvs_reportsVarChangesPerRepo(t *testing.T) {
+	setupTestConfig(t)
+
+	storeContext(&Context{
+		Profile: Profile{
+			Name: "test",
+			Path: "/p.yaml",
+			Environments: []Env{
+				{Name: "staging", Variables: []EnvVar{{Name: "LOG_LEVEL", Value: "debug"}, {Name: "REGION", Value: "eu"}}},
+				{Name: "production", Variables: []EnvVar{{Name: "LOG_LEVEL", Value: "warn"}, {Name: "REGION", Value: "eu"}}},
+			},
+			Repositories: []Repo{
+				{
+					Name: "api",
+					Path: "/api",
+					Environments: []Env{
+						{Name: "staging", Variables: []EnvVar{{Name: "DEBUG_PORT", Value: "9229"}}},
+						{Name: "production", Variables: []EnvVar{{Name: "REPLICAS", Value: "3"}}},
+					},
+				},
+			},
+		},
+	})
+
+	diff, err := DiffEnvs("staging", "production")
+	if err != nil {
+		t.Fatalf("DiffEnvs: %v", err)
+	}
+	if diff.Tasks != nil {
+		t.Errorf("Tasks = %+v, want nil when neither env declares tasks", diff.Tasks)
+	}
+	if len(diff.Repos) != 1 || diff.Repos[0].Repo != "api" {
+		t.Fatalf("Repos = %+v, want one entry for api", diff.Repos)
+	}
+	rd := diff.Repos[0]
+	if len(rd.Added) != 1 || rd.Added[0] != (EnvVarChange{Name: "REPLICAS", To: "3"}) {
+		t.Errorf("Added = %+v", rd.Added)
+	}
+	if len(rd.Removed) != 1 || rd.Removed[0] != (EnvVarChange{Name: "DEBUG_PORT", From: "9229"}) {
+		t.Errorf("Removed = %+v", rd.Removed)
+	}
+	if len(rd.Changed) != 1 || rd.Changed[0] != (EnvVarChange{Name: "LOG_LEVEL", From: "debug", To: "warn"}) {
+		t.Errorf("Changed = %+v", rd.Changed)
+	}
+}
+
+func TestDiffEnvs_masksSecrets(t *testing.T) {
+	setupTestConfig(t)
+
+	storeContext(&Context{
+		Profile: Profile{
+			Name: "test",
+			Path: "/p.yaml",
+			Environments: []Env{
+				{Name: "a", Variables: []EnvVar{{Name: "DB_URL", Value: "postgres://a", Secret: true}, {Name: "GITHUB_TOKEN", Value: "ghp_a"}}},
+				{Name: "b", Variables: []EnvVar{{Name: "DB_URL", Value: "postgres://b"}, {Name: "GITHUB_TOKEN", Value: "ghp_b"}}},
+			},
+			Repositories: []Repo{{Name: "api", Path: "/api"}},
+		},
+	})
+
+	diff, err := DiffEnvs("a", "b")
+	if err != nil {
+		t.Fatalf("DiffEnvs: %v", err)
+	}
+	if len(diff.Repos) != 1 {
+		t.Fatalf("Repos = %+v, want one entry", diff.Repos)
+	}
+	for _, c := range diff.Repos[0].Changed {
+		if !c.Secret || c.From != maskedValue || c.To != maskedValue {
+			t.Errorf("change %+v: want masked secret", c)
+		}
+	}
+	if len(diff.Repos[0].Changed) != 2 {
+		t.Errorf("Changed = %+v, want DB_URL (explicit) and GITHUB_TOKEN (by name)", diff.Repos[0].Changed)
+	}
+}
+
+func TestDiffEnvs_reportsTaskDifferences(t *testing.T) {
+	setupTestConfig(t)
+
+	shared := Task{Type: Shell, Cmd: "make build"}
+	storeContext(&Context{
+		Profile: Profile{
+			Name: "test",
+			Path: "/p.yaml",
+			Environments: []Env{
+				{Name: "a", Tasks: []Task{shared, {TaskProps: TaskProps{Name: "seed"}, Type: Shell, Cmd: "make seed"}}},
+				{Name: "b", Tasks: []Task{{Type: Print, Message: "hi"}, shared}},
+			},
+		},
+	})
+
+	diff, err := DiffEnvs("a", "b")
+	if err != nil {
+		t.Fatalf("DiffEnvs: %v", err)
+	}
+	if diff.Tasks == nil {
+		t.Fatal("Tasks = nil, want profile-level task diff")
+	}
+	if len(diff.Tasks.Removed) != 1 || diff.Tasks.Removed[0] != (EnvTaskRef{Index: 2, Label: "seed"}) {
+		t.Errorf("Removed = %+v", diff.Tasks.Removed)
+	}
+	if len(diff.Tasks.Added) != 1 || diff.Tasks.Added[0] != (EnvTaskRef{Index: 1, Label: "print"}) {
+		t.Errorf("Added = %+v", diff.Tasks.Added)
+	}
+}
+
+func TestDiffEnvs_identicalIsEmpty(t *testing.T) {
+	setupTestConfig(t)
+
+	vars := []EnvVar{{Name: "A", Value: "1"}}
+	storeContext(&Context{
+		Profile: Profile{
+			Name:         "test",
+			Path:         "/p.yaml",
+			Environments: []Env{{Name: "a", Variables: vars}, {Name: "b", Variables: vars}},
+			Repositories: []Repo{{Name: "api", Path: "/api"}},
+		},
+	})
+
+	diff, err := DiffEnvs("a", "b")
+	if err != nil {
+		t.Fatalf("DiffEnvs: %v", err)
+	}
+	if !diff.IsEmpty() {
+		t.Errorf("diff = %+v, want empty", diff)
+	}
+}
+
+func TestDiffEnvs_unknownEnv(t *testing.T) {
+	setupTestConfig(t)
+
+	storeContext(&Context{Profile: Profile{Name: "test", Path: "/p.yaml", Environments: []Env{{Name: "a"}}}})
+
+	_, err := DiffEnvs("a", "missing")
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeEnvNotFound {
+		t.Errorf("DiffEnvs(a, missing) err = %v, want ENV_NOT_FOUND", err)
+	}
+}
@@ -1,5 +1,7 @@
 package errs
 
+import "strings"
+
 // Each constructor produces an error message that matches the prior
 // fmt.Errorf wording so tests doing substring matches against error
 // strings keep working unchanged. New callers should rely on Code()
@@ -272,6 +274,57 @@ func TaskGitFailed(cause error) *RaidError {
 		map[string]any{"task": "Git"}, cause)
 }
 
+// TaskArchiveFailed — Archive extract/create failed.
+func TaskArchiveFailed(cause error) *RaidError {
+	msg := "Archive task failed"
+	if cause != nil {
+		msg = formatMsg("Archive task failed: %v", cause)
+	}
+	return newRaidError(CodeTaskArchiveFailed, CategoryTask, msg, "",
+		map[string]any{"task": "Archive"}, cause)
+}
+
+// TaskFileFailed — File task operation failed.
+func TaskFileFailed(cause error) *RaidError {
+	msg := "File task failed"
+	if cause != nil {
+		msg = formatMsg("File task failed: %v", cause)
+	}
+	return newRaidError(CodeTaskFileFailed, CategoryTask, msg, "",
+		map[string]any{"task": "File"}, cause)
+}
+
+// TaskConfigEditFailed — ConfigEdit couldn't parse, edit, or write its file.
+func TaskConfigEditFailed(cause error) *RaidError {
+	msg := "ConfigEdit task failed"
+	if cause != nil {
+		msg = formatMsg("ConfigEdit task failed: %v", cause)
+	}
+	return newRaidError(CodeTaskConfigEditFailed, CategoryTask, msg, "",
+		map[string]any{"task": "ConfigEdit"}, cause)
+}
+
+// TaskServiceFailed — a Service couldn't be started, stopped, or read.
+func TaskServiceFailed(name string, cause error) *RaidError {
+	msg := formatMsg("service '%s' failed", name)
+	if cause != nil {
+		msg = formatMsg("service '%s' failed: %v", name, cause)
+	}
+	return newRaidError(CodeTaskServiceFailed, CategoryTask, msg, "",
+		map[string]any{"task": "Service", "service": name}, cause)
+}
+
+// TaskContainerFailed — a Container task's engine command failed, or the
+// container never became healthy.
+func TaskContainerFailed(op string, cause error) *RaidError {
+	msg := formatMsg("Container %s failed", op)
+	if cause != nil {
+		msg = formatMsg("Container %s failed: %v", op, cause)
+	}
+	return newRaidError(CodeTaskContainerFailed, CategoryTask, msg, "",
+		map[string]any{"task": "Container", "op": op}, cause)
+}
+
 // TaskHTTPFailed — HTTP task (download/GET) failed. Network category.
 func TaskHTTPFailed(url string, cause error) *RaidError {
 	msg := formatMsg("HTTP task failed for %s", url)
@@ -310,3 +363,68 @@ func HeadlessPromptNoDefault(varName string) *RaidError {
 		"Add a `default:` to the Prompt task, or run raid without -y / --yes / --headless / RAID_HEADLESS.",
 		map[string]any{"var": varName}, nil)
 }
+
+// RequiredVarsUnmet — one or more `requires:` entries on a profile, env,
+// or command aren't satisfied. CategoryConfig because the invocation is
+// missing inputs the config declares up front. unmet holds one
+// human-readable line per problem; vars carries the matching structured
+// entries (name, reason, and the optional pattern / description) so
+// JSON consumers can list what to supply without parsing the message.
+func RequiredVarsUnmet(scope string, unmet []string, vars []map[string]any) *RaidError {
+	return newRaidError(CodeRequiredVarsUnmet, CategoryConfig,
+		formatMsg("required variables not satisfied for %s: %s", scope, strings.Join(unmet, "; ")),
+		"Export the listed variables (or set them with a Set task or command args) and re-run. `raid doctor` checks requirements ahead of time.",
+		map[string]any{"scope": scope, "vars": vars, "count": len(vars)}, nil)
+}
+
+// VarNotFound — `raid vars get/unset` referenced a variable that isn't
+// set (get) or isn't persisted (unset).
+func VarNotFound(name string) *RaidError {
+	return newRaidError(CodeVarNotFound, CategoryNotFound,
+		formatMsg("variable '%s' not found", name),
+		"Run `raid vars list` to see raid variables and where each value comes from.",
+		map[string]any{"var": name}, nil)
+}
+
+// Cancelled — raid was interrupted while a command or environment with
+// cleanup hooks ran. CategoryTask because the run stopped partway; cause
+// is the error of the task that was in flight.
+func Cancelled(cause error) *RaidError {
+	msg := "run cancelled"
+	if cause != nil {
+		msg = formatMsg("run cancelled: %v", cause)
+	}
+	return newRaidError(CodeCancelled, CategoryTask, msg, "", nil, cause)
+}
+
+// CommandLocked — a command's `exclusive:` or `lock:` lock is held by
+// another run. holder describes it, e.g. "PID 4242 since 15:04:05", and
+// is empty when the lock file couldn't be read.
+func CommandLocked(lock, holder string) *RaidError {
+	msg := formatMsg("lock '%s' is held by another run", lock)
+	if holder != "" {
+		msg = formatMsg("lock '%s' is held by %s", lock, holder)
+	}
+	return newRaidError(CodeCommandLocked, CategoryGeneric, msg,
+		"Wait for the other run to finish, or set `lockWait: true` on the command to queue behind it.",
+		map[string]any{"lock": lock}, nil)
+}
+
+// PolicyDenied — the MCP server's agent policy rejected a call. target
+// names what was called, e.g. "command 'deploy'", and reason why.
+func PolicyDenied(target, reason string) *RaidError {
+	return newRaidError(CodePolicyDenied, CategoryGeneric,
+		formatMsg("agent policy denies %s: %s", target, reason),
+		"Ask the user to run it, or to allow it in the profile's `agentPolicy:`.",
+		nil, nil)
+}
+
+// ConfirmationRequired — the agent policy needs a confirmation token for
+// command. The token is deliberately absent from the error, which goes
+// back to the agent; the server gives it to the user out of band.
+func ConfirmationRequired(command string) *RaidError {
+	return newRaidError(CodeConfirmationRequired, CategoryGeneric,
+		formatMsg("command '%s' needs the user's confirmation", command),
+		"Ask the user for the confirmation token raid printed to its stderr, then call again with it as `confirm`.",
+		map[string]any{"command": command}, nil)
+}
@@ -87,6 +87,11 @@ const (
 	CodeTaskWaitTimeout         = "TASK_WAIT_TIMEOUT"
 	CodeTaskTemplateFailed      = "TASK_TEMPLATE_FAILED"
 	CodeTaskGitFailed           = "TASK_GIT_FAILED"
+	CodeTaskArchiveFailed       = "TASK_ARCHIVE_FAILED"
+	CodeTaskFileFailed          = "TASK_FILE_FAILED"
+	CodeTaskConfigEditFailed    = "TASK_CONFIG_EDIT_FAILED"
+	CodeTaskServiceFailed       = "TASK_SERVICE_FAILED"
+	CodeTaskContainerFailed     = "TASK_CONTAINER_FAILED"
 	CodeCloneFailed             = "CLONE_FAILED"
 	CodeTaskHTTPFailed          = "TASK_HTTP_FAILED"
 	CodeProfileNotFound         = "PROFILE_NOT_FOUND"
@@ -98,6 +103,12 @@ const (
 	CodeCommandNotFound         = "COMMAND_NOT_FOUND"
 	CodeVerifyFailed            = "VERIFY_FAILED"
 	CodeHeadlessPromptNoDefault = "HEADLESS_PROMPT_NO_DEFAULT"
+	CodeRequiredVarsUnmet       = "REQUIRED_VARS_UNMET"
+	CodeVarNotFound             = "VAR_NOT_FOUND"
+	CodeCancelled               = "CANCELLED"
+	CodeCommandLocked           = "COMMAND_LOCKED"
+	CodePolicyDenied            = "POLICY_DENIED"
+	CodeConfirmationRequired    = "CONFIRMATION_REQUIRED"
 )
 
 // RaidError is the canonical implementation of raid's Error interface.
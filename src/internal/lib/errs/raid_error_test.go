@@ -319,11 +319,31 @@ func TestEveryConstructor_isWellFormed(t *testing.T) {
 		{"TaskTemplateFailed(nil)", func() *RaidError { return TaskTemplateFailed(nil) }, CodeTaskTemplateFailed},
 		{"TaskGitFailed", func() *RaidError { return TaskGitFailed(errors.New("c")) }, CodeTaskGitFailed},
 		{"TaskGitFailed(nil)", func() *RaidError { return TaskGitFailed(nil) }, CodeTaskGitFailed},
+		{"TaskArchiveFailed", func() *RaidError { return TaskArchiveFailed(errors.New("c")) }, CodeTaskArchiveFailed},
+		{"TaskArchiveFailed(nil)", func() *RaidError { return TaskArchiveFailed(nil) }, CodeTaskArchiveFailed},
+		{"TaskFileFailed", func() *RaidError { return TaskFileFailed(errors.New("c")) }, CodeTaskFileFailed},
+		{"TaskFileFailed(nil)", func() *RaidError { return TaskFileFailed(nil) }, CodeTaskFileFailed},
+		{"TaskConfigEditFailed", func() *RaidError { return TaskConfigEditFailed(errors.New("c")) }, CodeTaskConfigEditFailed},
+		{"TaskConfigEditFailed(nil)", func() *RaidError { return TaskConfigEditFailed(nil) }, CodeTaskConfigEditFailed},
+		{"TaskServiceFailed", func() *RaidError { return TaskServiceFailed("s", errors.New("c")) }, CodeTaskServiceFailed},
+		{"TaskServiceFailed(nil)", func() *RaidError { return TaskServiceFailed("s", nil) }, CodeTaskServiceFailed},
+		{"TaskContainerFailed", func() *RaidError { return TaskContainerFailed("run", errors.New("c")) }, CodeTaskContainerFailed},
+		{"TaskContainerFailed(nil)", func() *RaidError { return TaskContainerFailed("run", nil) }, CodeTaskContainerFailed},
 		{"TaskHTTPFailed", func() *RaidError { return TaskHTTPFailed("u", errors.New("c")) }, CodeTaskHTTPFailed},
 		{"TaskHTTPFailed(nil)", func() *RaidError { return TaskHTTPFailed("u", nil) }, CodeTaskHTTPFailed},
 		{"VerifyFailed", func() *RaidError { return VerifyFailed("v", errors.New("c")) }, CodeVerifyFailed},
 		{"VerifyFailed(nil)", func() *RaidError { return VerifyFailed("v", nil) }, CodeVerifyFailed},
 		{"HeadlessPromptNoDefault", func() *RaidError { return HeadlessPromptNoDefault("VAR") }, CodeHeadlessPromptNoDefault},
+		{"RequiredVarsUnmet", func() *RaidError {
+			return RequiredVarsUnmet("command 'x'", []string{"A is not set"}, []map[string]any{{"name": "A"}})
+		}, CodeRequiredVarsUnmet},
+		{"VarNotFound", func() *RaidError { return VarNotFound("V") }, CodeVarNotFound},
+		{"Cancelled", func() *RaidError { return Cancelled(errors.New("c")) }, CodeCancelled},
+		{"Cancelled(nil)", func() *RaidError { return Cancelled(nil) }, CodeCancelled},
+		{"CommandLocked", func() *RaidError { return CommandLocked("migrate", "PID 1") }, CodeCommandLocked},
+		{"CommandLocked(no holder)", func() *RaidError { return CommandLocked("migrate", "") }, CodeCommandLocked},
+		{"PolicyDenied", func() *RaidError { return PolicyDenied("command 'deploy'", "r") }, CodePolicyDenied},
+		{"ConfirmationRequired", func() *RaidError { return ConfirmationRequired("deploy") }, CodeConfirmationRequired},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,455 @@
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+	"github.com/8bitalex/raid/src/internal/sys"
+)
+
+// defaultBlockMarker brackets an ensureBlock block when `marker:` is unset.
+// {mark} becomes BEGIN and END.
+const defaultBlockMarker = "# {mark} raid managed block"
+
+// execFile runs a File task. Every op is idempotent: re-running a task
+// whose effect is already in place changes nothing on disk.
+func execFile(task Task) error {
+	raw := task
+	task = task.Expand()
+	if raw.Literal {
+		task.Line, task.Block = raw.Line, raw.Block
+	}
+
+	mode, err := parseFileMode(string(task.Mode))
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(task.Op) {
+	case "copy":
+		return fileCopy(task, mode)
+	case "move":
+		return fileMove(task)
+	case "remove":
+		return fileRemove(task)
+	case "mkdir":
+		return fileMkdir(task, mode)
+	case "symlink":
+		return fileSymlink(task)
+	case "chmod":
+		return fileChmod(task, mode)
+	case "touch":
+		return fileTouch(task, mode)
+	case "ensureline":
+		return fileEnsureLine(task)
+	case "ensureblock":
+		return fileEnsureBlock(task)
+	case "":
+		return liberrs.ArgInvalid("op is required for File task")
+	default:
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid file operation '%s' (supported: copy, move, remove, mkdir, symlink, chmod, touch, ensureLine, ensureBlock)", task.Op)
+	}
+}
+
+func requireFileFields(task Task, fields ...string) error {
+	for _, f := range fields {
+		var v string
+		switch f {
+		case "src":
+			v = task.Src
+		case "dest":
+			v = task.Dest
+		case "path":
+			v = task.Path
+		case "mode":
+			v = string(task.Mode)
+		}
+		if v == "" {
+			return liberrs.ArgInvalid(fmt.Sprintf("%s is required for File %s", f, task.Op))
+		}
+	}
+	return nil
+}
+
+func fileFailed(format string, args ...any) error {
+	return liberrs.Newf(liberrs.CodeTaskFileFailed, liberrs.CategoryTask, format, args...)
+}
+
+// intoDir returns dest/base(src) when dest is an existing directory and
+// src is not, matching cp and mv.
+func intoDir(src string, srcInfo fs.FileInfo, dest string) string {
+	if srcInfo.IsDir() {
+		return dest
+	}
+	if fi, err := os.Stat(dest); err == nil && fi.IsDir() {
+		return filepath.Join(dest, filepath.Base(src))
+	}
+	return dest
+}
+
+// fileCopy copies a file, or a directory's contents, to dest. Files whose
+// content already matches are left alone.
+func fileCopy(task Task, mode fs.FileMode) error {
+	if err := requireFileFields(task, "src", "dest"); err != nil {
+		return err
+	}
+	info, err := os.Stat(task.Src)
+	if err != nil {
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "copy source does not exist: %s", task.Src)
+	}
+	dest := intoDir(task.Src, info, task.Dest)
+	if !info.IsDir() {
+		if mode == 0 {
+			mode = info.Mode().Perm()
+		}
+		return copyFileIfChanged(task.Src, dest, mode)
+	}
+
+	return filepath.WalkDir(task.Src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fileFailed("failed to read '%s': %v", p, err)
+		}
+		rel, err := filepath.Rel(task.Src, p)
+		if err != nil {
+			return fileFailed("failed to copy '%s': %v", p, err)
+		}
+		target := filepath.Join(dest, rel)
+		fi, err := d.Info()
+		if err != nil {
+			return fileFailed("failed to read '%s': %v", p, err)
+		}
+		switch {
+		case fi.IsDir():
+			if err := os.MkdirAll(target, fi.Mode().Perm()|0o700); err != nil {
+				return fileFailed("failed to create directory '%s': %v", target, err)
+			}
+		case fi.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return fileFailed("failed to read symlink '%s': %v", p, err)
+			}
+			return ensureSymlink(link, target)
+		case fi.Mode().IsRegular():
+			return copyFileIfChanged(p, target, fi.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+// copyFileIfChanged copies src over dest unless dest already has the same
+// content, then makes sure dest has mode.
+func copyFileIfChanged(src, dest string, mode fs.FileMode) error {
+	same, err := sameFileContent(src, dest)
+	if err != nil {
+		return fileFailed("failed to compare '%s' with '%s': %v", src, dest, err)
+	}
+	if !same {
+		if err := sys.CopyFile(src, dest); err != nil {
+			return fileFailed("failed to copy: %v", err)
+		}
+	}
+	return chmodIfDifferent(dest, mode)
+}
+
+// sameFileContent reports whether b exists and holds exactly a's bytes.
+func sameFileContent(a, b string) (bool, error) {
+	bi, err := os.Stat(b)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	if bi.IsDir() || ai.Size() != bi.Size() {
+		return false, nil
+	}
+	ad, err := os.ReadFile(a)
+	if err != nil {
+		return false, err
+	}
+	bd, err := os.ReadFile(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ad, bd), nil
+}
+
+func chmodIfDifferent(p string, mode fs.FileMode) error {
+	if mode == 0 {
+		return nil
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		return fileFailed("failed to stat '%s': %v", p, err)
+	}
+	if fi.Mode().Perm() == mode.Perm() {
+		return nil
+	}
+	if err := os.Chmod(p, mode); err != nil {
+		return fileFailed("failed to set mode on '%s': %v", p, err)
+	}
+	return nil
+}
+
+// fileMove renames src to dest, falling back to copy-and-remove across
+// filesystems. A missing src with dest in place counts as already moved.
+func fileMove(task Task) error {
+	if err := requireFileFields(task, "src", "dest"); err != nil {
+		return err
+	}
+	info, err := os.Lstat(task.Src)
+	if errors.Is(err, fs.ErrNotExist) {
+		if _, derr := os.Lstat(task.Dest); derr == nil {
+			return nil
+		}
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "move source does not exist: %s", task.Src)
+	}
+	if err != nil {
+		return fileFailed("failed to stat '%s': %v", task.Src, err)
+	}
+	dest := intoDir(task.Src, info, task.Dest)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fileFailed("failed to create directory for '%s': %v", dest, err)
+	}
+	renameErr := os.Rename(task.Src, dest)
+	if renameErr == nil {
+		return nil
+	}
+	// Rename can't cross filesystems; copy then remove instead.
+	if err := fileCopy(Task{Op: "copy", Src: task.Src, Dest: dest}, 0); err != nil {
+		return fileFailed("failed to move '%s' to '%s': %v", task.Src, dest, renameErr)
+	}
+	if err := os.RemoveAll(task.Src); err != nil {
+		return fileFailed("failed to remove '%s' after copying it: %v", task.Src, err)
+	}
+	return nil
+}
+
+// fileRemove deletes path and anything under it. A missing path is
+// already removed. The filesystem root and the home directory are refused
+// outright so an unset variable can't turn into `rm -rf ~`.
+func fileRemove(task Task) error {
+	if err := requireFileFields(task, "path"); err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(task.Path)
+	if err != nil {
+		return fileFailed("failed to resolve '%s': %v", task.Path, err)
+	}
+	if abs == filepath.Dir(abs) || abs == filepath.Clean(sys.GetHomeDir()) {
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "refusing to remove '%s'", abs)
+	}
+	if err := os.RemoveAll(abs); err != nil {
+		return fileFailed("failed to remove '%s': %v", abs, err)
+	}
+	return nil
+}
+
+func fileMkdir(task Task, mode fs.FileMode) error {
+	if err := requireFileFields(task, "path"); err != nil {
+		return err
+	}
+	perm := mode
+	if perm == 0 {
+		perm = 0755
+	}
+	if err := os.MkdirAll(task.Path, perm); err != nil {
+		return fileFailed("failed to create directory '%s': %v", task.Path, err)
+	}
+	return chmodIfDifferent(task.Path, mode)
+}
+
+// fileSymlink points the link at dest to src.
+func fileSymlink(task Task) error {
+	if err := requireFileFields(task, "src", "dest"); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(task.Dest), 0755); err != nil {
+		return fileFailed("failed to create directory for '%s': %v", task.Dest, err)
+	}
+	return ensureSymlink(task.Src, task.Dest)
+}
+
+// ensureSymlink makes link a symlink to target, replacing a symlink that
+// points elsewhere. An existing file or directory at link is an error
+// rather than something to delete.
+func ensureSymlink(target, link string) error {
+	if fi, err := os.Lstat(link); err == nil {
+		if fi.Mode()&fs.ModeSymlink == 0 {
+			return fileFailed("cannot create symlink '%s': a file or directory is already there", link)
+		}
+		if cur, err := os.Readlink(link); err == nil && cur == target {
+			return nil
+		}
+		if err := os.Remove(link); err != nil {
+			return fileFailed("failed to replace symlink '%s': %v", link, err)
+		}
+	}
+	if err := os.Symlink(target, link); err != nil {
+		return fileFailed("failed to create symlink '%s': %v", link, err)
+	}
+	return nil
+}
+
+func fileChmod(task Task, mode fs.FileMode) error {
+	if err := requireFileFields(task, "path", "mode"); err != nil {
+		return err
+	}
+	if !sys.FileExists(task.Path) {
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "chmod target does not exist: %s", task.Path)
+	}
+	return chmodIfDifferent(task.Path, mode)
+}
+
+// fileTouch creates an empty file at path, or bumps an existing one's
+// modification time.
+func fileTouch(task Task, mode fs.FileMode) error {
+	if err := requireFileFields(task, "path"); err != nil {
+		return err
+	}
+	if _, err := os.Stat(task.Path); err == nil {
+		now := time.Now()
+		if err := os.Chtimes(task.Path, now, now); err != nil {
+			return fileFailed("failed to touch '%s': %v", task.Path, err)
+		}
+		return chmodIfDifferent(task.Path, mode)
+	}
+	return writeFileAtomic(task.Path, strings.NewReader(""), nil, mode)
+}
+
+// readLines returns path's lines without terminators, and the line ending
+// it uses. A missing file reads as empty.
+func readLines(path string) ([]string, string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "\n", nil
+	}
+	if err != nil {
+		return nil, "", fileFailed("failed to read '%s': %v", path, err)
+	}
+	eol := "\n"
+	if bytes.Contains(data, []byte("\r\n")) {
+		eol = "\r\n"
+	}
+	text := strings.TrimSuffix(string(data), eol)
+	if text == "" {
+		return nil, eol, nil
+	}
+	return strings.Split(text, eol), eol, nil
+}
+
+// writeLinesIfChanged writes lines back to path when they differ from
+// before, keeping the file's mode.
+func writeLinesIfChanged(path string, before, after []string, eol string) error {
+	if slices.Equal(before, after) {
+		return nil
+	}
+	content := ""
+	if len(after) > 0 {
+		content = strings.Join(after, eol) + eol
+	}
+	return writeFileAtomic(path, strings.NewReader(content), nil, 0)
+}
+
+// fileEnsureLine makes sure line is in path. With pattern, the last line
+// matching it is replaced; otherwise, or with no match, line is appended
+// unless it's already there.
+func fileEnsureLine(task Task) error {
+	if err := requireFileFields(task, "path"); err != nil {
+		return err
+	}
+	if task.Line == "" {
+		return liberrs.ArgInvalid("line is required for File ensureLine")
+	}
+	var re *regexp.Regexp
+	if task.Pattern != "" {
+		var err error
+		if re, err = regexp.Compile(task.Pattern); err != nil {
+			return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid pattern '%s': %v", task.Pattern, err)
+		}
+	}
+
+	lines, eol, err := readLines(task.Path)
+	if err != nil {
+		return err
+	}
+	out := append([]string(nil), lines...)
+	matched := -1
+	if re != nil {
+		for i, l := range out {
+			if re.MatchString(l) {
+				matched = i
+			}
+		}
+	}
+	switch {
+	case matched >= 0:
+		out[matched] = task.Line
+	case !slices.Contains(out, task.Line):
+		out = append(out, task.Line)
+	}
+	return writeLinesIfChanged(task.Path, lines, out, eol)
+}
+
+// fileEnsureBlock keeps block between a pair of marker lines in path,
+// replacing what was there before or appending the pair when absent. An
+// empty block removes the markers and their contents.
+func fileEnsureBlock(task Task) error {
+	if err := requireFileFields(task, "path"); err != nil {
+		return err
+	}
+	marker := task.Marker
+	if marker == "" {
+		marker = defaultBlockMarker
+	}
+	if !strings.Contains(marker, "{mark}") {
+		return liberrs.ArgInvalid("marker must contain {mark} for File ensureBlock")
+	}
+	begin := strings.ReplaceAll(marker, "{mark}", "BEGIN")
+	end := strings.ReplaceAll(marker, "{mark}", "END")
+
+	lines, eol, err := readLines(task.Path)
+	if err != nil {
+		return err
+	}
+	var managed []string
+	if block := strings.TrimRight(strings.ReplaceAll(task.Block, "\r\n", "\n"), "\n"); block != "" {
+		managed = append([]string{begin}, strings.Split(block, "\n")...)
+		managed = append(managed, end)
+	}
+
+	start, stop := -1, -1
+	for i, l := range lines {
+		if start < 0 && l == begin {
+			start = i
+		} else if start >= 0 && l == end {
+			stop = i
+			break
+		}
+	}
+	var out []string
+	if start >= 0 && stop >= 0 {
+		out = append(out, lines[:start]...)
+		out = append(out, managed...)
+		out = append(out, lines[stop+1:]...)
+	} else {
+		if start >= 0 {
+			return fileFailed("'%s' has %q with no matching %q", task.Path, begin, end)
+		}
+		out = append(append(out, lines...), managed...)
+	}
+	return writeLinesIfChanged(task.Path, lines, out, eol)
+}
@@ -0,0 +1,212 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+)
+
+func TestExecuteTask_fileCopyAndMove(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	os.MkdirAll(filepath.Join(src, "sub"), 0o755)
+	os.WriteFile(filepath.Join(src, "sub", "a.txt"), []byte("a"), 0o644)
+
+	out := filepath.Join(dir, "out")
+	for i := 0; i < 2; i++ {
+		if err := ExecuteTask(Task{Type: File, Op: "copy", Src: src, Dest: out}); err != nil {
+			t.Fatalf("copy #%d error: %v", i+1, err)
+		}
+	}
+	if got, _ := os.ReadFile(filepath.Join(out, "sub", "a.txt")); string(got) != "a" {
+		t.Errorf("copied a.txt = %q, want a", got)
+	}
+	if _, err := os.Stat(filepath.Join(out, "src")); !os.IsNotExist(err) {
+		t.Error("re-running copy nested the source directory")
+	}
+
+	// An existing directory as dest receives a file inside it.
+	moved := filepath.Join(out, "sub", "a.txt")
+	task := Task{Type: File, Op: "move", Src: moved, Dest: dir}
+	for i := 0; i < 2; i++ {
+		if err := ExecuteTask(task); err != nil {
+			t.Fatalf("move #%d error: %v", i+1, err)
+		}
+	}
+	task.Dest = filepath.Join(dir, "a.txt")
+	if err := ExecuteTask(task); err != nil {
+		t.Errorf("move with src gone and dest present: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.txt")); err != nil {
+		t.Errorf("a.txt not moved into dir: %v", err)
+	}
+}
+
+func TestExecuteTask_fileCopyLeavesMatchingFileAlone(t *testing.T) {
+	dir := t.TempDir()
+	src, dest := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	os.WriteFile(src, []byte("same"), 0o644)
+	os.WriteFile(dest, []byte("same"), 0o644)
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(dest, old, old)
+
+	if err := ExecuteTask(Task{Type: File, Op: "copy", Src: src, Dest: dest}); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(dest); !fi.ModTime().Equal(old) {
+		t.Errorf("dest mtime = %v, want it untouched", fi.ModTime())
+	}
+}
+
+func TestExecuteTask_fileMkdirChmodTouchRemove(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a", "b")
+	if err := ExecuteTask(Task{Type: File, Op: "mkdir", Path: dir, Mode: "0700"}); err != nil {
+		t.Fatal(err)
+	}
+	f := filepath.Join(dir, "stamp")
+	if err := ExecuteTask(Task{Type: File, Op: "touch", Path: f}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExecuteTask(Task{Type: File, Op: "chmod", Path: f, Mode: "0600"}); err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" {
+		if fi, _ := os.Stat(dir); fi.Mode().Perm() != 0o700 {
+			t.Errorf("dir mode = %o, want 0700", fi.Mode().Perm())
+		}
+		if fi, _ := os.Stat(f); fi.Mode().Perm() != 0o600 {
+			t.Errorf("file mode = %o, want 0600", fi.Mode().Perm())
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := ExecuteTask(Task{Type: File, Op: "remove", Path: dir}); err != nil {
+			t.Fatalf("remove #%d error: %v", i+1, err)
+		}
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("dir still exists: %v", err)
+	}
+}
+
+func TestExecuteTask_fileRemoveRefusesHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	err := ExecuteTask(Task{Type: File, Op: "remove", Path: "~"})
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeArgInvalid {
+		t.Fatalf("remove ~ error = %v, want ARG_INVALID", err)
+	}
+	if _, err := os.Stat(home); err != nil {
+		t.Errorf("home removed: %v", err)
+	}
+}
+
+func TestExecuteTask_fileSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need developer mode on Windows")
+	}
+	dir := t.TempDir()
+	link := filepath.Join(dir, "bin", "tool")
+	for _, target := range []string{"/usr/bin/true", "/usr/bin/true", "/bin/sh"} {
+		if err := ExecuteTask(Task{Type: File, Op: "symlink", Src: target, Dest: link}); err != nil {
+			t.Fatalf("symlink -> %s error: %v", target, err)
+		}
+	}
+	if got, _ := os.Readlink(link); got != "/bin/sh" {
+		t.Errorf("link -> %q, want /bin/sh", got)
+	}
+
+	file := filepath.Join(dir, "real")
+	os.WriteFile(file, []byte("keep"), 0o644)
+	err := ExecuteTask(Task{Type: File, Op: "symlink", Src: "/bin/sh", Dest: file})
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeTaskFileFailed {
+		t.Errorf("symlink over a file error = %v, want TASK_FILE_FAILED", err)
+	}
+}
+
+func TestExecuteTask_fileEnsureLine(t *testing.T) {
+	withRaidVar(t, "REGISTRY", "https://npm.acme.dev/")
+	path := filepath.Join(t.TempDir(), ".npmrc")
+	os.WriteFile(path, []byte("registry=https://old/\r\nsave-exact=true\r\n"), 0o600)
+
+	task := Task{Type: File, Op: "ensureLine", Path: path, Pattern: "^registry=", Line: "registry=$REGISTRY"}
+	for i := 0; i < 2; i++ {
+		if err := ExecuteTask(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := "registry=https://npm.acme.dev/\r\nsave-exact=true\r\n"
+	if got, _ := os.ReadFile(path); string(got) != want {
+		t.Errorf("file = %q, want %q", got, want)
+	}
+
+	task = Task{Type: File, Op: "ensureLine", Path: path, Line: "fund=false"}
+	for i := 0; i < 2; i++ {
+		if err := ExecuteTask(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := os.ReadFile(path); string(got) != want+"fund=false\r\n" {
+		t.Errorf("file = %q, want fund=false appended once", got)
+	}
+	if runtime.GOOS != "windows" {
+		if fi, _ := os.Stat(path); fi.Mode().Perm() != 0o600 {
+			t.Errorf("mode = %o, want 0600 kept", fi.Mode().Perm())
+		}
+	}
+}
+
+func TestExecuteTask_fileEnsureBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".zshrc")
+	os.WriteFile(path, []byte("alias ll='ls -l'\n"), 0o644)
+
+	task := Task{Type: File, Op: "ensureBlock", Path: path, Literal: true, Block: "export A=$HOME\n"}
+	for i := 0; i < 2; i++ {
+		if err := ExecuteTask(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := "alias ll='ls -l'\n# BEGIN raid managed block\nexport A=$HOME\n# END raid managed block\n"
+	if got, _ := os.ReadFile(path); string(got) != want {
+		t.Errorf("file = %q, want %q", got, want)
+	}
+
+	task.Block = "export B=1\nexport C=2"
+	if err := ExecuteTask(task); err != nil {
+		t.Fatal(err)
+	}
+	want = "alias ll='ls -l'\n# BEGIN raid managed block\nexport B=1\nexport C=2\n# END raid managed block\n"
+	if got, _ := os.ReadFile(path); string(got) != want {
+		t.Errorf("file = %q, want the block replaced", got)
+	}
+
+	task.Block = ""
+	if err := ExecuteTask(task); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "alias ll='ls -l'\n" {
+		t.Errorf("file = %q, want the block removed", got)
+	}
+}
+
+func TestExecuteTask_fileConfigErrors(t *testing.T) {
+	for _, task := range []Task{
+		{Type: File},
+		{Type: File, Op: "shred", Path: "x"},
+		{Type: File, Op: "copy", Src: "x"},
+		{Type: File, Op: "chmod", Path: "x"},
+		{Type: File, Op: "mkdir", Path: "x", Mode: "rwx"},
+		{Type: File, Op: "ensureLine", Path: "x"},
+		{Type: File, Op: "ensureLine", Path: "x", Line: "l", Pattern: "("},
+		{Type: File, Op: "ensureBlock", Path: "x", Marker: "# managed"},
+	} {
+		err := ExecuteTask(task)
+		if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeArgInvalid {
+			t.Errorf("ExecuteTask(%+v) = %v, want ARG_INVALID", task, err)
+		}
+	}
+}
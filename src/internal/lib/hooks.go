@@ -0,0 +1,224 @@
+package lib
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+)
+
+// Hooks are the task lists a command or environment runs around its
+// tasks. Before runs first and counts as part of the run. After runs only
+// when the run succeeded, OnFailure only when it failed, and Finally
+// always, including when raid is interrupted.
+type Hooks struct {
+	Before    []Task `json:"before,omitempty"`
+	After     []Task `json:"after,omitempty"`
+	OnFailure []Task `json:"onFailure,omitempty" yaml:"onFailure,omitempty"`
+	Finally   []Task `json:"finally,omitempty"`
+}
+
+// Env vars describing a failed run, set while OnFailure and Finally run.
+const (
+	failedTaskVar = "RAID_FAILED_TASK"
+	errorCodeVar  = "RAID_ERROR_CODE"
+)
+
+// mapTasks returns a copy of h with f applied to each task list.
+func (h Hooks) mapTasks(f func([]Task) []Task) Hooks {
+	return Hooks{
+		Before:    f(h.Before),
+		After:     f(h.After),
+		OnFailure: f(h.OnFailure),
+		Finally:   f(h.Finally),
+	}
+}
+
+// taskFailure tags a task's error with the task's label, so a failure
+// can be reported as RAID_FAILED_TASK. Its message is the cause's.
+type taskFailure struct {
+	label string
+	err   error
+}
+
+func (e *taskFailure) Error() string { return e.err.Error() }
+func (e *taskFailure) Unwrap() error { return e.err }
+
+// failedTask tags err with task's label. An error already tagged by a
+// task nested inside this one, in a Group or Run, keeps that label.
+func failedTask(task Task, err error) error {
+	var tf *taskFailure
+	if err == nil || errors.As(err, &tf) {
+		return err
+	}
+	return &taskFailure{label: task.Label(), err: err}
+}
+
+// failedTaskLabel returns the label of the task err came from, if known.
+func failedTaskLabel(err error) string {
+	var tf *taskFailure
+	if errors.As(err, &tf) {
+		return tf.label
+	}
+	return ""
+}
+
+// interrupted is set when raid is interrupted while a run with OnFailure
+// or Finally hooks is in flight. ExecuteTask refuses to start tasks while
+// it's set, so control falls through to the cleanup hooks.
+var interrupted atomic.Bool
+
+// interruptPoll is how often sleepInterruptible checks interrupted.
+const interruptPoll = 100 * time.Millisecond
+
+// checkInterrupted returns a Cancelled error once raid has been
+// interrupted. Tasks that loop in-process (waits, health checks, retries)
+// call it so a caught interrupt doesn't leave them running to their
+// timeout.
+func checkInterrupted() error {
+	if interrupted.Load() {
+		return liberrs.Cancelled(nil)
+	}
+	return nil
+}
+
+// sleepInterruptible sleeps for d, returning early with checkInterrupted's
+// error if raid is interrupted meanwhile.
+func sleepInterruptible(d time.Duration) error {
+	for d > 0 {
+		if err := checkInterrupted(); err != nil {
+			return err
+		}
+		step := min(d, interruptPoll)
+		time.Sleep(step)
+		d -= step
+	}
+	return checkInterrupted()
+}
+
+var (
+	interruptMu      sync.Mutex
+	interruptCatches int
+)
+
+// catchInterrupt makes an interrupt or SIGTERM cancel the run instead of
+// killing raid. The first signal sets interrupted; a second gets the
+// default behaviour, so a hanging cleanup can still be forced to quit.
+// The returned func stops catching, and the last one to stop clears
+// interrupted.
+func catchInterrupt() func() {
+	interruptMu.Lock()
+	interruptCatches++
+	interruptMu.Unlock()
+
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigs:
+			signal.Stop(sigs)
+			if !interrupted.Swap(true) {
+				lockedFprintf(commandStderr, "raid: interrupted, running cleanup tasks (interrupt again to force quit)\n")
+			}
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+		interruptMu.Lock()
+		defer interruptMu.Unlock()
+		if interruptCatches--; interruptCatches == 0 {
+			interrupted.Store(false)
+		}
+	}
+}
+
+// runHooked runs tasks wrapped in h. Before, tasks and After stop at the
+// first failure, which OnFailure and Finally then see as RAID_FAILED_TASK
+// and RAID_ERROR_CODE. Their own failures are joined to the run's error,
+// which stays first, so it decides the error code.
+func runHooked(h Hooks, tasks []Task) error {
+	cleanup := len(h.OnFailure) > 0 || len(h.Finally) > 0
+	if cleanup {
+		release := catchInterrupt()
+		defer release()
+	}
+
+	err := ExecuteTasks(h.Before)
+	if err == nil {
+		err = ExecuteTasks(tasks)
+	}
+	if err == nil {
+		err = ExecuteTasks(h.After)
+	}
+	if !cleanup {
+		return err
+	}
+
+	// Cleanup tasks have to be able to start, so cancellation is lifted
+	// while they run and put back for any enclosing run's cleanup.
+	cancelled := interrupted.Swap(false)
+	if cancelled && err != nil {
+		err = liberrs.Cancelled(err)
+	}
+	if err != nil {
+		restore := setSessionVars(map[string]string{failedTaskVar: failedTaskLabel(err), errorCodeVar: errorCodeFor(err)})
+		defer restore()
+	}
+
+	errs := []error{err}
+	if err != nil {
+		errs = append(errs, ExecuteTasks(h.OnFailure))
+	}
+	errs = append(errs, ExecuteTasks(h.Finally))
+	if cancelled {
+		interrupted.Store(true)
+	}
+	return errors.Join(errs...)
+}
+
+// setSessionVars sets vars in the command session, starting one if none
+// is active, and returns a func that restores the session as it was. The
+// process environment is left alone, so concurrent tasks elsewhere never
+// see them.
+func setSessionVars(vars map[string]string) func() {
+	if commandSession == nil {
+		startSession()
+		commandSession.mu.Lock()
+		maps.Copy(commandSession.vars, vars)
+		commandSession.mu.Unlock()
+		return endSession
+	}
+	s := commandSession
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := make(map[string]*string, len(vars))
+	for k, v := range vars {
+		if old, ok := s.vars[k]; ok {
+			prev[k] = &old
+		} else {
+			prev[k] = nil
+		}
+		s.vars[k] = v
+	}
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for k, old := range prev {
+			if old == nil {
+				delete(s.vars, k)
+			} else {
+				s.vars[k] = *old
+			}
+		}
+	}
+}
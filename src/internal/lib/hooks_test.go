@@ -0,0 +1,187 @@
+package lib
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+)
+
+// hookRecorder returns a Shell task that appends line to out, with
+// $RAID_FAILED_TASK and $RAID_ERROR_CODE left for the shell to expand.
+func hookRecorder(out, line string) Task {
+	return Task{Type: Shell, Shell: "sh", Literal: true, Cmd: `echo "` + line + `" >> ` + out}
+}
+
+func TestExecuteCommand_hooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	setupTestConfig(t)
+	origOut := commandStdout
+	commandStdout = io.Discard
+	t.Cleanup(func() { commandStdout = origOut })
+
+	out := filepath.Join(t.TempDir(), "out.txt")
+	hooks := Hooks{
+		Before:    []Task{hookRecorder(out, "before")},
+		After:     []Task{hookRecorder(out, "after")},
+		OnFailure: []Task{hookRecorder(out, "onFailure $RAID_FAILED_TASK $RAID_ERROR_CODE")},
+		Finally:   []Task{hookRecorder(out, "finally [$RAID_FAILED_TASK]")},
+	}
+	failing := Task{Type: Shell, Shell: "sh", Cmd: "exit 3"}
+	failing.Name = "migrate"
+	storeContext(&Context{Profile: Profile{Commands: []Command{
+		{Name: "ok", Tasks: []Task{hookRecorder(out, "task")}, Hooks: hooks},
+		{Name: "fail", Tasks: []Task{hookRecorder(out, "task"), failing, hookRecorder(out, "unreached")}, Hooks: hooks},
+	}}})
+
+	if err := ExecuteCommand("ok", nil, nil); err != nil {
+		t.Fatalf("ExecuteCommand(ok) error: %v", err)
+	}
+	want := "before\ntask\nafter\nfinally []\n"
+	if got, _ := os.ReadFile(out); string(got) != want {
+		t.Errorf("success output =\n%s\nwant\n%s", got, want)
+	}
+
+	os.Remove(out)
+	err := ExecuteCommand("fail", nil, nil)
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeTaskShellFailed {
+		t.Fatalf("ExecuteCommand(fail) error = %v, want TASK_SHELL_FAILED", err)
+	}
+	want = "before\ntask\nonFailure migrate TASK_SHELL_FAILED\nfinally [migrate]\n"
+	if got, _ := os.ReadFile(out); string(got) != want {
+		t.Errorf("failure output =\n%s\nwant\n%s", got, want)
+	}
+	for _, k := range []string{failedTaskVar, errorCodeVar} {
+		if _, ok := os.LookupEnv(k); ok {
+			t.Errorf("%s still set after the command returned", k)
+		}
+	}
+}
+
+func TestRunHooked_failureVarsScopedToSession(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	origOut := commandStdout
+	commandStdout = io.Discard
+	t.Cleanup(func() { commandStdout = origOut })
+
+	startSession()
+	t.Cleanup(endSession)
+	commandSession.vars[errorCodeVar] = "OUTER"
+
+	out := filepath.Join(t.TempDir(), "out.txt")
+	check := Task{Type: Shell, Shell: "sh", Cmd: "echo $RAID_ERROR_CODE >> " + out}
+	fail := Task{Type: Shell, Shell: "sh", Cmd: "exit 1"}
+	runHooked(Hooks{OnFailure: []Task{check}}, []Task{fail})
+
+	if got, _ := os.ReadFile(out); string(got) != "TASK_SHELL_FAILED\n" {
+		t.Errorf("onFailure saw RAID_ERROR_CODE = %q, want TASK_SHELL_FAILED", got)
+	}
+	if _, ok := os.LookupEnv(errorCodeVar); ok {
+		t.Errorf("%s was exported to the process environment", errorCodeVar)
+	}
+	if got, ok := commandSession.vars[failedTaskVar]; ok {
+		t.Errorf("%s = %q left in the session", failedTaskVar, got)
+	}
+	if got := commandSession.vars[errorCodeVar]; got != "OUTER" {
+		t.Errorf("%s = %q after the hooks, want the outer value restored", errorCodeVar, got)
+	}
+}
+
+func TestRunHooked_hookFailures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	origOut := commandStdout
+	commandStdout = io.Discard
+	t.Cleanup(func() { commandStdout = origOut })
+
+	out := filepath.Join(t.TempDir(), "out.txt")
+	fail := Task{Type: Shell, Shell: "sh", Cmd: "exit 1"}
+
+	err := runHooked(Hooks{Before: []Task{fail}, Finally: []Task{hookRecorder(out, "finally $RAID_FAILED_TASK")}}, []Task{hookRecorder(out, "task")})
+	if err == nil {
+		t.Fatal("runHooked() with a failing before hook returned nil")
+	}
+	if got, _ := os.ReadFile(out); string(got) != "finally shell\n" {
+		t.Errorf("output = %q, want only the finally hook, naming the failed task by type", got)
+	}
+
+	err = runHooked(Hooks{Finally: []Task{fail}}, []Task{hookRecorder(out, "task")})
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeTaskShellFailed {
+		t.Errorf("runHooked() with a failing finally hook = %v, want its error", err)
+	}
+}
+
+func TestRunHooked_cancelled(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	origOut, origErr := commandStdout, commandStderr
+	commandStdout, commandStderr = io.Discard, io.Discard
+	t.Cleanup(func() { commandStdout, commandStderr = origOut, origErr })
+
+	out := filepath.Join(t.TempDir(), "out.txt")
+	hooks := Hooks{
+		OnFailure: []Task{hookRecorder(out, "onFailure $RAID_ERROR_CODE")},
+		Finally:   []Task{hookRecorder(out, "finally")},
+	}
+	// The first task signals raid itself, as Ctrl-C in the terminal would,
+	// and waits for the interrupt to be caught. The second never starts.
+	tasks := []Task{
+		{Type: Shell, Shell: "sh", Cmd: "kill -INT $PPID; sleep 1"},
+		hookRecorder(out, "unreached"),
+	}
+
+	err := runHooked(hooks, tasks)
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeCancelled {
+		t.Fatalf("runHooked() error = %v, want CANCELLED", err)
+	}
+	want := "onFailure CANCELLED\nfinally\n"
+	if got, _ := os.ReadFile(out); string(got) != want {
+		t.Errorf("output =\n%s\nwant\n%s", got, want)
+	}
+	if interrupted.Load() {
+		t.Error("interrupted still set after the run returned")
+	}
+}
+
+func TestExecuteEnv_hooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	setupTestConfig(t)
+	origOut := commandStdout
+	commandStdout = io.Discard
+	t.Cleanup(func() { commandStdout = origOut })
+
+	out := filepath.Join(t.TempDir(), "out.txt")
+	storeContext(&Context{Profile: Profile{
+		Name: "test",
+		Path: "/test",
+		Environments: []Env{{
+			Name:  "dev",
+			Tasks: []Task{{Type: Shell, Shell: "sh", Cmd: "exit 1"}},
+			Hooks: Hooks{
+				After:     []Task{hookRecorder(out, "after")},
+				OnFailure: []Task{hookRecorder(out, "onFailure $RAID_ERROR_CODE")},
+				Finally:   []Task{hookRecorder(out, "finally")},
+			},
+		}},
+	}})
+	t.Cleanup(func() { storeContext(nil) })
+
+	if err := ExecuteEnv("dev"); err == nil {
+		t.Fatal("ExecuteEnv() expected error from failing task")
+	}
+	want := "onFailure TASK_SHELL_FAILED\nfinally\n"
+	if got, _ := os.ReadFile(out); string(got) != want {
+		t.Errorf("output =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,369 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultHTTPTimeout bounds an HTTP task with no `timeout:`.
+const defaultHTTPTimeout = 30 * time.Second
+
+// httpErrorSnippet caps how much of an unexpected response body is quoted
+// in the task error.
+const httpErrorSnippet = 512
+
+// BasicAuth is an HTTP task's `basicAuth:` credential pair.
+type BasicAuth struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+// HTTPCapture stores part of an HTTP response in a session variable: the
+// whole body, or the value at JSONPath when set.
+type HTTPCapture struct {
+	Var      string `json:"var"`
+	JSONPath string `json:"jsonPath,omitempty" yaml:"jsonPath,omitempty"`
+	Secret   bool   `json:"secret,omitempty"`
+}
+
+// StatusCodes is an HTTP task's `expectStatus:`. It accepts a single code
+// or a list, so `expectStatus: 201` reads naturally.
+type StatusCodes []int
+
+func (s *StatusCodes) UnmarshalJSON(data []byte) error {
+	var one int
+	if err := json.Unmarshal(data, &one); err == nil {
+		*s = StatusCodes{one}
+		return nil
+	}
+	var many []int
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("expectStatus must be a status code or a list of them")
+	}
+	*s = many
+	return nil
+}
+
+func (s *StatusCodes) UnmarshalYAML(node *yaml.Node) error {
+	var one int
+	if node.Kind == yaml.ScalarNode {
+		if err := node.Decode(&one); err != nil {
+			return fmt.Errorf("expectStatus must be a status code or a list of them")
+		}
+		*s = StatusCodes{one}
+		return nil
+	}
+	var many []int
+	if err := node.Decode(&many); err != nil {
+		return fmt.Errorf("expectStatus must be a status code or a list of them")
+	}
+	*s = many
+	return nil
+}
+
+// expandRaidRevealed is expandRaid with secret vars decrypted. Only for
+// values that leave raid without being rendered: HTTP request headers,
+// bodies, and credentials.
+func expandRaidRevealed(s string) string {
+	return os.Expand(s, func(key string) string {
+		v, ok := lookupRaidVarRaw(key)
+		if !ok {
+			return ""
+		}
+		plain, _ := revealRaidVar(key, v)
+		return plain
+	})
+}
+
+// newHTTPRequest builds the request for an HTTP task. The URL, headers,
+// body, and credentials are expanded with secrets revealed, since the
+// server needs the real values; the task's own URL field stays masked for
+// messages.
+func newHTTPRequest(raw, task Task) (*http.Request, error) {
+	expand := expandRaidRevealed
+	if raw.Literal {
+		expand = func(s string) string { return s }
+	}
+
+	method := strings.ToUpper(task.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	switch {
+	case raw.Body != "" && raw.BodyFile != "":
+		return nil, liberrs.ArgInvalid("body and bodyFile are mutually exclusive for HTTP task")
+	case raw.Body != "":
+		body = strings.NewReader(expand(raw.Body))
+	case task.BodyFile != "":
+		data, err := os.ReadFile(task.BodyFile)
+		if err != nil {
+			return nil, liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to read bodyFile '%s': %v", task.BodyFile, err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, expand(raw.URL), body)
+	if err != nil {
+		return nil, liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid HTTP request to '%s': %v", task.URL, err)
+	}
+	for k, v := range raw.Headers {
+		req.Header.Set(k, expand(v))
+	}
+	if raw.BasicAuth != nil && raw.Bearer != "" {
+		return nil, liberrs.ArgInvalid("basicAuth and bearer are mutually exclusive for HTTP task")
+	}
+	if raw.BasicAuth != nil {
+		req.SetBasicAuth(expand(raw.BasicAuth.User), expand(raw.BasicAuth.Password))
+	}
+	if raw.Bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+expand(raw.Bearer))
+	}
+	return req, nil
+}
+
+// newHTTPClient returns a client honouring the task's timeout and TLS
+// options. The default transport is cloned, not mutated, so `insecure:`
+// on one task can't leak into another.
+func newHTTPClient(task Task) (*http.Client, error) {
+	timeout := defaultHTTPTimeout
+	if task.Timeout != "" {
+		d, err := time.ParseDuration(task.Timeout)
+		if err != nil {
+			return nil, liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid timeout '%s': %v", task.Timeout, err)
+		}
+		timeout = d
+	}
+	client := &http.Client{Timeout: timeout}
+	if !task.Insecure && task.CAFile == "" {
+		return client, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: task.Insecure}
+	if task.CAFile != "" {
+		pem, err := os.ReadFile(task.CAFile)
+		if err != nil {
+			return nil, liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to read caFile '%s': %v", task.CAFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "caFile '%s' contains no PEM certificates", task.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client.Transport = transport
+	return client, nil
+}
+
+// checkHTTPStatus reports whether the response status is acceptable: one
+// of expectStatus when set, any 2xx otherwise. The error quotes the start
+// of the body, redacted, since that's usually where the server says why.
+func checkHTTPStatus(task Task, resp *http.Response) error {
+	ok := resp.StatusCode >= 200 && resp.StatusCode < 300
+	if len(task.ExpectStatus) > 0 {
+		ok = slices.Contains(task.ExpectStatus, resp.StatusCode)
+	}
+	if ok {
+		return nil
+	}
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, httpErrorSnippet))
+	msg := fmt.Sprintf("HTTP request to '%s' returned status %d", task.URL, resp.StatusCode)
+	if len(task.ExpectStatus) > 0 {
+		msg += fmt.Sprintf(" (expected %s)", joinInts(task.ExpectStatus))
+	}
+	if s := strings.TrimSpace(string(snippet)); s != "" {
+		msg += ": " + redactString(s)
+	}
+	return liberrs.Newf(liberrs.CodeTaskHTTPFailed, liberrs.CategoryNetwork, "%s", msg)
+}
+
+func joinInts(ns []int) string {
+	parts := make([]string, len(ns))
+	for i, n := range ns {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// storeHTTPCaptures evaluates each capture against the response body and
+// stores the results as session vars. The body is parsed as JSON at most
+// once, and only when some capture has a jsonPath.
+func storeHTTPCaptures(task Task, body []byte) error {
+	var doc any
+	parsed := false
+	for _, c := range task.Capture {
+		if c.Var == "" {
+			return liberrs.ArgInvalid("var is required for each HTTP capture")
+		}
+		value := strings.TrimRight(string(body), "\r\n")
+		if c.JSONPath != "" {
+			if !parsed {
+				if err := json.Unmarshal(body, &doc); err != nil {
+					return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "response from '%s' is not JSON, can't capture %s: %v", task.URL, c.Var, err)
+				}
+				parsed = true
+			}
+			v, err := jsonPathLookup(doc, c.JSONPath)
+			if err != nil {
+				return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "capture %s: %v", c.Var, err)
+			}
+			value = jsonScalarString(v)
+		}
+		if err := storeSessionVar(c.Var, value, c.Secret, "HTTP capture"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeSessionVar sets a session-scoped raid var, encrypting it when
+// secret. Shared by tasks that produce a value at run time.
+func storeSessionVar(name, value string, secret bool, caller string) error {
+	name = strings.ToUpper(name)
+	if err := validateRaidVar(name, value, caller); err != nil {
+		return err
+	}
+	if secret {
+		enc, err := encryptSecret(value)
+		if err != nil {
+			return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to encrypt %s: %v", name, err)
+		}
+		value = enc
+	}
+	raidVarsMu.Lock()
+	defer raidVarsMu.Unlock()
+	return storeRaidVarLocked(name, value, VarScopeSession)
+}
+
+// jsonPathSeg is one step of a parsed JSONPath: an object key or, when
+// isIndex is set, an array index.
+type jsonPathSeg struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func (s jsonPathSeg) String() string {
+	if s.isIndex {
+		return fmt.Sprintf("[%d]", s.index)
+	}
+	return "." + s.key
+}
+
+// parseJSONPath parses a small JSONPath subset: `$`, `.key`, `['key']`,
+// and `[index]`. Enough to address an ID or token in an API response, or a
+// setting in a config file, without a jq dependency.
+func parseJSONPath(path string) ([]jsonPathSeg, error) {
+	p := strings.TrimSpace(path)
+	if !strings.HasPrefix(p, "$") {
+		return nil, fmt.Errorf("jsonPath %q must start with $", path)
+	}
+	p = p[1:]
+	var segs []jsonPathSeg
+	for p != "" {
+		switch {
+		case p[0] == '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("jsonPath %q has an empty key", path)
+			}
+			segs = append(segs, jsonPathSeg{key: p[:end]})
+			p = p[end:]
+		case strings.HasPrefix(p, "['") || strings.HasPrefix(p, `["`):
+			quote := p[1]
+			end := strings.IndexByte(p[2:], quote)
+			if end < 0 || !strings.HasPrefix(p[2+end+1:], "]") {
+				return nil, fmt.Errorf("jsonPath %q has an unterminated ['key']", path)
+			}
+			segs = append(segs, jsonPathSeg{key: p[2 : 2+end]})
+			p = p[2+end+2:]
+		case p[0] == '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("jsonPath %q has an unterminated [index]", path)
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(p[1:end]))
+			if err != nil {
+				return nil, fmt.Errorf("jsonPath %q: %q is not an index", path, p[1:end])
+			}
+			segs = append(segs, jsonPathSeg{index: n, isIndex: true})
+			p = p[end+1:]
+		default:
+			return nil, fmt.Errorf("jsonPath %q: unexpected %q", path, p)
+		}
+	}
+	return segs, nil
+}
+
+// jsonPathLookup evaluates a JSONPath (see parseJSONPath) against a
+// decoded JSON document. Negative indexes count from the end.
+func jsonPathLookup(doc any, path string) (any, error) {
+	segs, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	cur := doc
+	for _, seg := range segs {
+		if seg.isIndex {
+			arr, ok := cur.([]any)
+			if !ok {
+				return nil, fmt.Errorf("jsonPath %q: [%d] applied to a non-array", path, seg.index)
+			}
+			index := seg.index
+			if index < 0 {
+				index += len(arr)
+			}
+			if index < 0 || index >= len(arr) {
+				return nil, fmt.Errorf("jsonPath %q: index %d out of range (length %d)", path, index, len(arr))
+			}
+			cur = arr[index]
+			continue
+		}
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("jsonPath %q: .%s applied to a non-object", path, seg.key)
+		}
+		v, ok := obj[seg.key]
+		if !ok {
+			return nil, fmt.Errorf("jsonPath %q: no key %q", path, seg.key)
+		}
+		cur = v
+	}
+	return cur, nil
+}
+
+// jsonScalarString renders a JSONPath result as a var value: strings
+// as-is, null as empty, everything else as compact JSON.
+func jsonScalarString(v any) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case nil:
+		return ""
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
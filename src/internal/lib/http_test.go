@@ -0,0 +1,207 @@
+package lib
+
+import (
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+	"gopkg.in/yaml.v3"
+)
+
+func TestExecuteTask_httpRequestAndCapture(t *testing.T) {
+	setupVarsFile(t)
+	if _, err := PersistVar("ADMIN_TOKEN", "tok-123456", VarScopeSession, true); err != nil {
+		t.Fatal(err)
+	}
+	withRaidVar(t, "USER_NAME", "ada")
+
+	var gotMethod, gotAuth, gotType, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotAuth = r.Header.Get("Authorization")
+		gotType = r.Header.Get("Content-Type")
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"user":{"id":42,"tags":["a","b"]},"token":"t-1"}`))
+	}))
+	defer srv.Close()
+
+	task := Task{
+		Type:         HTTP,
+		URL:          srv.URL + "/users",
+		Method:       "post",
+		Headers:      map[string]string{"Content-Type": "application/json"},
+		Body:         `{"name":"$USER_NAME"}`,
+		Bearer:       "$ADMIN_TOKEN",
+		ExpectStatus: StatusCodes{201},
+		Capture: []HTTPCapture{
+			{Var: "user_id", JSONPath: "$.user.id"},
+			{Var: "LAST_TAG", JSONPath: "$.user.tags[-1]"},
+			{Var: "SESSION_TOKEN", JSONPath: "$['token']", Secret: true},
+		},
+	}
+	if err := ExecuteTask(task); err != nil {
+		t.Fatalf("ExecuteTask(HTTP) error: %v", err)
+	}
+	if gotMethod != "POST" || gotType != "application/json" || gotBody != `{"name":"ada"}` {
+		t.Errorf("request = %s %q %q, want POST with the expanded JSON body", gotMethod, gotType, gotBody)
+	}
+	if gotAuth != "Bearer tok-123456" {
+		t.Errorf("Authorization = %q, want the decrypted bearer token", gotAuth)
+	}
+	if v, _ := lookupRaidVar("USER_ID"); v != "42" {
+		t.Errorf("USER_ID = %q, want 42", v)
+	}
+	if v, _ := lookupRaidVar("LAST_TAG"); v != "b" {
+		t.Errorf("LAST_TAG = %q, want b", v)
+	}
+	e, err := GetVar("SESSION_TOKEN")
+	if err != nil || !e.Secret || e.Source != VarSourceSession {
+		t.Errorf("GetVar(SESSION_TOKEN) = %+v, %v; want a session secret", e, err)
+	}
+}
+
+func TestExecuteTask_httpBasicAuthAndDiscard(t *testing.T) {
+	var user, pass string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ = r.BasicAuth()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	task := Task{Type: HTTP, URL: srv.URL, Method: "DELETE", BasicAuth: &BasicAuth{User: "admin", Password: "pw"}}
+	if err := ExecuteTask(task); err != nil {
+		t.Fatalf("ExecuteTask(HTTP DELETE) error: %v", err)
+	}
+	if user != "admin" || pass != "pw" {
+		t.Errorf("basic auth = %q/%q, want admin/pw", user, pass)
+	}
+}
+
+func TestExecuteTask_httpUnexpectedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte("user already exists"))
+	}))
+	defer srv.Close()
+
+	err := ExecuteTask(Task{Type: HTTP, URL: srv.URL, Method: "POST", ExpectStatus: StatusCodes{201, 200}})
+	rErr, ok := liberrs.AsError(err)
+	if !ok || rErr.Code() != liberrs.CodeTaskHTTPFailed {
+		t.Fatalf("error = %v, want TASK_HTTP_FAILED", err)
+	}
+	for _, want := range []string{"409", "201, 200", "user already exists"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error = %q, want it to mention %q", err.Error(), want)
+		}
+	}
+
+	// A listed non-2xx status is a success.
+	if err := ExecuteTask(Task{Type: HTTP, URL: srv.URL, Method: "POST", ExpectStatus: StatusCodes{409}}); err != nil {
+		t.Errorf("expectStatus 409 error: %v", err)
+	}
+}
+
+func TestExecuteTask_httpTLSOptions(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	dest := filepath.Join(t.TempDir(), "out")
+
+	if err := ExecuteTask(Task{Type: HTTP, URL: srv.URL, Dest: dest}); err == nil {
+		t.Fatal("self-signed server accepted without insecure or caFile")
+	}
+	if err := ExecuteTask(Task{Type: HTTP, URL: srv.URL, Dest: dest, Insecure: true}); err != nil {
+		t.Errorf("insecure: %v", err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExecuteTask(Task{Type: HTTP, URL: srv.URL, Dest: dest, CAFile: caFile}); err != nil {
+		t.Errorf("caFile: %v", err)
+	}
+}
+
+func TestExecuteTask_httpBodyFileAndTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	bodyFile := filepath.Join(t.TempDir(), "body.json")
+	os.WriteFile(bodyFile, []byte(`{"raw":"$NOT_EXPANDED"}`), 0o644)
+	dest := filepath.Join(t.TempDir(), "echo")
+	if err := ExecuteTask(Task{Type: HTTP, URL: srv.URL, Method: "PUT", BodyFile: bodyFile, Dest: dest, Timeout: "5s"}); err != nil {
+		t.Fatalf("ExecuteTask() error: %v", err)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != `{"raw":"$NOT_EXPANDED"}` {
+		t.Errorf("echoed body = %q, want bodyFile sent verbatim", got)
+	}
+
+	if err := ExecuteTask(Task{Type: HTTP, URL: srv.URL, Dest: dest, Timeout: "soon"}); err == nil {
+		t.Error("invalid timeout accepted")
+	}
+	if err := ExecuteTask(Task{Type: HTTP, URL: srv.URL, Method: "POST", Body: "a", BodyFile: bodyFile}); err == nil {
+		t.Error("body and bodyFile together accepted")
+	}
+}
+
+func TestJSONPathLookup(t *testing.T) {
+	doc := map[string]any{
+		"items": []any{map[string]any{"id": "x"}, map[string]any{"id": "y"}},
+		"a.b":   true,
+	}
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"$.items[1].id", "y", false},
+		{"$.items[-2]['id']", "x", false},
+		{`$["a.b"]`, "true", false},
+		{"$.items", `[{"id":"x"},{"id":"y"}]`, false},
+		{"$.missing", "", true},
+		{"$.items[5]", "", true},
+		{"$.items.id", "", true},
+		{"items", "", true},
+	}
+	for _, tt := range tests {
+		v, err := jsonPathLookup(doc, tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("jsonPathLookup(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			continue
+		}
+		if err == nil && jsonScalarString(v) != tt.want {
+			t.Errorf("jsonPathLookup(%q) = %q, want %q", tt.path, jsonScalarString(v), tt.want)
+		}
+	}
+}
+
+func TestStatusCodes_unmarshal(t *testing.T) {
+	var one, many Task
+	if err := yaml.Unmarshal([]byte("expectStatus: 201"), &one); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal([]byte("expectStatus: [200, 204]"), &many); err != nil {
+		t.Fatal(err)
+	}
+	if len(one.ExpectStatus) != 1 || one.ExpectStatus[0] != 201 || len(many.ExpectStatus) != 2 {
+		t.Errorf("ExpectStatus = %v / %v, want [201] / [200 204]", one.ExpectStatus, many.ExpectStatus)
+	}
+	var fromJSON StatusCodes
+	if err := fromJSON.UnmarshalJSON([]byte("404")); err != nil || fromJSON[0] != 404 {
+		t.Errorf("UnmarshalJSON(404) = %v, %v", fromJSON, err)
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"bytes"
 	stdctx "context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -72,11 +74,24 @@ func storeContext(c *Context) {
 	contextPtr.Store(c)
 }
 
-const raidVarsFileName = "vars"
+const (
+	// raidVarsFileName is the global vars file, shared by every profile.
+	raidVarsFileName = "vars"
+	// raidVarsDirName holds one vars file per profile, next to the
+	// global file.
+	raidVarsDirName = "vars.d"
+)
 
 var (
-	raidVarsMu           sync.RWMutex
-	raidVars             = map[string]string{}
+	raidVarsMu sync.RWMutex
+	raidVars   = map[string]string{}
+	// raidVarScopes records where each Set value in raidVars came from so
+	// the vars API can report and edit the right file. RAID_REPO_* entries
+	// are derived, not set, and aren't tracked here.
+	raidVarScopes = map[string]VarScope{}
+	// raidVarsProfile is the profile whose vars file is loaded into
+	// raidVars; "" when no profile is active.
+	raidVarsProfile      string
 	raidVarsOverridePath string // set in tests to redirect the vars file
 )
 
@@ -121,6 +136,7 @@ func endSession() {
 	commandSession = nil
 }
 
+// raidVarsPath returns the global vars file.
 func raidVarsPath() string {
 	if raidVarsOverridePath != "" {
 		return raidVarsOverridePath
@@ -128,10 +144,64 @@ func raidVarsPath() string {
 	return filepath.Join(sys.GetHomeDir(), ConfigDirName, raidVarsFileName)
 }
 
+// profileVarsPath returns the vars file for profile, or "" when profile
+// is empty. It lives in vars.d/ beside the global file so a test override
+// of raidVarsPath redirects both.
+func profileVarsPath(profile string) string {
+	return profileVarsPathIn(filepath.Dir(raidVarsPath()), profile)
+}
+
+// profileVarsPathIn builds the per-profile vars path under dir.
+func profileVarsPathIn(dir, profile string) string {
+	if profile == "" {
+		return ""
+	}
+	return filepath.Join(dir, raidVarsDirName, profileFileName(profile))
+}
+
+// profileFileName turns a profile name into a file name for per-profile
+// state. Names are folded to lowercase to match the case-insensitive
+// profile registry, and anything outside [a-z0-9_-] becomes '_' so a
+// profile name can't escape its directory or collide with a dotfile.
+func profileFileName(profile string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(profile))
+}
+
+// loadRaidVars merges the global vars file and then the active profile's
+// file into raidVars, so a profile-scoped value overrides a global one of
+// the same name. The profile is whatever raidVarsProfile names; ForceLoad
+// sets it before calling. A read-only load skips the legacy migration,
+// which writes files, and leaves it to the next real load.
 func loadRaidVars() {
-	path := raidVarsPath()
+	raidVarsMu.RLock()
+	profile := raidVarsProfile
+	raidVarsMu.RUnlock()
+
+	if !readOnlyLoad.Load() {
+		migrateRaidVars(profile)
+	}
+	global := readVarsFile(raidVarsPath())
+	var scoped map[string]string
+	if path := profileVarsPath(profile); path != "" {
+		scoped = readVarsFile(path)
+	}
+
+	raidVarsMu.Lock()
+	defer raidVarsMu.Unlock()
+	applyPersistedVarsLocked(global, scoped)
+}
+
+// readVarsFile parses one persisted vars file. A missing file yields nil;
+// a malformed one is reported to stderr and also yields nil so a bad file
+// never blocks a load.
+func readVarsFile(path string) map[string]string {
 	if !sys.FileExists(path) {
-		return
+		return nil
 	}
 	// Tighten perms on existing vars files written by earlier raid
 	// versions (godotenv defaults to 0644). The file may carry
@@ -152,18 +222,70 @@ func loadRaidVars() {
 		if !suppressLoadWarnings.Load() {
 			fmt.Fprintf(os.Stderr, "raid: failed to load persisted vars from %s: %v\n", path, err)
 		}
+		return nil
+	}
+	return m
+}
+
+// migrateRaidVars moves vars persisted before per-profile scoping existed
+// out of the global file and into the active profile's file — they were
+// written by Set tasks that now default to profile scope. It runs once:
+// the vars.d/ directory existing marks the layout as migrated, so values
+// later written to the global file with `scope: global` stay put. Nothing
+// happens until a profile is active, since there's nowhere to move to.
+func migrateRaidVars(profile string) {
+	if profile == "" {
+		return
+	}
+	globalPath := raidVarsPath()
+	dir := filepath.Join(filepath.Dir(globalPath), raidVarsDirName)
+	if _, err := os.Stat(dir); !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		if !suppressLoadWarnings.Load() {
+			fmt.Fprintf(os.Stderr, "raid: failed to create %s: %v\n", dir, err)
+		}
+		return
+	}
+	legacy := readVarsFile(globalPath)
+	if len(legacy) == 0 {
 		return
 	}
+
 	raidVarsMu.Lock()
 	defer raidVarsMu.Unlock()
-	for k, v := range m {
-		raidVars[strings.ToUpper(k)] = v
+	// Write the profile file before emptying the global one so a failure
+	// part-way leaves the values duplicated rather than lost.
+	target := profileVarsPath(profile)
+	err := rewriteVarsFile(target, func(m map[string]string) {
+		for k, v := range legacy {
+			if _, ok := m[k]; !ok {
+				m[k] = v
+			}
+		}
+	})
+	if err == nil {
+		err = rewriteVarsFile(globalPath, func(m map[string]string) {
+			for k := range legacy {
+				delete(m, k)
+			}
+		})
+	}
+	if err != nil {
+		if !suppressLoadWarnings.Load() {
+			fmt.Fprintf(os.Stderr, "raid: failed to migrate persisted vars to %s: %v\n", target, err)
+		}
+		return
+	}
+	if !suppressLoadWarnings.Load() {
+		fmt.Fprintf(os.Stderr, "raid: moved %d persisted var(s) from %s to %s; vars are now scoped per profile (use `scope: global` on a Set task to share one)\n", len(legacy), globalPath, target)
 	}
 }
 
 // snapshotRaidVars returns an independent copy of the raidVars map so callers
 // can serialize or hand it to JSON without holding the mutex or sharing
-// internal state. Returns nil when there are no vars so the JSON serializer
+// internal state. Secret values are masked. Returns nil when there are no vars so the JSON serializer
 // honours `omitempty` instead of emitting an empty object.
 func snapshotRaidVars() map[string]string {
 	raidVarsMu.RLock()
@@ -173,7 +295,7 @@ func snapshotRaidVars() map[string]string {
 	}
 	out := make(map[string]string, len(raidVars))
 	for k, v := range raidVars {
-		out[k] = v
+		out[k] = maskRaidVar(v)
 	}
 	return out
 }
@@ -188,11 +310,16 @@ var varsWatchDebounce = 50 * time.Millisecond
 // drives onChange synchronously instead of going through fsnotify.
 var newVarsWatcherFn = newVarsWatcher
 
-// WatchRaidVars watches the raid vars file (~/.raid/vars) for the lifetime
-// of ctx and invokes onChange whenever the file is created, modified, or
-// replaced. Events are debounced. The watcher is attached to the parent
-// directory so atomic-rename writes (which swap the inode) keep firing —
-// a watch on the file itself would silently go deaf after the first rename.
+// WatchRaidVars watches the raid vars files — the global ~/.raid/vars and
+// the active profile's ~/.raid/vars.d/<profile> — for the lifetime of ctx
+// and invokes onChange whenever either is created, modified, or replaced.
+// Events are debounced. The watcher is attached to the parent directories
+// so atomic-rename writes (which swap the inode) keep firing — a watch on
+// the file itself would silently go deaf after the first rename.
+//
+// The profile file is resolved per event from the profile the last load
+// used, so after a ForceLoad onto a different profile the watcher follows
+// the new file without being restarted.
 //
 // onChange is the caller's reload hook; lib does not assume what to reload,
 // so the MCP server passes a closure that runs ForceLoad under the
@@ -209,7 +336,6 @@ func newVarsWatcher(ctx stdctx.Context, varsPath string, onChange func()) error
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return liberrs.Newf(liberrs.CodeInternal, liberrs.CategoryGeneric, "ensure vars watch dir %s: %v", dir, err)
 	}
-
 	w, err := fsnotify.NewWatcher()
 	if err != nil {
 		return liberrs.Newf(liberrs.CodeInternal, liberrs.CategoryGeneric, "create fsnotify watcher: %v", err)
@@ -218,14 +344,38 @@ func newVarsWatcher(ctx stdctx.Context, varsPath string, onChange func()) error
 		_ = w.Close()
 		return liberrs.Newf(liberrs.CodeInternal, liberrs.CategoryGeneric, "watch %s: %v", dir, err)
 	}
+	// vars.d/ may not exist yet, and the watcher mustn't create it: its
+	// existence marks the vars migration done. runVarsWatcher starts
+	// watching it once it appears.
+	profileDir := filepath.Join(dir, raidVarsDirName)
+	if sys.FileExists(profileDir) {
+		if err := w.Add(profileDir); err != nil {
+			_ = w.Close()
+			return liberrs.Newf(liberrs.CodeInternal, liberrs.CategoryGeneric, "watch %s: %v", profileDir, err)
+		}
+	}
 
 	go runVarsWatcher(ctx, w, varsPath, onChange)
 	return nil
 }
 
+// isWatchedVarsFile reports whether the event path name is the global vars
+// file or the vars file of the currently loaded profile. Compares the last
+// two path elements rather than whole paths because fsnotify may report a
+// symlink-resolved directory (/private/var vs /var on macOS).
+func isWatchedVarsFile(varsPath, name string) bool {
+	parent := filepath.Base(filepath.Dir(name))
+	if parent == raidVarsDirName {
+		raidVarsMu.RLock()
+		profile := raidVarsProfile
+		raidVarsMu.RUnlock()
+		return profile != "" && filepath.Base(name) == filepath.Base(profileVarsPathIn(filepath.Dir(varsPath), profile))
+	}
+	return filepath.Base(name) == filepath.Base(varsPath) && parent == filepath.Base(filepath.Dir(varsPath))
+}
+
 func runVarsWatcher(ctx stdctx.Context, w *fsnotify.Watcher, varsPath string, onChange func()) {
 	defer w.Close()
-	target := filepath.Base(varsPath)
 
 	// Use a timer.C channel rather than time.AfterFunc so onChange runs
 	// from this goroutine — gated by the same select that watches
@@ -258,7 +408,16 @@ func runVarsWatcher(ctx stdctx.Context, w *fsnotify.Watcher, varsPath string, on
 			if !ok {
 				return
 			}
-			if filepath.Base(ev.Name) != target {
+			if ev.Has(fsnotify.Create) && ev.Name == filepath.Join(filepath.Dir(varsPath), raidVarsDirName) {
+				// vars.d/ was just created, likely by the migration, which
+				// writes the profile file before this watch is in place.
+				if err := w.Add(ev.Name); err != nil {
+					fmt.Fprintf(os.Stderr, "raid: vars watcher error: %v\n", err)
+				}
+				arm()
+				continue
+			}
+			if !isWatchedVarsFile(varsPath, ev.Name) {
 				continue
 			}
 			arm()
@@ -292,51 +451,84 @@ func stopTimer(t *time.Timer) {
 	}
 }
 
-// expandRaid expands $VAR and ${VAR} references. Lookup order:
+// lookupRaidVar resolves a variable name the way task expansion does.
+// Lookup order:
 //  1. raidVars (Set tasks) — highest priority
 //  2. commandSession vars (exports from Shell tasks in the current command)
 //  3. OS environment — lowest priority
-func expandRaid(s string) string {
-	return os.Expand(s, func(key string) string {
-		raidVarsMu.RLock()
-		v, ok := raidVars[strings.ToUpper(key)]
-		raidVarsMu.RUnlock()
+//
+// Secret raid vars resolve to maskedValue; only buildSubprocessEnv sees
+// their plaintext.
+func lookupRaidVar(key string) (string, bool) {
+	v, ok := lookupRaidVarRaw(key)
+	return maskRaidVar(v), ok
+}
+
+// lookupRaidVarRaw is lookupRaidVar without masking: a secret raid var is
+// returned still encrypted, so callers can tell it apart.
+func lookupRaidVarRaw(key string) (string, bool) {
+	raidVarsMu.RLock()
+	v, ok := raidVars[strings.ToUpper(key)]
+	raidVarsMu.RUnlock()
+	if ok {
+		return v, true
+	}
+	if commandSession != nil {
+		commandSession.mu.RLock()
+		v, ok = commandSession.vars[key]
+		commandSession.mu.RUnlock()
 		if ok {
-			return v
-		}
-		if commandSession != nil {
-			commandSession.mu.RLock()
-			v, ok = commandSession.vars[key]
-			commandSession.mu.RUnlock()
-			if ok {
-				return v
-			}
+			return v, true
 		}
-		return os.Getenv(key)
+	}
+	return os.LookupEnv(key)
+}
+
+// expandRaid expands $VAR and ${VAR} references using lookupRaidVar.
+// Unresolved references expand to the empty string.
+func expandRaid(s string) string {
+	return os.Expand(s, func(key string) string {
+		v, _ := lookupRaidVar(key)
+		return v
 	})
 }
 
+// expandRaidAll applies expandRaid to each element, returning nil for an
+// empty slice.
+func expandRaidAll(ss []string) []string {
+	if len(ss) == 0 {
+		return nil
+	}
+	out := make([]string, len(ss))
+	for i, s := range ss {
+		out[i] = expandRaid(s)
+	}
+	return out
+}
+
+// expandRaidMap applies expandRaid to each value of m, returning nil for an
+// empty map.
+func expandRaidMap(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = expandRaid(v)
+	}
+	return out
+}
+
 // expandRaidForShell is like expandRaid but leaves variables that cannot be
 // resolved as literal "$key" tokens so the shell subprocess can expand them
 // itself. This prevents shell-local variable references (e.g. ${WORD} set
 // earlier in the same script) from being silently replaced with empty strings.
+// Secret vars are passed through the same way: the shell reads their
+// plaintext from the subprocess env instead of raid splicing it into the
+// script text.
 func expandRaidForShell(s string) string {
 	return os.Expand(s, func(key string) string {
-		raidVarsMu.RLock()
-		v, ok := raidVars[strings.ToUpper(key)]
-		raidVarsMu.RUnlock()
-		if ok {
-			return v
-		}
-		if commandSession != nil {
-			commandSession.mu.RLock()
-			v, ok = commandSession.vars[key]
-			commandSession.mu.RUnlock()
-			if ok {
-				return v
-			}
-		}
-		if v, ok := os.LookupEnv(key); ok {
+		if v, ok := lookupRaidVarRaw(key); ok && !isSecretValue(v) {
 			return v
 		}
 		// Unknown — pass through using ${key} so that parameter expansions
@@ -358,6 +550,8 @@ func QuietLoad() []Command {
 	// will print again anyway.
 	suppressLoadWarnings.Store(true)
 	defer suppressLoadWarnings.Store(false)
+	readOnlyLoad.Store(true)
+	defer readOnlyLoad.Store(false)
 	if !initConfigReadOnly() {
 		return nil
 	}
@@ -371,6 +565,11 @@ func QuietLoad() []Command {
 // profile loading. Set only by QuietLoad, whose contract is "no warnings".
 var suppressLoadWarnings atomic.Bool
 
+// readOnlyLoad keeps a load from writing anything, such as the vars
+// migration. Set only by QuietLoad, whose contract is that it creates no
+// files.
+var readOnlyLoad atomic.Bool
+
 // ResetContext clears the cached load context, forcing the next Load or ForceLoad to
 // rebuild from the current viper configuration.
 func ResetContext() {
@@ -387,11 +586,13 @@ func Load() error {
 
 // ForceLoad rebuilds the context from the active profile, ignoring any cached state.
 func ForceLoad() error {
+	p := GetProfile()
 	raidVarsMu.Lock()
 	raidVars = map[string]string{}
+	raidVarScopes = map[string]VarScope{}
+	raidVarsProfile = p.Name
 	raidVarsMu.Unlock()
 	loadRaidVars()
-	p := GetProfile()
 	if p.IsZero() {
 		storeContext(&Context{Env: GetEnv()})
 		return nil
@@ -403,9 +604,7 @@ func ForceLoad() error {
 	}
 
 	homeDir := sys.GetHomeDir()
-	for i := range profile.Commands {
-		profile.Commands[i].Tasks = withDefaultDir(profile.Commands[i].Tasks, homeDir)
-	}
+	applyCommandDir(profile.Commands, homeDir)
 	for name, tasks := range profile.Groups {
 		profile.Groups[name] = withDefaultDir(tasks, homeDir)
 	}
@@ -416,9 +615,7 @@ func ForceLoad() error {
 		}
 		repo := &profile.Repositories[i]
 		repoDir := sys.ExpandPath(repo.Path)
-		for j := range repo.Commands {
-			repo.Commands[j].Tasks = withDefaultDir(repo.Commands[j].Tasks, repoDir)
-		}
+		applyCommandDir(repo.Commands, repoDir)
 		profile.Commands = mergeCommands(profile.Commands, repo.Commands)
 	}
 
@@ -434,6 +631,7 @@ func ForceLoad() error {
 	}
 
 	setRepoVars(profile.Repositories)
+	validateRedactPatterns(profile)
 
 	storeContext(&Context{
 		Profile: profile,
@@ -461,7 +659,7 @@ func setRepoVars(repos []Repo) {
 	raidVarsMu.Lock()
 	defer raidVarsMu.Unlock()
 	for k := range raidVars {
-		if strings.HasPrefix(k, "RAID_REPO_") {
+		if strings.HasPrefix(k, repoVarPrefix) {
 			delete(raidVars, k)
 		}
 	}
@@ -479,9 +677,9 @@ func setRepoVars(repos []Repo) {
 			}
 		}
 		seen[key] = repo.Name
-		raidVars["RAID_REPO_"+key+"_URL"] = ScrubURL(repo.URL)
-		raidVars["RAID_REPO_"+key+"_PATH"] = sys.ExpandPath(repo.Path)
-		raidVars["RAID_REPO_"+key+"_BRANCH"] = repo.Branch
+		raidVars[repoVarPrefix+key+"_URL"] = ScrubURL(repo.URL)
+		raidVars[repoVarPrefix+key+"_PATH"] = sys.ExpandPath(repo.Path)
+		raidVars[repoVarPrefix+key+"_BRANCH"] = repo.Branch
 	}
 }
 
@@ -578,7 +776,11 @@ func InstallRepo(name string) error {
 		return liberrs.Newf(liberrs.CodeRepoNotFound, liberrs.CategoryNotFound, "repository '%s' not found in active profile", name)
 	}
 
-	return installRepo(*repo)
+	vars := map[string]string{"REPO": repo.Name}
+	if err := runLifecycleHook(hookPreInstall, vars); err != nil {
+		return err
+	}
+	return runPostHook(hookPostInstall, vars, installRepo(*repo))
 }
 
 // Install clones all repositories in the active profile and runs install tasks.
@@ -592,6 +794,16 @@ func Install(maxThreads int) error {
 		return liberrs.Newf(liberrs.CodeProfileNotActive, liberrs.CategoryNotFound, "profile not found")
 	}
 
+	if err := runLifecycleHook(hookPreInstall, nil); err != nil {
+		return err
+	}
+	return runPostHook(hookPostInstall, nil, installProfile(profile, maxThreads))
+}
+
+// installProfile clones profile's repositories, at most maxThreads at a
+// time when it's positive, then runs the profile's and each repository's
+// install tasks.
+func installProfile(profile Profile, maxThreads int) error {
 	var semaphore chan struct{}
 	if maxThreads > 0 {
 		semaphore = make(chan struct{}, maxThreads)
@@ -0,0 +1,124 @@
+package lib
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+	"github.com/8bitalex/raid/src/internal/sys"
+)
+
+// Lifecycle hook events, named as they're keyed under a profile's hooks:.
+const (
+	hookPreInstall  = "preInstall"
+	hookPostInstall = "postInstall"
+	hookPreEnv      = "preEnv"
+	hookPostEnv     = "postEnv"
+	hookPreCommand  = "preCommand"
+	hookPostCommand = "postCommand"
+	hookPostClone   = "postClone"
+)
+
+// hookVarPrefix prefixes the env vars that describe the event to a
+// lifecycle hook's tasks, e.g. RAID_HOOK_EVENT.
+const hookVarPrefix = "RAID_HOOK_"
+
+// LifecycleHooks are a profile's `hooks:`, task lists run on raid events.
+// Pre hooks run before the event and abort it when they fail. Post hooks
+// run after it whether or not it succeeded, with the outcome in
+// RAID_HOOK_STATUS and RAID_HOOK_ERROR_CODE.
+type LifecycleHooks struct {
+	PreInstall  []Task `json:"preInstall,omitempty" yaml:"preInstall,omitempty"`
+	PostInstall []Task `json:"postInstall,omitempty" yaml:"postInstall,omitempty"`
+	PreEnv      []Task `json:"preEnv,omitempty" yaml:"preEnv,omitempty"`
+	PostEnv     []Task `json:"postEnv,omitempty" yaml:"postEnv,omitempty"`
+	PreCommand  []Task `json:"preCommand,omitempty" yaml:"preCommand,omitempty"`
+	PostCommand []Task `json:"postCommand,omitempty" yaml:"postCommand,omitempty"`
+	PostClone   []Task `json:"postClone,omitempty" yaml:"postClone,omitempty"`
+}
+
+func (h LifecycleHooks) tasks(event string) []Task {
+	switch event {
+	case hookPreInstall:
+		return h.PreInstall
+	case hookPostInstall:
+		return h.PostInstall
+	case hookPreEnv:
+		return h.PreEnv
+	case hookPostEnv:
+		return h.PostEnv
+	case hookPreCommand:
+		return h.PreCommand
+	case hookPostCommand:
+		return h.PostCommand
+	case hookPostClone:
+		return h.PostClone
+	}
+	return nil
+}
+
+// lifecycleMu serializes lifecycle hooks. Each swaps in a session of its
+// own for as long as it runs, and Install fires postClone from concurrent
+// clones.
+var lifecycleMu sync.Mutex
+
+// runLifecycleHook runs the active profile's tasks for event, from the
+// home directory, with vars exported as RAID_HOOK_<key> alongside
+// RAID_HOOK_EVENT. They're set in the hook's session, not the process
+// environment, so only the hook's tasks and their subprocesses see them,
+// not a git clone running alongside.
+func runLifecycleHook(event string, vars map[string]string) error {
+	ctx := loadContext()
+	if ctx == nil {
+		return nil
+	}
+	tasks := ctx.Profile.Hooks.tasks(event)
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	env := map[string]string{hookVarPrefix + "EVENT": event}
+	for k, v := range vars {
+		env[hookVarPrefix+k] = v
+	}
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+	// Hooks get their own session, as a Run task's command does, so their
+	// Shell exports, RAID_HOOK_* included, don't leak into the command
+	// they surround.
+	parentSession := commandSession
+	startSession()
+	defer func() { commandSession = parentSession }()
+	commandSession.mu.Lock()
+	maps.Copy(commandSession.vars, env)
+	commandSession.mu.Unlock()
+
+	if err := ExecuteTasks(withDefaultDir(tasks, sys.GetHomeDir())); err != nil {
+		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "%s hook failed: %v", event, err)
+	}
+	return nil
+}
+
+// runPostHook runs the hook for event after an action that returned err,
+// adding the outcome to vars. The action's error wins; a hook failure
+// after a failed action is only warned about.
+func runPostHook(event string, vars map[string]string, err error) error {
+	vars = maps.Clone(vars)
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+	vars["STATUS"] = "success"
+	if err != nil {
+		vars["STATUS"] = "failure"
+		vars["ERROR_CODE"] = errorCodeFor(err)
+	}
+	hookErr := runLifecycleHook(event, vars)
+	if err == nil {
+		return hookErr
+	}
+	if hookErr != nil {
+		fmt.Fprintf(commandStderr, "raid: warning: %v\n", hookErr)
+	}
+	return err
+}
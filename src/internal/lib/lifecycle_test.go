@@ -0,0 +1,201 @@
+package lib
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+)
+
+// lifecycleRecorder returns a hook task that appends line to out, with
+// $RAID_HOOK_* left for the shell to expand.
+func lifecycleRecorder(out, line string) []Task {
+	return []Task{{Type: Shell, Shell: "sh", Literal: true, Cmd: `echo "` + line + `" >> ` + out}}
+}
+
+func TestLifecycleHooks_command(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	setupTestConfig(t)
+	origOut := commandStdout
+	commandStdout = io.Discard
+	t.Cleanup(func() { commandStdout = origOut })
+
+	out := filepath.Join(t.TempDir(), "out.txt")
+	storeContext(&Context{Profile: Profile{
+		Commands: []Command{
+			{Name: "ok", Tasks: lifecycleRecorder(out, "ok")},
+			{Name: "fail", Tasks: []Task{{Type: Shell, Shell: "sh", Cmd: "exit 1"}}},
+		},
+		Repositories: []Repo{{Name: "api", Commands: []Command{{Name: "test", Tasks: lifecycleRecorder(out, "test")}}}},
+		Hooks: LifecycleHooks{
+			PreCommand:  lifecycleRecorder(out, "$RAID_HOOK_EVENT $RAID_HOOK_COMMAND [$RAID_HOOK_REPO]"),
+			PostCommand: lifecycleRecorder(out, "$RAID_HOOK_EVENT $RAID_HOOK_COMMAND $RAID_HOOK_STATUS [$RAID_HOOK_ERROR_CODE]"),
+		},
+	}})
+
+	if err := ExecuteCommand("ok", nil, nil); err != nil {
+		t.Fatalf("ExecuteCommand(ok) error: %v", err)
+	}
+	if err := ExecuteRepoCommand("api", "test", nil, nil); err != nil {
+		t.Fatalf("ExecuteRepoCommand(api, test) error: %v", err)
+	}
+	err := ExecuteCommand("fail", nil, nil)
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeTaskShellFailed {
+		t.Fatalf("ExecuteCommand(fail) error = %v, want the command's own TASK_SHELL_FAILED", err)
+	}
+
+	want := "preCommand ok []\nok\npostCommand ok success []\n" +
+		"preCommand test [api]\ntest\npostCommand test success []\n" +
+		"preCommand fail []\npostCommand fail failure [TASK_SHELL_FAILED]\n"
+	if got, _ := os.ReadFile(out); string(got) != want {
+		t.Errorf("output =\n%s\nwant\n%s", got, want)
+	}
+	if _, ok := os.LookupEnv("RAID_HOOK_EVENT"); ok {
+		t.Error("RAID_HOOK_EVENT still set after the hooks ran")
+	}
+}
+
+// envProbe records the process's RAID_HOOK_EVENT each time it's written
+// to, alongside what was written.
+type envProbe struct{ lines []string }
+
+func (p *envProbe) Write(b []byte) (int, error) {
+	p.lines = append(p.lines, string(b)+"env="+os.Getenv("RAID_HOOK_EVENT"))
+	return len(b), nil
+}
+
+func TestLifecycleHooks_varsStayOutOfProcessEnv(t *testing.T) {
+	// A concurrent clone's git inherits the process environment, so a
+	// hook's vars must reach only its own tasks.
+	setupTestConfig(t)
+	probe := &envProbe{}
+	origOut := commandStdout
+	commandStdout = probe
+	t.Cleanup(func() { commandStdout = origOut })
+	storeContext(&Context{Profile: Profile{Hooks: LifecycleHooks{
+		PostClone: []Task{{Type: Print, Message: "$RAID_HOOK_EVENT $RAID_HOOK_REPO"}},
+	}}})
+
+	if err := runLifecycleHook(hookPostClone, map[string]string{"REPO": "api"}); err != nil {
+		t.Fatalf("runLifecycleHook() error: %v", err)
+	}
+	if len(probe.lines) != 1 || probe.lines[0] != "postClone api\nenv=" {
+		t.Errorf("hook output = %q, want the vars expanded but not in the process env", probe.lines)
+	}
+}
+
+func TestLifecycleHooks_preHookFailureAborts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	setupTestConfig(t)
+	origOut := commandStdout
+	commandStdout = io.Discard
+	t.Cleanup(func() { commandStdout = origOut })
+
+	out := filepath.Join(t.TempDir(), "out.txt")
+	storeContext(&Context{Profile: Profile{
+		Name:         "test",
+		Path:         "/test",
+		Commands:     []Command{{Name: "ok", Tasks: lifecycleRecorder(out, "command")}},
+		Environments: []Env{{Name: "dev", Tasks: lifecycleRecorder(out, "env")}},
+		Hooks: LifecycleHooks{
+			PreCommand:  []Task{{Type: Shell, Shell: "sh", Cmd: "exit 1"}},
+			PreEnv:      []Task{{Type: Shell, Shell: "sh", Cmd: "exit 1"}},
+			PostCommand: lifecycleRecorder(out, "postCommand"),
+			PostEnv:     lifecycleRecorder(out, "postEnv"),
+		},
+	}})
+	t.Cleanup(func() { storeContext(nil) })
+
+	if err := ExecuteCommand("ok", nil, nil); err == nil {
+		t.Error("ExecuteCommand() with a failing preCommand hook returned nil")
+	}
+	if err := ExecuteEnv("dev"); err == nil {
+		t.Error("ExecuteEnv() with a failing preEnv hook returned nil")
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		got, _ := os.ReadFile(out)
+		t.Errorf("output = %q, want nothing to run after a failed pre hook", got)
+	}
+}
+
+func TestLifecycleHooks_env(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	setupTestConfig(t)
+	origOut := commandStdout
+	commandStdout = io.Discard
+	t.Cleanup(func() { commandStdout = origOut })
+
+	out := filepath.Join(t.TempDir(), "out.txt")
+	storeContext(&Context{Profile: Profile{
+		Name:         "test",
+		Path:         "/test",
+		Environments: []Env{{Name: "dev", Tasks: lifecycleRecorder(out, "env")}},
+		Hooks: LifecycleHooks{
+			PreEnv:  lifecycleRecorder(out, "$RAID_HOOK_EVENT $RAID_HOOK_ENV"),
+			PostEnv: lifecycleRecorder(out, "$RAID_HOOK_EVENT $RAID_HOOK_ENV $RAID_HOOK_STATUS"),
+		},
+	}})
+	t.Cleanup(func() { storeContext(nil) })
+
+	if err := ExecuteEnv("dev"); err != nil {
+		t.Fatalf("ExecuteEnv() error: %v", err)
+	}
+	want := "preEnv dev\nenv\npostEnv dev success\n"
+	if got, _ := os.ReadFile(out); string(got) != want {
+		t.Errorf("output =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLifecycleHooks_install(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	if !isGitInstalled() {
+		t.Skip("git not installed")
+	}
+	setupTestConfig(t)
+	origOut := commandStdout
+	commandStdout = io.Discard
+	t.Cleanup(func() { commandStdout = origOut })
+
+	srcDir := t.TempDir()
+	if err := exec.Command("git", "init", "--bare", srcDir).Run(); err != nil {
+		t.Skipf("git init --bare failed: %v", err)
+	}
+	dest := filepath.Join(t.TempDir(), "clone")
+	out := filepath.Join(t.TempDir(), "out.txt")
+	storeContext(&Context{Profile: Profile{
+		Name:         "test",
+		Path:         "/test",
+		Repositories: []Repo{{Name: "api", Path: dest, URL: "file://" + srcDir}},
+		Hooks: LifecycleHooks{
+			PreInstall:  lifecycleRecorder(out, "$RAID_HOOK_EVENT"),
+			PostClone:   lifecycleRecorder(out, "$RAID_HOOK_EVENT $RAID_HOOK_REPO $RAID_HOOK_PATH $RAID_HOOK_STATUS"),
+			PostInstall: lifecycleRecorder(out, "$RAID_HOOK_EVENT $RAID_HOOK_STATUS"),
+		},
+	}})
+	t.Cleanup(func() { storeContext(nil) })
+
+	if err := Install(0); err != nil {
+		t.Fatalf("Install() error: %v", err)
+	}
+	// The repo is already cloned the second time, so postClone is skipped.
+	if err := InstallRepo("api"); err != nil {
+		t.Fatalf("InstallRepo() error: %v", err)
+	}
+	want := "preInstall\npostClone api " + dest + " success\npostInstall success\n" +
+		"preInstall\npostInstall success\n"
+	if got, _ := os.ReadFile(out); string(got) != want {
+		t.Errorf("output =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
 	sys "github.com/8bitalex/raid/src/internal/sys"
@@ -115,3 +118,185 @@ func WithMutationLock(fn func() error) error {
 	defer release()
 	return fn()
 }
+
+// commandLocksDirName is the directory under ~/.raid holding the named
+// locks of `exclusive:` and `lock:` commands.
+const commandLocksDirName = "locks"
+
+// CommandLocksEnvVar lists, comma-separated, the command locks held by the
+// raid process that spawned this one. It's the command-lock counterpart
+// of MutationLockEnvVar: a nested `raid migrate` run from a Shell task of
+// an exclusive `migrate` runs under its parent's lock instead of failing
+// or waiting on it forever.
+const CommandLocksEnvVar = "RAID_COMMAND_LOCKS_HELD"
+
+// CommandLockDirOverride redirects the command locks directory. Tests set
+// this; empty in production.
+var CommandLockDirOverride string
+
+func commandLockDir() string {
+	if CommandLockDirOverride != "" {
+		return CommandLockDirOverride
+	}
+	return filepath.Join(sys.GetHomeDir(), ConfigDirName, commandLocksDirName)
+}
+
+// commandLockName returns the name of the lock cmd runs under: its
+// `lock:`, or for an `exclusive:` command its label, "name" or
+// "repo:name". Empty when cmd doesn't lock.
+func commandLockName(cmd Command, label string) string {
+	if cmd.Lock != "" {
+		return cmd.Lock
+	}
+	if cmd.Exclusive {
+		return label
+	}
+	return ""
+}
+
+// commandLockFile maps a lock name onto a file name, replacing anything
+// but letters, digits, dots, dashes and underscores.
+func commandLockFile(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name) + ".lock"
+}
+
+// commandLocksEnv returns the CommandLocksEnvVar entry that passes the
+// locks held by a task's chain of commands, and those this process
+// inherited, on to its subprocesses. Nil when there are none.
+func commandLocksEnv(task Task) []string {
+	names := inheritedCommandLocks()
+	for _, name := range task.commandLocks {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	slices.Sort(names)
+	return []string{CommandLocksEnvVar + "=" + strings.Join(names, ",")}
+}
+
+func inheritedCommandLocks() []string {
+	var names []string
+	for _, name := range strings.Split(os.Getenv(CommandLocksEnvVar), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// acquireCommandLock takes cmd's named lock, if it has one, and returns a
+// release function along with the locks held from then on. held is what
+// the chain of commands that led here already holds, passed down through
+// their Run tasks; a lock in it, or one a parent raid process holds, is
+// re-entered without touching the file. Any other holder, including
+// another run in this process such as a concurrent MCP call, makes it fail
+// with COMMAND_LOCKED naming the holder, or with `lockWait:` block until
+// the lock is free.
+func acquireCommandLock(cmd Command, label string, held []string) (func(), []string, error) {
+	name := commandLockName(cmd, label)
+	if name == "" || slices.Contains(held, name) || slices.Contains(inheritedCommandLocks(), name) {
+		return func() {}, held, nil
+	}
+
+	dir := commandLockDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, liberrs.LockFailed(fmt.Errorf("create command locks dir: %w", err))
+	}
+	path := filepath.Join(dir, commandLockFile(name))
+	lk := flock.New(path)
+	locked, err := lk.TryLock()
+	if err != nil {
+		return nil, nil, liberrs.LockFailed(err)
+	}
+	if !locked {
+		holder := commandLockHolder(path)
+		if !cmd.LockWait {
+			return nil, nil, liberrs.CommandLocked(name, holder)
+		}
+		if holder == "" {
+			holder = "another run"
+		}
+		fmt.Fprintf(commandStderr, "raid: waiting for lock '%s', held by %s\n", name, holder)
+		if err := lk.Lock(); err != nil {
+			return nil, nil, liberrs.LockFailed(err)
+		}
+	}
+	// Advisory, like the mutation lock's PID stamp: read back by
+	// commandLockHolder for the error a contending run reports.
+	_ = os.WriteFile(path, []byte(fmt.Sprintf("%d\n%s\n%s\n", os.Getpid(), time.Now().Format(time.RFC3339), label)), 0644)
+	return func() { _ = lk.Unlock() }, append(slices.Clone(held), name), nil
+}
+
+// commandLockHolder describes the run holding the lock at path from what
+// it stamped there, e.g. "PID 4242 (migrate) since 2026-01-02 15:04:05".
+// Empty when the file can't be read.
+func commandLockHolder(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	fields := strings.Split(strings.TrimSpace(string(data)), "\n")
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return ""
+	}
+	holder := fmt.Sprintf("PID %d", pid)
+	if len(fields) > 2 && fields[2] != "" {
+		holder += fmt.Sprintf(" (%s)", fields[2])
+	}
+	if len(fields) > 1 {
+		if started, err := time.Parse(time.RFC3339, fields[1]); err == nil {
+			holder += " since " + started.Local().Format(time.DateTime)
+		}
+	}
+	return holder
+}
+
+// CheckCommandLock fails with COMMAND_LOCKED when another run holds the
+// lock of the profile command at path, or of repo's command when repo is
+// set, and the command doesn't set `lockWait:`. It takes nothing — the
+// command takes its lock when it runs — but lets the CLI and MCP server
+// fail fast before they queue on the mutation lock behind the run that
+// holds it. Commands that can't be found pass; running them reports that.
+func CheckCommandLock(repo, path string) error {
+	var cmd Command
+	var err error
+	if repo != "" {
+		cmd, err = findRepoCommand(repo, path)
+	} else {
+		cmd, err = findCommand(path)
+	}
+	if err != nil {
+		return nil
+	}
+	label := cmd.Name
+	if repo != "" {
+		label = repo + ":" + cmd.Name
+	}
+	name := commandLockName(cmd, label)
+	if name == "" || cmd.LockWait || slices.Contains(inheritedCommandLocks(), name) {
+		return nil
+	}
+	lockFile := filepath.Join(commandLockDir(), commandLockFile(name))
+	if !sys.FileExists(lockFile) {
+		return nil
+	}
+	lk := flock.New(lockFile)
+	locked, err := lk.TryLock()
+	if err != nil {
+		return liberrs.LockFailed(err)
+	}
+	if !locked {
+		return liberrs.CommandLocked(name, commandLockHolder(lockFile))
+	}
+	return lk.Unlock()
+}
@@ -2,13 +2,18 @@ package lib
 
 import (
 	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/gofrs/flock"
+
 	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
 )
 
@@ -204,3 +209,215 @@ func TestMutationLockInherited_truthyValues(t *testing.T) {
 		}
 	}
 }
+
+func setupCommandLockDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	old := CommandLockDirOverride
+	t.Cleanup(func() { CommandLockDirOverride = old })
+	CommandLockDirOverride = dir
+	t.Setenv(CommandLocksEnvVar, "")
+	return dir
+}
+
+// holdCommandLock takes the lock file for name through a handle of its
+// own, as another raid process would, stamped with a foreign PID.
+func holdCommandLock(t *testing.T, dir, name string) *flock.Flock {
+	t.Helper()
+	path := filepath.Join(dir, commandLockFile(name))
+	lk := flock.New(path)
+	if ok, err := lk.TryLock(); err != nil || !ok {
+		t.Fatalf("TryLock(%s) = %v, %v", path, ok, err)
+	}
+	t.Cleanup(func() { _ = lk.Unlock() })
+	if err := os.WriteFile(path, []byte("4242\n2026-01-02T15:04:05Z\nmigrate\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return lk
+}
+
+func TestCommandLockName(t *testing.T) {
+	tests := []struct {
+		cmd  Command
+		want string
+	}{
+		{Command{}, ""},
+		{Command{Exclusive: true}, "api:migrate"},
+		{Command{Lock: "db"}, "db"},
+		{Command{Exclusive: true, Lock: "db"}, "db"},
+	}
+	for _, tt := range tests {
+		if got := commandLockName(tt.cmd, "api:migrate"); got != tt.want {
+			t.Errorf("commandLockName(%+v) = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+	if got := commandLockFile("api:db migrate"); got != "api_db_migrate.lock" {
+		t.Errorf("commandLockFile() = %q, want api_db_migrate.lock", got)
+	}
+}
+
+func TestAcquireCommandLock_failsFast(t *testing.T) {
+	dir := setupCommandLockDir(t)
+	holdCommandLock(t, dir, "migrate")
+
+	_, _, err := acquireCommandLock(Command{Exclusive: true}, "migrate", nil)
+	rErr, ok := liberrs.AsError(err)
+	if !ok || rErr.Code() != liberrs.CodeCommandLocked {
+		t.Fatalf("acquireCommandLock() error = %v, want COMMAND_LOCKED", err)
+	}
+	if !strings.Contains(err.Error(), "PID 4242 (migrate) since 2026-01-02") {
+		t.Errorf("error = %q, want the holder's PID and start time", err)
+	}
+
+	// A command without a lock isn't affected.
+	release, _, err := acquireCommandLock(Command{}, "migrate", nil)
+	if err != nil {
+		t.Fatalf("acquireCommandLock() without a lock error: %v", err)
+	}
+	release()
+}
+
+func TestAcquireCommandLock_wait(t *testing.T) {
+	dir := setupCommandLockDir(t)
+	origErr := commandStderr
+	commandStderr = io.Discard
+	t.Cleanup(func() { commandStderr = origErr })
+	holder := holdCommandLock(t, dir, "db")
+
+	acquired := make(chan func())
+	go func() {
+		release, _, err := acquireCommandLock(Command{Lock: "db", LockWait: true}, "seed", nil)
+		if err != nil {
+			t.Errorf("acquireCommandLock() with lockWait error: %v", err)
+			release = func() {}
+		}
+		acquired <- release
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquireCommandLock() with lockWait returned while the lock was held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	_ = holder.Unlock()
+	select {
+	case release := <-acquired:
+		release()
+	case <-time.After(5 * time.Second):
+		t.Fatal("acquireCommandLock() with lockWait still blocked after the lock was released")
+	}
+}
+
+func TestAcquireCommandLock_reentry(t *testing.T) {
+	dir := setupCommandLockDir(t)
+	cmd := Command{Exclusive: true}
+
+	release, held, err := acquireCommandLock(cmd, "migrate", nil)
+	if err != nil {
+		t.Fatalf("acquireCommandLock() error: %v", err)
+	}
+	if len(held) != 1 || held[0] != "migrate" {
+		t.Errorf("held = %v, want [migrate]", held)
+	}
+	inner, _, err := acquireCommandLock(cmd, "migrate", held)
+	if err != nil {
+		t.Fatalf("nested acquireCommandLock() error: %v", err)
+	}
+	if env := commandLocksEnv(Task{commandLocks: held}); !slices.Equal(env, []string{CommandLocksEnvVar + "=migrate"}) {
+		t.Errorf("commandLocksEnv() = %v, want the held lock passed on", env)
+	}
+	inner()
+	// The outer run still holds the file lock.
+	if ok, _ := flock.New(filepath.Join(dir, commandLockFile("migrate"))).TryLock(); ok {
+		t.Error("lock file free after only the nested run released it")
+	}
+	release()
+}
+
+func TestAcquireCommandLock_concurrentRunsContend(t *testing.T) {
+	// Two runs in one process, as concurrent MCP calls are, don't share a
+	// lock: only a Run task's own chain re-enters it.
+	setupCommandLockDir(t)
+	cmd := Command{Exclusive: true}
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	done := make(chan struct{})
+	errs := make(chan error, 2)
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			release, _, err := acquireCommandLock(cmd, "migrate", nil)
+			errs <- err
+			if err == nil {
+				<-done
+				release()
+			}
+		}()
+	}
+	close(start)
+	first, second := <-errs, <-errs
+	close(done)
+	wg.Wait()
+	if (first == nil) == (second == nil) {
+		t.Fatalf("errors = %v, %v; want exactly one run to get the lock", first, second)
+	}
+	err := first
+	if err == nil {
+		err = second
+	}
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeCommandLocked {
+		t.Errorf("error = %v, want COMMAND_LOCKED", err)
+	}
+}
+
+func TestExecuteCommand_runReentersSharedLock(t *testing.T) {
+	setupTestConfig(t)
+	setupCommandLockDir(t)
+	storeContext(&Context{Profile: Profile{Commands: []Command{
+		{Name: "reset", Lock: "db", Tasks: []Task{{Type: Run, Command: "seed"}}},
+		{Name: "seed", Lock: "db", Tasks: []Task{{Type: Shell, Cmd: "true"}}},
+	}}})
+
+	if err := ExecuteCommand("reset", nil, nil); err != nil {
+		t.Errorf("ExecuteCommand() error: %v, want seed to run under reset's lock", err)
+	}
+}
+
+func TestCheckCommandLock(t *testing.T) {
+	setupTestConfig(t)
+	dir := setupCommandLockDir(t)
+	storeContext(&Context{Profile: Profile{Commands: []Command{
+		{Name: "migrate", Exclusive: true},
+		{Name: "seed", Lock: "migrate", LockWait: true},
+	}}})
+
+	if err := CheckCommandLock("", "migrate"); err != nil {
+		t.Errorf("CheckCommandLock() with no lock file error: %v", err)
+	}
+	holder := holdCommandLock(t, dir, "migrate")
+	err := CheckCommandLock("", "migrate")
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeCommandLocked {
+		t.Errorf("CheckCommandLock() error = %v, want COMMAND_LOCKED", err)
+	}
+	if err := CheckCommandLock("", "seed"); err != nil {
+		t.Errorf("CheckCommandLock() of a lockWait command error: %v", err)
+	}
+	_ = holder.Unlock()
+	if err := CheckCommandLock("", "migrate"); err != nil {
+		t.Errorf("CheckCommandLock() after release error: %v", err)
+	}
+}
+
+func TestAcquireCommandLock_inherited(t *testing.T) {
+	dir := setupCommandLockDir(t)
+	holdCommandLock(t, dir, "migrate")
+	t.Setenv(CommandLocksEnvVar, "seed,migrate")
+
+	release, _, err := acquireCommandLock(Command{Exclusive: true}, "migrate", nil)
+	if err != nil {
+		t.Fatalf("acquireCommandLock() of an inherited lock error: %v", err)
+	}
+	release()
+}
@@ -33,6 +33,10 @@ type Profile struct {
 	Groups       map[string][]Task `json:"task_groups" yaml:"task_groups"`
 	Commands     []Command         `json:"commands"`
 	Verify       []Verify          `json:"verify,omitempty"`
+	Requires     []Requirement     `json:"requires,omitempty"`
+	Redact       []string          `json:"redact,omitempty"`
+	Hooks        LifecycleHooks    `json:"hooks,omitempty"`
+	AgentPolicy  *AgentPolicy      `json:"agentPolicy,omitempty" yaml:"agentPolicy,omitempty"`
 }
 
 // IsZero reports whether the profile is uninitialized.
@@ -0,0 +1,223 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+)
+
+// Prompt value types accepted by `valueType:`. Empty means free text.
+const (
+	promptTypeInt  = "int"
+	promptTypeBool = "bool"
+)
+
+// promptSpec is a Prompt task's validation rules, resolved once before the
+// first read so a choicesCmd runs once and a bad pattern fails before the
+// user types anything.
+type promptSpec struct {
+	choices   []string
+	pattern   *regexp.Regexp
+	rawPat    string
+	multi     bool
+	valueType string
+	secret    bool
+}
+
+// newPromptSpec resolves choices (running choicesCmd if set) and compiles
+// the pattern. Errors here are config problems, not bad answers.
+func newPromptSpec(task Task) (promptSpec, error) {
+	spec := promptSpec{multi: task.Multi, valueType: strings.ToLower(task.ValueType), secret: task.Secret}
+	switch spec.valueType {
+	case "", promptTypeInt, promptTypeBool:
+	default:
+		return spec, liberrs.ArgInvalid(fmt.Sprintf("Prompt %s: unknown valueType %q (want int or bool)", task.Var, task.ValueType))
+	}
+	if task.Pattern != "" {
+		re, err := regexp.Compile("^(?:" + task.Pattern + ")$")
+		if err != nil {
+			return spec, liberrs.ArgInvalid(fmt.Sprintf("Prompt %s: invalid pattern %q: %v", task.Var, task.Pattern, err))
+		}
+		spec.pattern, spec.rawPat = re, task.Pattern
+	}
+	spec.choices = task.Choices
+	if task.ChoicesCmd != "" {
+		choices, err := runChoicesCmd(task)
+		if err != nil {
+			return spec, err
+		}
+		spec.choices = choices
+	}
+	return spec, nil
+}
+
+// runChoicesCmd runs a Prompt's choicesCmd and returns one option per
+// non-blank stdout line.
+func runChoicesCmd(task Task) ([]string, error) {
+	shell := getShell(task.Shell)
+	cmd := exec.Command(shell[0], append(shell[1:], task.ChoicesCmd)...)
+	cmd.Env = append(buildSubprocessEnv(), commandLocksEnv(task)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "choicesCmd for %s failed: %v", task.Var, err)
+	}
+	var choices []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			choices = append(choices, line)
+		}
+	}
+	if len(choices) == 0 {
+		return nil, liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "choicesCmd for %s printed no choices", task.Var)
+	}
+	return choices, nil
+}
+
+// menu renders the numbered choice list shown under the banner.
+func (s promptSpec) menu() string {
+	var b strings.Builder
+	for i, c := range s.choices {
+		fmt.Fprintf(&b, "  %d) %s\n", i+1, c)
+	}
+	return b.String()
+}
+
+// ask is the short line the user types after, repeated on a re-prompt.
+func (s promptSpec) ask() string {
+	if s.multi {
+		return "Choose one or more, comma-separated:"
+	}
+	return fmt.Sprintf("Choose [1-%d]:", len(s.choices))
+}
+
+// parse turns raw input into the value to store, or explains why the
+// input isn't acceptable. A multi prompt checks each comma-separated item
+// and stores them comma-joined. With no rules set, input is returned as is.
+func (s promptSpec) parse(input string) (string, error) {
+	items := []string{strings.TrimSpace(input)}
+	if s.multi {
+		items = items[:0]
+		for _, p := range strings.Split(input, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				items = append(items, p)
+			}
+		}
+		if len(items) == 0 {
+			return "", fmt.Errorf("choose at least one")
+		}
+	} else if len(s.choices) == 0 && s.pattern == nil && s.valueType == "" {
+		return input, nil
+	}
+
+	seen := make(map[string]bool, len(items))
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		v, err := s.parseItem(item)
+		if err != nil {
+			return "", err
+		}
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return strings.Join(out, ","), nil
+}
+
+func (s promptSpec) parseItem(item string) (string, error) {
+	if len(s.choices) > 0 {
+		c, ok := s.matchChoice(item)
+		if !ok {
+			return "", fmt.Errorf("%s is not one of: %s", s.show(item), strings.Join(s.choices, ", "))
+		}
+		item = c
+	}
+	switch s.valueType {
+	case promptTypeInt:
+		if _, err := strconv.Atoi(item); err != nil {
+			return "", fmt.Errorf("%s is not a whole number", s.show(item))
+		}
+	case promptTypeBool:
+		b, ok := parsePromptBool(item)
+		if !ok {
+			return "", fmt.Errorf("%s is not yes or no", s.show(item))
+		}
+		item = strconv.FormatBool(b)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(item) {
+		return "", fmt.Errorf("%s does not match pattern %q", s.show(item), s.rawPat)
+	}
+	return item, nil
+}
+
+// show quotes an answer for an error message, masking secret input.
+func (s promptSpec) show(item string) string {
+	if s.secret {
+		return maskedValue
+	}
+	return strconv.Quote(item)
+}
+
+// matchChoice accepts a choice by its menu number, its exact text, or its
+// text ignoring case, in that order. Typing "2" therefore always picks the
+// second entry, even when another choice is literally named "2".
+func (s promptSpec) matchChoice(item string) (string, bool) {
+	if n, err := strconv.Atoi(item); err == nil && n >= 1 && n <= len(s.choices) {
+		return s.choices[n-1], true
+	}
+	for _, c := range s.choices {
+		if c == item {
+			return c, true
+		}
+	}
+	for _, c := range s.choices {
+		if strings.EqualFold(c, item) {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+func parsePromptBool(s string) (bool, bool) {
+	switch strings.ToLower(s) {
+	case "y", "yes", "true", "1", "on":
+		return true, true
+	case "n", "no", "false", "0", "off":
+		return false, true
+	}
+	return false, false
+}
+
+// readPromptInput reads one line of Prompt input. A secret prompt on an
+// interactive terminal reads with echo disabled so the value never appears
+// on screen; piped input is read as a plain line either way. Callers must
+// hold stdinMu.
+func readPromptInput(secret bool) (string, error) {
+	if secret && isTerminalSink(os.Stdin) {
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		// The user's Enter wasn't echoed; end the banner line ourselves.
+		lockedFprint(commandStderr, "\n")
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	value, err := getStdinReader().ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(value, "\r\n"), nil
+}
@@ -0,0 +1,165 @@
+package lib
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+	"gopkg.in/yaml.v3"
+)
+
+// withStdin replaces os.Stdin with a pipe pre-filled with input.
+func withStdin(t *testing.T, input string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString(input)
+	w.Close()
+	orig := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() { os.Stdin = orig })
+}
+
+func TestTask_promptFieldsFromYAML(t *testing.T) {
+	var task Task
+	src := "type: Prompt\nvar: SVC\nchoicesCmd: ls\nvalueType: int\nmulti: true\n"
+	if err := yaml.Unmarshal([]byte(src), &task); err != nil {
+		t.Fatal(err)
+	}
+	if task.ChoicesCmd != "ls" || task.ValueType != "int" || !task.Multi {
+		t.Errorf("Task = %+v, want choicesCmd, valueType and multi decoded", task)
+	}
+}
+
+func TestPromptSpec_parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    promptSpec
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"free text untouched", promptSpec{}, " as is ", " as is ", false},
+		{"choice by number", promptSpec{choices: []string{"api", "web"}}, "2", "web", false},
+		{"choice by name", promptSpec{choices: []string{"api", "web"}}, "api", "api", false},
+		{"choice ignoring case", promptSpec{choices: []string{"api", "web"}}, "WEB", "web", false},
+		{"not a choice", promptSpec{choices: []string{"api", "web"}}, "apu", "", true},
+		{"number out of range", promptSpec{choices: []string{"api", "web"}}, "3", "", true},
+		{"multi joins", promptSpec{choices: []string{"api", "web", "db"}, multi: true}, "3, api,3", "db,api", false},
+		{"multi empty", promptSpec{choices: []string{"api"}, multi: true}, " , ", "", true},
+		{"multi bad item", promptSpec{choices: []string{"api"}, multi: true}, "api,web", "", true},
+		{"int", promptSpec{valueType: promptTypeInt}, "42", "42", false},
+		{"int rejects text", promptSpec{valueType: promptTypeInt}, "forty", "", true},
+		{"bool normalizes", promptSpec{valueType: promptTypeBool}, "Yes", "true", false},
+		{"bool rejects", promptSpec{valueType: promptTypeBool}, "maybe", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.spec.parse(tt.input)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("parse(%q) = %q, %v; want %q, err=%v", tt.input, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewPromptSpec_patternMatchesWholeValue(t *testing.T) {
+	spec, err := newPromptSpec(Task{Var: "V", Pattern: `v[0-9]+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := spec.parse("v12"); err != nil {
+		t.Errorf("parse(v12) error: %v", err)
+	}
+	if _, err := spec.parse("xv12"); err == nil {
+		t.Error("parse(xv12) passed; pattern must match the whole value")
+	}
+}
+
+func TestNewPromptSpec_configErrors(t *testing.T) {
+	for _, task := range []Task{
+		{Var: "V", Pattern: `(`},
+		{Var: "V", ValueType: "float"},
+	} {
+		if _, err := newPromptSpec(task); err == nil {
+			t.Errorf("newPromptSpec(%+v) = nil error, want a config error", task)
+		}
+	}
+}
+
+func TestNewPromptSpec_choicesCmd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell")
+	}
+	spec, err := newPromptSpec(Task{Var: "V", ChoicesCmd: "printf 'api\\n\\n  web \\n'"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(spec.choices, "|") != "api|web" {
+		t.Errorf("choices = %q, want [api web]", spec.choices)
+	}
+	if _, err := newPromptSpec(Task{Var: "V", ChoicesCmd: "true"}); err == nil {
+		t.Error("choicesCmd with no output should fail")
+	}
+	if _, err := newPromptSpec(Task{Var: "V", ChoicesCmd: "exit 3"}); err == nil {
+		t.Error("failing choicesCmd should fail")
+	}
+}
+
+func TestExecuteTask_promptChoicesReprompts(t *testing.T) {
+	os.Unsetenv("RAID_PROMPT_SERVICE")
+	t.Cleanup(func() { os.Unsetenv("RAID_PROMPT_SERVICE") })
+	stderr := withCapturedStderr(t)
+	withStdin(t, "apu\n2\n")
+
+	task := Task{Type: Prompt, Var: "RAID_PROMPT_SERVICE", Message: "Which service?", Choices: []string{"api", "web"}}
+	if err := ExecuteTask(task); err != nil {
+		t.Fatalf("ExecuteTask() error: %v", err)
+	}
+	if got := os.Getenv("RAID_PROMPT_SERVICE"); got != "web" {
+		t.Errorf("RAID_PROMPT_SERVICE = %q, want web", got)
+	}
+	out := stderr.String()
+	if !strings.Contains(out, "1) api") || !strings.Contains(out, `"apu" is not one of`) {
+		t.Errorf("stderr = %q, want the menu and a re-prompt reason", out)
+	}
+}
+
+func TestExecuteTask_promptSecretValidationMasksInput(t *testing.T) {
+	setupVarsFile(t)
+	stderr := withCapturedStderr(t)
+	withStdin(t, "hunter2\n1234\n")
+
+	task := Task{Type: Prompt, Var: "RAID_PROMPT_PIN", Secret: true, ValueType: "int"}
+	if err := ExecuteTask(task); err != nil {
+		t.Fatalf("ExecuteTask() error: %v", err)
+	}
+	if strings.Contains(stderr.String(), "hunter2") {
+		t.Errorf("stderr = %q, echoed the secret answer", stderr.String())
+	}
+}
+
+func TestExecuteTask_promptHeadlessValidatesDefault(t *testing.T) {
+	defer SetHeadlessForTest(true)()
+	os.Unsetenv("RAID_PROMPT_ENV")
+	t.Cleanup(func() { os.Unsetenv("RAID_PROMPT_ENV") })
+
+	task := Task{Type: Prompt, Var: "RAID_PROMPT_ENV", Default: "prod", Choices: []string{"dev", "staging"}}
+	err := ExecuteTask(task)
+	rErr, ok := liberrs.AsError(err)
+	if !ok || rErr.Code() != liberrs.CodeArgInvalid {
+		t.Fatalf("ExecuteTask() error = %v, want ARG_INVALID for a default outside choices", err)
+	}
+
+	task.Default = "Staging"
+	if err := ExecuteTask(task); err != nil {
+		t.Fatalf("ExecuteTask() error: %v", err)
+	}
+	if got := os.Getenv("RAID_PROMPT_ENV"); got != "staging" {
+		t.Errorf("RAID_PROMPT_ENV = %q, want the canonical choice", got)
+	}
+}
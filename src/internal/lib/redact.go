@@ -0,0 +1,285 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRedactPatterns catch well-known credential formats even when
+// nobody marked the variable holding them secret. Profiles and repos add
+// their own through `redact:`.
+var defaultRedactPatterns = []string{
+	`\b(?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36,}\b`, // GitHub tokens
+	`\bgithub_pat_[A-Za-z0-9_]{22,}\b`,             // GitHub fine-grained tokens
+	`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,                // AWS access key IDs
+	`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`,            // Slack tokens
+}
+
+// minRedactLen is the shortest secret value masked verbatim. Masking a
+// one- or two-character value would mangle unrelated output everywhere.
+const minRedactLen = 4
+
+// redactor masks secret values and credential-shaped strings in text.
+// Built from a point-in-time snapshot, so a Set task's new secret is
+// picked up by the next task, not by one already running.
+type redactor struct {
+	values   *strings.Replacer
+	patterns []*regexp.Regexp
+	// targeted is set when there are secret values or `redact:` patterns,
+	// not just the built-in ones. Only then is output to a terminal worth
+	// piping through a redactingWriter; see setCmdOutput.
+	targeted bool
+}
+
+// redactSpec is what a redactor is built from. It's kept apart from the
+// redactor so a service supervisor, which has no profile loaded, can be
+// handed the spec of the run that started it.
+type redactSpec struct {
+	Values   []string `json:"values,omitempty"`
+	Builtin  []string `json:"builtin,omitempty"`
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+// newRedactor snapshots what's currently secret: every encrypted raid var
+// (decrypted here so its plaintext can be recognised), the values of
+// `secret: true` variables in the active environment, and — once a profile
+// is loaded — the built-in patterns plus `redact:` patterns from the
+// profile and its repos. Returns nil when there's nothing to mask, so
+// with no profile and no secrets output passes through untouched.
+func newRedactor() *redactor {
+	return currentRedactSpec().redactor()
+}
+
+// currentRedactSpec collects what newRedactor masks.
+func currentRedactSpec() redactSpec {
+	var values []string
+	raidVarsMu.RLock()
+	for _, v := range raidVars {
+		// Undecryptable values are already reported where they'd be
+		// used; there's no plaintext to look for here.
+		if isSecretValue(v) {
+			if plain, err := decryptSecret(v); err == nil {
+				values = append(values, plain)
+			}
+		}
+	}
+	raidVarsMu.RUnlock()
+
+	var builtin, patterns []string
+	if ctx := loadContext(); ctx != nil {
+		values = append(values, secretEnvValues(ctx)...)
+		if !ctx.Profile.IsZero() {
+			builtin = defaultRedactPatterns
+		}
+		patterns = append(patterns, ctx.Profile.Redact...)
+		for _, repo := range ctx.Profile.Repositories {
+			patterns = append(patterns, repo.Redact...)
+		}
+	}
+	return redactSpec{Values: values, Builtin: builtin, Patterns: patterns}
+}
+
+// redactor builds the redactor s describes, or nil if it masks nothing.
+func (s redactSpec) redactor() *redactor {
+	values := slices.Clone(s.Values)
+	r := &redactor{}
+	for i, p := range slices.Concat(s.Builtin, s.Patterns) {
+		// Invalid patterns are reported by validateRedactPatterns at load
+		// time; skipping them here keeps output flowing.
+		if re, err := regexp.Compile(p); err == nil {
+			r.patterns = append(r.patterns, re)
+			r.targeted = r.targeted || i >= len(s.Builtin)
+		}
+	}
+
+	// Longest first so a secret that contains another secret is masked
+	// whole instead of leaving its tail visible.
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	var pairs []string
+	seen := make(map[string]bool)
+	for _, v := range values {
+		if len(v) < minRedactLen || seen[v] {
+			continue
+		}
+		seen[v] = true
+		pairs = append(pairs, v, maskedValue)
+	}
+	if len(pairs) > 0 {
+		r.values = strings.NewReplacer(pairs...)
+		r.targeted = true
+	}
+	if r.values == nil && len(r.patterns) == 0 {
+		return nil
+	}
+	return r
+}
+
+// secretEnvValues returns the values of `secret: true` variables declared
+// for the active environment at profile and repo level.
+func secretEnvValues(ctx *Context) []string {
+	if ctx.Env == "" {
+		return nil
+	}
+	var out []string
+	collect := func(envs []Env) {
+		for _, e := range envs {
+			if e.Name != ctx.Env {
+				continue
+			}
+			for _, v := range e.Variables {
+				if v.Secret {
+					out = append(out, v.Value)
+				}
+			}
+		}
+	}
+	collect(ctx.Profile.Environments)
+	for _, repo := range ctx.Profile.Repositories {
+		collect(repo.Environments)
+	}
+	return out
+}
+
+// Redact masks every secret value and pattern match in s.
+func (r *redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	if r.values != nil {
+		s = r.values.Replace(s)
+	}
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, maskedValue)
+	}
+	return s
+}
+
+// redactString masks s against a fresh snapshot. For one-off lines such as
+// Print output; subprocess streams use a redactingWriter.
+func redactString(s string) string {
+	return newRedactor().Redact(s)
+}
+
+// validateRedactPatterns warns about `redact:` patterns that don't
+// compile. They're skipped when redacting, so a typo would otherwise
+// silently leave the credential it was meant to catch visible.
+func validateRedactPatterns(profile Profile) {
+	if suppressLoadWarnings.Load() {
+		return
+	}
+	check := func(owner string, patterns []string) {
+		for _, p := range patterns {
+			if _, err := regexp.Compile(p); err != nil {
+				fmt.Fprintf(os.Stderr, "raid: ignoring invalid redact pattern %q in %s: %v\n", p, owner, err)
+			}
+		}
+	}
+	check("profile '"+profile.Name+"'", profile.Redact)
+	for _, repo := range profile.Repositories {
+		check("repository '"+repo.Name+"'", repo.Redact)
+	}
+}
+
+// redactFlushDelay is how long a partial line (no trailing newline yet)
+// waits before being emitted anyway. Long enough that a line split across
+// pipe reads is reassembled before it's scanned; short enough that a
+// subprocess prompt such as "Password: " still shows up promptly.
+var redactFlushDelay = 100 * time.Millisecond
+
+// redactMaxLine bounds how much a redactingWriter holds while waiting for
+// a line break, so a subprocess streaming binary or one huge line can't
+// grow the buffer without limit.
+const redactMaxLine = 64 << 10
+
+// redactingWriter masks secrets in a subprocess's output stream. Matching
+// is line-by-line — bytes are held until '\n' or '\r' so a secret split
+// across two writes is still recognised — and each redacted line goes to
+// the sink in a single Write, so a prefixedWriter beneath it still sees
+// whole lines and keeps concurrent output attributable.
+type redactingWriter struct {
+	sink  io.Writer
+	r     *redactor
+	mu    sync.Mutex
+	buf   []byte
+	timer *time.Timer
+}
+
+func newRedactingWriter(sink io.Writer, r *redactor) *redactingWriter {
+	return &redactingWriter{sink: sink, r: r}
+}
+
+// Write satisfies io.Writer, always reporting len(p) on success: bytes
+// are either emitted or held for the next line.
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		j := bytes.IndexAny(w.buf, "\n\r")
+		if j < 0 {
+			break
+		}
+		if err := w.emitLocked(w.buf[:j+1]); err != nil {
+			w.buf = nil
+			return 0, err
+		}
+		w.buf = w.buf[j+1:]
+	}
+	if len(w.buf) >= redactMaxLine {
+		err := w.emitLocked(w.buf)
+		w.buf = nil
+		if err != nil {
+			return 0, err
+		}
+	}
+	if len(w.buf) == 0 {
+		w.buf = nil
+		w.stopTimerLocked()
+		return len(p), nil
+	}
+	// Copy the tail so we don't keep p's (or an old buffer's) backing
+	// array alive, then arm the partial-line flush.
+	w.buf = append([]byte(nil), w.buf...)
+	if w.timer == nil {
+		w.timer = time.AfterFunc(redactFlushDelay, func() { _ = w.Flush() })
+	} else {
+		w.timer.Reset(redactFlushDelay)
+	}
+	return len(p), nil
+}
+
+// Flush emits any held partial line. Called when the subprocess exits and
+// by the idle timer.
+func (w *redactingWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopTimerLocked()
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.emitLocked(w.buf)
+	w.buf = nil
+	return err
+}
+
+func (w *redactingWriter) emitLocked(line []byte) error {
+	_, err := io.WriteString(w.sink, w.r.Redact(string(line)))
+	return err
+}
+
+func (w *redactingWriter) stopTimerLocked() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
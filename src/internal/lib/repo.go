@@ -24,6 +24,7 @@ type Repo struct {
 	Install      OnInstall `json:"install"`
 	Commands     []Command `json:"commands"`
 	Verify       []Verify  `json:"verify,omitempty"`
+	Redact       []string  `json:"redact,omitempty"`
 }
 
 // IsZero reports whether the repo is uninitialized. URL is intentionally
@@ -76,6 +77,7 @@ func buildRepo(repo *Repo) error {
 	repo.Install.Tasks = append(repo.Install.Tasks, repoConfig.Install.Tasks...)
 	repo.Commands = append(repo.Commands, repoConfig.Commands...)
 	repo.Verify = append(repo.Verify, repoConfig.Verify...)
+	repo.Redact = append(repo.Redact, repoConfig.Redact...)
 
 	return nil
 }
@@ -111,11 +113,11 @@ func CloneRepository(repo Repo) error {
 		return liberrs.Newf(liberrs.CodeCloneFailed, liberrs.CategoryNetwork, "failed to create directory '%s': %v", path, err)
 	}
 
-	if err := clone(path, strings.TrimSpace(repo.URL), repo.Branch); err != nil {
-		return liberrs.CloneFailed(repo.Name, strings.TrimSpace(repo.URL), err)
+	err := clone(path, strings.TrimSpace(repo.URL), repo.Branch)
+	if err != nil {
+		err = liberrs.CloneFailed(repo.Name, strings.TrimSpace(repo.URL), err)
 	}
-
-	return nil
+	return runPostHook(hookPostClone, map[string]string{"REPO": repo.Name, "PATH": path, "URL": strings.TrimSpace(repo.URL)}, err)
 }
 
 func isGitRepository(path string) bool {
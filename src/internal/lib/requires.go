@@ -0,0 +1,111 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+)
+
+// Requirement declares a variable that must be set before an env or
+// command runs. Profiles, environments, and commands each carry a
+// `requires:` list; raid checks them up front so a task never expands a
+// missing variable to an empty string halfway through a run.
+type Requirement struct {
+	// Name is the variable to look up. Resolution matches task
+	// expansion: raid vars, then session vars, then the process env.
+	Name string `json:"name"`
+	// Pattern optionally constrains the value. It must match the whole
+	// value, so `[a-z]+` rejects "dev1".
+	Pattern string `json:"pattern,omitempty"`
+	// Description explains what the variable is for. Included in the
+	// error when it's missing and in the MCP commands resource.
+	Description string `json:"description,omitempty"`
+}
+
+// Unmet returns why the requirement isn't satisfied right now, or ""
+// when it is. An empty value counts as missing — that's the failure
+// mode requirements exist to catch. Values are never included in the
+// reason so a malformed secret doesn't end up in an error message.
+func (r Requirement) Unmet() string {
+	v, ok := lookupRaidVarRaw(r.Name)
+	if !ok || v == "" {
+		return "is not set"
+	}
+	if r.Pattern == "" {
+		return ""
+	}
+	// A secret is matched against its plaintext; the reason below never
+	// includes the value either way.
+	if v, ok = revealRaidVar(r.Name, v); !ok {
+		return "can't be decrypted"
+	}
+	re, err := regexp.Compile("^(?:" + r.Pattern + ")$")
+	if err != nil {
+		return fmt.Sprintf("has an invalid pattern %q: %v", r.Pattern, err)
+	}
+	if !re.MatchString(v) {
+		return fmt.Sprintf("does not match pattern %q", r.Pattern)
+	}
+	return ""
+}
+
+// checkRequirements evaluates every requirement across the given lists
+// and returns a single REQUIRED_VARS_UNMET error naming all of them, or
+// nil when each one is satisfied. scope labels what was about to run
+// ("environment 'dev'", "command 'deploy'"). Identical entries declared
+// at several levels — such as a repo env and its hoisted copy in a
+// single-repo profile — are only reported once.
+func checkRequirements(scope string, lists ...[]Requirement) error {
+	var unmet []string
+	var vars []map[string]any
+	for _, r := range mergeRequirements(lists...) {
+		reason := r.Unmet()
+		if reason == "" {
+			continue
+		}
+		line := r.Name + " " + reason
+		if r.Description != "" {
+			line += " (" + r.Description + ")"
+		}
+		unmet = append(unmet, line)
+		entry := map[string]any{"name": r.Name, "reason": reason}
+		if r.Pattern != "" {
+			entry["pattern"] = r.Pattern
+		}
+		if r.Description != "" {
+			entry["description"] = r.Description
+		}
+		vars = append(vars, entry)
+	}
+	if len(unmet) == 0 {
+		return nil
+	}
+	return liberrs.RequiredVarsUnmet(scope, unmet, vars)
+}
+
+// mergeRequirements concatenates requirement lists, dropping exact
+// duplicates while keeping first-seen order. Used to report a command's
+// effective requirements — the profile's plus its own.
+func mergeRequirements(lists ...[]Requirement) []Requirement {
+	var out []Requirement
+	seen := make(map[Requirement]bool)
+	for _, reqs := range lists {
+		for _, r := range reqs {
+			if !seen[r] {
+				seen[r] = true
+				out = append(out, r)
+			}
+		}
+	}
+	return out
+}
+
+// profileRequirements returns the active profile's top-level requires.
+func profileRequirements() []Requirement {
+	ctx := loadContext()
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Profile.Requires
+}
@@ -0,0 +1,245 @@
+package lib
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+)
+
+func TestRequirementUnmet(t *testing.T) {
+	t.Setenv("RAID_REQ_SET", "us-east-1")
+	t.Setenv("RAID_REQ_EMPTY", "")
+
+	tests := []struct {
+		name string
+		req  Requirement
+		want string // substring; "" means satisfied
+	}{
+		{"unset", Requirement{Name: "RAID_REQ_UNSET_XYZ"}, "is not set"},
+		{"empty counts as missing", Requirement{Name: "RAID_REQ_EMPTY"}, "is not set"},
+		{"set", Requirement{Name: "RAID_REQ_SET"}, ""},
+		{"pattern matches", Requirement{Name: "RAID_REQ_SET", Pattern: `[a-z]+-[a-z]+-[0-9]`}, ""},
+		{"pattern must match whole value", Requirement{Name: "RAID_REQ_SET", Pattern: `[a-z]+`}, "does not match pattern"},
+		{"invalid pattern", Requirement{Name: "RAID_REQ_SET", Pattern: `(`}, "invalid pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.req.Unmet()
+			if tt.want == "" && got != "" {
+				t.Errorf("Unmet() = %q, want satisfied", got)
+			}
+			if tt.want != "" && !strings.Contains(got, tt.want) {
+				t.Errorf("Unmet() = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequirementUnmet_resolvesRaidVars(t *testing.T) {
+	raidVarsMu.Lock()
+	old := raidVars
+	raidVars = map[string]string{"RAID_REQ_PERSISTED": "yes"}
+	raidVarsMu.Unlock()
+	t.Cleanup(func() {
+		raidVarsMu.Lock()
+		raidVars = old
+		raidVarsMu.Unlock()
+	})
+
+	if got := (Requirement{Name: "RAID_REQ_PERSISTED"}).Unmet(); got != "" {
+		t.Errorf("Unmet() = %q, want a raid var to satisfy the requirement", got)
+	}
+}
+
+func TestCheckRequirements_aggregatesAllProblems(t *testing.T) {
+	t.Setenv("RAID_REQ_REGION", "mars")
+
+	err := checkRequirements("command 'deploy'",
+		[]Requirement{{Name: "RAID_REQ_TOKEN_XYZ", Description: "deploy token"}},
+		[]Requirement{
+			{Name: "RAID_REQ_REGION", Pattern: `us-.*`},
+			{Name: "RAID_REQ_CLUSTER_XYZ"},
+			{Name: "RAID_REQ_TOKEN_XYZ", Description: "deploy token"}, // duplicate
+		},
+	)
+	if err == nil {
+		t.Fatal("checkRequirements() = nil, want error")
+	}
+	rErr, ok := liberrs.AsError(err)
+	if !ok || rErr.Code() != liberrs.CodeRequiredVarsUnmet {
+		t.Fatalf("checkRequirements() error = %v, want code %s", err, liberrs.CodeRequiredVarsUnmet)
+	}
+	if rErr.Category() != liberrs.CategoryConfig {
+		t.Errorf("Category() = %v, want config", rErr.Category())
+	}
+	msg := err.Error()
+	for _, want := range []string{"command 'deploy'", "RAID_REQ_TOKEN_XYZ is not set (deploy token)", "RAID_REQ_REGION does not match", "RAID_REQ_CLUSTER_XYZ is not set"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q missing %q", msg, want)
+		}
+	}
+	if strings.Contains(msg, "mars") {
+		t.Errorf("error %q leaks the malformed value", msg)
+	}
+	if got := rErr.Details()["count"]; got != 3 {
+		t.Errorf("Details()[count] = %v, want 3 (duplicate folded)", got)
+	}
+}
+
+func TestCheckRequirements_allSatisfied(t *testing.T) {
+	t.Setenv("RAID_REQ_OK", "1")
+	if err := checkRequirements("x", []Requirement{{Name: "RAID_REQ_OK", Pattern: `[0-9]+`}}, nil); err != nil {
+		t.Errorf("checkRequirements() = %v, want nil", err)
+	}
+}
+
+func TestExecuteCommand_requiresUnmet_runsNothing(t *testing.T) {
+	setupTestConfig(t)
+	marker := filepath.Join(t.TempDir(), "ran")
+	storeContext(&Context{
+		Profile: Profile{
+			Requires: []Requirement{{Name: "RAID_REQ_PROFILE_XYZ"}},
+			Commands: []Command{{
+				Name:     "deploy",
+				Requires: []Requirement{{Name: "RAID_REQ_CMD_XYZ"}},
+				Tasks:    []Task{{Type: Shell, Cmd: "touch " + marker}},
+			}},
+		},
+	})
+
+	err := ExecuteCommand("deploy", nil, nil)
+	if err == nil {
+		t.Fatal("ExecuteCommand() = nil, want requirements error")
+	}
+	for _, want := range []string{"RAID_REQ_PROFILE_XYZ", "RAID_REQ_CMD_XYZ"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q missing %q", err, want)
+		}
+	}
+	if _, statErr := os.Stat(marker); statErr == nil {
+		t.Error("task ran despite unmet requirements")
+	}
+}
+
+func TestExecuteCommand_requiresSatisfiedByNamedArg(t *testing.T) {
+	setupTestConfig(t)
+	origOut := commandStdout
+	commandStdout = io.Discard
+	t.Cleanup(func() { commandStdout = origOut })
+
+	storeContext(&Context{
+		Profile: Profile{
+			Commands: []Command{{
+				Name:     "deploy",
+				Args:     []Arg{{Name: "target"}},
+				Requires: []Requirement{{Name: "TARGET", Pattern: `prod|staging`}},
+				Tasks:    []Task{{Type: Shell, Cmd: "exit 0"}},
+			}},
+		},
+	})
+
+	if err := ExecuteCommand("deploy", nil, map[string]string{"target": "staging"}); err != nil {
+		t.Errorf("ExecuteCommand() error: %v", err)
+	}
+}
+
+func TestExecuteCommand_requiresSatisfiedByCommandEnv(t *testing.T) {
+	setupTestConfig(t)
+	origOut := commandStdout
+	commandStdout = io.Discard
+	t.Cleanup(func() { commandStdout = origOut })
+
+	storeContext(&Context{
+		Profile: Profile{
+			Commands: []Command{{
+				Name:     "deploy",
+				Args:     []Arg{{Name: "target"}},
+				Env:      map[string]string{"DEPLOY_TARGET": "$RAID_ARG_1"},
+				Requires: []Requirement{{Name: "DEPLOY_TARGET", Pattern: `prod|staging`}},
+				Tasks:    []Task{{Type: Shell, Cmd: "exit 0"}},
+			}},
+		},
+	})
+
+	if err := ExecuteCommand("deploy", []string{"staging"}, nil); err != nil {
+		t.Errorf("ExecuteCommand() error: %v, want the command's env to satisfy its requires", err)
+	}
+	err := ExecuteCommand("deploy", []string{"dev"}, nil)
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeRequiredVarsUnmet {
+		t.Errorf("ExecuteCommand() error = %v, want REQUIRED_VARS_UNMET", err)
+	}
+}
+
+func TestExecuteEnv_requiresUnmet_writesNothing(t *testing.T) {
+	setupTestConfig(t)
+	dir := t.TempDir()
+	storeContext(&Context{
+		Profile: Profile{
+			Name:         "test",
+			Path:         "/test",
+			Repositories: []Repo{{Name: "repo1", Path: dir, URL: "http://x.com", Environments: []Env{{Name: "dev", Requires: []Requirement{{Name: "RAID_REQ_REPO_XYZ"}}}}}},
+			Environments: []Env{{
+				Name:      "dev",
+				Requires:  []Requirement{{Name: "RAID_REQ_ENV_XYZ"}},
+				Variables: []EnvVar{{Name: "A", Value: "1"}},
+			}},
+		},
+	})
+
+	err := ExecuteEnv("dev")
+	if err == nil {
+		t.Fatal("ExecuteEnv() = nil, want requirements error")
+	}
+	if !strings.Contains(err.Error(), "environment 'dev'") || !strings.Contains(err.Error(), "RAID_REQ_REPO_XYZ") {
+		t.Errorf("ExecuteEnv() error = %v", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(dir, ".env")); statErr == nil {
+		t.Error(".env written despite unmet requirements")
+	}
+}
+
+func TestCheckRequires_findings(t *testing.T) {
+	t.Setenv("RAID_REQ_PRESENT", "x")
+	reqs := []Requirement{{Name: "RAID_REQ_PRESENT"}, {Name: "RAID_REQ_ABSENT_XYZ", Description: "needed"}}
+
+	findings := checkRequires("command/deploy requires", reqs, SeverityWarn, "deploy")
+	if len(findings) != 2 {
+		t.Fatalf("checkRequires() = %d findings, want 2", len(findings))
+	}
+	if findings[0].Severity != SeverityOK || findings[0].Check != "command/deploy requires/RAID_REQ_PRESENT" {
+		t.Errorf("findings[0] = %+v", findings[0])
+	}
+	if findings[1].Severity != SeverityWarn || !strings.Contains(findings[1].Message, "needed") || !strings.Contains(findings[1].Suggestion, "raid deploy") {
+		t.Errorf("findings[1] = %+v", findings[1])
+	}
+}
+
+func TestGetWorkspaceContext_commandRequires(t *testing.T) {
+	resetWorkspaceContextState(t)
+	t.Setenv("RAID_REQ_HAVE", "1")
+	storeContext(&Context{
+		Profile: Profile{
+			Name:     "demo",
+			Path:     "/tmp/demo.raid.yaml",
+			Requires: []Requirement{{Name: "RAID_REQ_HAVE"}},
+			Commands: []Command{
+				{Name: "deploy", Requires: []Requirement{{Name: "RAID_REQ_MISSING_XYZ", Description: "target"}}},
+			},
+		},
+	})
+
+	got := GetWorkspaceContext().Workspace.Commands[0].Requires
+	if len(got) != 2 {
+		t.Fatalf("Requires = %+v, want profile + command entries", got)
+	}
+	if got[0].Name != "RAID_REQ_HAVE" || !got[0].Satisfied {
+		t.Errorf("Requires[0] = %+v, want satisfied profile requirement", got[0])
+	}
+	if got[1].Name != "RAID_REQ_MISSING_XYZ" || got[1].Satisfied || got[1].Description != "target" {
+		t.Errorf("Requires[1] = %+v, want unsatisfied command requirement", got[1])
+	}
+}
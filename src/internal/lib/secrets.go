@@ -0,0 +1,183 @@
+package lib
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Secret vars (`secret: true` on a Set or Prompt task) are stored as
+// AES-256-GCM ciphertext — in the vars files and in the in-memory raidVars
+// map alike — and only decrypted into the environment buildSubprocessEnv
+// hands to child processes. Everything else that renders a var (task
+// expansion, Print, `raid vars`, the MCP vars resource) sees maskedValue.
+//
+// The key lives in a keyfile beside the global vars file. It protects the
+// values against casual disclosure — a synced dotfiles repo, a backup, a
+// `cat` over someone's shoulder — not against an attacker who can read
+// both files as the same user.
+
+const (
+	// secretValuePrefix marks an encrypted value. The version lets the
+	// format change without misreading older files.
+	secretValuePrefix = "enc:v1:"
+	varsKeyFileName   = "vars.key"
+	varsKeySize       = 32
+)
+
+var (
+	varsKeyMu    sync.Mutex
+	varsKeyCache struct {
+		path string
+		key  []byte
+	}
+)
+
+// varsKeyPath returns the keyfile beside the global vars file, so a test
+// override of raidVarsPath redirects it too.
+func varsKeyPath() string {
+	return filepath.Join(filepath.Dir(raidVarsPath()), varsKeyFileName)
+}
+
+// isSecretValue reports whether a stored var value is encrypted.
+func isSecretValue(v string) bool {
+	return strings.HasPrefix(v, secretValuePrefix)
+}
+
+// maskRaidVar returns v, or maskedValue when v is encrypted.
+func maskRaidVar(v string) string {
+	if isSecretValue(v) {
+		return maskedValue
+	}
+	return v
+}
+
+// loadVarsKey returns the vars encryption key, creating the keyfile when
+// create is set and none exists yet. The key is cached per path.
+func loadVarsKey(create bool) ([]byte, error) {
+	path := varsKeyPath()
+	varsKeyMu.Lock()
+	defer varsKeyMu.Unlock()
+	if varsKeyCache.path == path && varsKeyCache.key != nil {
+		return varsKeyCache.key, nil
+	}
+
+	key, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && create {
+		key, err = createVarsKey(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vars key %s: %w", path, err)
+	}
+	if len(key) != varsKeySize {
+		return nil, fmt.Errorf("vars key %s is %d bytes, want %d", path, len(key), varsKeySize)
+	}
+	varsKeyCache.path, varsKeyCache.key = path, key
+	return key, nil
+}
+
+// createVarsKey writes a fresh random key to path at 0600. O_EXCL makes a
+// concurrent creator lose cleanly: it re-reads the winner's key instead of
+// overwriting it and orphaning every value already encrypted with it.
+func createVarsKey(path string) ([]byte, error) {
+	key := make([]byte, varsKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, fs.ErrExist) {
+		return os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(key); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return key, nil
+}
+
+// encryptSecret seals plain under the vars key, creating the key on first
+// use, and returns the prefixed, base64-encoded nonce+ciphertext.
+func encryptSecret(plain string) (string, error) {
+	key, err := loadVarsKey(true)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newVarsGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return secretValuePrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret opens a value produced by encryptSecret.
+func decryptSecret(v string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(v, secretValuePrefix))
+	if err != nil {
+		return "", fmt.Errorf("malformed secret value: %w", err)
+	}
+	key, err := loadVarsKey(false)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newVarsGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("malformed secret value: too short")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("secret value can't be decrypted with the current vars key")
+	}
+	return string(plain), nil
+}
+
+func newVarsGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// revealRaidVar returns the plaintext of an encrypted value, or v itself
+// when it isn't encrypted. Reserved for the subprocess env and for
+// checks that never render the result.
+func revealRaidVar(name, v string) (string, bool) {
+	if !isSecretValue(v) {
+		return v, true
+	}
+	plain, err := decryptSecret(v)
+	if err != nil {
+		if !suppressLoadWarnings.Load() {
+			fmt.Fprintf(os.Stderr, "raid: skipping secret var %s: %v\n", name, err)
+		}
+		return "", false
+	}
+	return plain, true
+}
@@ -0,0 +1,176 @@
+package lib
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestEncryptSecret_roundTrip(t *testing.T) {
+	setupVarsFile(t)
+
+	enc, err := encryptSecret("s3cret")
+	if err != nil {
+		t.Fatalf("encryptSecret() error: %v", err)
+	}
+	if !isSecretValue(enc) || strings.Contains(enc, "s3cret") {
+		t.Fatalf("encryptSecret() = %q, want an opaque enc:v1 value", enc)
+	}
+	again, _ := encryptSecret("s3cret")
+	if again == enc {
+		t.Error("encryptSecret() reused a nonce: identical ciphertexts for one plaintext")
+	}
+	plain, err := decryptSecret(enc)
+	if err != nil || plain != "s3cret" {
+		t.Errorf("decryptSecret() = %q, %v; want s3cret", plain, err)
+	}
+
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(varsKeyPath())
+		if err != nil {
+			t.Fatalf("stat keyfile: %v", err)
+		}
+		if fi.Mode().Perm() != 0o600 {
+			t.Errorf("keyfile mode = %o, want 0600", fi.Mode().Perm())
+		}
+	}
+}
+
+func TestDecryptSecret_wrongKey(t *testing.T) {
+	setupVarsFile(t)
+	enc, err := encryptSecret("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second isolated vars dir has its own keyfile.
+	setupVarsFile(t)
+	if _, err := encryptSecret("other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decryptSecret(enc); err == nil {
+		t.Error("decryptSecret() succeeded with a different key")
+	}
+	suppressLoadWarnings.Store(true)
+	t.Cleanup(func() { suppressLoadWarnings.Store(false) })
+	if _, ok := revealRaidVar("TOKEN", enc); ok {
+		t.Error("revealRaidVar() = ok for an undecryptable value")
+	}
+}
+
+func TestExecuteTask_setSecret(t *testing.T) {
+	path := setupVarsFile(t)
+
+	if err := ExecuteTask(Task{Type: SetVar, Var: "API_TOKEN", Value: "tok-123", Secret: true}); err != nil {
+		t.Fatalf("ExecuteTask(Set secret) error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "tok-123") || !strings.Contains(string(data), secretValuePrefix) {
+		t.Errorf("vars file = %q, want the value encrypted", data)
+	}
+	if v, _ := lookupRaidVar("API_TOKEN"); v != maskedValue {
+		t.Errorf("lookupRaidVar() = %q, want mask", v)
+	}
+	if got := expandRaid("token=$API_TOKEN"); got != "token="+maskedValue {
+		t.Errorf("expandRaid() = %q, want masked", got)
+	}
+	if got := snapshotRaidVars()["API_TOKEN"]; got != maskedValue {
+		t.Errorf("snapshotRaidVars() = %q, want mask", got)
+	}
+	e, err := GetVar("API_TOKEN")
+	if err != nil || !e.Secret || e.Value != maskedValue {
+		t.Errorf("GetVar() = %+v, %v; want masked secret entry", e, err)
+	}
+
+	found := false
+	for _, kv := range buildSubprocessEnv() {
+		if kv == "API_TOKEN=tok-123" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("buildSubprocessEnv() missing the decrypted secret")
+	}
+}
+
+func TestExpandRaidForShell_leavesSecretsToTheShell(t *testing.T) {
+	setupVarsFile(t)
+	if _, err := PersistVar("API_TOKEN", "tok-123", VarScopeSession, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := expandRaidForShell("curl -H $API_TOKEN"); got != "curl -H ${API_TOKEN}" {
+		t.Errorf("expandRaidForShell() = %q, want the reference left for the shell", got)
+	}
+}
+
+func TestExecuteCommand_secretReachesShellNotPrint(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell redirection")
+	}
+	setupTestConfig(t)
+	setupVarsFile(t)
+	var buf bytes.Buffer
+	origOut := commandStdout
+	commandStdout = &buf
+	t.Cleanup(func() { commandStdout = origOut })
+
+	out := filepath.Join(t.TempDir(), "token")
+	storeContext(&Context{Profile: Profile{Commands: []Command{{
+		Name: "deploy",
+		Tasks: []Task{
+			{Type: SetVar, Var: "API_TOKEN", Value: "tok-123", Secret: true, Scope: "session"},
+			{Type: Shell, Cmd: "printf %s \"$API_TOKEN\" > " + out},
+			{Type: Print, Message: "using $API_TOKEN"},
+		},
+	}}}})
+
+	if err := ExecuteCommand("deploy", nil, nil); err != nil {
+		t.Fatalf("ExecuteCommand() error: %v", err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "tok-123" {
+		t.Errorf("shell saw %q, want the decrypted secret", data)
+	}
+	if strings.Contains(buf.String(), "tok-123") || !strings.Contains(buf.String(), "using "+maskedValue) {
+		t.Errorf("Print output = %q, want the secret masked", buf.String())
+	}
+	if v, _ := lookupRaidVar("API_TOKEN"); v != maskedValue {
+		t.Errorf("lookupRaidVar() after shell = %q, want mask (plaintext captured from the shell env)", v)
+	}
+}
+
+func TestExecuteTask_promptSecretHeadless(t *testing.T) {
+	defer SetHeadlessForTest(true)()
+	setupVarsFile(t)
+	t.Cleanup(func() { os.Unsetenv("RAID_PROMPT_SECRET") })
+
+	if err := ExecuteTask(Task{Type: Prompt, Var: "RAID_PROMPT_SECRET", Default: "hunter2", Secret: true}); err != nil {
+		t.Fatalf("ExecuteTask(Prompt secret) error: %v", err)
+	}
+	if _, ok := os.LookupEnv("RAID_PROMPT_SECRET"); ok {
+		t.Error("secret prompt exported into raid's own process env")
+	}
+	e, err := GetVar("RAID_PROMPT_SECRET")
+	if err != nil || !e.Secret || e.Source != VarSourceSession {
+		t.Errorf("GetVar() = %+v, %v; want a session secret", e, err)
+	}
+}
+
+func TestRequirementUnmet_patternOnSecret(t *testing.T) {
+	setupVarsFile(t)
+	if _, err := PersistVar("RAID_REQ_SECRET", "ghp_abc", VarScopeSession, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := (Requirement{Name: "RAID_REQ_SECRET", Pattern: `ghp_.*`}).Unmet(); got != "" {
+		t.Errorf("Unmet() = %q, want the decrypted value to match", got)
+	}
+	if got := (Requirement{Name: "RAID_REQ_SECRET", Pattern: `xyz`}).Unmet(); !strings.Contains(got, "does not match") {
+		t.Errorf("Unmet() = %q, want a mismatch", got)
+	}
+}
@@ -0,0 +1,524 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+	"github.com/8bitalex/raid/src/internal/sys"
+)
+
+const (
+	servicesDirName = "services"
+	// ServiceSupervisorArg, as a raid process's only argument besides a
+	// state file path, turns it into the supervisor of one restartable
+	// service. It's never typed by a user.
+	ServiceSupervisorArg = "__raid-service-supervisor"
+	// serviceRedactEnvVar hands the supervisor the redactSpec, as JSON,
+	// of the run that started it. The supervisor drops it from the
+	// service's own environment.
+	serviceRedactEnvVar = "RAID_SERVICE_REDACT"
+
+	serviceStopGrace       = 10 * time.Second
+	maxServiceRestartDelay = 30 * time.Second
+	serviceLogPollInterval = 250 * time.Millisecond
+)
+
+// Service restart policies.
+const (
+	restartNo        = "no"
+	restartOnFailure = "on-failure"
+	restartAlways    = "always"
+)
+
+// ServicesPathOverride redirects ~/.raid/services. Intended only for tests.
+var ServicesPathOverride string
+
+var serviceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ServiceInfo describes a service raid has started for the active profile.
+type ServiceInfo struct {
+	Name    string `json:"name"`
+	Running bool   `json:"running"`
+	// PID is the process raid stops to stop the service: the raid
+	// supervisor the command runs under.
+	PID      int       `json:"pid,omitempty"`
+	Cmd      string    `json:"cmd"`
+	Dir      string    `json:"dir,omitempty"`
+	Restart  string    `json:"restart"`
+	Restarts int       `json:"restarts"`
+	LastExit *int      `json:"lastExit,omitempty"`
+	Started  time.Time `json:"started"`
+	Log      string    `json:"log"`
+}
+
+// serviceState is what raid records in <name>.json for each service.
+type serviceState struct {
+	ServiceInfo
+	Argv []string `json:"argv"`
+	// PIDStart identifies the process behind PID by when it started; see
+	// serviceAlive.
+	PIDStart string `json:"pidStart,omitempty"`
+}
+
+// servicesDir holds the state and log files of the active profile's
+// services.
+func servicesDir() string {
+	root := ServicesPathOverride
+	if root == "" {
+		root = filepath.Join(sys.GetHomeDir(), ConfigDirName, servicesDirName)
+	}
+	profile := "default"
+	if ctx := loadContext(); ctx != nil && ctx.Profile.Name != "" {
+		profile = profileFileName(ctx.Profile.Name)
+	}
+	return filepath.Join(root, profile)
+}
+
+func serviceStatePath(dir, name string) string {
+	return filepath.Join(dir, name+".json")
+}
+
+func serviceLogPath(dir, name string) string {
+	return filepath.Join(dir, name+".log")
+}
+
+// openServiceLog opens a service's log for appending. Logs hold raw
+// service output, so they're private to the user, including any created
+// before raid made them so.
+func openServiceLog(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(0o600); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func readServiceState(path string) (serviceState, error) {
+	var s serviceState
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("invalid service state %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// serviceAlive reports whether s's process is still the one raid started.
+// A PID alone can't tell: after a reboot or once PIDs wrap around it may
+// belong to an unrelated process, so its start time must still match the
+// one recorded. State recorded without a start time falls back to the PID.
+func serviceAlive(s serviceState) bool {
+	if !processAlive(s.PID) {
+		return false
+	}
+	return s.PIDStart == "" || processStartTime(s.PID) == s.PIDStart
+}
+
+func writeServiceState(path string, s serviceState) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, bytes.NewReader(data), nil, 0o644)
+}
+
+// serviceEnv is the environment a service runs with. It drops the
+// mutation- and command-lock markers: a service outlives the raid run that
+// holds the locks, so raid commands it runs later must take them
+// themselves.
+func serviceEnv() []string {
+	return slices.DeleteFunc(buildSubprocessEnv(), func(kv string) bool {
+		return strings.HasPrefix(kv, MutationLockEnvVar+"=") || strings.HasPrefix(kv, CommandLocksEnvVar+"=")
+	})
+}
+
+func execService(task Task) error {
+	if !task.Literal {
+		task.Path = task.resolvePath(task.Path)
+		task.Shell = expandRaid(task.Shell)
+		task.Cmd = expandRaidForShell(task.Cmd)
+	}
+	name := task.Name
+	if name == "" {
+		return liberrs.ArgInvalid("name is required for Service task")
+	}
+	if !serviceNamePattern.MatchString(name) {
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid service name '%s': use letters, digits, '.', '_' and '-'", name)
+	}
+	if task.Cmd == "" {
+		return liberrs.ArgInvalid("cmd is required for Service task")
+	}
+	restart := strings.ToLower(task.Restart)
+	switch restart {
+	case "":
+		restart = restartNo
+	case restartNo, restartOnFailure, restartAlways:
+	default:
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid restart '%s' for Service task (supported: no, on-failure, always)", task.Restart)
+	}
+	var ready *waitProbe
+	var timeout, interval time.Duration
+	if task.Ready != nil {
+		target := *task.Ready
+		if !task.Literal {
+			target = target.expand(task.resolvePath)
+		}
+		var err error
+		if ready, err = newWaitProbe(target); err != nil {
+			return err
+		}
+		if timeout, err = parseWaitDuration("timeout", task.Timeout, defaultWaitTimeout); err != nil {
+			return err
+		}
+		if interval, err = parseWaitDuration("interval", task.Interval, defaultWaitInterval); err != nil {
+			return err
+		}
+	}
+
+	dir := servicesDir()
+	s := serviceState{
+		ServiceInfo: ServiceInfo{Name: name, Cmd: task.Cmd, Dir: task.Path, Restart: restart, Log: serviceLogPath(dir, name)},
+		Argv:        append(getShell(task.Shell), task.Cmd),
+	}
+	s, started, err := startService(dir, s)
+	if err != nil {
+		return err
+	}
+	if started {
+		lockedFprintf(commandStdout, "Started service %s (pid %d), logging to %s\n", name, s.PID, s.Log)
+	} else {
+		lockedFprintf(commandStdout, "Service %s is already running (pid %d)\n", name, s.PID)
+	}
+	if ready == nil {
+		return nil
+	}
+
+	label := fmt.Sprintf("service %s to be ready", name)
+	lockedFprintf(commandStdout, "Waiting for %s (timeout: %s)...\n", label, timeout)
+	return pollWait(label, []*waitProbe{ready}, false, timeout, interval, func() error {
+		if !serviceAlive(s) {
+			return liberrs.TaskServiceFailed(name, fmt.Errorf("exited before it was ready; see %s", s.Log))
+		}
+		return nil
+	})
+}
+
+// startService launches s unless a service of that name is already
+// running, and reports whether it started one. Every service runs under a
+// detached supervisor raid process, which restarts it as its policy says
+// and masks secrets in its output before they reach the log.
+func startService(dir string, s serviceState) (serviceState, bool, error) {
+	path := serviceStatePath(dir, s.Name)
+	if old, err := readServiceState(path); err == nil && serviceAlive(old) {
+		old.Running = true
+		return old, false, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return s, false, liberrs.TaskServiceFailed(s.Name, err)
+	}
+	logf, err := openServiceLog(s.Log)
+	if err != nil {
+		return s, false, liberrs.TaskServiceFailed(s.Name, err)
+	}
+	defer logf.Close()
+	spec, err := json.Marshal(currentRedactSpec())
+	if err != nil {
+		return s, false, liberrs.TaskServiceFailed(s.Name, err)
+	}
+
+	s.Started = time.Now()
+	fmt.Fprintf(logf, "--- raid: starting %s at %s ---\n", s.Name, s.Started.Format(time.RFC3339))
+	// The supervisor reads the command from the state file, so it must be
+	// written before the supervisor starts.
+	if err := writeServiceState(path, s); err != nil {
+		return s, false, liberrs.TaskServiceFailed(s.Name, err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return s, false, liberrs.TaskServiceFailed(s.Name, err)
+	}
+	cmd := exec.Command(exe, ServiceSupervisorArg, path)
+	cmd.Env = append(serviceEnv(), serviceRedactEnvVar+"="+string(spec))
+	cmd.Stdout, cmd.Stderr = logf, logf
+	detachProcess(cmd)
+	if err := cmd.Start(); err != nil {
+		return s, false, liberrs.TaskServiceFailed(s.Name, err)
+	}
+	// Reap the process if it exits while raid is still running, so a
+	// zombie doesn't read as a live service.
+	go cmd.Wait()
+
+	s.PID = cmd.Process.Pid
+	s.PIDStart = processStartTime(s.PID)
+	s.Running = true
+	if err := writeServiceState(path, s); err != nil {
+		return s, false, liberrs.TaskServiceFailed(s.Name, err)
+	}
+	return s, true, nil
+}
+
+// StartServices runs the Service tasks of the active environment, or only
+// those named, leaving every other env task alone. Services that are
+// already running are left as they are.
+func StartServices(names []string) error {
+	ctx := loadContext()
+	if ctx == nil {
+		return liberrs.Internal("raid context is not initialized")
+	}
+	env := GetEnv()
+	if env == "" {
+		return liberrs.ArgInvalid("no active environment; run 'raid env <name>' first")
+	}
+
+	var tasks []Task
+	if !ctx.Profile.IsSingleRepo() {
+		tasks = append(tasks, serviceTasks(ctx.Profile.getEnv(env).Tasks, sys.GetHomeDir())...)
+	}
+	for _, repo := range ctx.Profile.Repositories {
+		tasks = append(tasks, serviceTasks(repo.getEnv(env).Tasks, sys.ExpandPath(repo.Path))...)
+	}
+	if len(names) > 0 {
+		var picked []Task
+		for _, name := range names {
+			i := slices.IndexFunc(tasks, func(t Task) bool { return t.Name == name })
+			if i < 0 {
+				return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "no Service named '%s' in environment '%s'", name, env)
+			}
+			picked = append(picked, tasks[i])
+		}
+		tasks = picked
+	}
+	if len(tasks) == 0 {
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "environment '%s' has no Service tasks", env)
+	}
+	return ExecuteTasks(tasks)
+}
+
+// serviceTasks picks the Service tasks out of tasks, defaulting their
+// working directory to dir.
+func serviceTasks(tasks []Task, dir string) []Task {
+	var out []Task
+	for _, t := range withDefaultDir(tasks, dir) {
+		if t.Type.ToLower() == Service {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// ListServices returns the services raid has started for the active
+// profile, sorted by name, including ones that have since exited.
+func ListServices() ([]ServiceInfo, error) {
+	dir := servicesDir()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, liberrs.Internal(err.Error())
+	}
+	services := make([]ServiceInfo, 0, len(paths))
+	for _, path := range paths {
+		s, err := readServiceState(path)
+		if err != nil {
+			fmt.Fprintf(commandStderr, "raid: skipping %s: %v\n", path, err)
+			continue
+		}
+		s.Running = serviceAlive(s)
+		services = append(services, s.ServiceInfo)
+	}
+	slices.SortFunc(services, func(a, b ServiceInfo) int { return strings.Compare(a.Name, b.Name) })
+	return services, nil
+}
+
+// StopServices stops the named services, or every service of the active
+// profile when names is empty, and forgets them. Their logs are kept.
+func StopServices(names []string) error {
+	dir := servicesDir()
+	if len(names) == 0 {
+		services, err := ListServices()
+		if err != nil {
+			return err
+		}
+		for _, s := range services {
+			names = append(names, s.Name)
+		}
+		if len(names) == 0 {
+			lockedFprintf(commandStdout, "No services are running.\n")
+			return nil
+		}
+	}
+	var errs []error
+	for _, name := range names {
+		path := serviceStatePath(dir, name)
+		s, err := readServiceState(path)
+		if errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, liberrs.TaskServiceFailed(name, errors.New("no such service")))
+			continue
+		}
+		if err != nil {
+			errs = append(errs, liberrs.TaskServiceFailed(name, err))
+			continue
+		}
+		if serviceAlive(s) {
+			if err := stopProcessTree(s.PID, serviceStopGrace); err != nil {
+				errs = append(errs, liberrs.TaskServiceFailed(name, err))
+				continue
+			}
+			lockedFprintf(commandStdout, "Stopped service %s\n", name)
+		} else {
+			lockedFprintf(commandStdout, "Service %s was not running\n", name)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, liberrs.TaskServiceFailed(name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ServiceLogs copies the named service's log to w. With follow set it
+// keeps copying new output until ctx is done.
+func ServiceLogs(ctx context.Context, name string, follow bool, w io.Writer) error {
+	f, err := os.Open(serviceLogPath(servicesDir(), name))
+	if errors.Is(err, os.ErrNotExist) {
+		return liberrs.TaskServiceFailed(name, errors.New("no log file; has it been started?"))
+	}
+	if err != nil {
+		return liberrs.TaskServiceFailed(name, err)
+	}
+	defer f.Close()
+	for {
+		if _, err := io.Copy(w, f); err != nil {
+			return liberrs.TaskServiceFailed(name, err)
+		}
+		if !follow {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(serviceLogPollInterval):
+		}
+	}
+}
+
+// serviceOutput returns where the supervisor sends its command's output:
+// logf, through the redactor described by serviceRedactEnvVar when there
+// is one, and a func that writes out a partial line it's holding.
+func serviceOutput(logf io.Writer) (io.Writer, func()) {
+	var spec redactSpec
+	if data := os.Getenv(serviceRedactEnvVar); data != "" {
+		if err := json.Unmarshal([]byte(data), &spec); err != nil {
+			fmt.Fprintf(logf, "--- raid: ignoring invalid %s: %v ---\n", serviceRedactEnvVar, err)
+		}
+	}
+	red := spec.redactor()
+	if red == nil {
+		return logf, func() {}
+	}
+	w := newRedactingWriter(logf, red)
+	return w, func() { w.Flush() }
+}
+
+// RunServiceSupervisor runs the service recorded in the state file at
+// statePath, restarting it according to its policy until raid down stops
+// the supervisor. It's the whole job of a raid process started with
+// ServiceSupervisorArg, and returns that process's exit code.
+func RunServiceSupervisor(statePath string) int {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	if err := superviseService(statePath, stop); err != nil {
+		fmt.Fprintf(os.Stderr, "--- raid: supervisor failed: %v ---\n", err)
+		return 1
+	}
+	return 0
+}
+
+func superviseService(statePath string, stop <-chan os.Signal) error {
+	s, err := readServiceState(statePath)
+	if err != nil {
+		return err
+	}
+	if len(s.Argv) == 0 {
+		return fmt.Errorf("no command recorded in %s", statePath)
+	}
+	s.PID = os.Getpid()
+	s.PIDStart = processStartTime(s.PID)
+	logf, err := openServiceLog(s.Log)
+	if err != nil {
+		return err
+	}
+	defer logf.Close()
+	out, flush := serviceOutput(logf)
+	env := slices.DeleteFunc(os.Environ(), func(kv string) bool { return strings.HasPrefix(kv, serviceRedactEnvVar+"=") })
+
+	delay := time.Second
+	for {
+		cmd := exec.Command(s.Argv[0], s.Argv[1:]...)
+		cmd.Dir = s.Dir
+		cmd.Env = env
+		cmd.Stdout, cmd.Stderr = out, out
+		started := time.Now()
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+
+		select {
+		case <-stop:
+			interruptProcess(cmd.Process)
+			<-done
+			flush()
+			return nil
+		case err := <-done:
+			flush()
+			code := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				code = exitErr.ExitCode()
+			} else if err != nil {
+				code = -1
+			}
+			s.LastExit = &code
+			if s.Restart != restartAlways && (s.Restart != restartOnFailure || code == 0) {
+				fmt.Fprintf(logf, "--- raid: %s exited with code %d ---\n", s.Name, code)
+				return writeServiceState(statePath, s)
+			}
+			// A run that lasted a while was healthy; start backing off
+			// from scratch.
+			if time.Since(started) > maxServiceRestartDelay {
+				delay = time.Second
+			}
+			s.Restarts++
+			fmt.Fprintf(logf, "--- raid: %s exited with code %d; restarting in %s ---\n", s.Name, code, delay)
+			if err := writeServiceState(statePath, s); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxServiceRestartDelay)
+	}
+}
@@ -0,0 +1,318 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+)
+
+// TestMain lets the test binary stand in for raid as a service's
+// supervisor, since that's the executable startService re-runs.
+func TestMain(m *testing.M) {
+	if len(os.Args) == 3 && os.Args[1] == ServiceSupervisorArg {
+		os.Exit(RunServiceSupervisor(os.Args[2]))
+	}
+	os.Exit(m.Run())
+}
+
+// setupServicesDir points service state at a temp dir and stops anything a
+// test leaves running.
+func setupServicesDir(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("service tests use sh")
+	}
+	old := ServicesPathOverride
+	ServicesPathOverride = t.TempDir()
+	t.Cleanup(func() {
+		withCapturedStdout(t, func() { StopServices(nil) })
+		ServicesPathOverride = old
+	})
+	return servicesDir()
+}
+
+func withCapturedStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	var buf bytes.Buffer
+	old := commandStdout
+	commandStdout = &buf
+	defer func() { commandStdout = old }()
+	fn()
+	return buf.String()
+}
+
+func TestExecuteTask_serviceStartListStop(t *testing.T) {
+	dir := setupServicesDir(t)
+	task := Task{TaskProps: TaskProps{Name: "api"}, Type: Service, Cmd: "echo hello; exec sleep 30", Shell: "sh"}
+
+	out := withCapturedStdout(t, func() {
+		if err := ExecuteTask(task); err != nil {
+			t.Fatalf("ExecuteTask() error: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Started service api") {
+		t.Errorf("output = %q, want a started line", out)
+	}
+	services, err := ListServices()
+	if err != nil || len(services) != 1 || !services[0].Running || services[0].Restart != restartNo {
+		t.Fatalf("ListServices() = %+v, %v; want api running", services, err)
+	}
+	pid := services[0].PID
+
+	out = withCapturedStdout(t, func() {
+		if err := ExecuteTask(task); err != nil {
+			t.Fatalf("second ExecuteTask() error: %v", err)
+		}
+	})
+	if !strings.Contains(out, "already running") {
+		t.Errorf("second start output = %q, want already running", out)
+	}
+	if services, _ := ListServices(); services[0].PID != pid {
+		t.Errorf("second start replaced pid %d with %d", pid, services[0].PID)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if data, _ := os.ReadFile(filepath.Join(dir, "api.log")); strings.Contains(string(data), "hello") {
+			break
+		}
+	}
+	withCapturedStdout(t, func() {
+		if err := StopServices([]string{"api"}); err != nil {
+			t.Fatalf("StopServices() error: %v", err)
+		}
+	})
+	if processAlive(pid) {
+		t.Error("service still running after StopServices")
+	}
+	if services, _ := ListServices(); len(services) != 0 {
+		t.Errorf("ListServices() after stop = %+v, want none", services)
+	}
+	var log bytes.Buffer
+	if err := ServiceLogs(context.Background(), "api", false, &log); err != nil || !strings.Contains(log.String(), "hello") {
+		t.Errorf("ServiceLogs() = %q, %v; want the log kept", log.String(), err)
+	}
+}
+
+func TestExecuteTask_serviceLogRedacted(t *testing.T) {
+	storeContext(&Context{Profile: Profile{Name: "p", Path: "/p.yaml", Redact: []string{`hunter\d+`}}})
+	t.Cleanup(func() { storeContext(nil) })
+	dir := setupServicesDir(t)
+	token := "ghp_" + strings.Repeat("a", 36)
+	task := Task{TaskProps: TaskProps{Name: "api"}, Type: Service, Cmd: "echo token=" + token + " pw=hunter22; exec sleep 30", Shell: "sh"}
+	withCapturedStdout(t, func() {
+		if err := ExecuteTask(task); err != nil {
+			t.Fatalf("ExecuteTask() error: %v", err)
+		}
+	})
+
+	logPath := filepath.Join(dir, "api.log")
+	var data []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if data, _ = os.ReadFile(logPath); strings.Contains(string(data), "token=") {
+			break
+		}
+	}
+	if !strings.Contains(string(data), "token=******** pw=********") {
+		t.Errorf("log =\n%s\nwant the token and password masked", data)
+	}
+	info, err := os.Stat(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("log mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestExecuteTask_serviceReady(t *testing.T) {
+	setupServicesDir(t)
+	marker := filepath.Join(t.TempDir(), "ready")
+	task := Task{
+		TaskProps: TaskProps{Name: "worker"}, Type: Service, Shell: "sh",
+		Cmd:   "sleep 0.1; touch " + marker + "; exec sleep 30",
+		Ready: &WaitTarget{File: marker}, Interval: "20ms", Timeout: "5s",
+	}
+	withCapturedStdout(t, func() {
+		if err := ExecuteTask(task); err != nil {
+			t.Fatalf("ExecuteTask() error: %v", err)
+		}
+	})
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("task returned before the service was ready: %v", err)
+	}
+}
+
+func TestExecuteTask_serviceExitsBeforeReady(t *testing.T) {
+	setupServicesDir(t)
+	task := Task{
+		TaskProps: TaskProps{Name: "broken"}, Type: Service, Shell: "sh",
+		Cmd:   "echo boom; exit 1",
+		Ready: &WaitTarget{File: filepath.Join(t.TempDir(), "never")}, Interval: "20ms", Timeout: "5s",
+	}
+	var err error
+	withCapturedStdout(t, func() { err = ExecuteTask(task) })
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeTaskServiceFailed {
+		t.Fatalf("error = %v, want TASK_SERVICE_FAILED", err)
+	}
+	var log bytes.Buffer
+	ServiceLogs(context.Background(), "broken", false, &log)
+	if !strings.Contains(log.String(), "boom") {
+		t.Errorf("log = %q, want the service's output", log.String())
+	}
+}
+
+func TestExecuteTask_serviceConfigErrors(t *testing.T) {
+	setupServicesDir(t)
+	for _, task := range []Task{
+		{Type: Service, Cmd: "sleep 1"},
+		{TaskProps: TaskProps{Name: "../up"}, Type: Service, Cmd: "sleep 1"},
+		{TaskProps: TaskProps{Name: "api"}, Type: Service},
+		{TaskProps: TaskProps{Name: "api"}, Type: Service, Cmd: "sleep 1", Restart: "sometimes"},
+		{TaskProps: TaskProps{Name: "api"}, Type: Service, Cmd: "sleep 1", Ready: &WaitTarget{}},
+		{TaskProps: TaskProps{Name: "api"}, Type: Service, Cmd: "sleep 1", Ready: &WaitTarget{File: "x"}, Timeout: "soon"},
+	} {
+		err := ExecuteTask(task)
+		if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeArgInvalid {
+			t.Errorf("ExecuteTask(%+v) = %v, want ARG_INVALID", task, err)
+		}
+	}
+	if services, _ := ListServices(); len(services) != 0 {
+		t.Errorf("invalid tasks started services: %+v", services)
+	}
+}
+
+func TestStopServices_unknown(t *testing.T) {
+	setupServicesDir(t)
+	err := StopServices([]string{"ghost"})
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeTaskServiceFailed {
+		t.Errorf("error = %v, want TASK_SERVICE_FAILED", err)
+	}
+}
+
+func TestStopServices_stalePIDLeftAlone(t *testing.T) {
+	// A state file whose PID now belongs to another process, as after a
+	// reboot, must read as not running and never be signalled.
+	dir := setupServicesDir(t)
+	other := exec.Command("sleep", "30")
+	detachProcess(other)
+	if err := other.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { other.Process.Kill(); other.Wait() })
+	if processStartTime(other.Process.Pid) == "" {
+		t.Skip("can't read process start times here")
+	}
+	s := serviceState{ServiceInfo: ServiceInfo{Name: "api", PID: other.Process.Pid, Cmd: "sleep 30", Restart: restartNo}, PIDStart: "an earlier process"}
+	if err := writeServiceState(serviceStatePath(dir, "api"), s); err != nil {
+		t.Fatal(err)
+	}
+
+	if services, err := ListServices(); err != nil || len(services) != 1 || services[0].Running {
+		t.Errorf("ListServices() = %+v, %v; want api not running", services, err)
+	}
+	out := withCapturedStdout(t, func() {
+		if err := StopServices([]string{"api"}); err != nil {
+			t.Errorf("StopServices() error: %v", err)
+		}
+	})
+	if !strings.Contains(out, "was not running") {
+		t.Errorf("output = %q, want not running", out)
+	}
+	if !processAlive(other.Process.Pid) {
+		t.Error("StopServices signalled a process it didn't start")
+	}
+}
+
+func TestStartServices_runsOnlyServiceTasks(t *testing.T) {
+	setupTestConfig(t)
+	setupServicesDir(t)
+	marker := filepath.Join(t.TempDir(), "shell-ran")
+	storeContext(&Context{Profile: Profile{Name: "acme", Environments: []Env{{Name: "dev", Tasks: []Task{
+		{Type: Shell, Cmd: "touch " + marker},
+		{TaskProps: TaskProps{Name: "api"}, Type: Service, Cmd: "exec sleep 30", Shell: "sh"},
+		{TaskProps: TaskProps{Name: "web"}, Type: Service, Cmd: "exec sleep 30", Shell: "sh"},
+	}}}}})
+	if err := SetEnv("dev"); err != nil {
+		t.Fatal(err)
+	}
+
+	withCapturedStdout(t, func() {
+		if err := StartServices([]string{"web"}); err != nil {
+			t.Fatalf("StartServices() error: %v", err)
+		}
+	})
+	services, _ := ListServices()
+	if len(services) != 1 || services[0].Name != "web" || services[0].Dir != filepath.Clean(os.Getenv("HOME")) {
+		t.Errorf("ListServices() = %+v, want only web, in the home dir", services)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("StartServices ran a non-Service task")
+	}
+	if err := StartServices([]string{"db"}); err == nil {
+		t.Error("StartServices(db) succeeded for a service the env doesn't declare")
+	}
+}
+
+func TestSuperviseService_restartsOnFailure(t *testing.T) {
+	dir := setupServicesDir(t)
+	path := serviceStatePath(dir, "flaky")
+	// The supervisor records its own pid, the test binary's; keep
+	// setupServicesDir's cleanup from stopping it.
+	t.Cleanup(func() { os.Remove(path) })
+	s := serviceState{
+		ServiceInfo: ServiceInfo{Name: "flaky", Restart: restartOnFailure, Log: serviceLogPath(dir, "flaky")},
+		Argv:        []string{"sh", "-c", "exit 3"},
+	}
+	if err := writeServiceState(path, s); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() { done <- superviseService(path, stop) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if got, _ := readServiceState(path); got.Restarts >= 1 {
+			if got.LastExit == nil || *got.LastExit != 3 || got.PID != os.Getpid() {
+				t.Errorf("state = %+v, want lastExit 3 and the supervisor's pid", got)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("supervisor never restarted the service")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	stop <- os.Interrupt
+	if err := <-done; err != nil {
+		t.Errorf("superviseService() error: %v", err)
+	}
+}
+
+func TestSuperviseService_cleanExitNotRestarted(t *testing.T) {
+	dir := setupServicesDir(t)
+	path := serviceStatePath(dir, "once")
+	t.Cleanup(func() { os.Remove(path) })
+	s := serviceState{
+		ServiceInfo: ServiceInfo{Name: "once", Restart: restartOnFailure, Log: serviceLogPath(dir, "once")},
+		Argv:        []string{"sh", "-c", "exit 0"},
+	}
+	if err := writeServiceState(path, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := superviseService(path, make(chan os.Signal)); err != nil {
+		t.Fatalf("superviseService() error: %v", err)
+	}
+	if got, _ := readServiceState(path); got.Restarts != 0 || got.LastExit == nil || *got.LastExit != 0 {
+		t.Errorf("state = %+v, want one clean run", got)
+	}
+}
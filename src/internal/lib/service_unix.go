@@ -0,0 +1,80 @@
+//go:build !windows
+
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// detachProcess starts cmd in a session of its own, so it outlives raid,
+// ignores the terminal's Ctrl-C, and leads a process group raid can stop
+// as a whole.
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// processStartTime identifies when pid started, or returns "" if it can't
+// tell. On Linux that's the boot ID and the start tick from /proc, which
+// tells apart processes from different boots; elsewhere it's ps's lstart.
+func processStartTime(pid int) string {
+	if stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat"); err == nil {
+		// The command name in parentheses may itself hold spaces, so
+		// count fields from its closing parenthesis: starttime is the
+		// 22nd field, the 20th after it.
+		i := bytes.LastIndexByte(stat, ')')
+		if i < 0 {
+			return ""
+		}
+		fields := strings.Fields(string(stat[i+1:]))
+		if len(fields) < 20 {
+			return ""
+		}
+		bootID, _ := os.ReadFile("/proc/sys/kernel/random/boot_id")
+		return strings.TrimSpace(string(bootID)) + ":" + fields[19]
+	}
+	out, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// stopProcessTree sends SIGTERM to the process group pid leads and, if it
+// is still running after grace, SIGKILL.
+func stopProcessTree(pid int, grace time.Duration) error {
+	if err := syscall.Kill(-pid, syscall.SIGTERM); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return nil
+		}
+		return err
+	}
+	for deadline := time.Now().Add(grace); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if !processAlive(pid) {
+			return nil
+		}
+	}
+	if err := syscall.Kill(-pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return err
+	}
+	return nil
+}
+
+// interruptProcess asks a supervised command to exit.
+func interruptProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,71 @@
+//go:build windows
+
+package lib
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	detachedProcess = 0x00000008
+	stillActive     = 259
+)
+
+// detachProcess starts cmd without a console and in a process group of
+// its own, so it outlives raid and ignores the terminal's Ctrl-C.
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess}
+}
+
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	h, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
+
+// processStartTime identifies when pid started by its creation time, or
+// returns "" if it can't tell.
+func processStartTime(pid int) string {
+	h, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return ""
+	}
+	defer syscall.CloseHandle(h)
+	var created, exited, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(h, &created, &exited, &kernel, &user); err != nil {
+		return ""
+	}
+	return strconv.FormatInt(created.Nanoseconds(), 10)
+}
+
+// stopProcessTree ends pid and its descendants. Windows can't deliver a
+// graceful signal to another console-less process, so grace is unused and
+// taskkill /T takes the whole tree down.
+func stopProcessTree(pid int, _ time.Duration) error {
+	out, err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).CombinedOutput()
+	if err != nil && processAlive(pid) {
+		return fmt.Errorf("taskkill: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// interruptProcess asks a supervised command to exit.
+func interruptProcess(p *os.Process) error {
+	return p.Kill()
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"path/filepath"
 	"strings"
 
 	"github.com/8bitalex/raid/src/internal/sys"
@@ -23,7 +24,8 @@ func (c Condition) IsZero() bool {
 // representation, and remain accessible via field promotion (e.g. `task.Name`).
 type TaskProps struct {
 	// Name is an optional human-readable label for the task, surfaced in logs
-	// and agent-facing output. It does not affect execution.
+	// and agent-facing output. It does not affect execution, except on a
+	// Service task, where it is the service's required name.
 	Name string `json:"name,omitempty" yaml:"name,omitempty"`
 	// Options is the shared options block — see TaskOptions. Composes across
 	// every task type and is also accepted on user-defined commands. Omitting
@@ -63,7 +65,7 @@ type Task struct {
 	Type       TaskType   `json:"type"`
 	Concurrent bool       `json:"concurrent,omitempty"`
 	Condition  *Condition `json:"condition,omitempty"`
-	// Shell
+	// Shell / Service
 	Cmd     string `json:"cmd,omitempty"`
 	Literal bool   `json:"literal,omitempty"`
 	Shell   string `json:"shell,omitempty"`
@@ -71,16 +73,66 @@ type Task struct {
 	Path   string `json:"path,omitempty"`
 	Runner string `json:"runner,omitempty"`
 	// HTTP
-	URL  string `json:"url,omitempty"`
-	Dest string `json:"dest,omitempty"`
-	// Wait
-	Timeout string `json:"timeout,omitempty"`
-	// Template
+	URL          string            `json:"url,omitempty"`
+	Dest         string            `json:"dest,omitempty"`
+	Method       string            `json:"method,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Body         string            `json:"body,omitempty"`
+	BodyFile     string            `json:"bodyFile,omitempty" yaml:"bodyFile,omitempty"`
+	BasicAuth    *BasicAuth        `json:"basicAuth,omitempty" yaml:"basicAuth,omitempty"`
+	Bearer       string            `json:"bearer,omitempty"`
+	ExpectStatus StatusCodes       `json:"expectStatus,omitempty" yaml:"expectStatus,omitempty"`
+	Insecure     bool              `json:"insecure,omitempty"`
+	CAFile       string            `json:"caFile,omitempty" yaml:"caFile,omitempty"`
+	Capture      []HTTPCapture     `json:"capture,omitempty"`
+	SHA256       string            `json:"sha256,omitempty"`
+	SHA512       string            `json:"sha512,omitempty"`
+	Mode         OctalMode         `json:"mode,omitempty"`
+	// Wait / Service / Container
+	Timeout      string       `json:"timeout,omitempty"`
+	Interval     string       `json:"interval,omitempty"`
+	BodyContains string       `json:"bodyContains,omitempty" yaml:"bodyContains,omitempty"`
+	BodyRegex    string       `json:"bodyRegex,omitempty" yaml:"bodyRegex,omitempty"`
+	Contains     string       `json:"contains,omitempty"`
+	PortFree     string       `json:"portFree,omitempty" yaml:"portFree,omitempty"`
+	All          []WaitTarget `json:"all,omitempty"`
+	Any          []WaitTarget `json:"any,omitempty"`
+	// Service
+	Restart string      `json:"restart,omitempty"`
+	Ready   *WaitTarget `json:"ready,omitempty"`
+	// Template / Archive / File
 	Src string `json:"src,omitempty"`
+	// Template / Container
+	Engine string `json:"engine,omitempty"`
+	// Container
+	Image     string            `json:"image,omitempty"`
+	Container string            `json:"container,omitempty"`
+	Ports     []string          `json:"ports,omitempty"`
+	Volumes   []string          `json:"volumes,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	// File
+	Line   string `json:"line,omitempty"`
+	Block  string `json:"block,omitempty"`
+	Marker string `json:"marker,omitempty"`
+	// ConfigEdit / Wait / Container
+	File  string         `json:"file,omitempty"`
+	Edits []ConfigEditOp `json:"edits,omitempty"`
+	// Archive / ConfigEdit
+	Format  string   `json:"format,omitempty"`
+	Strip   int      `json:"strip,omitempty"`
+	Include []string `json:"include,omitempty"`
 	// Group
 	Ref      string `json:"ref,omitempty"`
 	Parallel bool   `json:"parallel,omitempty"`
-	// Git
+	// Run
+	Command string `json:"command,omitempty"`
+	Repo    string `json:"repo,omitempty"`
+	// Flags holds YAML/JSON scalars; execRun expands and formats them
+	// once each flag's type is known.
+	Flags map[string]any `json:"flags,omitempty"`
+	// Container / Run
+	Args []string `json:"args,omitempty"`
+	// Git / Archive / File / Container
 	Op     string `json:"op,omitempty"`
 	Branch string `json:"branch,omitempty"`
 	// Prompt / Confirm / Print
@@ -88,8 +140,16 @@ type Task struct {
 	// Prompt / SetVar
 	Var     string `json:"var,omitempty"`
 	Default string `json:"default,omitempty"`
+	Secret  bool   `json:"secret,omitempty"`
+	// Prompt
+	Choices    []string `json:"choices,omitempty"`
+	ChoicesCmd string   `json:"choicesCmd,omitempty" yaml:"choicesCmd,omitempty"`
+	Pattern    string   `json:"pattern,omitempty"`
+	Multi      bool     `json:"multi,omitempty"`
+	ValueType  string   `json:"valueType,omitempty" yaml:"valueType,omitempty"`
 	// SetVar
 	Value string `json:"value,omitempty"`
+	Scope string `json:"scope,omitempty"`
 	// Print
 	Color string `json:"color,omitempty"`
 	// Retry
@@ -101,6 +161,15 @@ type Task struct {
 	// cycles instead of recursing until stack exhaustion. Unexported and
 	// never serialized — execution-time bookkeeping only.
 	groupStack []string
+	// runStack is the same for commands: the chain of commands, by name
+	// or repo:name, whose Run tasks led here.
+	runStack []string
+	// commandLocks is the command locks that chain holds; see
+	// acquireCommandLock.
+	commandLocks []string
+	// dir is the running command's `dir:`, stamped by applyCommandDefaults.
+	// Relative paths resolve against it; see resolvePath.
+	dir string
 }
 
 // IsZero reports whether the task has no type set.
@@ -118,27 +187,90 @@ func (t Task) Expand() Task {
 		Cmd:        expandRaid(t.Cmd),
 		Literal:    t.Literal,
 		Shell:      t.Shell,
-		Path:       sys.ExpandPath(expandRaid(t.Path)),
+		Path:       t.resolvePath(t.Path),
 		Runner:     expandRaid(t.Runner),
 		URL:        expandRaid(t.URL),
-		Dest:       sys.ExpandPath(expandRaid(t.Dest)),
-		Timeout:    t.Timeout,
-		Src:        sys.ExpandPath(expandRaid(t.Src)),
-		Ref:        t.Ref,
-		Parallel:   t.Parallel,
-		Op:         t.Op,
-		Branch:     expandRaid(t.Branch),
-		Message:    expandRaid(t.Message),
-		Var:        t.Var,
-		Default:    expandRaid(t.Default),
-		Value:      expandRaid(t.Value),
-		Color:      t.Color,
-		Attempts:   t.Attempts,
-		Delay:      t.Delay,
-		groupStack: t.groupStack,
+		Dest:       t.resolvePath(t.Dest),
+		Method:     expandRaid(t.Method),
+		// Headers, Body, BasicAuth and Bearer are expanded by execHTTP
+		// with secrets revealed, so they're copied as written here.
+		Headers:      t.Headers,
+		Body:         t.Body,
+		BodyFile:     t.resolvePath(t.BodyFile),
+		BasicAuth:    t.BasicAuth,
+		Bearer:       t.Bearer,
+		ExpectStatus: t.ExpectStatus,
+		Insecure:     t.Insecure,
+		CAFile:       t.resolvePath(t.CAFile),
+		Capture:      t.Capture,
+		SHA256:       expandRaid(t.SHA256),
+		SHA512:       expandRaid(t.SHA512),
+		Mode:         t.Mode,
+		Timeout:      t.Timeout,
+		Interval:     t.Interval,
+		BodyContains: expandRaid(t.BodyContains),
+		BodyRegex:    t.BodyRegex,
+		Contains:     expandRaid(t.Contains),
+		PortFree:     expandRaid(t.PortFree),
+		All:          expandWaitTargets(t.All, t.resolvePath),
+		Any:          expandWaitTargets(t.Any, t.resolvePath),
+		Restart:      t.Restart,
+		Ready:        t.Ready,
+		Src:          t.resolvePath(t.Src),
+		Engine:       t.Engine,
+		Image:        expandRaid(t.Image),
+		Container:    expandRaid(t.Container),
+		Ports:        expandRaidAll(t.Ports),
+		Volumes:      expandRaidAll(t.Volumes),
+		Env:          expandRaidMap(t.Env),
+		Format:       expandRaid(t.Format),
+		Strip:        t.Strip,
+		Include:      expandRaidAll(t.Include),
+		File:         t.resolvePath(t.File),
+		// Edits are expanded by execConfigEdit, which honours literal.
+		Edits:        t.Edits,
+		Line:         expandRaid(t.Line),
+		Block:        expandRaid(t.Block),
+		Marker:       t.Marker,
+		Ref:          t.Ref,
+		Parallel:     t.Parallel,
+		Command:      expandRaid(t.Command),
+		Repo:         expandRaid(t.Repo),
+		Flags:        t.Flags,
+		Args:         expandRaidAll(t.Args),
+		Op:           t.Op,
+		Branch:       expandRaid(t.Branch),
+		Message:      expandRaid(t.Message),
+		Var:          t.Var,
+		Default:      expandRaid(t.Default),
+		Secret:       t.Secret,
+		Choices:      expandRaidAll(t.Choices),
+		ChoicesCmd:   expandRaidForShell(t.ChoicesCmd),
+		Pattern:      t.Pattern,
+		Multi:        t.Multi,
+		ValueType:    t.ValueType,
+		Value:        expandRaid(t.Value),
+		Scope:        t.Scope,
+		Color:        t.Color,
+		Attempts:     t.Attempts,
+		Delay:        t.Delay,
+		groupStack:   t.groupStack,
+		runStack:     t.runStack,
+		commandLocks: t.commandLocks,
+		dir:          t.dir,
 	}
 }
 
+// resolvePath expands a path field. A relative path resolves against the
+// command's dir when it has one, and the current directory otherwise.
+func (t Task) resolvePath(p string) string {
+	p = expandRaid(p)
+	if t.dir != "" && p != "" && !filepath.IsAbs(p) && !strings.HasPrefix(p, "~") {
+		p = filepath.Join(t.dir, p)
+	}
+	return sys.ExpandPath(p)
+}
+
 // TaskType identifies which task executor to dispatch to.
 type TaskType string
 
@@ -154,6 +286,14 @@ const (
 	Confirm  TaskType = "confirm"
 	Print    TaskType = "print"
 	SetVar   TaskType = "set"
+	Archive  TaskType = "archive"
+	File     TaskType = "file"
+	// ConfigEdit is spelled as one word so `type: ConfigEdit` matches
+	// after lowercasing.
+	ConfigEdit TaskType = "configedit"
+	Service    TaskType = "service"
+	Container  TaskType = "container"
+	Run        TaskType = "run"
 )
 
 // ToLower returns the task type normalized to lowercase for case-insensitive comparisons.
@@ -2,11 +2,11 @@ package lib
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"hash/fnv"
 	"io"
-	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -18,7 +18,6 @@ import (
 	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
 	"github.com/8bitalex/raid/src/internal/sys"
 	"github.com/8bitalex/raid/src/internal/telemetry"
-	"github.com/joho/godotenv"
 )
 
 // commandStdout and commandStderr are the output writers used by task
@@ -138,6 +137,12 @@ func ExecuteTasks(tasks []Task) error {
 				}
 			}(task)
 		} else {
+			if task.Type == Run {
+				// A Run task swaps the command session and rebinds
+				// RAID_ARG_*, both process-wide, so concurrent peers
+				// still in flight have to finish first.
+				wg.Wait()
+			}
 			if err := ExecuteTask(task); err != nil {
 				if isContinueOnFailure(task) {
 					// Best-effort task — log a warning and keep going.
@@ -199,6 +204,9 @@ func ExecuteTask(task Task) error {
 	if task.Condition != nil && !evaluateCondition(task.Condition) {
 		return nil
 	}
+	if interrupted.Load() {
+		return failedTask(task, liberrs.Cancelled(nil))
+	}
 
 	// Wrap the per-type dispatch with showExeTime timing so the emitted
 	// line covers both happy and failure paths (the user still wants to
@@ -208,12 +216,12 @@ func ExecuteTask(task Task) error {
 		err := dispatchTask(task)
 		emitExeTime(task.Label(), timeNowFn().Sub(start))
 		captureTaskTelemetry(task, err, timeNowFn().Sub(start))
-		return err
+		return failedTask(task, err)
 	}
 	start := timeNowFn()
 	err := dispatchTask(task)
 	captureTaskTelemetry(task, err, timeNowFn().Sub(start))
-	return err
+	return failedTask(task, err)
 }
 
 // captureTaskTelemetry fires the sampled raid_task_executed event.
@@ -262,6 +270,18 @@ func dispatchTask(task Task) error {
 		return execPrint(task)
 	case SetVar:
 		return execSetVar(task)
+	case Archive:
+		return execArchive(task)
+	case File:
+		return execFile(task)
+	case ConfigEdit:
+		return execConfigEdit(task)
+	case Service:
+		return execService(task)
+	case Container:
+		return execContainer(task)
+	case Run:
+		return execRun(task)
 	default:
 		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "invalid task type: %s", task.Type)
 	}
@@ -305,7 +325,7 @@ func execShell(task Task) error {
 		// (e.g. shell-local vars set earlier in the same script) are left as
 		// "$VAR" tokens for the shell to resolve, rather than silently becoming
 		// empty strings.
-		task.Path = sys.ExpandPath(expandRaid(task.Path))
+		task.Path = task.resolvePath(task.Path)
 		task.Shell = expandRaid(task.Shell)
 		task.Cmd = expandRaidForShell(task.Cmd)
 	}
@@ -346,7 +366,7 @@ func execShell(task Task) error {
 	if task.Path != "" {
 		cmd.Dir = sys.ExpandPath(task.Path)
 	}
-	cmd.Env = buildSubprocessEnv()
+	cmd.Env = append(buildSubprocessEnv(), commandLocksEnv(task)...)
 	flush := setCmdOutput(cmd, task)
 	defer flush()
 
@@ -393,10 +413,17 @@ func updateSessionFromEnv(data []byte) {
 	}
 
 	after := parseEnvLines(string(data))
+	// A secret raid var reaches the shell decrypted; its baseline entry is
+	// the ciphertext, so without this the plaintext would be "captured" as
+	// a session export and surface through task expansion.
+	secrets := secretRaidVarNames()
 
 	commandSession.mu.Lock()
 	defer commandSession.mu.Unlock()
 	for k, v := range after {
+		if secrets[k] {
+			continue
+		}
 		baseVal, inBase := commandSession.baseline[k]
 		if !inBase || baseVal != v {
 			commandSession.vars[k] = v
@@ -543,8 +570,9 @@ func execScript(task Task) error {
 	} else {
 		cmd = exec.Command(task.Path)
 	}
+	cmd.Dir = task.dir
 
-	cmd.Env = buildSubprocessEnv()
+	cmd.Env = append(buildSubprocessEnv(), commandLocksEnv(task)...)
 	flush := setCmdOutput(cmd, task)
 	defer flush()
 
@@ -559,17 +587,22 @@ func execScript(task Task) error {
 // setCmdOutput wires a subprocess's stdout/stderr/stdin. For tasks
 // opted into concurrent execution on a TTY sink, the writers are
 // wrapped with per-line prefixers so output stays attributable when
-// peers interleave; the returned cleanup must be deferred to flush
-// any trailing partial line on subprocess exit. For sequential tasks
-// or non-TTY sinks the cleanup is a no-op and writers pass through
-// to commandStdout/commandStderr unchanged — pipes, file redirects,
-// CI logs, and the MCP server's syncBuffer capture all stay
-// byte-identical to today.
+// peers interleave. On top of that (or directly on the sink) sits a
+// redactingWriter whenever there are secret values or `redact:` patterns
+// to mask — see redact.go. The built-in patterns alone don't wrap a
+// terminal sink, where the pipe would cost the subprocess its TTY and
+// delay partial lines; files, out.file tees and MCP captures always get
+// them. The returned cleanup must be deferred to flush any trailing
+// partial line on subprocess exit. With nothing to prefix or redact,
+// writers pass through to commandStdout/commandStderr unchanged.
 func setCmdOutput(cmd *exec.Cmd, task Task) func() {
 	cmd.Stdin = os.Stdin
+	red := newRedactor()
+	redactOut := red != nil && (red.targeted || !isTerminalSinkFn(commandStdout))
+	redactErr := red != nil && (red.targeted || !isTerminalSinkFn(commandStderr))
 	wrapOut := shouldPrefix(task, commandStdout)
 	wrapErr := shouldPrefix(task, commandStderr)
-	if !wrapOut && !wrapErr {
+	if !wrapOut && !wrapErr && !redactOut && !redactErr {
 		cmd.Stdout = commandStdout
 		cmd.Stderr = commandStderr
 		return func() {}
@@ -580,19 +613,33 @@ func setCmdOutput(cmd *exec.Cmd, task Task) func() {
 	}
 	prefix := buildPrefix(task.Label(), color)
 	var out, errW *prefixedWriter
+	cmd.Stdout, cmd.Stderr = commandStdout, commandStderr
 	if wrapOut {
 		out = newPrefixedWriter(commandStdout, prefix)
 		cmd.Stdout = out
-	} else {
-		cmd.Stdout = commandStdout
 	}
 	if wrapErr {
 		errW = newPrefixedWriter(commandStderr, prefix)
 		cmd.Stderr = errW
-	} else {
-		cmd.Stderr = commandStderr
+	}
+	var redOut, redErr *redactingWriter
+	if redactOut {
+		redOut = newRedactingWriter(cmd.Stdout, red)
+		cmd.Stdout = redOut
+	}
+	if redactErr {
+		redErr = newRedactingWriter(cmd.Stderr, red)
+		cmd.Stderr = redErr
 	}
 	return func() {
+		// Redactors first: their held tail still has to pass through the
+		// prefixers before those flush.
+		if redOut != nil {
+			_ = redOut.Flush()
+		}
+		if redErr != nil {
+			_ = redErr.Flush()
+		}
 		if out != nil {
 			_ = out.Flush()
 		}
@@ -636,7 +683,9 @@ func buildSubprocessEnv() []string {
 	}
 	raidVarsMu.RLock()
 	for k, v := range raidVars {
-		if validEnvPair(k, v) {
+		// The one place secret vars are decrypted: children need the real
+		// value, nothing else raid renders does.
+		if v, ok := revealRaidVar(k, v); ok && validEnvPair(k, v) {
 			env = append(env, k+"="+v)
 		}
 	}
@@ -644,6 +693,22 @@ func buildSubprocessEnv() []string {
 	return env
 }
 
+// secretRaidVarNames returns the names of raid vars holding encrypted values.
+func secretRaidVarNames() map[string]bool {
+	raidVarsMu.RLock()
+	defer raidVarsMu.RUnlock()
+	var out map[string]bool
+	for k, v := range raidVars {
+		if isSecretValue(v) {
+			if out == nil {
+				out = make(map[string]bool)
+			}
+			out[k] = true
+		}
+	}
+	return out
+}
+
 // validEnvPair reports whether (key, value) is safe to inject into a
 // subprocess environment. NUL bytes terminate C strings and would corrupt
 // the entry; "=" in the key would be re-split into a different key by
@@ -662,99 +727,82 @@ func validEnvPair(key, value string) bool {
 }
 
 func execHTTP(task Task) error {
+	raw := task
 	task = task.Expand()
 
 	if task.URL == "" {
 		return liberrs.ArgInvalid("url is required for HTTP task")
 	}
-	if task.Dest == "" {
-		return liberrs.ArgInvalid("dest is required for HTTP task")
+	// A GET with nowhere to put the response does nothing; other methods
+	// are called for their side effects and may discard it.
+	method := strings.ToUpper(task.Method)
+	if (method == "" || method == http.MethodGet) && task.Dest == "" && len(task.Capture) == 0 {
+		return liberrs.ArgInvalid("dest or capture is required for HTTP GET task")
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Get(task.URL)
+	mode, err := parseFileMode(string(task.Mode))
 	if err != nil {
-		return liberrs.Newf(liberrs.CodeTaskHTTPFailed, liberrs.CategoryNetwork, "failed to fetch '%s': %v", task.URL, err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return liberrs.Newf(liberrs.CodeTaskHTTPFailed, liberrs.CategoryNetwork, "HTTP request to '%s' returned status %d", task.URL, resp.StatusCode)
+		return err
 	}
-
-	if err := os.MkdirAll(filepath.Dir(task.Dest), 0755); err != nil {
-		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to create directory for '%s': %v", task.Dest, err)
+	client, err := newHTTPClient(task)
+	if err != nil {
+		return err
 	}
-
-	f, err := os.Create(task.Dest)
+	sum, err := resolveChecksum(client, task)
 	if err != nil {
-		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to create file '%s': %v", task.Dest, err)
+		return err
 	}
-	defer f.Close()
-
-	if _, err := io.Copy(f, resp.Body); err != nil {
-		f.Close()
-		os.Remove(task.Dest)
-		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to write to '%s': %v", task.Dest, err)
+	// A download that's already in place with the right digest is left
+	// alone, so re-running install doesn't refetch every pinned binary.
+	if sum != nil && task.Dest != "" && len(task.Capture) == 0 && (method == "" || method == http.MethodGet) &&
+		fileMatchesChecksum(task.Dest, sum) {
+		if mode != 0 {
+			if err := os.Chmod(task.Dest, mode); err != nil {
+				return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to set mode on '%s': %v", task.Dest, err)
+			}
+		}
+		return nil
 	}
 
-	return nil
-}
-
-func execWait(task Task) error {
-	task = task.Expand()
-
-	if task.URL == "" {
-		return liberrs.ArgInvalid("url is required for Wait task")
+	req, err := newHTTPRequest(raw, task)
+	if err != nil {
+		return err
 	}
-
-	timeout := 30 * time.Second
-	if task.Timeout != "" {
-		d, err := time.ParseDuration(task.Timeout)
-		if err != nil {
-			return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid timeout '%s': %v", task.Timeout, err)
-		}
-		timeout = d
+	resp, err := client.Do(req)
+	if err != nil {
+		return liberrs.Newf(liberrs.CodeTaskHTTPFailed, liberrs.CategoryNetwork, "failed to fetch '%s': %v", task.URL, redactString(err.Error()))
 	}
+	defer resp.Body.Close()
 
-	lockedFprintf(commandStdout, "Waiting for %s (timeout: %s)...\n", task.URL, timeout)
-
-	check := checkHTTP
-	if !strings.HasPrefix(task.URL, "http://") && !strings.HasPrefix(task.URL, "https://") {
-		check = checkTCP
+	if err := checkHTTPStatus(task, resp); err != nil {
+		return err
 	}
 
-	deadline := time.Now().Add(timeout)
-	for time.Now().Before(deadline) {
-		if check(task.URL) == nil {
+	if len(task.Capture) == 0 {
+		if task.Dest == "" {
+			_, _ = io.Copy(io.Discard, resp.Body)
 			return nil
 		}
-		time.Sleep(1 * time.Second)
+		return writeFileAtomic(task.Dest, resp.Body, sum, mode)
 	}
 
-	return liberrs.Newf(liberrs.CodeTaskWaitTimeout, liberrs.CategoryTask, "timed out waiting for '%s' after %s", task.URL, timeout)
-}
-
-func checkHTTP(url string) error {
-	client := &http.Client{Timeout: 2 * time.Second}
-	resp, err := client.Get(url)
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return liberrs.Newf(liberrs.CodeTaskHTTPFailed, liberrs.CategoryNetwork, "failed to read response from '%s': %v", task.URL, err)
 	}
-	resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return liberrs.Newf(liberrs.CodeTaskHTTPFailed, liberrs.CategoryNetwork, "HTTP %d", resp.StatusCode)
+	if sum != nil {
+		h := sum.new()
+		h.Write(body)
+		if err := sum.verify(h.Sum(nil), task.URL); err != nil {
+			return err
+		}
 	}
-	return nil
-}
-
-func checkTCP(address string) error {
-	conn, err := net.DialTimeout("tcp", address, 2*time.Second)
-	if err != nil {
-		return err
+	if task.Dest != "" {
+		if err := writeFileAtomic(task.Dest, bytes.NewReader(body), nil, mode); err != nil {
+			return err
+		}
 	}
-	conn.Close()
-	return nil
+	return storeHTTPCaptures(task, body)
 }
 
 func execTemplate(task Task) error {
@@ -766,6 +814,10 @@ func execTemplate(task Task) error {
 	if task.Dest == "" {
 		return liberrs.ArgInvalid("dest is required for Template task")
 	}
+	engine, err := templateEngine(task.Engine)
+	if err != nil {
+		return err
+	}
 
 	if !sys.FileExists(task.Src) {
 		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "template file does not exist: %s", task.Src)
@@ -776,7 +828,14 @@ func execTemplate(task Task) error {
 		return liberrs.Newf(liberrs.CodeTaskTemplateFailed, liberrs.CategoryTask, "failed to read template '%s': %v", task.Src, err)
 	}
 
-	rendered := expandRaid(string(data))
+	var rendered string
+	if engine == templateEngineGo {
+		if rendered, err = renderGoTemplate(task.Src, string(data)); err != nil {
+			return err
+		}
+	} else {
+		rendered = expandRaid(string(data))
+	}
 
 	if err := os.MkdirAll(filepath.Dir(task.Dest), 0755); err != nil {
 		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to create directory for '%s': %v", task.Dest, err)
@@ -820,6 +879,9 @@ func execGroup(task Task) error {
 	children := make([]Task, len(tasks))
 	for i, t := range tasks {
 		t.groupStack = stack
+		t.runStack = task.runStack
+		t.commandLocks = task.commandLocks
+		t.dir = task.dir
 		if task.Parallel {
 			t.Concurrent = true
 		}
@@ -846,8 +908,13 @@ func execGroupWithRetry(tasks []Task, attempts int, delayStr string) error {
 	var lastErr error
 	for i := 0; i < attempts; i++ {
 		if i > 0 {
+			if err := checkInterrupted(); err != nil {
+				return err
+			}
 			lockedFprintf(commandStdout, "Retrying... (attempt %d/%d)\n", i+1, attempts)
-			time.Sleep(delay)
+			if err := sleepInterruptible(delay); err != nil {
+				return err
+			}
 		}
 		if err := ExecuteTasks(tasks); err != nil {
 			lastErr = err
@@ -929,24 +996,40 @@ func execPrompt(task Task) error {
 	if !task.Literal {
 		task.Message = expandRaid(task.Message)
 		task.Default = expandRaid(task.Default)
+		task.Choices = expandRaidAll(task.Choices)
+		task.ChoicesCmd = expandRaidForShell(task.ChoicesCmd)
+	}
+
+	spec, err := newPromptSpec(task)
+	if err != nil {
+		return err
 	}
 
 	// Headless mode: skip stdin entirely. Use the declared default if
 	// present; otherwise fail fast with a structured error. We refuse
 	// to set the variable to "" silently because callers downstream
-	// would silently misbehave on the missing value.
+	// would silently misbehave on the missing value. The default goes
+	// through the same choices / pattern / valueType checks as typed
+	// input, so a stale default fails here rather than downstream.
 	if IsHeadless() {
 		if task.Default == "" {
 			return liberrs.HeadlessPromptNoDefault(task.Var)
 		}
-		os.Setenv(task.Var, task.Default)
-		return nil
+		value, err := spec.parse(task.Default)
+		if err != nil {
+			return liberrs.ArgInvalid(fmt.Sprintf("Prompt %s: default is invalid: %v", task.Var, err))
+		}
+		return storePromptValue(task, value)
 	}
 
 	message := task.Message
 	if message == "" {
 		message = fmt.Sprintf("Enter value for %s:", task.Var)
 	}
+	banner := message + " "
+	if len(spec.choices) > 0 {
+		banner = message + "\n" + spec.menu() + spec.ask() + " "
+	}
 
 	stdinMu.Lock()
 	defer stdinMu.Unlock()
@@ -957,22 +1040,48 @@ func execPrompt(task Task) error {
 	// interactive prompts) so `out: {stdout: false}` or a plain shell
 	// redirect can't swallow it and leave the CLI blocked invisibly
 	// on stdin.
-	lockedFprint(commandStderr, message+" ")
+	//
+	// An answer that fails validation re-prompts with the reason until
+	// one passes or stdin runs out.
+	for {
+		lockedFprint(commandStderr, banner)
 
-	value, err := getStdinReader().ReadString('\n')
-	if err != nil {
-		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to read input: %v", err)
+		input, err := readPromptInput(task.Secret)
+		if err != nil {
+			return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to read input: %v", err)
+		}
+		if input == "" && task.Default != "" {
+			input = task.Default
+		}
+		value, err := spec.parse(input)
+		if err == nil {
+			return storePromptValue(task, value)
+		}
+		lockedFprintf(commandStderr, "%v, try again.\n", err)
+		// The menu was shown once; repeat only the short prompt.
+		if len(spec.choices) > 0 {
+			banner = spec.ask() + " "
+		}
 	}
-	value = strings.TrimRight(value, "\r\n")
+}
 
-	if value == "" && task.Default != "" {
-		value = task.Default
+// storePromptValue records a Prompt answer: secret answers as an
+// encrypted session var, everything else in the process env as before.
+func storePromptValue(task Task, value string) error {
+	if task.Secret {
+		return storeSecretPrompt(task.Var, value)
 	}
-
 	os.Setenv(task.Var, value)
 	return nil
 }
 
+// storeSecretPrompt keeps a `secret: true` Prompt answer as an encrypted
+// session var instead of exporting it into raid's own process env, where
+// task expansion and Print would render it in the clear.
+func storeSecretPrompt(name, value string) error {
+	return storeSessionVar(name, value, true, "Prompt task")
+}
+
 func execConfirm(task Task) error {
 	// Headless mode auto-accepts every Confirm. This is the documented
 	// trade-off for CI / agent invocations — destructive guards must be
@@ -1017,6 +1126,7 @@ func execPrint(task Task) error {
 	if !task.Literal {
 		msg = expandRaid(msg)
 	}
+	msg = redactString(msg)
 
 	// Wrapped output locks per-line inside prefixedWriter.Write; the
 	// unwrapped path must go through lockedFprintf so a Print can't land
@@ -1060,84 +1170,44 @@ func execSetVar(task Task) error {
 	task = task.Expand()
 	task.Var = strings.ToUpper(task.Var)
 
-	// Reject names that would corrupt the vars file or be silently
-	// dropped from subprocess envs. '=' splits into a different key on
-	// godotenv re-read (the in-memory entry then diverges from what was
-	// persisted), and NUL/newline/'#'/quotes/whitespace break either the
-	// dotenv round-trip or the exec env-block encoding.
-	if !validEnvPair(task.Var, task.Value) || strings.ContainsAny(task.Var, " \t\n\r\"'#") {
-		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid var name %q for Set task: must not contain '=', whitespace, quotes, or '#'", task.Var)
+	if err := validateRaidVar(task.Var, task.Value, "Set task"); err != nil {
+		return err
+	}
+	value := task.Value
+	if task.Secret {
+		enc, err := encryptSecret(value)
+		if err != nil {
+			return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to encrypt %s: %v", task.Var, err)
+		}
+		value = enc
 	}
 
-	path := raidVarsPath()
-
-	// Serialize access to the shared vars file to avoid lost updates when
+	// Serialize access to the shared vars files to avoid lost updates when
 	// multiple Set tasks run concurrently.
 	raidVarsMu.Lock()
 	defer raidVarsMu.Unlock()
 
-	f, err := sys.CreateFile(path)
+	scope, err := resolveVarScopeLocked(VarScope(strings.ToLower(task.Scope)))
 	if err != nil {
-		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to create vars file: %v", err)
-	}
-	if err := f.Close(); err != nil {
-		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to close vars file: %v", err)
-	}
-
-	m, err := godotenv.Read(path)
-	if err != nil {
-		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to read vars file: %v", err)
-	}
-	m[task.Var] = task.Value
-
-	// Write updated vars atomically: write to a temporary file in the same
-	// directory and then rename it over the original.
-	dir := filepath.Dir(path)
-	tmpFile, err := os.CreateTemp(dir, ".raid-vars-*")
-	if err != nil {
-		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to create temp vars file: %v", err)
-	}
-	tmpName := tmpFile.Name()
-	// Ensure the temp file is removed if we hit an error before a successful rename.
-	defer os.Remove(tmpName)
-
-	if err := tmpFile.Close(); err != nil {
-		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to close temp vars file: %v", err)
-	}
-
-	if err := godotenv.Write(m, tmpName); err != nil {
-		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to write temp vars file: %v", err)
-	}
-
-	// Tighten perms BEFORE the rename so the final file lands at 0600
-	// atomically — godotenv.Write defaults to 0644 (world-readable),
-	// which is wrong for a file that holds raid vars (RAID_REPO_*_URL
-	// can be a clone URL, and user-defined Set values can be anything
-	// the project author treats as secret-ish). Chmod on the tempfile
-	// path: if it fails we abort before rename so we never leave a
-	// 0644 vars file on disk.
-	if err := os.Chmod(tmpName, 0600); err != nil {
-		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to set vars file permissions: %v", err)
+		return err
 	}
-
-	if err := os.Rename(tmpName, path); err != nil {
-		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "failed to replace vars file: %v", err)
+	if err := storeRaidVarLocked(task.Var, value, scope); err != nil {
+		return liberrs.Newf(liberrs.CodeTaskFailed, liberrs.CategoryTask, "%v", err)
 	}
-
-	raidVars[task.Var] = task.Value
 	return nil
 }
 
-// withDefaultDir returns a copy of tasks with path set to dir on any Shell task
-// that does not already have an explicit path. Used to apply profile-level (home)
-// and repository-level (repo path) defaults without modifying the original slice.
+// withDefaultDir returns a copy of tasks with path set to dir on any Shell,
+// Service or Container task that does not already have an explicit path.
+// Used to apply profile-level (home) and repository-level (repo path)
+// defaults without modifying the original slice.
 func withDefaultDir(tasks []Task, dir string) []Task {
 	if dir == "" || len(tasks) == 0 {
 		return tasks
 	}
 	result := make([]Task, len(tasks))
 	for i, t := range tasks {
-		if t.Type.ToLower() == Shell && t.Path == "" {
+		if typ := t.Type.ToLower(); (typ == Shell || typ == Service || typ == Container) && t.Path == "" {
 			t.Path = dir
 		}
 		result[i] = t
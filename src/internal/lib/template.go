@@ -0,0 +1,144 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+	"github.com/8bitalex/raid/src/internal/sys"
+)
+
+// Template engines. The default substitutes $VAR and ${VAR}; "go" renders
+// the file with text/template against templateData.
+const (
+	templateEngineEnv = "env"
+	templateEngineGo  = "go"
+)
+
+// templateData is the model a `engine: go` template renders against.
+type templateData struct {
+	// Env is the active environment's name, empty when none is set.
+	Env string
+	// Vars holds raid variables. Secret values are masked.
+	Vars     map[string]string
+	Profile  templateProfile
+	Repos    []templateRepo
+	Platform string
+	// Args holds the running command's args: named args and flags under
+	// their declared names, positional args under "1", "2", ...
+	Args map[string]string
+}
+
+type templateProfile struct {
+	Name string
+	Path string
+}
+
+type templateRepo struct {
+	Name   string
+	Path   string
+	URL    string
+	Branch string
+}
+
+// newTemplateData snapshots the current profile, vars, and command args.
+func newTemplateData() templateData {
+	data := templateData{
+		Env:      GetEnv(),
+		Vars:     snapshotRaidVars(),
+		Platform: string(sys.GetPlatform()),
+		Args:     snapshotCommandArgs(),
+	}
+	if ctx := loadContext(); ctx != nil {
+		data.Profile = templateProfile{Name: ctx.Profile.Name, Path: ctx.Profile.Path}
+		for _, r := range ctx.Profile.Repositories {
+			data.Repos = append(data.Repos, templateRepo{
+				Name:   r.Name,
+				Path:   sys.ExpandPath(r.Path),
+				URL:    r.URL,
+				Branch: r.Branch,
+			})
+		}
+	}
+	return data
+}
+
+// templateFuncs are the helpers available to `engine: go` templates.
+var templateFuncs = template.FuncMap{
+	"default": func(def, v any) any {
+		if isEmptyTemplateValue(v) {
+			return def
+		}
+		return v
+	},
+	"required": func(msg string, v any) (any, error) {
+		if isEmptyTemplateValue(v) {
+			return nil, errors.New(msg)
+		}
+		return v, nil
+	},
+	"toJSON": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"indent": func(n int, s string) string {
+		pad := strings.Repeat(" ", n)
+		return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+	},
+	"env": func(name string) string {
+		v, _ := lookupRaidVar(name)
+		return v
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// isEmptyTemplateValue reports whether v is nil or its type's zero value,
+// or an empty slice or map.
+func isEmptyTemplateValue(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
+
+// renderGoTemplate renders src with text/template. Parse and execution
+// errors carry the file name and line, e.g. "app.tmpl:3: unexpected ...".
+func renderGoTemplate(src string, text string) (string, error) {
+	tmpl, err := template.New(filepath.Base(src)).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", liberrs.Newf(liberrs.CodeTaskTemplateFailed, liberrs.CategoryTask, "failed to parse template %s", trimTemplateErr(err))
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, newTemplateData()); err != nil {
+		return "", liberrs.Newf(liberrs.CodeTaskTemplateFailed, liberrs.CategoryTask, "failed to render template %s", trimTemplateErr(err))
+	}
+	return buf.String(), nil
+}
+
+// trimTemplateErr drops text/template's "template: " prefix, leaving the
+// "name:line:" location first.
+func trimTemplateErr(err error) string {
+	return strings.TrimPrefix(err.Error(), "template: ")
+}
+
+// templateEngine normalizes `engine:`, defaulting to $VAR substitution.
+func templateEngine(engine string) (string, error) {
+	switch strings.ToLower(engine) {
+	case "", templateEngineEnv:
+		return templateEngineEnv, nil
+	case templateEngineGo:
+		return templateEngineGo, nil
+	}
+	return "", liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid template engine '%s' (supported: env, go)", engine)
+}
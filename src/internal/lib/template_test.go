@@ -0,0 +1,107 @@
+package lib
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+)
+
+func writeTemplate(t *testing.T, body string) (src, dest string) {
+	t.Helper()
+	dir := t.TempDir()
+	src = filepath.Join(dir, "app.tmpl")
+	if err := os.WriteFile(src, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return src, filepath.Join(dir, "out", "app.txt")
+}
+
+func TestExecuteTask_templateGoEngine(t *testing.T) {
+	withRaidVar(t, "REGION", "eu-west-1")
+	old := loadContext()
+	t.Cleanup(func() { storeContext(old) })
+	storeContext(&Context{Profile: Profile{Name: "acme", Repositories: []Repo{
+		{Name: "api", Path: "/src/api", URL: "git@x:api.git", Branch: "main"},
+		{Name: "web", Path: "/src/web", URL: "git@x:web.git"},
+	}}})
+
+	src, dest := writeTemplate(t, `profile: {{ .Profile.Name | upper }}
+region: {{ .Vars.REGION }} {{ env "REGION" | lower }}
+{{- range .Repos }}
+{{ .Name }}: {{ .Path }} ({{ .Branch | default "develop" }})
+{{- end }}
+name: {{ toJSON .Profile.Name }}
+{{ indent 2 "a\nb" }}
+`)
+	if err := ExecuteTask(Task{Type: Template, Engine: "go", Src: src, Dest: dest}); err != nil {
+		t.Fatalf("ExecuteTask() error: %v", err)
+	}
+	want := "profile: ACME\nregion: eu-west-1 eu-west-1\napi: /src/api (main)\nweb: /src/web (develop)\nname: \"acme\"\n  a\n  b\n"
+	if got, _ := os.ReadFile(dest); string(got) != want {
+		t.Errorf("output =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExecuteTask_templateGoEngineErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		engine string
+		code   string
+		where  string
+	}{
+		{"parse error", "ok\n{{ end }}\n", "go", liberrs.CodeTaskTemplateFailed, "app.tmpl:2:"},
+		{"required", "a\nb {{ required \"token is required\" .Vars.MISSING_TOKEN }}\n", "go", liberrs.CodeTaskTemplateFailed, "token is required"},
+		{"unknown field", "{{ .Nope }}", "go", liberrs.CodeTaskTemplateFailed, "app.tmpl:1:"},
+		{"bad engine", "x", "jinja", liberrs.CodeArgInvalid, "jinja"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dest := writeTemplate(t, tt.body)
+			err := ExecuteTask(Task{Type: Template, Engine: tt.engine, Src: src, Dest: dest})
+			if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != tt.code || !strings.Contains(err.Error(), tt.where) {
+				t.Fatalf("error = %v, want %s mentioning %q", err, tt.code, tt.where)
+			}
+			if _, err := os.Stat(dest); !os.IsNotExist(err) {
+				t.Error("dest written despite the error")
+			}
+		})
+	}
+}
+
+func TestExecuteTask_templateEnvEngineKeepsGoSyntax(t *testing.T) {
+	withRaidVar(t, "NAME", "raid")
+	src, dest := writeTemplate(t, "{{ .Name }} $NAME")
+	if err := ExecuteTask(Task{Type: Template, Src: src, Dest: dest}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != "{{ .Name }} raid" {
+		t.Errorf("output = %q", got)
+	}
+}
+
+func TestExecuteCommand_templateGoEngineArgs(t *testing.T) {
+	setupTestConfig(t)
+	origOut, origErr := commandStdout, commandStderr
+	commandStdout, commandStderr = io.Discard, io.Discard
+	t.Cleanup(func() { commandStdout = origOut; commandStderr = origErr })
+
+	src, dest := writeTemplate(t, `{{ index .Args "1" }} {{ index .Args "service-name" }}`)
+	storeContext(&Context{Profile: Profile{Commands: []Command{{Name: "gen", Tasks: []Task{
+		{Type: Template, Engine: "go", Src: src, Dest: dest},
+	}}}}})
+
+	if err := ExecuteCommand("gen", []string{"first"}, map[string]string{"service-name": "api"}); err != nil {
+		t.Fatalf("ExecuteCommand() error: %v", err)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != "first api" {
+		t.Errorf("output = %q, want %q", got, "first api")
+	}
+	if args := snapshotCommandArgs(); len(args) != 0 {
+		t.Errorf("command args leaked after run: %v", args)
+	}
+}
@@ -0,0 +1,416 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+	sys "github.com/8bitalex/raid/src/internal/sys"
+	"github.com/joho/godotenv"
+)
+
+// repoVarPrefix marks the RAID_REPO_<NAME>_{URL,PATH,BRANCH} vars seeded
+// by setRepoVars. They're derived from the profile on every load, so the
+// vars API reports them as repo metadata and refuses to edit them.
+const repoVarPrefix = "RAID_REPO_"
+
+// VarScope selects which store a Set task or `raid vars set` writes to.
+type VarScope string
+
+const (
+	// VarScopeGlobal is ~/.raid/vars, visible to every profile.
+	VarScopeGlobal VarScope = "global"
+	// VarScopeProfile is ~/.raid/vars.d/<profile>, visible only while that
+	// profile is active. The default when a profile is loaded.
+	VarScopeProfile VarScope = "profile"
+	// VarScopeSession keeps the value in memory for the rest of the current
+	// run and never writes it to disk.
+	VarScopeSession VarScope = "session"
+)
+
+// VarSource identifies where a variable's effective value comes from.
+type VarSource string
+
+const (
+	// VarSourceGlobal is a value stored in the global vars file.
+	VarSourceGlobal VarSource = "global"
+	// VarSourceProfile is a value stored in the active profile's vars file.
+	VarSourceProfile VarSource = "profile"
+	// VarSourceSession is an in-memory value from a `scope: session` Set.
+	VarSourceSession VarSource = "session"
+	// VarSourceRepo is a RAID_REPO_* value derived from the active
+	// profile's repository metadata.
+	VarSourceRepo VarSource = "repo"
+	// VarSourceEnv is a value inherited from the process environment.
+	VarSourceEnv VarSource = "env"
+)
+
+// VarEntry is one variable as raid resolves it. ShadowsEnv reports that a
+// process env var of the same name exists but is overridden by the raid
+// value — the usual answer to "why doesn't my export take effect?". Secret
+// entries are stored encrypted and carry a masked Value.
+type VarEntry struct {
+	Name       string    `json:"name"`
+	Value      string    `json:"value"`
+	Source     VarSource `json:"source"`
+	Secret     bool      `json:"secret,omitempty"`
+	ShadowsEnv bool      `json:"shadowsEnv,omitempty"`
+}
+
+// ListVars returns every raid var — persisted, session, and repo
+// metadata — sorted by name. Process env vars aren't listed; use GetVar
+// to resolve a single name through the full lookup chain.
+func ListVars() []VarEntry {
+	raidVarsMu.RLock()
+	defer raidVarsMu.RUnlock()
+	out := make([]VarEntry, 0, len(raidVars))
+	for k, v := range raidVars {
+		out = append(out, raidVarEntry(k, v))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// GetVar resolves name the way task expansion does outside a command
+// (raid vars first, then the process environment) and reports where the
+// value came from. An env value is masked when its name looks secret and
+// redacted otherwise, as it would be in task output.
+func GetVar(name string) (VarEntry, error) {
+	if e, err := GetRaidVar(name); err == nil {
+		return e, nil
+	}
+	if v, ok := os.LookupEnv(name); ok {
+		if isSecretName(name) {
+			v = maskedValue
+		} else {
+			v = redactString(v)
+		}
+		return VarEntry{Name: name, Value: v, Source: VarSourceEnv}, nil
+	}
+	return VarEntry{}, liberrs.VarNotFound(name)
+}
+
+// GetRaidVar is GetVar without the process environment: only raid's own
+// variables are looked up.
+func GetRaidVar(name string) (VarEntry, error) {
+	raidVarsMu.RLock()
+	defer raidVarsMu.RUnlock()
+	v, ok := raidVars[strings.ToUpper(name)]
+	if !ok {
+		return VarEntry{}, liberrs.VarNotFound(name)
+	}
+	return raidVarEntry(strings.ToUpper(name), v), nil
+}
+
+// PersistVar stores name=value in scope with the same validation and
+// atomic write a Set task uses, and returns the resulting entry. Names are
+// uppercased. An empty scope picks the default: the active profile's file,
+// or the global file when no profile is loaded. A secret value is
+// encrypted before it's stored, as with `secret: true` on a Set task.
+func PersistVar(name, value string, scope VarScope, secret bool) (VarEntry, error) {
+	name = strings.ToUpper(name)
+	if err := validateRaidVar(name, value, "raid vars set"); err != nil {
+		return VarEntry{}, err
+	}
+	if err := rejectRepoVar(name); err != nil {
+		return VarEntry{}, err
+	}
+	if secret {
+		enc, err := encryptSecret(value)
+		if err != nil {
+			return VarEntry{}, liberrs.Unknown(err)
+		}
+		value = enc
+	}
+
+	raidVarsMu.Lock()
+	defer raidVarsMu.Unlock()
+	scope, err := resolveVarScopeLocked(scope)
+	if err != nil {
+		return VarEntry{}, err
+	}
+	if err := storeRaidVarLocked(name, value, scope); err != nil {
+		return VarEntry{}, liberrs.Unknown(err)
+	}
+	return VarEntry{Name: name, Value: maskRaidVar(value), Source: VarSource(scope), Secret: secret}, nil
+}
+
+// UnsetVar removes name from scope. An empty scope removes it from
+// wherever its effective value lives. Returns VAR_NOT_FOUND when the scope
+// doesn't hold name — including when it only exists in the process env,
+// which raid can't remove. Unsetting a profile value exposes a global one
+// of the same name, if any.
+func UnsetVar(name string, scope VarScope) error {
+	name = strings.ToUpper(name)
+	if err := rejectRepoVar(name); err != nil {
+		return err
+	}
+
+	raidVarsMu.Lock()
+	defer raidVarsMu.Unlock()
+	if scope == "" {
+		held, ok := raidVarScopes[name]
+		if !ok {
+			return liberrs.VarNotFound(name)
+		}
+		scope = held
+	}
+	scope, err := resolveVarScopeLocked(scope)
+	if err != nil {
+		return err
+	}
+	if scope == VarScopeSession {
+		if raidVarScopes[name] != VarScopeSession {
+			return liberrs.VarNotFound(name)
+		}
+		delete(raidVars, name)
+		delete(raidVarScopes, name)
+		refreshPersistedVarsLocked()
+		return nil
+	}
+
+	found := false
+	err = rewriteVarsFile(varsFileLocked(scope), func(m map[string]string) {
+		if _, ok := m[name]; ok {
+			found = true
+			delete(m, name)
+		}
+	})
+	if err != nil {
+		return liberrs.Unknown(err)
+	}
+	if !found {
+		return liberrs.VarNotFound(name)
+	}
+	refreshPersistedVarsLocked()
+	return nil
+}
+
+// ClearVars removes every var in scope and returns how many were removed.
+// An empty scope means the default scope, as for PersistVar. Repo
+// metadata vars are unaffected; they're rebuilt from the profile on the
+// next load regardless.
+func ClearVars(scope VarScope) (int, error) {
+	raidVarsMu.Lock()
+	defer raidVarsMu.Unlock()
+	scope, err := resolveVarScopeLocked(scope)
+	if err != nil {
+		return 0, err
+	}
+	if scope == VarScopeSession {
+		removed := 0
+		for k, sc := range raidVarScopes {
+			if sc == VarScopeSession {
+				delete(raidVars, k)
+				delete(raidVarScopes, k)
+				removed++
+			}
+		}
+		refreshPersistedVarsLocked()
+		return removed, nil
+	}
+
+	removed := 0
+	err = rewriteVarsFile(varsFileLocked(scope), func(m map[string]string) {
+		for k := range m {
+			removed++
+			delete(m, k)
+		}
+	})
+	if err != nil {
+		return 0, liberrs.Unknown(err)
+	}
+	refreshPersistedVarsLocked()
+	return removed, nil
+}
+
+// resolveVarScopeLocked validates scope and fills in the default for an
+// empty one. Callers must hold raidVarsMu.
+func resolveVarScopeLocked(scope VarScope) (VarScope, error) {
+	switch scope {
+	case "":
+		if raidVarsProfile != "" {
+			return VarScopeProfile, nil
+		}
+		return VarScopeGlobal, nil
+	case VarScopeGlobal, VarScopeSession:
+		return scope, nil
+	case VarScopeProfile:
+		if raidVarsProfile == "" {
+			return "", liberrs.ArgInvalid("scope 'profile' needs an active profile; run `raid profile use <name>` or use scope 'global'")
+		}
+		return scope, nil
+	default:
+		return "", liberrs.ArgInvalid(fmt.Sprintf("invalid var scope %q: must be global, profile, or session", scope))
+	}
+}
+
+// varsFileLocked returns the file backing a persisted scope. Callers must
+// hold raidVarsMu and have resolved scope to global or profile.
+func varsFileLocked(scope VarScope) string {
+	if scope == VarScopeProfile {
+		return profileVarsPath(raidVarsProfile)
+	}
+	return raidVarsPath()
+}
+
+// storeRaidVarLocked records name=value in scope: a session value goes
+// straight into raidVars, a persisted one is written to its file and the
+// in-memory view re-derived so scope precedence holds — a global write
+// doesn't displace a profile value of the same name. Callers must hold
+// raidVarsMu and have resolved scope.
+func storeRaidVarLocked(name, value string, scope VarScope) error {
+	if scope == VarScopeSession {
+		raidVars[name] = value
+		raidVarScopes[name] = VarScopeSession
+		return nil
+	}
+	if err := rewriteVarsFile(varsFileLocked(scope), func(m map[string]string) { m[name] = value }); err != nil {
+		return err
+	}
+	refreshPersistedVarsLocked()
+	return nil
+}
+
+// refreshPersistedVarsLocked re-reads the global and profile vars files
+// into raidVars, replacing the previously loaded persisted entries. Session
+// values outrank both and are left alone. Callers must hold raidVarsMu.
+func refreshPersistedVarsLocked() {
+	for k, sc := range raidVarScopes {
+		if sc != VarScopeSession {
+			delete(raidVars, k)
+			delete(raidVarScopes, k)
+		}
+	}
+	var scoped map[string]string
+	if path := profileVarsPath(raidVarsProfile); path != "" {
+		scoped = readVarsFile(path)
+	}
+	applyPersistedVarsLocked(readVarsFile(raidVarsPath()), scoped)
+}
+
+// applyPersistedVarsLocked merges the global and then the profile vars into
+// raidVars, so a profile value overrides a global one. Names already held
+// by a session value are skipped. Callers must hold raidVarsMu.
+func applyPersistedVarsLocked(global, profile map[string]string) {
+	apply := func(m map[string]string, scope VarScope) {
+		for k, v := range m {
+			k = strings.ToUpper(k)
+			if raidVarScopes[k] == VarScopeSession {
+				continue
+			}
+			raidVars[k] = v
+			raidVarScopes[k] = scope
+		}
+	}
+	apply(global, VarScopeGlobal)
+	apply(profile, VarScopeProfile)
+}
+
+// raidVarEntry describes a raidVars entry. Callers must hold raidVarsMu.
+func raidVarEntry(name, value string) VarEntry {
+	e := VarEntry{Name: name, Value: maskRaidVar(value), Source: VarSourceGlobal, Secret: isSecretValue(value)}
+	if sc, ok := raidVarScopes[name]; ok {
+		e.Source = VarSource(sc)
+	} else if strings.HasPrefix(name, repoVarPrefix) {
+		e.Source = VarSourceRepo
+	}
+	if _, ok := os.LookupEnv(name); ok {
+		e.ShadowsEnv = true
+	}
+	return e
+}
+
+func rejectRepoVar(name string) error {
+	if strings.HasPrefix(name, repoVarPrefix) {
+		return liberrs.ArgInvalid(fmt.Sprintf("%s is derived from the profile's repositories and can't be edited; change the repository entry instead", name))
+	}
+	return nil
+}
+
+// validateRaidVar rejects names that would corrupt the vars file or be
+// silently dropped from subprocess envs. '=' splits into a different key
+// on godotenv re-read (the in-memory entry then diverges from what was
+// persisted), and NUL/newline/'#'/quotes/whitespace break either the
+// dotenv round-trip or the exec env-block encoding. caller names the
+// entry point in the error message.
+func validateRaidVar(name, value, caller string) error {
+	if !validEnvPair(name, value) || strings.ContainsAny(name, " \t\n\r\"'#") {
+		return liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid var name %q for %s: must not contain '=', whitespace, quotes, or '#'", name, caller)
+	}
+	return nil
+}
+
+// rewriteVarsFile applies mutate to the vars persisted at path and writes
+// the result back atomically: a temp file in the same directory, tightened to
+// 0600, then renamed over the original. Callers must hold raidVarsMu so
+// concurrent writers don't lose updates, and are responsible for keeping
+// the in-memory raidVars map in step.
+func rewriteVarsFile(path string, mutate func(map[string]string)) error {
+	f, err := sys.CreateFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to create vars file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close vars file: %w", err)
+	}
+
+	m, err := godotenv.Read(path)
+	if err != nil {
+		return fmt.Errorf("failed to read vars file: %w", err)
+	}
+	mutate(m)
+
+	dir := filepath.Dir(path)
+	tmpFile, err := os.CreateTemp(dir, ".raid-vars-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp vars file: %w", err)
+	}
+	tmpName := tmpFile.Name()
+	// Ensure the temp file is removed if we hit an error before a successful rename.
+	defer os.Remove(tmpName)
+
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temp vars file: %w", err)
+	}
+
+	if err := godotenv.Write(m, tmpName); err != nil {
+		return fmt.Errorf("failed to write temp vars file: %w", err)
+	}
+
+	// Tighten perms BEFORE the rename so the final file lands at 0600
+	// atomically — godotenv.Write defaults to 0644 (world-readable),
+	// which is wrong for a file that holds raid vars (RAID_REPO_*_URL
+	// can be a clone URL, and user-defined Set values can be anything
+	// the project author treats as secret-ish). Chmod on the tempfile
+	// path: if it fails we abort before rename so we never leave a
+	// 0644 vars file on disk.
+	if err := os.Chmod(tmpName, 0600); err != nil {
+		return fmt.Errorf("failed to set vars file permissions: %w", err)
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("failed to replace vars file: %w", err)
+	}
+	return nil
+}
+
+// SetVarsPathForTest redirects the global vars file to path — and the
+// per-profile files to vars.d/ beside it — and starts from an empty
+// in-memory var set with no profile loaded for the duration of a test. Returns a restore
+// function to defer. Lets tests outside lib exercise the vars API without
+// touching the developer's real ~/.raid/vars.
+func SetVarsPathForTest(path string) func() {
+	raidVarsMu.Lock()
+	prevPath, prevVars, prevScopes, prevProfile := raidVarsOverridePath, raidVars, raidVarScopes, raidVarsProfile
+	raidVarsOverridePath, raidVars, raidVarScopes, raidVarsProfile = path, map[string]string{}, map[string]VarScope{}, ""
+	raidVarsMu.Unlock()
+	return func() {
+		raidVarsMu.Lock()
+		raidVarsOverridePath, raidVars, raidVarScopes, raidVarsProfile = prevPath, prevVars, prevScopes, prevProfile
+		raidVarsMu.Unlock()
+	}
+}
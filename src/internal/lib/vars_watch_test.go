@@ -247,3 +247,54 @@ func TestNewVarsWatcher_CreatesParentDir(t *testing.T) {
 		t.Fatalf("parent dir was not created: %v", err)
 	}
 }
+
+// TestWatchRaidVars_followsProfileDirOnceCreated checks the watcher leaves
+// vars.d/ alone, since its existence marks the vars migration done, and
+// picks up the profile file once something else creates the directory.
+func TestWatchRaidVars_followsProfileDirOnceCreated(t *testing.T) {
+	varsPath := withIsolatedRaidVars(t)
+	raidVarsMu.Lock()
+	oldProfile := raidVarsProfile
+	raidVarsProfile = "alpha"
+	raidVarsMu.Unlock()
+	t.Cleanup(func() {
+		raidVarsMu.Lock()
+		raidVarsProfile = oldProfile
+		raidVarsMu.Unlock()
+	})
+
+	ctx, cancel := stdctx.WithCancel(stdctx.Background())
+	t.Cleanup(cancel)
+	done := make(chan struct{}, 1)
+	if err := WatchRaidVars(ctx, func() {
+		select {
+		case done <- struct{}{}:
+		default:
+		}
+	}); err != nil {
+		t.Fatalf("WatchRaidVars: %v", err)
+	}
+	profileDir := filepath.Join(filepath.Dir(varsPath), raidVarsDirName)
+	if _, err := os.Stat(profileDir); !os.IsNotExist(err) {
+		t.Fatalf("watcher created vars.d/ (stat error %v)", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	if err := os.Mkdir(profileDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("onChange was not invoked when vars.d/ appeared")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(profileDir, "alpha"), []byte("FOO=bar\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("onChange was not invoked for the profile vars file")
+	}
+}
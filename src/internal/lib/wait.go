@@ -0,0 +1,352 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+)
+
+const (
+	defaultWaitTimeout  = 30 * time.Second
+	defaultWaitInterval = 1 * time.Second
+	// maxWaitBody caps how much of a response bodyContains and bodyRegex see.
+	maxWaitBody = 1 << 20
+)
+
+// WaitTarget is one condition a Wait task polls for: a URL or TCP
+// host:port that answers, a file that exists (and optionally contains some
+// text), or a port nothing is listening on. The task's own url, file, and
+// portFree fields describe a single target; `all:` and `any:` list several.
+type WaitTarget struct {
+	URL          string      `json:"url,omitempty"`
+	ExpectStatus StatusCodes `json:"expectStatus,omitempty" yaml:"expectStatus,omitempty"`
+	BodyContains string      `json:"bodyContains,omitempty" yaml:"bodyContains,omitempty"`
+	BodyRegex    string      `json:"bodyRegex,omitempty" yaml:"bodyRegex,omitempty"`
+	File         string      `json:"file,omitempty"`
+	Contains     string      `json:"contains,omitempty"`
+	PortFree     string      `json:"portFree,omitempty" yaml:"portFree,omitempty"`
+}
+
+func (w WaitTarget) expand(resolvePath func(string) string) WaitTarget {
+	return WaitTarget{
+		URL:          expandRaid(w.URL),
+		ExpectStatus: w.ExpectStatus,
+		BodyContains: expandRaid(w.BodyContains),
+		BodyRegex:    w.BodyRegex,
+		File:         resolvePath(w.File),
+		Contains:     expandRaid(w.Contains),
+		PortFree:     expandRaid(w.PortFree),
+	}
+}
+
+// expandWaitTargets applies expand to each target, returning nil for an
+// empty slice.
+func expandWaitTargets(ts []WaitTarget, resolvePath func(string) string) []WaitTarget {
+	if len(ts) == 0 {
+		return nil
+	}
+	out := make([]WaitTarget, len(ts))
+	for i, t := range ts {
+		out[i] = t.expand(resolvePath)
+	}
+	return out
+}
+
+func (w WaitTarget) isZero() bool {
+	return w.URL == "" && len(w.ExpectStatus) == 0 && w.BodyContains == "" && w.BodyRegex == "" &&
+		w.File == "" && w.Contains == "" && w.PortFree == ""
+}
+
+// String names the target in progress and timeout messages.
+func (w WaitTarget) String() string {
+	switch {
+	case w.URL != "":
+		return "'" + w.URL + "'"
+	case w.File != "":
+		return "'" + w.File + "'"
+	}
+	return "port " + w.PortFree + " to be free"
+}
+
+// waitProbe is a validated target, ready to be polled.
+type waitProbe struct {
+	target  WaitTarget
+	bodyRe  *regexp.Regexp
+	lastErr error
+}
+
+func newWaitProbe(w WaitTarget) (*waitProbe, error) {
+	set := 0
+	for _, v := range []string{w.URL, w.File, w.PortFree} {
+		if v != "" {
+			set++
+		}
+	}
+	if set == 0 {
+		return nil, liberrs.ArgInvalid("url, file or portFree is required for Wait task")
+	}
+	if set > 1 {
+		return nil, liberrs.ArgInvalid("set only one of url, file or portFree per Wait target; list several under all or any")
+	}
+	if !isHTTPURL(w.URL) && (len(w.ExpectStatus) > 0 || w.BodyContains != "" || w.BodyRegex != "") {
+		return nil, liberrs.ArgInvalid("expectStatus, bodyContains and bodyRegex need an http(s) url")
+	}
+	if w.Contains != "" && w.File == "" {
+		return nil, liberrs.ArgInvalid("contains needs a file to look in")
+	}
+	if w.PortFree != "" {
+		if _, port, err := net.SplitHostPort(portFreeAddr(w.PortFree)); err != nil || !isPortNumber(port) {
+			return nil, liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid portFree '%s': want a port or host:port", w.PortFree)
+		}
+	}
+	p := &waitProbe{target: w}
+	if w.BodyRegex != "" {
+		re, err := regexp.Compile(w.BodyRegex)
+		if err != nil {
+			return nil, liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid bodyRegex '%s': %v", w.BodyRegex, err)
+		}
+		p.bodyRe = re
+	}
+	return p, nil
+}
+
+func (p *waitProbe) check() error {
+	w := p.target
+	switch {
+	case w.File != "":
+		return checkFile(w.File, w.Contains)
+	case w.PortFree != "":
+		return checkPortFree(w.PortFree)
+	case isHTTPURL(w.URL):
+		return probeHTTP(w, p.bodyRe)
+	}
+	return checkTCP(w.URL)
+}
+
+// execWait polls the task's targets until they're met or the timeout
+// passes.
+func execWait(task Task) error {
+	task = task.Expand()
+
+	timeout, err := parseWaitDuration("timeout", task.Timeout, defaultWaitTimeout)
+	if err != nil {
+		return err
+	}
+	interval, err := parseWaitDuration("interval", task.Interval, defaultWaitInterval)
+	if err != nil {
+		return err
+	}
+	targets, anyOf, err := waitTargets(task)
+	if err != nil {
+		return err
+	}
+	probes := make([]*waitProbe, len(targets))
+	for i, t := range targets {
+		if probes[i], err = newWaitProbe(t); err != nil {
+			return err
+		}
+	}
+
+	label := describeWaitTargets(targets, anyOf)
+	lockedFprintf(commandStdout, "Waiting for %s (timeout: %s)...\n", label, timeout)
+	return pollWait(label, probes, anyOf, timeout, interval, nil)
+}
+
+// pollWait checks probes every interval until they're met or the timeout
+// passes. With anyOf unset, a probe that has been met once is not checked
+// again. abort, when set, runs before each round and ends the wait early
+// with its error; an interrupt ends it with a Cancelled error.
+func pollWait(label string, probes []*waitProbe, anyOf bool, timeout, interval time.Duration, abort func() error) error {
+	pending := probes
+	deadline := time.Now().Add(timeout)
+	for {
+		if err := checkInterrupted(); err != nil {
+			return err
+		}
+		if abort != nil {
+			if err := abort(); err != nil {
+				return err
+			}
+		}
+		var next []*waitProbe
+		for _, p := range pending {
+			if p.lastErr = p.check(); p.lastErr != nil {
+				next = append(next, p)
+			} else if anyOf {
+				return nil
+			}
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		pending = next
+		wait := min(interval, time.Until(deadline))
+		if wait <= 0 {
+			break
+		}
+		if err := sleepInterruptible(wait); err != nil {
+			return err
+		}
+	}
+
+	reasons := make([]string, len(pending))
+	for i, p := range pending {
+		reasons[i] = p.lastErr.Error()
+		if len(pending) > 1 {
+			reasons[i] = p.target.String() + ": " + reasons[i]
+		}
+	}
+	return liberrs.Newf(liberrs.CodeTaskWaitTimeout, liberrs.CategoryTask, "timed out waiting for %s after %s: %s", label, timeout, strings.Join(reasons, "; "))
+}
+
+// waitTargets returns the task's targets and whether any one of them is
+// enough. A task lists targets under all or any, or describes a single
+// one with its own fields, never both.
+func waitTargets(task Task) ([]WaitTarget, bool, error) {
+	single := WaitTarget{
+		URL:          task.URL,
+		ExpectStatus: task.ExpectStatus,
+		BodyContains: task.BodyContains,
+		BodyRegex:    task.BodyRegex,
+		File:         task.File,
+		Contains:     task.Contains,
+		PortFree:     task.PortFree,
+	}
+	switch {
+	case len(task.All) > 0 && len(task.Any) > 0:
+		return nil, false, liberrs.ArgInvalid("set either all or any on a Wait task, not both")
+	case len(task.All) > 0 || len(task.Any) > 0:
+		if !single.isZero() {
+			return nil, false, liberrs.ArgInvalid("list every Wait target under all or any when either is set")
+		}
+		if len(task.Any) > 0 {
+			return task.Any, true, nil
+		}
+		return task.All, false, nil
+	}
+	return []WaitTarget{single}, false, nil
+}
+
+func describeWaitTargets(targets []WaitTarget, anyOf bool) string {
+	if len(targets) == 1 {
+		return targets[0].String()
+	}
+	names := make([]string, len(targets))
+	for i, t := range targets {
+		names[i] = t.String()
+	}
+	if anyOf {
+		return "any of " + strings.Join(names, ", ")
+	}
+	return "all of " + strings.Join(names, ", ")
+}
+
+func parseWaitDuration(field, value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid %s '%s': %v", field, value, err)
+	}
+	if d <= 0 {
+		return 0, liberrs.Newf(liberrs.CodeArgInvalid, liberrs.CategoryConfig, "invalid %s '%s': must be positive", field, value)
+	}
+	return d, nil
+}
+
+func isHTTPURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+func isPortNumber(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0 && n <= 65535
+}
+
+func checkHTTP(url string) error {
+	return probeHTTP(WaitTarget{URL: url}, nil)
+}
+
+// probeHTTP succeeds when a GET of w.URL returns an expected status (any
+// 2xx by default) and the start of the body satisfies bodyContains and
+// bodyRe.
+func probeHTTP(w WaitTarget, bodyRe *regexp.Regexp) error {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(w.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkHTTPStatus(Task{URL: w.URL, ExpectStatus: w.ExpectStatus}, resp); err != nil {
+		return err
+	}
+	if w.BodyContains == "" && bodyRe == nil {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxWaitBody))
+	if err != nil {
+		return err
+	}
+	if w.BodyContains != "" && !bytes.Contains(body, []byte(w.BodyContains)) {
+		return fmt.Errorf("response body does not contain %q", w.BodyContains)
+	}
+	if bodyRe != nil && !bodyRe.Match(body) {
+		return fmt.Errorf("response body does not match %s", bodyRe)
+	}
+	return nil
+}
+
+func checkTCP(address string) error {
+	conn, err := net.DialTimeout("tcp", address, 2*time.Second)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
+// checkFile succeeds once path exists and, when contains is set, its
+// content includes contains. Sockets and directories count as existing.
+func checkFile(path, contains string) error {
+	if contains == "" {
+		_, err := os.Stat(path)
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(data, []byte(contains)) {
+		return fmt.Errorf("%s does not contain %q", path, contains)
+	}
+	return nil
+}
+
+// checkPortFree succeeds once addr can be bound, i.e. the process that
+// held it has let go.
+func checkPortFree(addr string) error {
+	ln, err := net.Listen("tcp", portFreeAddr(addr))
+	if err != nil {
+		return err
+	}
+	return ln.Close()
+}
+
+// portFreeAddr turns a bare port into a listen address on every
+// interface, which is how servers usually bind it.
+func portFreeAddr(addr string) string {
+	if !strings.Contains(addr, ":") {
+		return ":" + addr
+	}
+	return addr
+}
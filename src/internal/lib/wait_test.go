@@ -0,0 +1,141 @@
+package lib
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	liberrs "github.com/8bitalex/raid/src/internal/lib/errs"
+	"gopkg.in/yaml.v3"
+)
+
+func TestExecuteTask_waitHTTPBody(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Write([]byte(`{"status":"STARTING"}`))
+		default:
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"status":"UP"}`))
+		}
+	}))
+	defer srv.Close()
+
+	task := Task{Type: Wait, URL: srv.URL, ExpectStatus: StatusCodes{202}, BodyContains: `"status":"UP"`, BodyRegex: `"status"\s*:`, Interval: "10ms", Timeout: "5s"}
+	if err := ExecuteTask(task); err != nil {
+		t.Fatalf("ExecuteTask() error: %v", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("polled %d times, want 3", got)
+	}
+}
+
+func TestExecuteTask_waitFileContains(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		os.WriteFile(path, []byte("booting\n"), 0o644)
+		time.Sleep(30 * time.Millisecond)
+		os.WriteFile(path, []byte("booting\nStarted in 1.2s\n"), 0o644)
+	}()
+	task := Task{Type: Wait, File: path, Contains: "Started", Interval: "10ms", Timeout: "5s"}
+	if err := ExecuteTask(task); err != nil {
+		t.Fatalf("ExecuteTask() error: %v", err)
+	}
+}
+
+func TestExecuteTask_waitInterrupted(t *testing.T) {
+	t.Cleanup(func() { interrupted.Store(false) })
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		interrupted.Store(true)
+	}()
+
+	// A long interval and timeout: only the interrupt ends this wait.
+	task := Task{Type: Wait, File: filepath.Join(t.TempDir(), "never"), Interval: "10s", Timeout: "30s"}
+	start := time.Now()
+	err := ExecuteTask(task)
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeCancelled {
+		t.Fatalf("ExecuteTask() error = %v, want CANCELLED", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("wait took %s to notice the interrupt", d)
+	}
+}
+
+func TestExecuteTask_waitPortFree(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	err = ExecuteTask(Task{Type: Wait, PortFree: addr, Interval: "10ms", Timeout: "50ms"})
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeTaskWaitTimeout {
+		t.Fatalf("port in use error = %v, want TASK_WAIT_TIMEOUT", err)
+	}
+
+	time.AfterFunc(30*time.Millisecond, func() { ln.Close() })
+	if err := ExecuteTask(Task{Type: Wait, PortFree: addr, Interval: "10ms", Timeout: "5s"}); err != nil {
+		t.Errorf("ExecuteTask() after close error: %v", err)
+	}
+}
+
+func TestExecuteTask_waitAllAny(t *testing.T) {
+	dir := t.TempDir()
+	present := filepath.Join(dir, "present.sock")
+	os.WriteFile(present, nil, 0o644)
+	missing := filepath.Join(dir, "missing")
+
+	err := ExecuteTask(Task{Type: Wait, Any: []WaitTarget{{File: missing}, {File: present}}, Timeout: "1s"})
+	if err != nil {
+		t.Errorf("any with one target met: %v", err)
+	}
+
+	err = ExecuteTask(Task{Type: Wait, All: []WaitTarget{{File: present}, {File: missing}}, Interval: "10ms", Timeout: "50ms"})
+	if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeTaskWaitTimeout {
+		t.Fatalf("all with one target missing error = %v, want TASK_WAIT_TIMEOUT", err)
+	}
+	if !strings.Contains(err.Error(), "'"+missing+"'") || strings.Contains(err.Error(), "'"+present+"':") {
+		t.Errorf("timeout error %q should name only the unmet target", err)
+	}
+}
+
+func TestExecuteTask_waitConfigErrors(t *testing.T) {
+	for _, task := range []Task{
+		{Type: Wait, URL: "localhost:1", File: "x"},
+		{Type: Wait, URL: "localhost:1", BodyContains: "UP"},
+		{Type: Wait, Contains: "Started"},
+		{Type: Wait, URL: "http://localhost:1", BodyRegex: "("},
+		{Type: Wait, PortFree: "http"},
+		{Type: Wait, URL: "localhost:1", Interval: "0s"},
+		{Type: Wait, All: []WaitTarget{{File: "x"}}, Any: []WaitTarget{{File: "y"}}},
+		{Type: Wait, URL: "localhost:1", All: []WaitTarget{{File: "x"}}},
+		{Type: Wait, Any: []WaitTarget{{}}},
+	} {
+		err := ExecuteTask(task)
+		if rErr, ok := liberrs.AsError(err); !ok || rErr.Code() != liberrs.CodeArgInvalid {
+			t.Errorf("ExecuteTask(%+v) = %v, want ARG_INVALID", task, err)
+		}
+	}
+}
+
+func TestTask_waitFromYAML(t *testing.T) {
+	var task Task
+	src := "type: Wait\nany:\n  - url: http://localhost/health\n    expectStatus: 200\n    bodyContains: UP\n  - portFree: \"8080\"\ninterval: 250ms\n"
+	if err := yaml.Unmarshal([]byte(src), &task); err != nil {
+		t.Fatal(err)
+	}
+	if len(task.Any) != 2 || task.Any[0].BodyContains != "UP" || len(task.Any[0].ExpectStatus) != 1 || task.Any[1].PortFree != "8080" || task.Interval != "250ms" {
+		t.Errorf("task = %+v, want any targets and interval decoded", task)
+	}
+}
@@ -18,6 +18,10 @@ type Repo = lib.WorkspaceRepo
 // optional Steps outline derived from named tasks.
 type Command = lib.WorkspaceCommand
 
+// Requirement is a variable a command checks for before it runs, with
+// whether it's currently satisfied.
+type Requirement = lib.WorkspaceRequirement
+
 // Step describes one named task inside a command's task sequence.
 type Step = lib.WorkspaceStep
 
@@ -24,3 +24,21 @@ func Contains(name string) bool {
 func Execute(env string) error {
 	return lib.ExecuteEnv(env)
 }
+
+// Diff is the result of comparing two environments. See lib.EnvDiff.
+type Diff = lib.EnvDiff
+
+// RepoDiff holds one repository's differences between two environments.
+type RepoDiff = lib.RepoEnvDiff
+
+// VarChange describes one variable that differs between two environments.
+type VarChange = lib.EnvVarChange
+
+// TaskDiff lists env tasks present in only one of two environments.
+type TaskDiff = lib.EnvTaskDiff
+
+// Compare resolves both environments across the active profile and returns
+// their per-repo variable and task differences, with secret values masked.
+func Compare(from, to string) (Diff, error) {
+	return lib.DiffEnvs(from, to)
+}
@@ -49,6 +49,11 @@ const (
 	CodeTaskWaitTimeout         = liberrs.CodeTaskWaitTimeout
 	CodeTaskTemplateFailed      = liberrs.CodeTaskTemplateFailed
 	CodeTaskGitFailed           = liberrs.CodeTaskGitFailed
+	CodeTaskArchiveFailed       = liberrs.CodeTaskArchiveFailed
+	CodeTaskFileFailed          = liberrs.CodeTaskFileFailed
+	CodeTaskConfigEditFailed    = liberrs.CodeTaskConfigEditFailed
+	CodeTaskServiceFailed       = liberrs.CodeTaskServiceFailed
+	CodeTaskContainerFailed     = liberrs.CodeTaskContainerFailed
 	CodeCloneFailed             = liberrs.CodeCloneFailed
 	CodeTaskHTTPFailed          = liberrs.CodeTaskHTTPFailed
 	CodeProfileNotFound         = liberrs.CodeProfileNotFound
@@ -60,6 +65,12 @@ const (
 	CodeCommandNotFound         = liberrs.CodeCommandNotFound
 	CodeVerifyFailed            = liberrs.CodeVerifyFailed
 	CodeHeadlessPromptNoDefault = liberrs.CodeHeadlessPromptNoDefault
+	CodeRequiredVarsUnmet       = liberrs.CodeRequiredVarsUnmet
+	CodeVarNotFound             = liberrs.CodeVarNotFound
+	CodeCancelled               = liberrs.CodeCancelled
+	CodeCommandLocked           = liberrs.CodeCommandLocked
+	CodePolicyDenied            = liberrs.CodePolicyDenied
+	CodeConfirmationRequired    = liberrs.CodeConfirmationRequired
 )
 
 // AsError walks the wrapped-error chain and returns the first Error.
@@ -119,6 +130,19 @@ func TaskScriptFailed(cause error) Error               { return liberrs.TaskScri
 func TaskWaitTimeout(target string, cause error) Error { return liberrs.TaskWaitTimeout(target, cause) }
 func TaskTemplateFailed(cause error) Error             { return liberrs.TaskTemplateFailed(cause) }
 func TaskGitFailed(cause error) Error                  { return liberrs.TaskGitFailed(cause) }
+func TaskArchiveFailed(cause error) Error              { return liberrs.TaskArchiveFailed(cause) }
+func TaskFileFailed(cause error) Error                 { return liberrs.TaskFileFailed(cause) }
+func TaskConfigEditFailed(cause error) Error           { return liberrs.TaskConfigEditFailed(cause) }
+func TaskServiceFailed(name string, cause error) Error { return liberrs.TaskServiceFailed(name, cause) }
+func TaskContainerFailed(op string, cause error) Error { return liberrs.TaskContainerFailed(op, cause) }
 func TaskHTTPFailed(url string, cause error) Error     { return liberrs.TaskHTTPFailed(url, cause) }
 func VerifyFailed(name string, cause error) Error      { return liberrs.VerifyFailed(name, cause) }
 func HeadlessPromptNoDefault(varName string) Error     { return liberrs.HeadlessPromptNoDefault(varName) }
+func RequiredVarsUnmet(scope string, unmet []string, vars []map[string]any) Error {
+	return liberrs.RequiredVarsUnmet(scope, unmet, vars)
+}
+func VarNotFound(name string) Error             { return liberrs.VarNotFound(name) }
+func Cancelled(cause error) Error               { return liberrs.Cancelled(cause) }
+func CommandLocked(lock, holder string) Error   { return liberrs.CommandLocked(lock, holder) }
+func PolicyDenied(target, reason string) Error  { return liberrs.PolicyDenied(target, reason) }
+func ConfirmationRequired(command string) Error { return liberrs.ConfirmationRequired(command) }
@@ -45,9 +45,18 @@ func TestPublicSurface_constructorsRouteThrough(t *testing.T) {
 		{"TaskWaitTimeout", TaskWaitTimeout("t", nil), CodeTaskWaitTimeout, CategoryTask},
 		{"TaskTemplateFailed", TaskTemplateFailed(nil), CodeTaskTemplateFailed, CategoryTask},
 		{"TaskGitFailed", TaskGitFailed(nil), CodeTaskGitFailed, CategoryTask},
+		{"TaskArchiveFailed", TaskArchiveFailed(nil), CodeTaskArchiveFailed, CategoryTask},
+		{"TaskFileFailed", TaskFileFailed(nil), CodeTaskFileFailed, CategoryTask},
+		{"TaskConfigEditFailed", TaskConfigEditFailed(nil), CodeTaskConfigEditFailed, CategoryTask},
+		{"TaskServiceFailed", TaskServiceFailed("s", nil), CodeTaskServiceFailed, CategoryTask},
+		{"TaskContainerFailed", TaskContainerFailed("run", nil), CodeTaskContainerFailed, CategoryTask},
 		{"TaskHTTPFailed", TaskHTTPFailed("u", nil), CodeTaskHTTPFailed, CategoryNetwork},
 		{"VerifyFailed", VerifyFailed("v", nil), CodeVerifyFailed, CategoryConfig},
 		{"HeadlessPromptNoDefault", HeadlessPromptNoDefault("VAR"), CodeHeadlessPromptNoDefault, CategoryTask},
+		{"Cancelled", Cancelled(nil), CodeCancelled, CategoryTask},
+		{"CommandLocked", CommandLocked("migrate", ""), CodeCommandLocked, CategoryGeneric},
+		{"PolicyDenied", PolicyDenied("command 'deploy'", "r"), CodePolicyDenied, CategoryGeneric},
+		{"ConfirmationRequired", ConfirmationRequired("deploy"), CodeConfirmationRequired, CategoryGeneric},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
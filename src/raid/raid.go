@@ -88,11 +88,55 @@ func WithMutationLock(fn func() error) error {
 	return lib.WithMutationLock(fn)
 }
 
-// WatchRaidVars watches the persisted raid vars file (~/.raid/vars) for the
-// lifetime of ctx and invokes onChange whenever the file is created, modified,
-// or replaced. Events are debounced internally. The watcher returns when ctx
-// is cancelled. See lib.WatchRaidVars for atomic-rename / inode-swap
-// semantics.
+// AgentDecision is one line of the agent policy audit log.
+type AgentDecision = lib.AgentDecision
+
+// Agent policy decisions recorded in the audit log.
+const (
+	AgentDecisionAllow   = lib.AgentDecisionAllow
+	AgentDecisionDeny    = lib.AgentDecisionDeny
+	AgentDecisionConfirm = lib.AgentDecisionConfirm
+)
+
+// AgentPolicyDeclared reports whether the active profile declares an
+// `agentPolicy:`, which the MCP server then enforces.
+func AgentPolicyDeclared() bool {
+	return lib.AgentPolicyDeclared()
+}
+
+// CheckAgentCommand applies the active agent policy to an agent running
+// the profile command name, reporting whether it needs a confirmation
+// token.
+func CheckAgentCommand(name string) (bool, error) {
+	return lib.CheckAgentCommand(name)
+}
+
+// CheckAgentTool applies the active agent policy to an agent calling a
+// mutating MCP tool.
+func CheckAgentTool(tool string) error {
+	return lib.CheckAgentTool(tool)
+}
+
+// AuditAgentDecision appends d to the agent policy audit log.
+func AuditAgentDecision(d AgentDecision) error {
+	return lib.AuditAgentDecision(d)
+}
+
+// CheckCommandLock fails with COMMAND_LOCKED when another run holds the
+// named lock of the profile command at path, or of repo's command when
+// repo is set. Call it before WithMutationLock so a locked command fails
+// fast rather than queueing on the mutation lock; the command takes the
+// lock itself when it runs.
+func CheckCommandLock(repo, path string) error {
+	return lib.CheckCommandLock(repo, path)
+}
+
+// WatchRaidVars watches the persisted raid vars files (~/.raid/vars and the
+// active profile's ~/.raid/vars.d/<profile>) for the lifetime of ctx and
+// invokes onChange whenever either is created, modified, or replaced. Events
+// are debounced internally and follow the active profile across reloads.
+// The watcher returns when ctx is cancelled. See lib.WatchRaidVars for
+// atomic-rename / inode-swap semantics.
 func WatchRaidVars(ctx context.Context, onChange func()) error {
 	return lib.WatchRaidVars(ctx, onChange)
 }
@@ -125,6 +169,12 @@ func ScrubURL(raw string) string {
 	return lib.ScrubURL(raw)
 }
 
+// CompleteValue returns the shell completions for a command arg or flag
+// that start with toComplete. See lib.CompleteValue.
+func CompleteValue(complete *lib.Completion, choices []string, dir, toComplete string) []string {
+	return lib.CompleteValue(complete, choices, dir, toComplete)
+}
+
 // QuietGetCommands performs a best-effort, read-only profile load and returns
 // the available commands. It does not create config files or emit warnings, and
 // returns nil if the config is absent or loading fails.
@@ -0,0 +1,45 @@
+// Manage the long-running processes started by Service tasks.
+package service
+
+import (
+	"context"
+	"io"
+
+	"github.com/8bitalex/raid/src/internal/lib"
+)
+
+// Info describes one service started for the active profile.
+type Info = lib.ServiceInfo
+
+// SupervisorArg, as raid's first argument, runs the supervisor of a
+// service instead of the CLI. See Supervise.
+const SupervisorArg = lib.ServiceSupervisorArg
+
+// Up starts the Service tasks of the active environment, or only those
+// named. Services already running are left alone.
+func Up(names []string) error {
+	return lib.StartServices(names)
+}
+
+// Down stops the named services, or all of the active profile's services
+// when names is empty.
+func Down(names []string) error {
+	return lib.StopServices(names)
+}
+
+// List returns the active profile's services, running or exited.
+func List() ([]Info, error) {
+	return lib.ListServices()
+}
+
+// Logs copies a service's log to w, and with follow keeps copying new
+// output until ctx is done.
+func Logs(ctx context.Context, name string, follow bool, w io.Writer) error {
+	return lib.ServiceLogs(ctx, name, follow, w)
+}
+
+// Supervise runs the service recorded at statePath until it is stopped
+// and returns the process exit code.
+func Supervise(statePath string) int {
+	return lib.RunServiceSupervisor(statePath)
+}
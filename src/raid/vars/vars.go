@@ -0,0 +1,63 @@
+// Inspect and edit raid's persisted variables.
+package vars
+
+import "github.com/8bitalex/raid/src/internal/lib"
+
+// Entry is one variable with the source of its effective value.
+type Entry = lib.VarEntry
+
+// Source identifies where a variable's value comes from.
+type Source = lib.VarSource
+
+// Variable sources reported on Entry.Source.
+const (
+	SourceGlobal  = lib.VarSourceGlobal
+	SourceProfile = lib.VarSourceProfile
+	SourceSession = lib.VarSourceSession
+	SourceRepo    = lib.VarSourceRepo
+	SourceEnv     = lib.VarSourceEnv
+)
+
+// Scope selects which store Set, Unset, and Clear act on. The zero value
+// picks the default: the active profile, or global when none is loaded.
+type Scope = lib.VarScope
+
+// Variable scopes.
+const (
+	ScopeGlobal  = lib.VarScopeGlobal
+	ScopeProfile = lib.VarScopeProfile
+	ScopeSession = lib.VarScopeSession
+)
+
+// List returns every raid variable — persisted and repo metadata — sorted by name.
+func List() []Entry {
+	return lib.ListVars()
+}
+
+// Get resolves a single variable through raid vars and the process
+// environment. Env values that look secret are masked.
+func Get(name string) (Entry, error) {
+	return lib.GetVar(name)
+}
+
+// GetRaid looks up a single raid variable, ignoring the process environment.
+func GetRaid(name string) (Entry, error) {
+	return lib.GetRaidVar(name)
+}
+
+// Set persists name=value in scope and returns the stored entry. A secret
+// value is encrypted at rest and masked in the returned entry.
+func Set(name, value string, scope Scope, secret bool) (Entry, error) {
+	return lib.PersistVar(name, value, scope, secret)
+}
+
+// Unset removes a variable from scope, or from wherever its value lives
+// when scope is empty.
+func Unset(name string, scope Scope) error {
+	return lib.UnsetVar(name, scope)
+}
+
+// Clear removes every variable in scope and returns how many were removed.
+func Clear(scope Scope) (int, error) {
+	return lib.ClearVars(scope)
+}